@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zhnt/aql/internal/mcp"
+	"github.com/zhnt/aql/internal/module"
+	"github.com/zhnt/aql/internal/service"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// newFlagSet 创建子命令的参数解析器
+func newFlagSet(name, argsUsage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: aql %s %s\n", name, argsUsage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseSingleFile 解析参数并要求恰好一个文件参数
+// 解析失败时返回空文件名和应使用的退出码
+func parseSingleFile(fs *flag.FlagSet, args []string) (string, int) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return "", exitOK
+		}
+		return "", exitUsage
+	}
+	if fs.NArg() != 1 || fs.Arg(0) == "" {
+		fs.Usage()
+		return "", exitUsage
+	}
+	return fs.Arg(0), exitOK
+}
+
+// reportError 将错误输出到stderr并返回对应退出码
+func reportError(err error, code int) int {
+	fmt.Fprintln(os.Stderr, err)
+	return code
+}
+
+// runCommand 运行脚本
+func runCommand(args []string) int {
+	fs := newFlagSet("run", "[--debug] [--verify] [--deterministic] [--path dirs] [--mock name,...] [--mcp name=command ...] [--trace text|events|json] [--trace-file path] <script.aql|script.aqlc>")
+	debug := fs.Bool("debug", false, "启用调试输出（执行前打印字节码）")
+	verify := fs.Bool("verify", false, "执行前校验编译得到的字节码")
+	deterministic := fs.Bool("deterministic", false, "确定性执行：定时器和装饰器使用虚拟时钟，异步工作按提交顺序执行")
+	mock := fs.String("mock", "", "以确定性的mock服务注册这些服务名（逗号分隔），如 --mock llm,search")
+	path := fs.String("path", "", "模块搜索路径（以系统路径分隔符分隔），在AQL_PATH之前搜索")
+	var mcpServers mcpFlags
+	fs.Var(&mcpServers, "mcp", "启动MCP服务器并注册为服务，格式 name=command [args...]，可重复")
+	traceKind := fs.String("trace", "", "执行跟踪: text（调试信息）、events（调试信息和执行事件）或 json（JSON Lines）")
+	traceFile := fs.String("trace-file", "", "跟踪输出文件（默认stderr）")
+	filename, code := parseSingleFile(fs, args)
+	if filename == "" {
+		return code
+	}
+
+	if *traceKind != "" {
+		out := io.Writer(os.Stderr)
+		if *traceFile != "" {
+			f, err := os.Create(*traceFile)
+			if err != nil {
+				return reportError(err, exitIOError)
+			}
+			defer f.Close()
+			out = f
+		}
+
+		tracer, err := newTracer(*traceKind, out)
+		if err != nil {
+			return reportError(err, exitUsage)
+		}
+		vm.SetDefaultTracer(tracer)
+		defer vm.SetDefaultTracer(nil)
+	}
+
+	initRuntime(*debug)
+
+	function, code, err := loadFunction(filename)
+	if err != nil {
+		return reportError(err, code)
+	}
+	if *verify {
+		if err := vm.Verify(function); err != nil {
+			return reportError(fmt.Errorf("%s: %w", filename, err), exitCompileError)
+		}
+	}
+
+	if *debug {
+		fmt.Print(vm.Disassemble(function))
+	}
+
+	executor := vm.NewExecutor()
+	executor.SetModuleLoader(newModuleLoader(*path))
+	executor.Loop().SetDeterministic(*deterministic)
+	if *deterministic {
+		executor.SetClock(vm.NewManualClock(time.Unix(0, 0)))
+	}
+	if err := registerLLMService(executor); err != nil {
+		return reportError(err, exitUsage)
+	}
+	if err := registerMockServices(executor, *mock); err != nil {
+		return reportError(err, exitUsage)
+	}
+	clients, err := startMCPServers(executor, mcpServers)
+	if err != nil {
+		return reportError(err, exitRuntimeError)
+	}
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+	results, err := executor.Execute(function, nil)
+	if err != nil {
+		printRuntimeError(os.Stderr, err)
+		return exitRuntimeError
+	}
+
+	if len(results) == 0 {
+		return exitOK
+	}
+	// 最后一个表达式是async调用时打印兑现值；生成器对象没有可打印的结果
+	result, err := executor.Await(results[0])
+	if err != nil {
+		printRuntimeError(os.Stderr, err)
+		return exitRuntimeError
+	}
+	if !result.IsNil() && !result.IsCoroutine() {
+		fmt.Printf("结果: %s\n", result.ToString())
+	}
+	return exitOK
+}
+
+// registerLLMService 设置了AQL_LLM_BASE_URL或API密钥时把OpenAI兼容服务注册为 @llm
+func registerLLMService(executor *vm.Executor) error {
+	config, ok, err := service.OpenAIConfigFromEnv()
+	if err != nil || !ok {
+		return err
+	}
+	return executor.RegisterService("llm", service.NewOpenAIProvider(config))
+}
+
+// registerMockServices 把--mock参数中的每个服务名注册为mock服务
+func registerMockServices(executor *vm.Executor, names string) error {
+	if names == "" {
+		return nil
+	}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if err := executor.RegisterService(name, service.NewMockProvider()); err != nil {
+			return fmt.Errorf("--mock: %w", err)
+		}
+	}
+	return nil
+}
+
+// newModuleLoader 创建模块加载器，先搜索--path中的目录，再搜索AQL_PATH
+func newModuleLoader(path string) *module.Loader {
+	loader := module.NewLoader(filepath.SplitList(path)...)
+	loader.AddPath(module.SearchPathFromEnv()...)
+	return loader
+}
+
+// mcpFlags 可重复的--mcp参数
+type mcpFlags []string
+
+func (m *mcpFlags) String() string { return strings.Join(*m, "; ") }
+
+func (m *mcpFlags) Set(value string) error {
+	name, command, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(command) == "" {
+		return fmt.Errorf("expected name=command, got %q", value)
+	}
+	*m = append(*m, value)
+	return nil
+}
+
+// startMCPServers 启动--mcp指定的服务器并注册为服务，出错时关闭已启动的服务器
+func startMCPServers(executor *vm.Executor, servers mcpFlags) ([]*mcp.Client, error) {
+	var clients []*mcp.Client
+	for _, server := range servers {
+		name, command, _ := strings.Cut(server, "=")
+		fields := strings.Fields(command)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		client, err := mcp.Start(ctx, mcp.ServerConfig{Command: fields[0], Args: fields[1:]})
+		cancel()
+		if err == nil {
+			err = executor.RegisterService(strings.TrimSpace(name), client)
+		}
+		if err != nil {
+			for _, started := range clients {
+				started.Close()
+			}
+			return nil, fmt.Errorf("--mcp %s: %w", name, err)
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+// newTracer 根据--trace参数创建跟踪器
+func newTracer(kind string, w io.Writer) (vm.Tracer, error) {
+	switch kind {
+	case "text":
+		return vm.NewTextTracer(w), nil
+	case "events":
+		tracer := vm.NewTextTracer(w)
+		tracer.Events = true
+		return tracer, nil
+	case "json":
+		return vm.NewJSONTracer(w), nil
+	default:
+		return nil, fmt.Errorf("unknown trace format: %s (expected text, events or json)", kind)
+	}
+}
+
+// compileCommand 编译脚本为字节码文件
+func compileCommand(args []string) int {
+	fs := newFlagSet("compile", "[--verify] [--peephole-stats] [-o out.aqlc] <script.aql>")
+	output := fs.String("o", "", "输出文件（默认与源文件同名，扩展名为.aqlc）")
+	verify := fs.Bool("verify", false, "写入前校验编译得到的字节码")
+	peepholeStats := fs.Bool("peephole-stats", false, "在标准错误输出各窥孔优化规则删除的指令数")
+	filename, code := parseSingleFile(fs, args)
+	if filename == "" {
+		return code
+	}
+
+	initRuntime(false)
+
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return reportError(err, exitIOError)
+	}
+
+	function, stats, err := compileSourceStats(filename, string(source))
+	if err != nil {
+		return reportError(err, exitCompileError)
+	}
+	if *peepholeStats {
+		fmt.Fprintf(os.Stderr, "%s: peephole %s\n", filename, stats)
+	}
+	if *verify {
+		if err := vm.Verify(function); err != nil {
+			return reportError(fmt.Errorf("%s: %w", filename, err), exitCompileError)
+		}
+	}
+
+	outPath := *output
+	if outPath == "" {
+		outPath = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".aqlc"
+	}
+
+	file, err := os.Create(outPath)
+	if err != nil {
+		return reportError(err, exitIOError)
+	}
+
+	if err := vm.WriteBytecode(file, function); err != nil {
+		file.Close()
+		return reportError(fmt.Errorf("%s: %w", outPath, err), exitIOError)
+	}
+	if err := file.Close(); err != nil {
+		return reportError(err, exitIOError)
+	}
+
+	return exitOK
+}
+
+// disasmCommand 反汇编脚本或字节码文件
+func disasmCommand(args []string) int {
+	fs := newFlagSet("disasm", "<script.aql|script.aqlc>")
+	filename, code := parseSingleFile(fs, args)
+	if filename == "" {
+		return code
+	}
+
+	initRuntime(false)
+
+	function, code, err := loadFunction(filename)
+	if err != nil {
+		return reportError(err, code)
+	}
+
+	fmt.Print(vm.Disassemble(function))
+	return exitOK
+}
+
+// checkCommand 只做语法分析、编译和字节码校验
+func checkCommand(args []string) int {
+	fs := newFlagSet("check", "<script.aql>")
+	filename, code := parseSingleFile(fs, args)
+	if filename == "" {
+		return code
+	}
+
+	initRuntime(false)
+
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return reportError(err, exitIOError)
+	}
+
+	function, err := compileSource(filename, string(source))
+	if err != nil {
+		return reportError(err, exitCompileError)
+	}
+	if err := vm.Verify(function); err != nil {
+		return reportError(fmt.Errorf("%s: %w", filename, err), exitCompileError)
+	}
+
+	return exitOK
+}
@@ -0,0 +1,119 @@
+// Command aql AQL语言命令行工具
+//
+// 用法：
+//
+//	aql run [--debug] [--verify] [--deterministic] [--path dirs] [--mock name,...] [--mcp name=command] [--trace text|events|json] script.aql   运行脚本（也接受.aqlc字节码文件）
+//	aql compile [--verify] [--peephole-stats] [-o out.aqlc] script.aql
+//	aql disasm script.aql|script.aqlc
+//	aql check script.aql           只做语法分析、编译和字节码校验
+//	aql mcp-serve [--name server] [--path dirs] [--mock name,...] script.aql   把脚本函数作为MCP工具通过stdio提供
+//	aql repl                       交互式环境
+//	aql version
+//
+// 直接执行 `aql script.aql` 等同于 `aql run script.aql`。.aqlc 文件加载时总是校验字节码。
+// import 的模块先相对于导入方文件解析，再依次在 --path 和 AQL_PATH 的目录中查找。
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 版本信息，由Makefile通过-ldflags注入
+var (
+	Version   = "dev"
+	BuildTime = "unknown"
+)
+
+// 退出码
+const (
+	exitOK           = 0 // 成功
+	exitRuntimeError = 1 // 运行时错误
+	exitUsage        = 2 // 命令行用法错误
+	exitCompileError = 3 // 语法或编译错误
+	exitIOError      = 4 // 文件读写错误
+)
+
+// command 子命令定义
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"run", "运行AQL脚本或.aqlc字节码文件", runCommand},
+		{"compile", "将AQL脚本编译为.aqlc字节码文件", compileCommand},
+		{"disasm", "反汇编AQL脚本或.aqlc字节码文件", disasmCommand},
+		{"check", "检查脚本语法、编译并校验字节码，不执行", checkCommand},
+		{"mcp-serve", "把脚本函数作为MCP工具通过stdio提供", mcpServeCommand},
+		{"repl", "启动交互式环境", replCommand},
+		{"version", "显示版本信息", versionCommand},
+		{"help", "显示帮助信息", helpCommand},
+	}
+}
+
+func main() {
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+// dispatch 根据第一个参数分发子命令
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+
+	name := args[0]
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args[1:])
+		}
+	}
+
+	switch name {
+	case "-h", "--help":
+		usage(os.Stdout)
+		return exitOK
+	case "-v", "--version":
+		return versionCommand(nil)
+	}
+
+	// 兼容直接传入脚本路径的用法: aql script.aql
+	if strings.HasSuffix(name, ".aql") || strings.HasSuffix(name, ".aqlc") {
+		return runCommand(args)
+	}
+
+	fmt.Fprintf(os.Stderr, "aql: 未知命令 %q\n\n", name)
+	usage(os.Stderr)
+	return exitUsage
+}
+
+// usage 输出帮助信息
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "用法: aql <命令> [参数]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "命令:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "退出码: 0 成功, 1 运行时错误, 2 用法错误, 3 语法/编译错误, 4 文件错误")
+}
+
+// versionCommand 显示版本信息
+func versionCommand(args []string) int {
+	fmt.Printf("aql %s (built %s)\n", Version, BuildTime)
+	return exitOK
+}
+
+// helpCommand 显示帮助信息
+func helpCommand(args []string) int {
+	usage(os.Stdout)
+	return exitOK
+}
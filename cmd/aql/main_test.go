@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// 命令行测试
+// =============================================================================
+
+// TestMain 设置 AQL_TEST_MAIN 时测试二进制作为aql命令运行，测试用它检查输出和退出码
+func TestMain(m *testing.M) {
+	if os.Getenv("AQL_TEST_MAIN") == "1" {
+		os.Exit(dispatch(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// aql 在dir中运行aql命令，返回stdout、stderr和退出码
+func aql(t *testing.T, dir, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "AQL_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+// writeScripts 在临时目录中写入脚本文件
+func writeScripts(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExitCodes(t *testing.T) {
+	dir := writeScripts(t, map[string]string{
+		"ok.aql":     "function half(n) { return n / 2 }\nhalf(9)\n",
+		"syntax.aql": "let = 3\n",
+		"undef.aql":  "let x = 1\nlet y = missing\n",
+		"crash.aql":  "function f(a) {\n    return a[5]\n}\nf([1])\n",
+		"async.aql":  "async function f() { await sleep(1); return 7 }\nf()\n",
+		"gen.aql":    "function g() { yield 1 }\ng()\n",
+	})
+
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr []string
+	}{
+		{[]string{"run", "ok.aql"}, exitOK, "结果: 4.5\n", nil},
+		{[]string{"ok.aql"}, exitOK, "结果: 4.5\n", nil},
+		{[]string{"check", "ok.aql"}, exitOK, "", nil},
+		{[]string{"run", "async.aql"}, exitOK, "结果: 7\n", nil},
+		{[]string{"run", "gen.aql"}, exitOK, "", nil},
+		{[]string{"run", "syntax.aql"}, exitCompileError, "", []string{"syntax.aql:1:5: "}},
+		{[]string{"check", "undef.aql"}, exitCompileError, "", []string{"undef.aql:2:9: ", "undefined variable: missing"}},
+		{[]string{"run", "crash.aql"}, exitRuntimeError, "", []string{
+			"crash.aql:2:13: ", "array index out of bounds", "at f (crash.aql:2:13)", "at main (crash.aql:4:2)",
+		}},
+		{[]string{"run", "missing.aql"}, exitIOError, "", []string{"missing.aql"}},
+		{[]string{"run"}, exitUsage, "", nil},
+		{nil, exitUsage, "", []string{"用法: aql"}},
+		{[]string{"bogus"}, exitUsage, "", []string{`未知命令 "bogus"`}},
+		{[]string{"version"}, exitOK, "aql dev (built unknown)\n", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			stdout, stderr, code := aql(t, dir, "", tt.args...)
+			if code != tt.code {
+				t.Errorf("exit code should be %d, got %d (stderr %q)", tt.code, code, stderr)
+			}
+			if stdout != tt.stdout {
+				t.Errorf("stdout should be %q, got %q", tt.stdout, stdout)
+			}
+			for _, want := range tt.stderr {
+				if !strings.Contains(stderr, want) {
+					t.Errorf("stderr should contain %q, got %q", want, stderr)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileAndDisasm(t *testing.T) {
+	dir := writeScripts(t, map[string]string{
+		"ok.aql": "function half(n) { return n / 2 }\nhalf(9)\n",
+	})
+
+	if _, stderr, code := aql(t, dir, "", "compile", "-o", "ok.aqlc", "ok.aql"); code != exitOK {
+		t.Fatalf("compile failed with %d: %s", code, stderr)
+	}
+	if stdout, stderr, code := aql(t, dir, "", "run", "ok.aqlc"); code != exitOK || stdout != "结果: 4.5\n" {
+		t.Errorf("running the bytecode should print %q, got %q (exit %d, stderr %q)", "结果: 4.5\n", stdout, code, stderr)
+	}
+
+	stdout, _, code := aql(t, dir, "", "disasm", "ok.aqlc")
+	for _, want := range []string{"function main", "source ok.aql", "<function half>", "SET_GLOBAL", "function half"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("disassembly should contain %q, got:\n%s", want, stdout)
+		}
+	}
+	if code != exitOK {
+		t.Errorf("disasm should exit with %d, got %d", exitOK, code)
+	}
+
+	// 截断的字节码文件
+	data, err := os.ReadFile(filepath.Join(dir, "ok.aqlc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "broken.aqlc"), data[:len(data)/2], 0o644)
+	if _, stderr, code := aql(t, dir, "", "run", "broken.aqlc"); code != exitIOError || !strings.HasPrefix(stderr, "broken.aqlc: ") {
+		t.Errorf("a truncated bytecode file should fail with %d, got %d (stderr %q)", exitIOError, code, stderr)
+	}
+}
+
+func TestRepl(t *testing.T) {
+	stdout, stderr, code := aql(t, t.TempDir(), "let a = 2\na * 21\nfunction f() { return a }\nf()\nlet = \n\"still running\"\n", "repl")
+	if code != exitOK {
+		t.Errorf("repl should exit with %d at end of input, got %d", exitOK, code)
+	}
+	// 语法错误不结束REPL，之前定义的变量和函数仍然可用
+	for _, want := range []string{"aql> 42\n", "aql> 2\n", "still running\n"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("repl output should contain %q, got %q", want, stdout)
+		}
+	}
+	if !strings.HasPrefix(stderr, "<repl>:1:5: ") {
+		t.Errorf("syntax errors should be reported with their position, got %q", stderr)
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zhnt/aql/internal/compiler1"
+	"github.com/zhnt/aql/internal/mcp"
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// aql mcp-serve：把脚本函数作为MCP工具提供
+// =============================================================================
+
+// 设计原理：
+// - 工具是脚本顶层的具名函数；只要有函数带 // @tool 注释或被 export，就只提供这些函数，
+//   否则提供所有不以 _ 开头的函数
+// - 函数上方紧邻的 // 注释作为工具描述，// @param name type 描述 补充参数的类型和说明
+// - 每次调用使用全新的Executor：先执行脚本顶层代码，再调用函数并等待async结果，
+//   调用之间互不影响；返回前关闭Executor，释放它登记在全局注册表中的原生闭包和代码块；
+//   VM的全局状态不是并发安全的，所以调用串行执行
+// - stdout专用于协议消息，脚本的print输出到stderr
+
+// scriptTool 从脚本中提取的工具
+type scriptTool struct {
+	Name        string
+	Params      []string
+	Description string
+	ParamTypes  map[string]string // @param 声明的类型
+	ParamDocs   map[string]string // @param 声明的说明
+	Annotated   bool              // 带 @tool 注释
+	Exported    bool              // 以 export 声明
+}
+
+// schemaTypes @param 类型到JSON Schema类型的映射，any 和未知类型不限制类型
+var schemaTypes = map[string]string{
+	"string":  "string",
+	"str":     "string",
+	"number":  "number",
+	"float":   "number",
+	"int":     "integer",
+	"integer": "integer",
+	"bool":    "boolean",
+	"boolean": "boolean",
+	"array":   "array",
+	"list":    "array",
+	"object":  "object",
+	"map":     "object",
+}
+
+// mcpServeCommand 通过stdio提供脚本中的工具
+func mcpServeCommand(args []string) int {
+	fs := newFlagSet("mcp-serve", "[--name server] [--path dirs] [--mock name,...] <script.aql>")
+	name := fs.String("name", "", "服务器名称（默认为脚本文件名）")
+	mock := fs.String("mock", "", "以确定性的mock服务注册这些服务名（逗号分隔），供工具内的服务调用使用")
+	path := fs.String("path", "", "模块搜索路径（以系统路径分隔符分隔），在AQL_PATH之前搜索")
+	filename, code := parseSingleFile(fs, args)
+	if filename == "" {
+		return code
+	}
+
+	initRuntime(false)
+
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return reportError(err, exitIOError)
+	}
+	program, err := parseSource(filename, string(source))
+	if err != nil {
+		return reportError(err, exitCompileError)
+	}
+	comp := compiler1.New()
+	comp.SetSource(filename)
+	function, err := comp.Compile(program)
+	if err != nil {
+		return reportError(wrapCompileError(filename, err), exitCompileError)
+	}
+
+	tools := scriptTools(program, string(source))
+	if len(tools) == 0 {
+		return reportError(fmt.Errorf("%s: no functions to serve as tools", filename), exitCompileError)
+	}
+
+	runner := &toolRunner{main: function, mock: *mock, path: *path}
+	// 提前检查服务配置，避免每次调用才报告同样的错误
+	executor, err := runner.newExecutor(context.Background())
+	if err != nil {
+		return reportError(err, exitUsage)
+	}
+	executor.Close()
+
+	if *name == "" {
+		*name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	server := mcp.NewServer(*name, Version)
+	for _, tool := range tools {
+		symbol, ok := comp.SymbolTable().Resolve(tool.Name)
+		if !ok || symbol.Scope != compiler1.GLOBAL_SCOPE {
+			continue
+		}
+		server.AddTool(tool.schema(), runner.handler(tool, symbol.Index))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := server.Serve(ctx, os.Stdin, os.Stdout); err != nil && err != context.Canceled {
+		return reportError(err, exitIOError)
+	}
+	return exitOK
+}
+
+// scriptTools 收集脚本顶层的具名函数
+func scriptTools(program *parser1.Program, source string) []*scriptTool {
+	lines := strings.Split(source, "\n")
+
+	var tools []*scriptTool
+	selected := false
+	for _, stmt := range program.Statements {
+		// 注释位于 export 和装饰器上方
+		line := 0
+		exported := false
+		if export, ok := stmt.(*parser1.ExportStatement); ok {
+			line, stmt, exported = export.Token.Line, export.Declaration, true
+		}
+		exprStmt, ok := stmt.(*parser1.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		// 装饰后的函数仍按原函数的参数提供
+		expr := exprStmt.Expression
+		if decorated, ok := expr.(*parser1.DecoratedFunction); ok {
+			if line == 0 {
+				line = decorated.Token.Line
+			}
+			expr = decorated.Function
+		}
+		fn, ok := expr.(*parser1.FunctionLiteral)
+		if !ok || fn.Name == nil {
+			continue
+		}
+		if line == 0 {
+			line = fn.Token.Line
+		}
+
+		tool := &scriptTool{
+			Name:       fn.Name.Value,
+			ParamTypes: map[string]string{},
+			ParamDocs:  map[string]string{},
+			Exported:   exported,
+		}
+		for _, param := range fn.Parameters {
+			tool.Params = append(tool.Params, param.Value)
+		}
+		tool.parseComment(commentAbove(lines, line))
+		selected = selected || tool.Annotated || tool.Exported
+		tools = append(tools, tool)
+	}
+
+	served := tools[:0]
+	for _, tool := range tools {
+		if selected && (tool.Annotated || tool.Exported) || !selected && !strings.HasPrefix(tool.Name, "_") {
+			served = append(served, tool)
+		}
+	}
+	return served
+}
+
+// commentAbove 返回第line行（从1开始）上方紧邻的 // 注释行，已去掉注释符号
+func commentAbove(lines []string, line int) []string {
+	var comment []string
+	for i := line - 2; i >= 0 && i < len(lines); i-- {
+		text := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(text, "//") {
+			break
+		}
+		comment = append([]string{strings.TrimSpace(strings.TrimPrefix(text, "//"))}, comment...)
+	}
+	return comment
+}
+
+// parseComment 从注释中提取描述、@tool 和 @param
+func (t *scriptTool) parseComment(comment []string) {
+	var description []string
+	for _, line := range comment {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) > 0 && fields[0] == "@tool":
+			t.Annotated = true
+			if rest := strings.TrimSpace(strings.TrimPrefix(line, "@tool")); rest != "" {
+				description = append(description, rest)
+			}
+		case len(fields) > 1 && fields[0] == "@param":
+			name := fields[1]
+			rest := fields[2:]
+			if len(rest) > 0 {
+				if _, ok := schemaTypes[rest[0]]; ok || rest[0] == "any" {
+					t.ParamTypes[name] = rest[0]
+					rest = rest[1:]
+				}
+			}
+			t.ParamDocs[name] = strings.Join(rest, " ")
+		default:
+			description = append(description, line)
+		}
+	}
+	t.Description = strings.TrimSpace(strings.Join(description, "\n"))
+}
+
+// schema 生成工具定义，所有参数都是必需的
+func (t *scriptTool) schema() mcp.Tool {
+	properties := map[string]interface{}{}
+	required := make([]interface{}, len(t.Params))
+	for i, param := range t.Params {
+		property := map[string]interface{}{}
+		if kind, ok := schemaTypes[t.ParamTypes[param]]; ok {
+			property["type"] = kind
+		}
+		if doc := t.ParamDocs[param]; doc != "" {
+			property["description"] = doc
+		}
+		properties[param] = property
+		required[i] = param
+	}
+
+	return mcp.Tool{
+		Name:        t.Name,
+		Description: t.Description,
+		InputSchema: map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		},
+	}
+}
+
+// toolRunner 在新的Executor中执行工具调用
+type toolRunner struct {
+	main *vm.Function
+	mock string
+	path string // 模块搜索路径
+	mu   sync.Mutex
+}
+
+// newExecutor 创建注册了服务的Executor，print输出到stderr
+func (r *toolRunner) newExecutor(ctx context.Context) (*vm.Executor, error) {
+	executor := vm.NewExecutor()
+	// 模块带有执行状态，每个Executor使用自己的加载器
+	executor.SetModuleLoader(newModuleLoader(r.path))
+	executor.SetStdout(os.Stderr)
+	executor.SetContext(ctx)
+	if err := registerLLMService(executor); err != nil {
+		return nil, err
+	}
+	if err := registerMockServices(executor, r.mock); err != nil {
+		return nil, err
+	}
+	return executor, nil
+}
+
+// handler 返回调用全局变量index中函数的工具实现
+func (r *toolRunner) handler(tool *scriptTool, index int) mcp.ToolHandler {
+	return func(ctx context.Context, arguments map[string]interface{}) (*mcp.ToolResult, error) {
+		args, err := tool.arguments(arguments)
+		if err != nil {
+			return nil, err
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		executor, err := r.newExecutor(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// 释放本次调用在全局注册表中登记的原生闭包和代码块
+		defer executor.Close()
+		if _, err := executor.Execute(r.main, nil); err != nil {
+			return nil, err
+		}
+		if index >= len(executor.Globals) {
+			return nil, fmt.Errorf("function %s is not defined", tool.Name)
+		}
+
+		result, err := executor.Call(executor.Globals[index], args)
+		if err == nil {
+			result, err = executor.Await(result)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return toolResult(result)
+	}
+}
+
+// arguments 按参数顺序把工具参数对象转换为AQL值
+// 参数必须符合 schema()：不能有未声明的参数，每个参数都必须提供，声明了类型的参数必须是该类型；
+// 不符合时返回 CodeInvalidParams 错误，而不是带着nil或错误类型的值调用函数
+func (t *scriptTool) arguments(arguments map[string]interface{}) ([]vm.ValueGC, error) {
+	var unknown []string
+	for name := range arguments {
+		if !containsString(t.Params, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, invalidParams("%s: unknown argument(s) %s", t.Name, strings.Join(unknown, ", "))
+	}
+
+	var missing []string
+	for _, param := range t.Params {
+		if _, ok := arguments[param]; !ok {
+			missing = append(missing, param)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, invalidParams("%s: missing argument(s) %s", t.Name, strings.Join(missing, ", "))
+	}
+
+	args := make([]vm.ValueGC, len(t.Params))
+	for i, param := range t.Params {
+		value, err := t.argument(param, arguments[param])
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return args, nil
+}
+
+// argument 按 @param 声明的类型检查并转换一个参数，int 类型的参数以整数传给脚本
+func (t *scriptTool) argument(param string, value interface{}) (vm.ValueGC, error) {
+	kind := schemaTypes[t.ParamTypes[param]]
+	ok := true
+	switch kind {
+	case "string":
+		_, ok = value.(string)
+	case "number":
+		_, ok = value.(float64)
+	case "integer":
+		var number float64
+		number, ok = value.(float64)
+		if ok = ok && number == math.Trunc(number); ok {
+			value = int64(number)
+		}
+	case "boolean":
+		_, ok = value.(bool)
+	case "array":
+		_, ok = value.([]interface{})
+	case "object":
+		_, ok = value.(map[string]interface{})
+	}
+	if !ok {
+		return vm.NewNilValueGC(), invalidParams("%s: argument %s should be %s, got %s", t.Name, param, kind, jsonTypeName(value))
+	}
+
+	converted, err := vm.FromGoValue(value)
+	if err != nil {
+		return vm.NewNilValueGC(), invalidParams("%s: argument %s: %v", t.Name, param, err)
+	}
+	return converted, nil
+}
+
+// invalidParams 创建 CodeInvalidParams 错误，服务器把它作为JSON-RPC错误响应返回
+func invalidParams(format string, args ...interface{}) error {
+	return &mcp.Error{Code: mcp.CodeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// jsonTypeName 返回JSON解码得到的值的JSON Schema类型名
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// toolResult 把返回值转换为工具结果：字符串原样作为文本，其他值编码为JSON，
+// 对象同时作为 structuredContent
+func toolResult(value vm.ValueGC) (*mcp.ToolResult, error) {
+	result, err := vm.ToGoValue(value)
+	if err != nil {
+		return nil, err
+	}
+	if text, ok := result.(string); ok {
+		return mcp.TextResult(text), nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	toolResult := mcp.TextResult(string(data))
+	if object, ok := result.(map[string]interface{}); ok {
+		toolResult.StructuredContent = object
+	}
+	return toolResult, nil
+}
+
+// containsString 判断列表中是否包含s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
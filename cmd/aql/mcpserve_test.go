@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zhnt/aql/internal/mcp"
+)
+
+// =============================================================================
+// mcp-serve 测试
+// =============================================================================
+
+const toolsScript = `// 两数相加
+// @param a int 第一个数
+// @param b number
+function add(a, b) { return a + b }
+
+// @tool 大写问候
+// @param name string 名字
+function greet(name) {
+    if (name == "") { throw {name: "ValueError", message: "empty name"} }
+    print("greeting", name)
+    return "HELLO " + name
+}
+
+function _helper() { return 0 }
+`
+
+// mcpResponse mcp-serve 返回的一条JSON-RPC响应
+type mcpResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *mcp.Error      `json:"error"`
+}
+
+// mcpServe 把请求逐行写入 mcp-serve 的stdin，按id返回响应
+func mcpServe(t *testing.T, script string, requests ...string) map[int]mcpResponse {
+	t.Helper()
+	dir := writeScripts(t, map[string]string{"tools.aql": script})
+	stdin := `{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}` + "\n" +
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}` + "\n" +
+		strings.Join(requests, "\n") + "\n"
+	stdout, stderr, code := aql(t, dir, stdin, "mcp-serve", "tools.aql")
+	if code != exitOK {
+		t.Fatalf("mcp-serve should exit with %d at end of input, got %d (stderr %q)", exitOK, code, stderr)
+	}
+
+	responses := map[int]mcpResponse{}
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		var response mcpResponse
+		if err := json.Unmarshal([]byte(line), &response); err != nil {
+			t.Fatalf("stdout should only contain protocol messages, got %q", line)
+		}
+		responses[response.ID] = response
+	}
+	return responses
+}
+
+// toolCall 返回调用工具的请求
+func toolCall(id int, name, arguments string) string {
+	return `{"jsonrpc":"2.0","id":` + strconv.Itoa(id) + `,"method":"tools/call","params":{"name":"` + name + `","arguments":` + arguments + `}}`
+}
+
+func TestMCPServeToolsList(t *testing.T) {
+	responses := mcpServe(t, toolsScript, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	var list struct {
+		Tools []mcp.Tool `json:"tools"`
+	}
+	if err := json.Unmarshal(responses[1].Result, &list); err != nil {
+		t.Fatal(err)
+	}
+
+	// 带 @tool 的函数存在时只提供这些函数
+	if len(list.Tools) != 1 || list.Tools[0].Name != "greet" {
+		t.Fatalf("only greet should be served, got %+v", list.Tools)
+	}
+	tool := list.Tools[0]
+	if tool.Description != "大写问候" {
+		t.Errorf("description should come from the comment, got %q", tool.Description)
+	}
+	want := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string", "description": "名字"},
+		},
+		"required":             []interface{}{"name"},
+		"additionalProperties": false,
+	}
+	if !reflect.DeepEqual(tool.InputSchema, want) {
+		t.Errorf("schema should be %v, got %v", want, tool.InputSchema)
+	}
+
+	// 没有 @tool 和 export 时提供所有不以 _ 开头的函数
+	untagged := strings.Replace(toolsScript, "// @tool 大写问候", "// 大写问候", 1)
+	responses = mcpServe(t, untagged, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if err := json.Unmarshal(responses[1].Result, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Tools) != 2 || list.Tools[0].Name != "add" || list.Tools[1].Name != "greet" {
+		t.Fatalf("add and greet should be served, got %+v", list.Tools)
+	}
+	add := list.Tools[0].InputSchema["properties"].(map[string]interface{})
+	wantAdd := map[string]interface{}{
+		"a": map[string]interface{}{"type": "integer", "description": "第一个数"},
+		"b": map[string]interface{}{"type": "number"},
+	}
+	if !reflect.DeepEqual(add, wantAdd) {
+		t.Errorf("add properties should be %v, got %v", wantAdd, add)
+	}
+}
+
+func TestMCPServeToolsCall(t *testing.T) {
+	script := strings.Replace(toolsScript, "// @tool 大写问候", "// 大写问候", 1)
+	responses := mcpServe(t, script,
+		toolCall(1, "greet", `{"name":"ada"}`),
+		toolCall(2, "add", `{"a":2,"b":0.5}`),
+		toolCall(3, "greet", `{"name":""}`),
+	)
+
+	tests := []struct {
+		id      int
+		text    string
+		isError bool
+	}{
+		{1, "HELLO ada", false},
+		{2, "2.5", false},
+		// 脚本抛出的异常作为 isError 结果返回，而不是JSON-RPC错误
+		{3, "ValueError: empty name", true},
+	}
+	for _, tt := range tests {
+		response := responses[tt.id]
+		if response.Error != nil {
+			t.Errorf("call %d should succeed at the protocol level, got %v", tt.id, response.Error)
+			continue
+		}
+		var result mcp.ToolResult
+		if err := json.Unmarshal(response.Result, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.IsError != tt.isError || len(result.Content) != 1 || !strings.Contains(result.Content[0].Text, tt.text) {
+			t.Errorf("call %d should return %q (isError %v), got %+v", tt.id, tt.text, tt.isError, result)
+		}
+	}
+}
+
+func TestMCPServeInvalidArguments(t *testing.T) {
+	script := strings.Replace(toolsScript, "// @tool 大写问候", "// 大写问候", 1)
+	responses := mcpServe(t, script,
+		toolCall(1, "greet", `{}`),
+		toolCall(2, "add", `{"a":"x","b":1}`),
+		toolCall(3, "add", `{"a":1.5,"b":1}`),
+		toolCall(4, "greet", `{"name":null}`),
+		toolCall(5, "greet", `{"name":"ada","loud":true}`),
+	)
+
+	tests := []struct {
+		id      int
+		message string
+	}{
+		{1, "greet: missing argument(s) name"},
+		{2, "add: argument a should be integer, got string"},
+		{3, "add: argument a should be integer, got number"},
+		{4, "greet: argument name should be string, got null"},
+		{5, "greet: unknown argument(s) loud"},
+	}
+	for _, tt := range tests {
+		response := responses[tt.id]
+		if response.Error == nil {
+			t.Errorf("call %d should be rejected, got result %s", tt.id, response.Result)
+			continue
+		}
+		if response.Error.Code != mcp.CodeInvalidParams || response.Error.Message != tt.message {
+			t.Errorf("call %d should fail with %d %q, got %d %q", tt.id, mcp.CodeInvalidParams, tt.message, response.Error.Code, response.Error.Message)
+		}
+	}
+}
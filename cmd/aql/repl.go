@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zhnt/aql/internal/compiler1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+const (
+	replPrompt         = "aql> "
+	replContinuePrompt = "...  "
+	replFilename       = "<repl>"
+)
+
+// replCommand 启动交互式环境
+func replCommand(args []string) int {
+	fs := newFlagSet("repl", "")
+	debug := fs.Bool("debug", false, "启用调试输出（执行前打印字节码）")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	initRuntime(*debug)
+
+	fmt.Printf("AQL %s REPL，输入 exit 退出\n", Version)
+	runREPL(os.Stdin, os.Stdout, os.Stderr, *debug)
+	return exitOK
+}
+
+// runREPL 读取-编译-执行循环
+// 符号表、常量池和执行器在多次输入之间共享，因此全局变量和函数定义会保留
+func runREPL(in io.Reader, out, errOut io.Writer, debug bool) {
+	scanner := bufio.NewScanner(in)
+	symbolTable := compiler1.NewBuiltinSymbolTable()
+	var constants []vm.ValueGC
+	executor := vm.NewExecutor()
+	executor.SetModuleLoader(newModuleLoader(""))
+
+	var input strings.Builder
+	for {
+		if input.Len() == 0 {
+			fmt.Fprint(out, replPrompt)
+		} else {
+			fmt.Fprint(out, replContinuePrompt)
+		}
+
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		line := scanner.Text()
+
+		if input.Len() == 0 {
+			switch strings.TrimSpace(line) {
+			case "":
+				continue
+			case "exit", "quit":
+				return
+			}
+		}
+
+		input.WriteString(line)
+		input.WriteString("\n")
+
+		// 括号未闭合时继续读取下一行
+		if !inputComplete(input.String()) {
+			continue
+		}
+
+		source := input.String()
+		input.Reset()
+
+		program, err := parseSource(replFilename, source)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			continue
+		}
+
+		comp := compiler1.NewWithState(symbolTable, constants)
+		comp.SetSource(replFilename)
+		function, err := comp.Compile(program)
+		if err != nil {
+			fmt.Fprintln(errOut, wrapCompileError(replFilename, err))
+			continue
+		}
+		// 编译成功才提交状态，失败的输入不影响后续会话
+		symbolTable = comp.SymbolTable()
+		constants = comp.Constants()
+
+		if debug {
+			fmt.Fprint(out, vm.Disassemble(function))
+		}
+
+		results, err := executor.Execute(function, nil)
+		if err != nil {
+			printRuntimeError(errOut, err)
+			continue
+		}
+		if len(results) > 0 && !results[0].IsNil() {
+			fmt.Fprintln(out, results[0].ToString())
+		}
+	}
+}
+
+// inputComplete 判断输入的括号是否已经配对（忽略字符串和注释中的括号）
+func inputComplete(source string) bool {
+	depth := 0
+	inString := false
+	for i := 0; i < len(source); i++ {
+		ch := source[i]
+		switch {
+		case inString:
+			if ch == '\\' {
+				i++
+			} else if ch == '"' {
+				inString = false
+			}
+		case ch == '"':
+			inString = true
+		case ch == '/' && i+1 < len(source) && source[i+1] == '/':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case ch == '(' || ch == '[' || ch == '{':
+			depth++
+		case ch == ')' || ch == ']' || ch == '}':
+			depth--
+		}
+	}
+	return depth <= 0 && !inString
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zhnt/aql/internal/compiler1"
+	"github.com/zhnt/aql/internal/gc"
+	"github.com/zhnt/aql/internal/lexer1"
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// sourceError 带源码位置的错误，输出格式为 file:line:column: message
+type sourceError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *sourceError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Message)
+}
+
+// errorList 多个源码错误（语法分析会一次报告所有错误）
+type errorList []*sourceError
+
+func (l errorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// initRuntime 初始化GC管理器，执行任何包含长字符串或数组的代码前必须调用
+func initRuntime(debug bool) {
+	vm.InitValueGCManager(gc.NewUnifiedGCManager(gc.NewAQLUnifiedAllocator(debug), nil))
+}
+
+// parseSource 解析源码，返回AST或带位置的语法错误
+func parseSource(filename, source string) (*parser1.Program, error) {
+	p := parser1.New(lexer1.New(source))
+	program := p.ParseProgram()
+
+	if parseErrors := p.ParseErrors(); len(parseErrors) > 0 {
+		list := make(errorList, len(parseErrors))
+		for i, pe := range parseErrors {
+			list[i] = &sourceError{
+				File:    filename,
+				Line:    pe.Line,
+				Column:  pe.Column,
+				Message: "语法错误: " + pe.Message,
+			}
+		}
+		return nil, list
+	}
+
+	return program, nil
+}
+
+// compileSource 解析并编译源码
+func compileSource(filename, source string) (*vm.Function, error) {
+	function, _, err := compileSourceStats(filename, source)
+	return function, err
+}
+
+// compileSourceStats 解析并编译源码，同时返回窥孔优化的统计
+func compileSourceStats(filename, source string) (*vm.Function, compiler1.PeepholeStats, error) {
+	program, err := parseSource(filename, source)
+	if err != nil {
+		return nil, compiler1.PeepholeStats{}, err
+	}
+
+	comp := compiler1.New()
+	comp.SetSource(filename)
+	function, err := comp.Compile(program)
+	if err != nil {
+		return nil, compiler1.PeepholeStats{}, wrapCompileError(filename, err)
+	}
+
+	return function, comp.PeepholeStats(), nil
+}
+
+// wrapCompileError 为编译错误附加文件和位置信息
+func wrapCompileError(filename string, err error) error {
+	var ce *compiler1.CompilationError
+	if errors.As(err, &ce) {
+		line, column := ce.Position()
+		return &sourceError{File: filename, Line: line, Column: column, Message: ce.Error()}
+	}
+	return &sourceError{File: filename, Message: err.Error()}
+}
+
+// loadFunction 读取脚本或字节码文件并返回可执行的主函数
+// 返回的退出码仅在err非nil时有意义
+func loadFunction(filename string) (*vm.Function, int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, exitIOError, err
+	}
+
+	if bytes.HasPrefix(data, []byte(vm.BytecodeMagic)) {
+		function, err := vm.ReadBytecode(bytes.NewReader(data))
+		if err != nil {
+			return nil, exitIOError, fmt.Errorf("%s: %w", filename, err)
+		}
+		return function, exitOK, nil
+	}
+
+	function, err := compileSource(filename, string(data))
+	if err != nil {
+		return nil, exitCompileError, err
+	}
+	return function, exitOK, nil
+}
+
+// printRuntimeError 输出运行时错误，跨函数调用时附带AQL调用栈
+func printRuntimeError(w io.Writer, err error) {
+	fmt.Fprintln(w, err)
+
+	var re *vm.RuntimeError
+	if errors.As(err, &re) && len(re.StackTrace) > 1 {
+		fmt.Fprintln(w, "调用栈:")
+		fmt.Fprint(w, re.FormatStackTrace())
+	}
+}
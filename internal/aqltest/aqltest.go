@@ -0,0 +1,114 @@
+// Package aqltest 提供测试中编译和运行AQL脚本的辅助函数
+package aqltest
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/zhnt/aql/internal/compiler1"
+	"github.com/zhnt/aql/internal/gc"
+	"github.com/zhnt/aql/internal/lexer1"
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 脚本运行辅助
+// =============================================================================
+
+// 设计原理：
+// - GC管理器是进程级的，InitRuntime 只初始化一次，各包的测试共用
+// - 执行器的print输出写入返回的缓冲区，测试比较输出文本
+// - 语法和编译错误使测试立即失败；运行时错误由 Run 报告为失败，由 RunScript 返回给调用方检查
+// - 测试专用的原生函数通过 RunWithNatives 作为脚本的全局变量提供，不注册到进程级的原生函数表
+
+var initOnce sync.Once
+
+// InitRuntime 初始化GC管理器，执行任何包含长字符串、数组或对象的代码前必须调用
+func InitRuntime() {
+	initOnce.Do(func() {
+		vm.InitValueGCManager(gc.NewUnifiedGCManager(gc.NewAQLUnifiedAllocator(false), nil))
+	})
+}
+
+// NewExecutor 创建print输出写入缓冲区的执行器
+func NewExecutor() (*vm.Executor, *bytes.Buffer) {
+	InitRuntime()
+	var out bytes.Buffer
+	executor := vm.NewExecutor()
+	executor.SetStdout(&out)
+	return executor, &out
+}
+
+// Compile 解析并编译脚本，出错时测试失败
+func Compile(t testing.TB, source string) *vm.Function {
+	t.Helper()
+	InitRuntime()
+	p := parser1.New(lexer1.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	function, err := compiler1.New().Compile(program)
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	return function
+}
+
+// Run 编译并在executor上运行脚本，返回print输出；运行时错误使测试失败
+func Run(t testing.TB, executor *vm.Executor, out *bytes.Buffer, source string) string {
+	t.Helper()
+	function := Compile(t, source)
+	if _, err := executor.Execute(function, nil); err != nil {
+		t.Fatalf("script failed: %v\noutput so far:\n%s", err, out.String())
+	}
+	return out.String()
+}
+
+// Native 只对一次 RunWithNatives 可见的原生函数
+type Native struct {
+	Name  string
+	Arity int
+	Fn    vm.NativeFunc
+}
+
+// RunWithNatives 与 Run 相同，natives 是executor的原生闭包，按名字作为脚本的全局变量
+func RunWithNatives(t testing.TB, executor *vm.Executor, out *bytes.Buffer, source string, natives ...Native) string {
+	t.Helper()
+	InitRuntime()
+	names := make([]string, len(natives))
+	executor.Globals = executor.Globals[:0]
+	for i, native := range natives {
+		value, err := executor.NewNativeClosure(native.Name, native.Arity, native.Fn, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names[i] = native.Name
+		executor.Globals = append(executor.Globals, value)
+	}
+
+	chunk, err := compiler1.CompileChunk(source, vm.ChunkOptions{Name: "test", Globals: names})
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	if _, err := executor.Execute(chunk.Main, nil); err != nil {
+		t.Fatalf("script failed: %v\noutput so far:\n%s", err, out.String())
+	}
+	return out.String()
+}
+
+// RunScript 用注册了services的新执行器运行脚本，返回print输出和运行时错误
+func RunScript(t testing.TB, source string, services map[string]vm.ServiceProvider) (string, error) {
+	t.Helper()
+	function := Compile(t, source)
+	executor, out := NewExecutor()
+	for name, provider := range services {
+		if err := executor.RegisterService(name, provider); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := executor.Execute(function, nil)
+	return out.String(), err
+}
@@ -0,0 +1,86 @@
+package compiler1
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/zhnt/aql/internal/lexer1"
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// 运行时加载代码（load / loadString / eval）的编译
+//
+// vm 不依赖编译器，这里在包初始化时把 CompileChunk 注册给 vm。
+// 受限环境的块使用不含内建函数的符号表，env 中的名字依次定义为全局变量 0..n-1，
+// 未定义的名字在编译时报错。
+
+func init() {
+	vm.SetChunkCompiler(CompileChunk)
+}
+
+// CompileChunk 编译运行时加载的代码块，语法和编译错误以 *vm.CompileError 返回
+func CompileChunk(source string, options vm.ChunkOptions) (*vm.Chunk, error) {
+	p := parser1.New(lexer1.New(source))
+	program := p.ParseProgram()
+	if parseErrors := p.ParseErrors(); len(parseErrors) > 0 {
+		first := parseErrors[0]
+		messages := make([]string, len(parseErrors))
+		for i, pe := range parseErrors {
+			messages[i] = pe.Message
+		}
+		return nil, &vm.CompileError{
+			Kind:    "SyntaxError",
+			Chunk:   options.Name,
+			Line:    first.Line,
+			Column:  first.Column,
+			Message: strings.Join(messages, "; "),
+		}
+	}
+	if options.ReturnLast {
+		returnLastExpression(program)
+	}
+
+	c := New()
+	if options.Restricted {
+		c.symbolTable = NewSymbolTable()
+	}
+	for _, name := range options.Globals {
+		c.symbolTable.Define(name)
+	}
+	c.SetSource(options.Name)
+
+	main, err := c.Compile(program)
+	if err != nil {
+		compileErr := &vm.CompileError{Kind: "CompileError", Chunk: options.Name, Message: err.Error()}
+		var ce *CompilationError
+		if errors.As(err, &ce) {
+			compileErr.Message = ce.Message
+			compileErr.Line, compileErr.Column = ce.Position()
+		}
+		return nil, compileErr
+	}
+	main.Name = options.Name
+	return &vm.Chunk{Main: main, Globals: main.GlobalNames}, nil
+}
+
+// returnLastExpression 把程序最后一条表达式语句改为return语句（函数声明除外）
+func returnLastExpression(program *parser1.Program) {
+	n := len(program.Statements)
+	if n == 0 {
+		return
+	}
+	stmt, ok := program.Statements[n-1].(*parser1.ExpressionStatement)
+	if !ok || stmt.Expression == nil {
+		return
+	}
+	switch expr := stmt.Expression.(type) {
+	case *parser1.DecoratedFunction:
+		return
+	case *parser1.FunctionLiteral:
+		if expr.Name != nil {
+			return
+		}
+	}
+	program.Statements[n-1] = &parser1.ReturnStatement{Token: stmt.Token, ReturnValue: stmt.Expression}
+}
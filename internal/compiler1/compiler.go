@@ -2,6 +2,8 @@ package compiler1
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/zhnt/aql/internal/parser1"
 	"github.com/zhnt/aql/internal/vm"
@@ -9,17 +11,28 @@ import (
 
 // Compiler AQL编译器，将AST编译为VM字节码
 type Compiler struct {
-	constants    []vm.ValueGC    // 常量池
-	symbolTable  *SymbolTable    // 符号表
-	scopes       []*CompileScope // 作用域栈
-	scopeIndex   int             // 当前作用域索引
-	nextRegister int             // 下一个可用寄存器
-	maxRegisters int             // 最大寄存器使用数
-	loopStack    []*LoopContext  // 循环栈，用于break/continue
+	constants    []vm.ValueGC      // 常量池
+	symbolTable  *SymbolTable      // 符号表
+	scopes       []*CompileScope   // 作用域栈
+	scopeIndex   int               // 当前作用域索引
+	nextRegister int               // 下一个可用寄存器
+	maxRegisters int               // 最大寄存器使用数
+	loopStack    []*LoopContext    // 循环栈，用于break/continue
+	hiddenCount  int               // 已生成的内部变量数量
+	exports      []vm.ModuleExport // export声明，按声明顺序
 
 	// 寄存器管理优化
 	freeRegisters []int // 空闲寄存器池
 	registerStack []int // 寄存器栈，用于嵌套表达式
+
+	// 窥孔优化
+	noPeephole    bool          // 关闭窥孔优化
+	peepholeStats PeepholeStats // 各规则删除的指令数
+
+	// 调试信息
+	source string // 源文件名，写入每个编译出的函数
+	line   int    // 当前正在编译的节点所在行
+	column int    // 当前正在编译的节点所在列
 }
 
 // LoopContext 循环上下文，用于处理break/continue
@@ -31,7 +44,13 @@ type LoopContext struct {
 
 // CompileScope 编译作用域
 type CompileScope struct {
-	instructions        []vm.Instruction // 当前作用域的指令
+	instructions        []vm.Instruction      // 当前作用域的指令
+	lines               []int                 // 每条指令对应的源码行
+	columns             []int                 // 每条指令对应的源码列
+	handlers            []vm.ExceptionHandler // 异常处理表
+	isGenerator         bool                  // 函数体中出现了yield
+	isAsync             bool                  // 正在编译async函数
+	tries               []*TryContext         // 正在编译的try语句，从外到内
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
 	// 寄存器状态保存
@@ -55,6 +74,17 @@ func (ce *CompilationError) Error() string {
 	return fmt.Sprintf("编译错误: %s", ce.Message)
 }
 
+// Position 返回出错节点的行列号，无法定位时返回0
+func (ce *CompilationError) Position() (line, column int) {
+	if ce.Node == nil {
+		return 0, 0
+	}
+	if tok, ok := parser1.NodeToken(ce.Node); ok {
+		return tok.Line, tok.Column
+	}
+	return 0, 0
+}
+
 // New 创建新的编译器
 func New() *Compiler {
 	mainScope := &CompileScope{
@@ -65,7 +95,7 @@ func New() *Compiler {
 
 	return &Compiler{
 		constants:     make([]vm.ValueGC, 0),
-		symbolTable:   NewSymbolTable(),
+		symbolTable:   NewBuiltinSymbolTable(),
 		scopes:        []*CompileScope{mainScope},
 		scopeIndex:    0,
 		nextRegister:  0,
@@ -76,6 +106,29 @@ func New() *Compiler {
 	}
 }
 
+// NewWithState 使用已有的符号表和常量池创建编译器（用于REPL多次输入间保持状态）
+func NewWithState(symbolTable *SymbolTable, constants []vm.ValueGC) *Compiler {
+	compiler := New()
+	compiler.symbolTable = symbolTable
+	compiler.constants = constants
+	return compiler
+}
+
+// SetSource 设置源文件名，用于运行时错误定位
+func (c *Compiler) SetSource(source string) {
+	c.source = source
+}
+
+// SymbolTable 返回编译器当前的符号表
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+// Constants 返回编译器的常量池
+func (c *Compiler) Constants() []vm.ValueGC {
+	return c.constants
+}
+
 // Compile 编译程序为VM函数
 func (c *Compiler) Compile(node parser1.Node) (*vm.Function, error) {
 	switch node := node.(type) {
@@ -91,6 +144,8 @@ func (c *Compiler) Compile(node parser1.Node) (*vm.Function, error) {
 
 // compileProgram 编译程序
 func (c *Compiler) compileProgram(program *parser1.Program) (*vm.Function, error) {
+	foldProgram(program)
+
 	for _, stmt := range program.Statements {
 		err := c.compileStatement(stmt)
 		if err != nil {
@@ -102,16 +157,20 @@ func (c *Compiler) compileProgram(program *parser1.Program) (*vm.Function, error
 	function := vm.NewFunction("main")
 	function.Instructions = c.currentInstructions()
 	function.Constants = c.constants
+	c.setDebugInfo(function)
 
 	// 动态计算MaxStackSize，确保足够的寄存器空间
 	calculatedSize := c.calculateOptimalStackSize()
 	function.MaxStackSize = calculatedSize
+	c.optimizeFunction(function, true)
 
 	return function, nil
 }
 
 // compileStatement 编译语句
 func (c *Compiler) compileStatement(stmt parser1.Statement) error {
+	defer c.trackPosition(stmt)()
+
 	switch stmt := stmt.(type) {
 	case *parser1.LetStatement:
 		return c.compileLetStatement(stmt)
@@ -129,6 +188,14 @@ func (c *Compiler) compileStatement(stmt parser1.Statement) error {
 		return c.compileBreakStatement(stmt)
 	case *parser1.ContinueStatement:
 		return c.compileContinueStatement(stmt)
+	case *parser1.TryStatement:
+		return c.compileTryStatement(stmt)
+	case *parser1.ThrowStatement:
+		return c.compileThrowStatement(stmt)
+	case *parser1.ImportStatement:
+		return c.compileImportStatement(stmt)
+	case *parser1.ExportStatement:
+		return c.compileExportStatement(stmt)
 	default:
 		return &CompilationError{
 			Message: fmt.Sprintf("unsupported statement type: %T", stmt),
@@ -145,8 +212,13 @@ func (c *Compiler) compileLetStatement(stmt *parser1.LetStatement) error {
 		return err
 	}
 
-	// 定义符号
-	symbol := c.symbolTable.Define(stmt.Name.Value)
+	c.defineVariable(stmt.Name.Value, reg)
+	return nil
+}
+
+// defineVariable 定义变量并以R[reg]初始化
+func (c *Compiler) defineVariable(name string, reg int) Symbol {
+	symbol := c.symbolTable.Define(name)
 
 	// 为局部变量分配固定的寄存器
 	var targetReg int
@@ -171,7 +243,7 @@ func (c *Compiler) compileLetStatement(stmt *parser1.LetStatement) error {
 		c.emit(vm.OP_SET_LOCAL, targetReg, symbol.Index) // L(symbol.Index) := R[targetReg]
 	}
 
-	return nil
+	return symbol
 }
 
 // compileConstStatement 编译const语句
@@ -217,8 +289,14 @@ func (c *Compiler) compileReturnStatement(stmt *parser1.ReturnStatement) error {
 		if err != nil {
 			return err
 		}
+		if reg, err = c.exitTries(0, reg); err != nil {
+			return err
+		}
 		c.emit(vm.OP_RETURN, reg, 1, 0) // return R[reg], 1个返回值
 	} else {
+		if _, err := c.exitTries(0, -1); err != nil {
+			return err
+		}
 		// 没有返回值，返回nil
 		nilReg := c.allocateRegister()
 		c.emit(vm.OP_LOADK, nilReg, c.addConstant(vm.NewNilValue()))
@@ -233,6 +311,9 @@ func (c *Compiler) compileExpressionStatement(stmt *parser1.ExpressionStatement)
 	if funcLit, ok := stmt.Expression.(*parser1.FunctionLiteral); ok && funcLit.Name != nil {
 		return c.compileNamedFunctionDefinition(funcLit)
 	}
+	if decorated, ok := stmt.Expression.(*parser1.DecoratedFunction); ok {
+		return c.compileDecoratedFunction(decorated)
+	}
 
 	reg, err := c.compileExpression(stmt.Expression)
 	if err != nil {
@@ -275,6 +356,8 @@ func (c *Compiler) findSafeResultRegister() int {
 
 // compileExpression 编译表达式，返回结果所在的寄存器号
 func (c *Compiler) compileExpression(expr parser1.Expression) (int, error) {
+	defer c.trackPosition(expr)()
+
 	switch expr := expr.(type) {
 	case *parser1.IntegerLiteral:
 		return c.compileIntegerLiteral(expr)
@@ -292,6 +375,8 @@ func (c *Compiler) compileExpression(expr parser1.Expression) (int, error) {
 		return c.compileAssignmentExpression(expr)
 	case *parser1.IndexAssignmentStatement:
 		return c.compileIndexAssignmentExpression(expr)
+	case *parser1.PropertyAssignmentStatement:
+		return c.compilePropertyAssignmentExpression(expr)
 	case *parser1.InfixExpression:
 		return c.compileInfixExpression(expr)
 	case *parser1.PrefixExpression:
@@ -308,6 +393,23 @@ func (c *Compiler) compileExpression(expr parser1.Expression) (int, error) {
 		return c.compileArrayConstructor(expr)
 	case *parser1.IndexExpression:
 		return c.compileIndexExpression(expr)
+	case *parser1.ObjectLiteral:
+		return c.compileObjectLiteral(expr)
+	case *parser1.PropertyExpression:
+		return c.compilePropertyExpression(expr)
+	case *parser1.YieldExpression:
+		return c.compileYieldExpression(expr)
+	case *parser1.AwaitExpression:
+		return c.compileAwaitExpression(expr)
+	case *parser1.PipeExpression:
+		return c.compilePipeExpression(expr)
+	case *parser1.ServiceCallExpression:
+		return c.compileServiceCallExpression(expr)
+	case *parser1.DecoratedFunction:
+		return 0, &CompilationError{
+			Message: "decorated function must be declared as a statement",
+			Node:    expr,
+		}
 	default:
 		return -1, &CompilationError{
 			Message: fmt.Sprintf("unsupported expression type: %T", expr),
@@ -373,6 +475,8 @@ func (c *Compiler) compileIdentifier(expr *parser1.Identifier) (int, error) {
 		c.emit(vm.OP_GET_GLOBAL, reg, symbol.Index) // R[reg] := G(symbol.Index)
 	case FREE_SCOPE:
 		c.emit(vm.OP_GET_UPVALUE, reg, symbol.Index) // R[reg] := Upvalue[symbol.Index].Get()
+	case BUILTIN_SCOPE:
+		c.emit(vm.OP_LOADK, reg, c.addConstant(vm.NewNativeFunctionValueGC(symbol.Index))) // R[reg] := Native(symbol.Index)
 	default: // LOCAL_SCOPE 和其他
 		c.emit(vm.OP_GET_LOCAL, reg, symbol.Index) // R[reg] := L(symbol.Index)
 	}
@@ -438,13 +542,35 @@ func (c *Compiler) compileIndexAssignmentExpression(expr *parser1.IndexAssignmen
 		return -1, err
 	}
 
-	// 发射数组设置指令: ARRAY_SET arrayReg, indexReg, valueReg
-	c.emit(vm.OP_ARRAY_SET, arrayReg, indexReg, valueReg)
+	// 发射索引设置指令: SET_INDEX arrayReg, indexReg, valueReg（数组下标或对象动态键）
+	c.emit(vm.OP_SET_INDEX, arrayReg, indexReg, valueReg)
 
 	// 索引赋值表达式的结果就是被赋的值
 	return valueReg, nil
 }
 
+// compilePropertyAssignmentExpression 编译属性赋值表达式 obj.field = value
+func (c *Compiler) compilePropertyAssignmentExpression(expr *parser1.PropertyAssignmentStatement) (int, error) {
+	// 编译右值表达式
+	valueReg, err := c.compileExpression(expr.Value)
+	if err != nil {
+		return -1, err
+	}
+
+	// 编译对象表达式
+	objectReg, err := c.compileExpression(expr.Left.Object)
+	if err != nil {
+		return -1, err
+	}
+
+	// 发射字段设置指令: SET_FIELD objectReg, K(field), valueReg
+	keyIndex := c.addConstant(vm.NewStringValue(expr.Left.Property.Value))
+	c.emit(vm.OP_SET_FIELD, objectReg, keyIndex, valueReg)
+
+	// 属性赋值表达式的结果就是被赋的值
+	return valueReg, nil
+}
+
 // 运算表达式编译方法
 
 func (c *Compiler) compileInfixExpression(expr *parser1.InfixExpression) (int, error) {
@@ -539,43 +665,38 @@ func (c *Compiler) compileIfExpression(expr *parser1.IfStatement) (int, error) {
 	// 存储所有跳转位置，用于后续回填
 	var jumpToEndPositions []int
 
-	// 编译主if条件
-	conditionReg, err := c.compileExpression(expr.Condition)
-	if err != nil {
-		return -1, err
-	}
-
-	// 发射条件跳转指令：如果条件为假，跳过if块
-	jumpIfFalsePos := c.emit(vm.OP_JUMP_IF_FALSE, conditionReg, 9999)
-
-	// 编译if块（consequence）
-	err = c.compileIfBlock(expr.Consequence, resultReg)
-	if err != nil {
-		return -1, err
-	}
+	// 主if和elif分支按相同方式编译
+	branches := append([]*parser1.ElifBranch{{Token: expr.Token, Condition: expr.Condition, Consequence: expr.Consequence}}, expr.ElifBranches...)
+	alternative := expr.Alternative
 
-	// 发射无条件跳转指令：跳到最终结束位置
-	jumpToEndPos := c.emit(vm.OP_JUMP, 9999)
-	jumpToEndPositions = append(jumpToEndPositions, jumpToEndPos)
-
-	// 回填第一个条件跳转的目标地址
-	currentPos := len(c.currentInstructions())
-	jumpTarget := currentPos - jumpIfFalsePos
-	c.scopes[c.scopeIndex].instructions[jumpIfFalsePos].Bx = jumpTarget
+	for i, branch := range branches {
+		// 条件为常量时消除死分支
+		if truthy, ok := constantCondition(branch.Condition); ok {
+			rest := []*parser1.BlockStatement{expr.Alternative}
+			for _, later := range branches[i+1:] {
+				rest = append(rest, later.Consequence)
+			}
+			if truthy && !c.declaresVariables(rest...) {
+				// 条件恒真：该分支作为else编译，其后的分支不可达
+				alternative = branch.Consequence
+				break
+			}
+			if !truthy && !c.declaresVariables(branch.Consequence) {
+				continue
+			}
+		}
 
-	// 编译所有elif分支
-	for _, elifBranch := range expr.ElifBranches {
-		// 编译elif条件
-		elifConditionReg, err := c.compileExpression(elifBranch.Condition)
+		// 编译分支条件
+		conditionReg, err := c.compileExpression(branch.Condition)
 		if err != nil {
 			return -1, err
 		}
 
-		// 发射条件跳转指令：如果elif条件为假，跳过elif块
-		elifJumpIfFalsePos := c.emit(vm.OP_JUMP_IF_FALSE, elifConditionReg, 9999)
+		// 发射条件跳转指令：如果条件为假，跳过该分支
+		jumpIfFalsePos := c.emit(vm.OP_JUMP_IF_FALSE, conditionReg, 9999)
 
-		// 编译elif块
-		err = c.compileIfBlock(elifBranch.Consequence, resultReg)
+		// 编译分支块
+		err = c.compileIfBlock(branch.Consequence, resultReg)
 		if err != nil {
 			return -1, err
 		}
@@ -584,15 +705,14 @@ func (c *Compiler) compileIfExpression(expr *parser1.IfStatement) (int, error) {
 		jumpToEndPos := c.emit(vm.OP_JUMP, 9999)
 		jumpToEndPositions = append(jumpToEndPositions, jumpToEndPos)
 
-		// 回填elif条件跳转的目标地址
-		currentPos = len(c.currentInstructions())
-		jumpTarget = currentPos - elifJumpIfFalsePos
-		c.scopes[c.scopeIndex].instructions[elifJumpIfFalsePos].Bx = jumpTarget
+		// 回填条件跳转的目标地址
+		currentPos := len(c.currentInstructions())
+		c.scopes[c.scopeIndex].instructions[jumpIfFalsePos].Bx = currentPos - jumpIfFalsePos
 	}
 
 	// 如果有else块，编译它
-	if expr.Alternative != nil {
-		err = c.compileIfBlock(expr.Alternative, resultReg)
+	if alternative != nil {
+		err := c.compileIfBlock(alternative, resultReg)
 		if err != nil {
 			return -1, err
 		}
@@ -602,10 +722,9 @@ func (c *Compiler) compileIfExpression(expr *parser1.IfStatement) (int, error) {
 	}
 
 	// 回填所有跳转到结束位置的指令
-	currentPos = len(c.currentInstructions())
+	currentPos := len(c.currentInstructions())
 	for _, jumpPos := range jumpToEndPositions {
-		jumpTarget = currentPos - jumpPos
-		c.scopes[c.scopeIndex].instructions[jumpPos].Bx = jumpTarget
+		c.scopes[c.scopeIndex].instructions[jumpPos].Bx = currentPos - jumpPos
 	}
 
 	return resultReg, nil
@@ -739,6 +858,13 @@ func (c *Compiler) compileForStatement(stmt *parser1.ForStatement) error {
 // compileWhileStatement 编译while循环语句
 // while (condition) { body }
 func (c *Compiler) compileWhileStatement(stmt *parser1.WhileStatement) error {
+	// 条件恒假的循环体不会执行；条件恒真时省略条件检查
+	truthy, constant := constantCondition(stmt.Condition)
+	if constant && !truthy && !c.declaresVariables(stmt.Body) {
+		return nil
+	}
+	infinite := constant && truthy
+
 	// 1. 创建循环上下文并推入循环栈
 	loopContext := &LoopContext{
 		breakJumps:    make([]int, 0),
@@ -752,16 +878,18 @@ func (c *Compiler) compileWhileStatement(stmt *parser1.WhileStatement) error {
 	loopContext.updateStart = loopStart // continue跳回到条件检查
 
 	// 3. 编译条件表达式
-	conditionReg, err := c.compileExpression(stmt.Condition)
-	if err != nil {
-		return err
-	}
-
 	// 4. 如果条件为假，跳转到循环结束（占位符，稍后回填）
-	conditionJumpPos := c.emit(vm.OP_JUMP_IF_FALSE, conditionReg, 9999)
+	conditionJumpPos := -1
+	if !infinite {
+		conditionReg, err := c.compileExpression(stmt.Condition)
+		if err != nil {
+			return err
+		}
+		conditionJumpPos = c.emit(vm.OP_JUMP_IF_FALSE, conditionReg, 9999)
+	}
 
 	// 5. 编译循环体
-	err = c.compileBlockStatement(stmt.Body)
+	err := c.compileBlockStatement(stmt.Body)
 	if err != nil {
 		return err
 	}
@@ -775,8 +903,9 @@ func (c *Compiler) compileWhileStatement(stmt *parser1.WhileStatement) error {
 	loopEnd := len(c.currentInstructions())
 
 	// 8. 回填条件跳转指令
-	jumpTarget := loopEnd - conditionJumpPos
-	c.scopes[c.scopeIndex].instructions[conditionJumpPos].Bx = jumpTarget
+	if conditionJumpPos >= 0 {
+		c.scopes[c.scopeIndex].instructions[conditionJumpPos].Bx = loopEnd - conditionJumpPos
+	}
 
 	// 9. 回填所有break跳转（跳转到循环结束）
 	for _, breakJumpPos := range loopContext.breakJumps {
@@ -810,6 +939,11 @@ func (c *Compiler) compileBreakStatement(stmt *parser1.BreakStatement) error {
 	currentLoop := c.loopStack[len(c.loopStack)-1]
 
 	// 发射跳转指令，跳转到循环结束（占位符，稍后回填）
+	// 跳出当前循环内的try之前执行finally
+	if _, err := c.exitTries(c.loopTryDepth(), -1); err != nil {
+		return err
+	}
+
 	jumpPos := c.emit(vm.OP_JUMP, 9999)
 	currentLoop.breakJumps = append(currentLoop.breakJumps, jumpPos)
 
@@ -830,6 +964,11 @@ func (c *Compiler) compileContinueStatement(stmt *parser1.ContinueStatement) err
 	currentLoop := c.loopStack[len(c.loopStack)-1]
 
 	// 发射跳转指令，跳转到循环更新部分（占位符，稍后回填）
+	// 跳出当前循环内的try之前执行finally
+	if _, err := c.exitTries(c.loopTryDepth(), -1); err != nil {
+		return err
+	}
+
 	jumpPos := c.emit(vm.OP_JUMP, 9999)
 	currentLoop.continueJumps = append(currentLoop.continueJumps, jumpPos)
 
@@ -865,6 +1004,8 @@ func (c *Compiler) compileFunctionLiteral(expr *parser1.FunctionLiteral) (int, e
 
 	function := vm.NewFunction(functionName)
 	function.ParamCount = len(expr.Parameters)
+	function.IsAsync = expr.IsAsync
+	c.scopes[c.scopeIndex].isAsync = expr.IsAsync
 
 	// 先定义参数为局部变量（从索引0开始）
 	for _, param := range expr.Parameters {
@@ -900,6 +1041,8 @@ func (c *Compiler) compileFunctionLiteral(expr *parser1.FunctionLiteral) (int, e
 	function.Instructions = c.currentInstructions()
 	function.Constants = c.constants
 	function.MaxStackSize = c.maxRegisters
+	function.IsGenerator = c.scopes[c.scopeIndex].isGenerator
+	c.setDebugInfo(function)
 
 	// 检查是否有自由变量（需要创建闭包）
 	freeSymbols := c.symbolTable.FreeSymbols
@@ -908,6 +1051,7 @@ func (c *Compiler) compileFunctionLiteral(expr *parser1.FunctionLiteral) (int, e
 	// 退出作用域
 	c.leaveScope()
 	c.symbolTable = c.symbolTable.Outer
+	c.optimizeFunction(function, false)
 
 	// 将编译好的函数注册到全局Function注册表
 	functionID := vm.RegisterFunction(function)
@@ -978,20 +1122,25 @@ func (c *Compiler) compileFunctionLiteral(expr *parser1.FunctionLiteral) (int, e
 				}
 			}
 
-			// 根据当前符号表中的解析结果生成指令
+			// 根据当前符号表中的解析结果生成指令，同时记录捕获变量的描述
+			desc := vm.UpvalueDesc{Name: freeVar.Name, Index: currentSymbol.Index}
 			switch currentSymbol.Scope {
 			case GLOBAL_SCOPE:
 				c.emit(vm.OP_GET_GLOBAL, captureReg, currentSymbol.Index)
+				desc.Kind = vm.UpvalueGlobal
 			case FREE_SCOPE:
 				c.emit(vm.OP_GET_UPVALUE, captureReg, currentSymbol.Index)
+				desc.Kind = vm.UpvalueOuter
 			case LOCAL_SCOPE:
 				c.emit(vm.OP_GET_LOCAL, captureReg, currentSymbol.Index)
+				desc.Kind = vm.UpvalueLocal
 			default:
 				return -1, &CompilationError{
 					Message: "unsupported scope for free variable: " + string(currentSymbol.Scope),
 				}
 			}
 
+			function.Upvalues = append(function.Upvalues, desc)
 			captureRegs[i] = captureReg
 		}
 
@@ -1013,6 +1162,59 @@ func (c *Compiler) compileFunctionLiteral(expr *parser1.FunctionLiteral) (int, e
 	}
 }
 
+// compileYieldExpression 编译yield表达式，所在函数成为生成器
+func (c *Compiler) compileYieldExpression(expr *parser1.YieldExpression) (int, error) {
+	if c.scopeIndex == 0 {
+		return -1, &CompilationError{
+			Message: "yield outside of a function",
+			Node:    expr,
+		}
+	}
+	if c.scopes[c.scopeIndex].isAsync {
+		return -1, &CompilationError{
+			Message: "yield inside an async function is not supported",
+			Node:    expr,
+		}
+	}
+	c.scopes[c.scopeIndex].isGenerator = true
+
+	var valueReg int
+	if expr.Expression != nil {
+		reg, err := c.compileExpression(expr.Expression)
+		if err != nil {
+			return -1, err
+		}
+		valueReg = reg
+	} else {
+		valueReg = c.allocateRegister()
+		c.emit(vm.OP_LOADK, valueReg, c.addConstant(vm.NewNilValueGC()))
+	}
+
+	resultReg := c.allocateRegister()
+	c.emit(vm.OP_YIELD, resultReg, valueReg) // 挂起并交出R[valueReg]，恢复值写入R[resultReg]
+	return resultReg, nil
+}
+
+// compileAwaitExpression 编译await表达式
+// 只能出现在async函数或脚本顶层，顶层的await会驱动事件循环直到promise完成
+func (c *Compiler) compileAwaitExpression(expr *parser1.AwaitExpression) (int, error) {
+	if c.scopeIndex > 0 && !c.scopes[c.scopeIndex].isAsync {
+		return -1, &CompilationError{
+			Message: "await outside of an async function",
+			Node:    expr,
+		}
+	}
+
+	valueReg, err := c.compileExpression(expr.Expression)
+	if err != nil {
+		return -1, err
+	}
+
+	resultReg := c.allocateRegister()
+	c.emit(vm.OP_AWAIT, resultReg, valueReg) // R[resultReg] := await R[valueReg]
+	return resultReg, nil
+}
+
 func (c *Compiler) compileCallExpression(expr *parser1.CallExpression) (int, error) {
 	// 编译函数表达式
 	funcReg, err := c.compileExpression(expr.Function)
@@ -1044,6 +1246,87 @@ func (c *Compiler) compileCallExpression(expr *parser1.CallExpression) (int, err
 	return funcReg, nil
 }
 
+// compileServiceCallExpression 编译AI服务调用 @service.method(args)
+// 服务在运行时按名字查找，编译期不检查服务是否存在
+func (c *Compiler) compileServiceCallExpression(expr *parser1.ServiceCallExpression) (int, error) {
+	if expr.Service == nil || expr.Method == nil {
+		return -1, &CompilationError{
+			Message: "incomplete service call",
+			Node:    expr,
+		}
+	}
+
+	nameIndex := c.addConstant(vm.NewStringValueGC(expr.Service.Value + "." + expr.Method.Value))
+	baseReg := c.allocateRegister()
+
+	// 与CALL相同的参数布局: R(A+1), R(A+2), ...
+	for i, arg := range expr.Arguments {
+		argReg, err := c.compileExpression(arg)
+		if err != nil {
+			return -1, err
+		}
+		targetReg := baseReg + 1 + i
+		if argReg != targetReg {
+			c.emit(vm.OP_MOVE, targetReg, argReg, 0)
+		}
+	}
+
+	c.emit(vm.OP_SERVICE_CALL, baseReg, len(expr.Arguments)+1, nameIndex)
+	return baseReg, nil
+}
+
+// compilePipeExpression 编译管道表达式，左侧的值作为第一个参数插入右侧的调用
+//
+//	x |> f(a, b)       => f(x, a, b)
+//	x |> f             => f(x)
+//	x |> @svc.m(a)     => @svc.m(x, a)
+//
+// 管道是左结合的，链式管道的左侧已经是重写后的调用
+func (c *Compiler) compilePipeExpression(expr *parser1.PipeExpression) (int, error) {
+	if expr.Left == nil || expr.Right == nil {
+		return -1, &CompilationError{
+			Message: "incomplete pipe expression",
+			Node:    expr,
+		}
+	}
+
+	switch right := expr.Right.(type) {
+	case *parser1.CallExpression:
+		return c.compileExpression(&parser1.CallExpression{
+			Token:     right.Token,
+			Function:  right.Function,
+			Arguments: prependArgument(expr.Left, right.Arguments),
+		})
+	case *parser1.ServiceCallExpression:
+		return c.compileExpression(&parser1.ServiceCallExpression{
+			Token:     right.Token,
+			Service:   right.Service,
+			Method:    right.Method,
+			Arguments: prependArgument(expr.Left, right.Arguments),
+		})
+	case *parser1.IntegerLiteral, *parser1.FloatLiteral, *parser1.StringLiteral,
+		*parser1.BooleanLiteral, *parser1.NullLiteral, *parser1.ArrayLiteral, *parser1.ObjectLiteral:
+		return -1, &CompilationError{
+			Message: fmt.Sprintf("cannot pipe into %s, expected a function or call", expr.Right.String()),
+			Node:    expr,
+		}
+	default:
+		// 其他表达式（标识符、属性访问、函数字面量等）按函数值调用
+		return c.compileExpression(&parser1.CallExpression{
+			Token:     expr.Token,
+			Function:  expr.Right,
+			Arguments: []parser1.Expression{expr.Left},
+		})
+	}
+}
+
+// prependArgument 返回在args前插入first后的新参数列表，不修改原AST
+func prependArgument(first parser1.Expression, args []parser1.Expression) []parser1.Expression {
+	result := make([]parser1.Expression, 0, len(args)+1)
+	result = append(result, first)
+	return append(result, args...)
+}
+
 func (c *Compiler) compileArrayLiteral(expr *parser1.ArrayLiteral) (int, error) {
 	// 创建新数组
 	length := len(expr.Elements)
@@ -1121,8 +1404,89 @@ func (c *Compiler) compileIndexExpression(expr *parser1.IndexExpression) (int, e
 	// 分配结果寄存器，确保不会与之前的寄存器冲突
 	resultReg := c.allocateRegister()
 
-	// 发射数组获取指令: ARRAY_GET resultReg, leftReg, indexReg
-	c.emit(vm.OP_ARRAY_GET, resultReg, leftReg, indexReg)
+	// 发射索引获取指令: GET_INDEX resultReg, leftReg, indexReg（数组下标或对象动态键）
+	c.emit(vm.OP_GET_INDEX, resultReg, leftReg, indexReg)
+
+	return resultReg, nil
+}
+
+// compileObjectLiteral 编译对象字面量 {key: value, [expr]: value, name, ...base}
+// 条目按源码顺序求值并写入，对象的遍历顺序与书写顺序一致，后写入的同名键覆盖先前的值
+func (c *Compiler) compileObjectLiteral(expr *parser1.ObjectLiteral) (int, error) {
+	objectReg := c.allocateRegister()
+
+	// 发射创建对象指令: NEW_OBJECT objectReg, 条目数量
+	c.emit(vm.OP_NEW_OBJECT, objectReg, len(expr.Entries), 0)
+
+	for _, entry := range expr.Entries {
+		switch entry.Kind {
+		case parser1.ObjectEntrySpread:
+			// 展开条目: SPREAD_OBJECT objectReg, sourceReg
+			sourceReg, err := c.compileExpression(entry.Value)
+			if err != nil {
+				return -1, err
+			}
+			c.emit(vm.OP_SPREAD_OBJECT, objectReg, sourceReg, 0)
+
+		case parser1.ObjectEntryComputed:
+			// 计算键: SET_INDEX objectReg, keyReg, valueReg
+			keyReg, err := c.compileExpression(entry.Key)
+			if err != nil {
+				return -1, err
+			}
+			valueReg, err := c.compileExpression(entry.Value)
+			if err != nil {
+				return -1, err
+			}
+			c.emit(vm.OP_SET_INDEX, objectReg, keyReg, valueReg)
+
+		default:
+			// 静态键（含简写）: SET_FIELD objectReg, K(name), valueReg
+			name, err := objectLiteralKey(entry.Key)
+			if err != nil {
+				return -1, err
+			}
+			valueReg, err := c.compileExpression(entry.Value)
+			if err != nil {
+				return -1, err
+			}
+			keyIndex := c.addConstant(vm.NewStringValue(name))
+			c.emit(vm.OP_SET_FIELD, objectReg, keyIndex, valueReg)
+		}
+	}
+
+	return objectReg, nil
+}
+
+// objectLiteralKey 获取对象字面量中静态键的字段名
+func objectLiteralKey(key parser1.Expression) (string, error) {
+	switch key := key.(type) {
+	case *parser1.Identifier:
+		return key.Value, nil
+	case *parser1.StringLiteral:
+		return key.Value, nil
+	case *parser1.IntegerLiteral:
+		return strconv.FormatInt(key.Value, 10), nil
+	default:
+		return "", &CompilationError{
+			Message: fmt.Sprintf("invalid object key: %s", key.String()),
+			Node:    key,
+		}
+	}
+}
+
+// compilePropertyExpression 编译属性访问表达式 obj.field
+func (c *Compiler) compilePropertyExpression(expr *parser1.PropertyExpression) (int, error) {
+	objectReg, err := c.compileExpression(expr.Object)
+	if err != nil {
+		return -1, err
+	}
+
+	resultReg := c.allocateRegister()
+
+	// 发射字段获取指令: GET_FIELD resultReg, objectReg, K(field)
+	keyIndex := c.addConstant(vm.NewStringValue(expr.Property.Value))
+	c.emit(vm.OP_GET_FIELD, resultReg, objectReg, keyIndex)
 
 	return resultReg, nil
 }
@@ -1282,11 +1646,56 @@ func (c *Compiler) makeInstruction(op vm.OpCode, operands ...int) vm.Instruction
 
 // addInstruction 添加指令到当前作用域
 func (c *Compiler) addInstruction(ins vm.Instruction) int {
-	posNewInstruction := len(c.currentInstructions())
-	c.scopes[c.scopeIndex].instructions = append(c.scopes[c.scopeIndex].instructions, ins)
+	scope := c.scopes[c.scopeIndex]
+	posNewInstruction := len(scope.instructions)
+	scope.instructions = append(scope.instructions, ins)
+	scope.lines = append(scope.lines, c.line)
+	scope.columns = append(scope.columns, c.column)
 	return posNewInstruction
 }
 
+// trackPosition 将当前源码位置切换到node，返回恢复原位置的函数
+// 父节点在子节点编译完成后发射的指令（如ADD、CALL）仍然记录父节点的位置
+func (c *Compiler) trackPosition(node parser1.Node) func() {
+	line, column := c.line, c.column
+	if tok, ok := parser1.NodeToken(node); ok && tok.Line > 0 {
+		c.line, c.column = tok.Line, tok.Column
+	}
+	return func() {
+		c.line, c.column = line, column
+	}
+}
+
+// setDebugInfo 将当前作用域的行列号表、源文件名、异常处理表和变量名写入函数
+func (c *Compiler) setDebugInfo(function *vm.Function) {
+	scope := c.scopes[c.scopeIndex]
+	function.LineNumbers = scope.lines
+	function.Columns = scope.columns
+	function.Source = c.source
+	function.Handlers = scope.handlers
+
+	// 被同名定义覆盖的变量不在符号表中，其寄存器按临时寄存器处理
+	if c.symbolTable.Outer == nil {
+		function.GlobalNames = make([]string, c.symbolTable.numDefinitions)
+	}
+	for name, symbol := range c.symbolTable.store {
+		if strings.HasPrefix(name, "<") {
+			continue
+		}
+		switch symbol.Scope {
+		case LOCAL_SCOPE:
+			for len(function.LocalNames) <= symbol.Index {
+				function.LocalNames = append(function.LocalNames, "")
+			}
+			function.LocalNames[symbol.Index] = name
+		case GLOBAL_SCOPE:
+			if symbol.Index < len(function.GlobalNames) {
+				function.GlobalNames[symbol.Index] = name
+			}
+		}
+	}
+}
+
 // setLastInstruction 设置最后发射的指令信息
 func (c *Compiler) setLastInstruction(op vm.OpCode, pos int) {
 	previous := c.scopes[c.scopeIndex].lastInstruction
@@ -1325,14 +1734,14 @@ func (c *Compiler) leaveScope() []vm.Instruction {
 
 	// 恢复上一个作用域的寄存器状态
 	if c.scopeIndex > 0 {
-		parentScope := c.scopes[c.scopeIndex-1]
-
 		// 重要修复：我们需要更新父作用域的寄存器状态，确保后续的寄存器分配
 		// 能够正确地继续，而不是重用已经被占用的寄存器
 
-		// 首先恢复到父作用域的状态
-		c.nextRegister = parentScope.savedNextRegister
-		c.maxRegisters = parentScope.savedMaxRegisters
+		// 首先恢复进入当前作用域时保存的父作用域状态，
+		// 父作用域中已分配的寄存器（如正在构造的对象、数组和调用参数）不会被重用
+		scope := c.scopes[c.scopeIndex]
+		c.nextRegister = scope.savedNextRegister
+		c.maxRegisters = scope.savedMaxRegisters
 
 		// 然后更新父作用域的状态，确保后续的寄存器分配不会冲突
 		// 重新扫描父作用域的局部变量，更新nextRegister
@@ -1395,6 +1804,40 @@ func (c *Compiler) compileNamedFunctionDefinition(funcLit *parser1.FunctionLiter
 	return nil
 }
 
+// compileDecoratedFunction 编译带装饰器的函数声明
+// 先按普通具名函数定义，再编译 name = d1(d2(name, args2), args1)：
+// 离函数最近的装饰器最先应用，具名参数合并为对象放在位置参数之后
+func (c *Compiler) compileDecoratedFunction(decorated *parser1.DecoratedFunction) error {
+	fn := decorated.Function
+	if err := c.compileNamedFunctionDefinition(fn); err != nil {
+		return err
+	}
+
+	var value parser1.Expression = fn.Name
+	for i := len(decorated.Decorators) - 1; i >= 0; i-- {
+		decorator := decorated.Decorators[i]
+		args := append([]parser1.Expression{value}, decorator.Arguments...)
+		if len(decorator.Named) > 0 {
+			options := &parser1.ObjectLiteral{Token: decorator.Token}
+			for _, named := range decorator.Named {
+				key := &parser1.StringLiteral{Token: named.Name.Token, Value: named.Name.Value}
+				options.Entries = append(options.Entries, &parser1.ObjectEntry{
+					Kind:  parser1.ObjectEntryKeyValue,
+					Key:   key,
+					Value: named.Value,
+				})
+			}
+			args = append(args, options)
+		}
+		value = &parser1.CallExpression{Token: decorator.Token, Function: decorator.Name, Arguments: args}
+	}
+
+	return c.compileExpressionStatement(&parser1.ExpressionStatement{
+		Token:      decorated.Token,
+		Expression: &parser1.AssignmentStatement{Token: decorated.Token, Name: fn.Name, Value: value},
+	})
+}
+
 // ByteCode 编译结果
 type ByteCode struct {
 	Instructions []vm.Instruction
@@ -0,0 +1,36 @@
+package compiler1_test
+
+import (
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+)
+
+// =============================================================================
+// 装饰器展开测试
+// =============================================================================
+
+func TestDecoratorDesugarOrder(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	got := aqltest.Run(t, executor, out, `
+function tag(f, label, options) {
+    print("apply", label, options)
+    return function(x) { return label + "(" + f(x) + ")" }
+}
+function plain(f) {
+    print("apply plain")
+    return f
+}
+@tag("outer") @plain @tag("inner", level=2, on=true)
+function base(x) { return x }
+print(base("v"))
+`)
+	// 离函数最近的装饰器最先应用，具名参数合并为对象放在位置参数之后
+	want := "apply inner {level: 2, on: true}\n" +
+		"apply plain\n" +
+		"apply outer nil\n" +
+		"outer(inner(v))\n"
+	if got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
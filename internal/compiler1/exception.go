@@ -0,0 +1,244 @@
+package compiler1
+
+import (
+	"fmt"
+
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// try / catch / finally / throw 的编译
+//
+// 布局（异常处理表项按从内到外的顺序写入函数）：
+//
+//	try块                    ; 受保护区间1 -> catch入口（没有catch时 -> finally入口）
+//	JUMP 正常出口
+//	catch入口: CATCH r       ; 绑定catch参数
+//	catch块                  ; 受保护区间2 -> finally入口（有finally时）
+//	正常出口: finally块
+//	JUMP 结束
+//	finally入口: CATCH r     ; 异常暂存到隐藏变量
+//	finally块
+//	THROW 隐藏变量           ; 重新抛出
+//	结束:
+//
+// try/catch块中的 return、break、continue 会在跳出之前内联需要执行的finally块，
+// 内联的代码不属于对应try的受保护区间。
+
+// TryContext try语句的编译上下文
+type TryContext struct {
+	finally   *parser1.BlockStatement // 提前退出时需要内联的finally块
+	loopDepth int                     // 进入try时的循环嵌套深度
+	start     int                     // 当前受保护区间的起点
+	active    bool                    // 受保护区间是否打开
+	suspended bool                    // 受保护区间是否因内联finally暂时关闭
+	ranges    [][2]int                // 已关闭的受保护区间 [start, end)
+}
+
+// open 从pc开始一个受保护区间
+func (t *TryContext) open(pc int) {
+	t.start = pc
+	t.active = true
+}
+
+// close 在pc结束当前受保护区间
+func (t *TryContext) close(pc int) {
+	if t.active && pc > t.start {
+		t.ranges = append(t.ranges, [2]int{t.start, pc})
+	}
+	t.active = false
+}
+
+// suspend 内联finally之前暂时关闭受保护区间
+func (t *TryContext) suspend(pc int) {
+	if t.active {
+		t.close(pc)
+		t.suspended = true
+	}
+}
+
+// resume 内联finally之后重新打开受保护区间
+func (t *TryContext) resume(pc int) {
+	if t.suspended {
+		t.open(pc)
+		t.suspended = false
+	}
+}
+
+// takeRanges 取出并清空已关闭的受保护区间
+func (t *TryContext) takeRanges() [][2]int {
+	ranges := t.ranges
+	t.ranges = nil
+	return ranges
+}
+
+// compileTryStatement 编译try语句
+func (c *Compiler) compileTryStatement(stmt *parser1.TryStatement) error {
+	scope := c.scopes[c.scopeIndex]
+	tryContext := &TryContext{finally: stmt.Finally, loopDepth: len(c.loopStack)}
+	scope.tries = append(scope.tries, tryContext)
+
+	// 1. try块
+	tryContext.open(c.currentPC())
+	if err := c.compileBlockStatement(stmt.Body); err != nil {
+		return err
+	}
+	tryContext.close(c.currentPC())
+	finallyRanges := tryContext.takeRanges()
+
+	// 2. catch块
+	var exitJumps []int
+	if stmt.CatchBody != nil {
+		exitJumps = append(exitJumps, c.emit(vm.OP_JUMP, 9999))
+		c.addHandlers(finallyRanges, c.currentPC())
+
+		reg := c.allocateRegister()
+		c.emit(vm.OP_CATCH, reg) // R[reg] := 捕获的异常
+		if stmt.CatchParam != nil {
+			c.defineVariable(stmt.CatchParam.Value, reg)
+		}
+
+		if stmt.Finally != nil {
+			tryContext.open(c.currentPC())
+		}
+		if err := c.compileBlockStatement(stmt.CatchBody); err != nil {
+			return err
+		}
+		tryContext.close(c.currentPC())
+		finallyRanges = tryContext.takeRanges()
+	}
+
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	c.patchJumps(exitJumps, c.currentPC())
+
+	if stmt.Finally == nil {
+		return nil
+	}
+
+	// 3. 正常完成时执行finally
+	if err := c.compileBlockStatement(stmt.Finally); err != nil {
+		return err
+	}
+	endJump := c.emit(vm.OP_JUMP, 9999)
+
+	// 4. 异常路径：暂存异常，执行finally后重新抛出
+	c.addHandlers(finallyRanges, c.currentPC())
+	reg := c.allocateRegister()
+	c.emit(vm.OP_CATCH, reg)
+	pending := c.hiddenName("exception")
+	c.defineVariable(pending, reg)
+
+	if err := c.compileBlockStatement(stmt.Finally); err != nil {
+		return err
+	}
+	valueReg, err := c.compileIdentifier(&parser1.Identifier{Value: pending})
+	if err != nil {
+		return err
+	}
+	c.emit(vm.OP_THROW, valueReg)
+
+	c.patchJumps([]int{endJump}, c.currentPC())
+	return nil
+}
+
+// compileThrowStatement 编译throw语句
+func (c *Compiler) compileThrowStatement(stmt *parser1.ThrowStatement) error {
+	reg, err := c.compileExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	c.emit(vm.OP_THROW, reg)
+	return nil
+}
+
+// exitTries 在return/break/continue跳出try之前内联tries[from:]的finally块（从内到外）
+// valueReg >= 0 时表示需要跨越finally保留的返回值，返回保留后所在的寄存器
+func (c *Compiler) exitTries(from int, valueReg int) (int, error) {
+	scope := c.scopes[c.scopeIndex]
+	tries := scope.tries
+	if from >= len(tries) || !hasFinally(tries[from:]) {
+		return valueReg, nil
+	}
+
+	// finally块中的语句会重置寄存器，返回值先存入隐藏变量
+	saved := ""
+	if valueReg >= 0 {
+		saved = c.hiddenName("return")
+		c.defineVariable(saved, valueReg)
+	}
+
+	for _, tryContext := range tries[from:] {
+		tryContext.suspend(c.currentPC())
+	}
+	for i := len(tries) - 1; i >= from; i-- {
+		if tries[i].finally == nil {
+			continue
+		}
+		// 内联的finally中再次跳出时只需要执行更外层的finally
+		scope.tries = tries[:i]
+		err := c.compileBlockStatement(tries[i].finally)
+		scope.tries = tries
+		if err != nil {
+			return -1, err
+		}
+	}
+	for _, tryContext := range tries[from:] {
+		tryContext.resume(c.currentPC())
+	}
+
+	if saved == "" {
+		return valueReg, nil
+	}
+	return c.compileIdentifier(&parser1.Identifier{Value: saved})
+}
+
+// loopTryDepth 返回当前循环内第一个try的下标，break/continue需要执行它及更内层的finally
+func (c *Compiler) loopTryDepth() int {
+	tries := c.scopes[c.scopeIndex].tries
+	for i, tryContext := range tries {
+		if tryContext.loopDepth >= len(c.loopStack) {
+			return i
+		}
+	}
+	return len(tries)
+}
+
+// hasFinally 判断是否有try带finally块
+func hasFinally(tries []*TryContext) bool {
+	for _, tryContext := range tries {
+		if tryContext.finally != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// addHandlers 为受保护区间添加异常处理表项
+func (c *Compiler) addHandlers(ranges [][2]int, handlerPC int) {
+	scope := c.scopes[c.scopeIndex]
+	for _, r := range ranges {
+		scope.handlers = append(scope.handlers, vm.ExceptionHandler{
+			StartPC:   r[0],
+			EndPC:     r[1],
+			HandlerPC: handlerPC,
+		})
+	}
+}
+
+// patchJumps 把JUMP指令的目标回填为target
+func (c *Compiler) patchJumps(jumps []int, target int) {
+	for _, pos := range jumps {
+		c.scopes[c.scopeIndex].instructions[pos].Bx = target - pos
+	}
+}
+
+// currentPC 返回下一条指令的位置
+func (c *Compiler) currentPC() int {
+	return len(c.currentInstructions())
+}
+
+// hiddenName 生成脚本中无法引用的内部变量名
+func (c *Compiler) hiddenName(kind string) string {
+	c.hiddenCount++
+	return fmt.Sprintf("<%s#%d>", kind, c.hiddenCount)
+}
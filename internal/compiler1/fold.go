@@ -0,0 +1,559 @@
+package compiler1
+
+import (
+	"strconv"
+
+	"github.com/zhnt/aql/internal/lexer1"
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 常量折叠与代数化简
+// =============================================================================
+
+// 设计原理：
+// - 编译前对AST做一次改写：两侧都是字面量的算术、比较、字符串连接和逻辑非直接求值，
+//   替换为字面量节点。求值复用执行器使用的 vm.AddValuesGC 等运算函数，
+//   折叠结果（整数溢出转浮点、整数相除、字符串连接）与运行时完全一致；
+//   运算出错（除零、类型不匹配）时保留原表达式，错误仍在运行时报告
+// - 值为字面量的 const 在其后的引用处替换为字面量。只处理程序或函数体顶层的 const，
+//   且名字在整个程序中只绑定一次、从未被赋值：块不引入作用域，嵌套在块中的 const
+//   可能没有执行；多次绑定需要分析遮蔽。const 语句本身保留，全局变量和导出不受影响
+// - 恒等化简（x*1、1*x、x/1、x+0、0+x、x-0）只在x已知为数值时进行：
+//   + 对字符串是连接，* 和 / 对非数值会报错，化简会改变语义
+// - && 和 || 编译器尚不支持，不做折叠，避免只有常量操作数时才能通过编译
+// - 条件为常量的 if/elif/while 由 compileIfExpression 和 compileWhileStatement
+//   消除死分支；被删除的代码定义了变量时保留原样，否则后续引用会变成未定义变量
+
+// foldBinaryOps 可折叠的二元运算符，与 compileInfixExpression 发射的指令一一对应
+var foldBinaryOps = map[string]func(a, b vm.ValueGC) (vm.ValueGC, error){
+	"+":  vm.AddValuesGC,
+	"-":  vm.SubtractValuesGC,
+	"*":  vm.MultiplyValuesGC,
+	"/":  vm.DivideValuesGC,
+	"%":  vm.ModuloValuesGC,
+	"==": vm.EqualValuesGC,
+	"!=": vm.NotEqualValuesGC,
+	"<":  vm.LessThanValuesGC,
+	"<=": vm.LessEqualValuesGC,
+	">":  vm.GreaterThanValuesGC,
+	">=": vm.GreaterEqualValuesGC,
+}
+
+// foldUnaryOps 可折叠的前缀运算符
+var foldUnaryOps = map[string]func(v vm.ValueGC) (vm.ValueGC, error){
+	"-": vm.NegateValueGC,
+	"!": vm.LogicalNotValueGC,
+}
+
+// foldProgram 就地折叠整个程序
+func foldProgram(program *parser1.Program) {
+	f := &folder{
+		bindings: make(map[string]int),
+		assigned: make(map[string]bool),
+	}
+	inspect(program, f.collect)
+	f.scopes = []map[string]vm.ValueGC{{}}
+	program.Statements = f.statements(program.Statements, true)
+}
+
+// folder 常量折叠状态
+type folder struct {
+	bindings map[string]int          // 名字在整个程序中被绑定的次数
+	assigned map[string]bool         // 被赋值语句修改过的名字
+	scopes   []map[string]vm.ValueGC // 每层函数中可替换的const，内层在后
+}
+
+// collect 统计绑定和赋值，决定哪些const可以替换
+func (f *folder) collect(node parser1.Node) bool {
+	switch node := node.(type) {
+	case *parser1.LetStatement:
+		f.bindings[node.Name.Value]++
+	case *parser1.ConstStatement:
+		f.bindings[node.Name.Value]++
+	case *parser1.AssignmentStatement:
+		f.bindings[node.Name.Value]++
+		f.assigned[node.Name.Value] = true
+	case *parser1.FunctionLiteral:
+		if node.Name != nil {
+			f.bindings[node.Name.Value]++
+		}
+		for _, param := range node.Parameters {
+			f.bindings[param.Value]++
+		}
+	case *parser1.TryStatement:
+		if node.CatchParam != nil {
+			f.bindings[node.CatchParam.Value]++
+		}
+	case *parser1.ImportStatement:
+		if node.Namespace != nil {
+			f.bindings[node.Namespace.Value]++
+		}
+		for _, spec := range node.Specifiers {
+			f.bindings[spec.Alias.Value]++
+		}
+	}
+	return true
+}
+
+func (f *folder) statements(stmts []parser1.Statement, topLevel bool) []parser1.Statement {
+	for i, stmt := range stmts {
+		stmts[i] = f.statement(stmt, topLevel)
+	}
+	return stmts
+}
+
+func (f *folder) block(block *parser1.BlockStatement) {
+	if block != nil {
+		block.Statements = f.statements(block.Statements, false)
+	}
+}
+
+// statement 折叠语句，topLevel表示语句位于程序或函数体的顶层
+func (f *folder) statement(stmt parser1.Statement, topLevel bool) parser1.Statement {
+	switch stmt := stmt.(type) {
+	case *parser1.LetStatement:
+		stmt.Value = f.expression(stmt.Value)
+	case *parser1.ConstStatement:
+		stmt.Value = f.expression(stmt.Value)
+		name := stmt.Name.Value
+		if value, ok := literalValue(stmt.Value); ok && topLevel && f.bindings[name] == 1 && !f.assigned[name] {
+			f.scopes[len(f.scopes)-1][name] = value
+		}
+	case *parser1.ReturnStatement:
+		stmt.ReturnValue = f.expression(stmt.ReturnValue)
+	case *parser1.ExpressionStatement:
+		stmt.Expression = f.expression(stmt.Expression)
+	case *parser1.BlockStatement:
+		f.block(stmt)
+	case *parser1.WhileStatement:
+		stmt.Condition = f.expression(stmt.Condition)
+		f.block(stmt.Body)
+	case *parser1.ForStatement:
+		if stmt.Init != nil {
+			stmt.Init = f.statement(stmt.Init, false)
+		}
+		stmt.Condition = f.expression(stmt.Condition)
+		stmt.Update = f.expression(stmt.Update)
+		f.block(stmt.Body)
+	case *parser1.TryStatement:
+		f.block(stmt.Body)
+		f.block(stmt.CatchBody)
+		f.block(stmt.Finally)
+	case *parser1.ThrowStatement:
+		stmt.Value = f.expression(stmt.Value)
+	case *parser1.ExportStatement:
+		stmt.Declaration = f.statement(stmt.Declaration, topLevel)
+	case parser1.Expression:
+		// 赋值语句和if语句同时也是表达式
+		if expr, ok := f.expression(stmt).(parser1.Statement); ok {
+			return expr
+		}
+	}
+	return stmt
+}
+
+// expression 折叠表达式，返回替换后的节点
+func (f *folder) expression(expr parser1.Expression) parser1.Expression {
+	switch expr := expr.(type) {
+	case *parser1.Identifier:
+		for i := len(f.scopes) - 1; i >= 0; i-- {
+			if value, ok := f.scopes[i][expr.Value]; ok {
+				return literalNode(value, expr.Token)
+			}
+		}
+	case *parser1.PrefixExpression:
+		expr.Right = f.expression(expr.Right)
+		if op, ok := foldUnaryOps[expr.Operator]; ok {
+			if right, ok := literalValue(expr.Right); ok {
+				if result, err := op(right); err == nil {
+					return literalNode(result, expr.Token)
+				}
+			}
+		}
+	case *parser1.InfixExpression:
+		expr.Left = f.expression(expr.Left)
+		expr.Right = f.expression(expr.Right)
+		if op, ok := foldBinaryOps[expr.Operator]; ok {
+			left, leftOK := literalValue(expr.Left)
+			right, rightOK := literalValue(expr.Right)
+			if leftOK && rightOK {
+				if result, err := op(left, right); err == nil {
+					return literalNode(result, expr.Token)
+				}
+				return expr
+			}
+		}
+		return simplify(expr)
+	case *parser1.AssignmentStatement:
+		expr.Value = f.expression(expr.Value)
+	case *parser1.IndexAssignmentStatement:
+		expr.Left = f.expression(expr.Left)
+		expr.Value = f.expression(expr.Value)
+	case *parser1.PropertyAssignmentStatement:
+		expr.Left.Object = f.expression(expr.Left.Object)
+		expr.Value = f.expression(expr.Value)
+	case *parser1.IfStatement:
+		expr.Condition = f.expression(expr.Condition)
+		f.block(expr.Consequence)
+		for _, elif := range expr.ElifBranches {
+			elif.Condition = f.expression(elif.Condition)
+			f.block(elif.Consequence)
+		}
+		f.block(expr.Alternative)
+	case *parser1.CallExpression:
+		f.call(expr)
+	case *parser1.FunctionLiteral:
+		f.function(expr)
+	case *parser1.DecoratedFunction:
+		for _, decorator := range expr.Decorators {
+			f.expressions(decorator.Arguments)
+			for _, named := range decorator.Named {
+				named.Value = f.expression(named.Value)
+			}
+		}
+		f.function(expr.Function)
+	case *parser1.ArrayLiteral:
+		f.expressions(expr.Elements)
+	case *parser1.ArrayConstructor:
+		expr.Capacity = f.expression(expr.Capacity)
+		expr.DefaultValue = f.expression(expr.DefaultValue)
+	case *parser1.IndexExpression:
+		expr.Left = f.expression(expr.Left)
+		expr.Index = f.expression(expr.Index)
+	case *parser1.PropertyExpression:
+		expr.Object = f.expression(expr.Object)
+	case *parser1.AwaitExpression:
+		expr.Expression = f.expression(expr.Expression)
+	case *parser1.YieldExpression:
+		expr.Expression = f.expression(expr.Expression)
+	case *parser1.ServiceCallExpression:
+		f.expressions(expr.Arguments)
+	case *parser1.PipeExpression:
+		expr.Left = f.expression(expr.Left)
+		// 右侧的形状决定如何调用，只折叠其中的参数
+		switch right := expr.Right.(type) {
+		case *parser1.CallExpression:
+			f.call(right)
+		case *parser1.ServiceCallExpression:
+			f.expressions(right.Arguments)
+		}
+	case *parser1.ObjectLiteral:
+		for _, entry := range expr.Entries {
+			switch entry.Kind {
+			case parser1.ObjectEntryComputed:
+				entry.Key = f.expression(entry.Key)
+				entry.Value = f.expression(entry.Value)
+			case parser1.ObjectEntryKeyValue, parser1.ObjectEntrySpread:
+				entry.Value = f.expression(entry.Value)
+			}
+		}
+	}
+	return expr
+}
+
+func (f *folder) expressions(exprs []parser1.Expression) {
+	for i, expr := range exprs {
+		exprs[i] = f.expression(expr)
+	}
+}
+
+// call 折叠调用的参数，被调用的标识符保持原样
+func (f *folder) call(expr *parser1.CallExpression) {
+	if _, ok := expr.Function.(*parser1.Identifier); !ok {
+		expr.Function = f.expression(expr.Function)
+	}
+	f.expressions(expr.Arguments)
+}
+
+// function 在新的函数作用域中折叠函数体
+func (f *folder) function(fn *parser1.FunctionLiteral) {
+	if fn == nil || fn.Body == nil {
+		return
+	}
+	f.scopes = append(f.scopes, map[string]vm.ValueGC{})
+	fn.Body.Statements = f.statements(fn.Body.Statements, true)
+	f.scopes = f.scopes[:len(f.scopes)-1]
+}
+
+// simplify 化简一侧为单位元的数值运算
+func simplify(expr *parser1.InfixExpression) parser1.Expression {
+	switch expr.Operator {
+	case "*":
+		if isNumberLiteral(expr.Right, 1) && isNumeric(expr.Left) {
+			return expr.Left
+		}
+		if isNumberLiteral(expr.Left, 1) && isNumeric(expr.Right) {
+			return expr.Right
+		}
+	case "/":
+		if isNumberLiteral(expr.Right, 1) && isNumeric(expr.Left) {
+			return expr.Left
+		}
+	case "+":
+		if isNumberLiteral(expr.Right, 0) && isNumeric(expr.Left) {
+			return expr.Left
+		}
+		if isNumberLiteral(expr.Left, 0) && isNumeric(expr.Right) {
+			return expr.Right
+		}
+	case "-":
+		if isNumberLiteral(expr.Right, 0) && isNumeric(expr.Left) {
+			return expr.Left
+		}
+	}
+	return expr
+}
+
+// isNumeric 报告表达式求值成功时是否一定得到数值
+func isNumeric(expr parser1.Expression) bool {
+	switch expr := expr.(type) {
+	case *parser1.IntegerLiteral, *parser1.FloatLiteral:
+		return true
+	case *parser1.PrefixExpression:
+		return expr.Operator == "-"
+	case *parser1.InfixExpression:
+		switch expr.Operator {
+		case "-", "*", "/", "%":
+			return true
+		case "+":
+			return isNumeric(expr.Left) && isNumeric(expr.Right)
+		}
+	}
+	return false
+}
+
+// isNumberLiteral 报告表达式是否是值为n的数值字面量
+func isNumberLiteral(expr parser1.Expression, n float64) bool {
+	switch expr := expr.(type) {
+	case *parser1.IntegerLiteral:
+		return float64(expr.Value) == n
+	case *parser1.FloatLiteral:
+		return expr.Value == n
+	}
+	return false
+}
+
+// literalValue 返回字面量节点编译后的常量值
+func literalValue(expr parser1.Expression) (vm.ValueGC, bool) {
+	switch expr := expr.(type) {
+	case *parser1.IntegerLiteral:
+		return vm.NewNumberValue(float64(expr.Value)), true
+	case *parser1.FloatLiteral:
+		return vm.NewNumberValue(expr.Value), true
+	case *parser1.StringLiteral:
+		return vm.NewStringValue(expr.Value), true
+	case *parser1.BooleanLiteral:
+		return vm.NewBoolValue(expr.Value), true
+	case *parser1.NullLiteral:
+		return vm.NewNilValue(), true
+	}
+	return vm.NewNilValue(), false
+}
+
+// literalNode 构造值为value的字面量节点，沿用被替换节点的源码位置
+func literalNode(value vm.ValueGC, at lexer1.Token) parser1.Expression {
+	tok := lexer1.Token{Line: at.Line, Column: at.Column, Position: at.Position}
+	switch value.Type() {
+	case vm.ValueGCTypeSmallInt:
+		n := int64(value.AsSmallInt())
+		tok.Type, tok.Literal = lexer1.INT, strconv.FormatInt(n, 10)
+		return &parser1.IntegerLiteral{Token: tok, Value: n}
+	case vm.ValueGCTypeDouble:
+		tok.Type, tok.Literal = lexer1.FLOAT, strconv.FormatFloat(value.AsDouble(), 'g', -1, 64)
+		return &parser1.FloatLiteral{Token: tok, Value: value.AsDouble()}
+	case vm.ValueGCTypeString:
+		tok.Type, tok.Literal = lexer1.STRING, value.AsString()
+		return &parser1.StringLiteral{Token: tok, Value: value.AsString()}
+	case vm.ValueGCTypeBool:
+		if value.AsBool() {
+			tok.Type, tok.Literal = lexer1.TRUE, "true"
+		} else {
+			tok.Type, tok.Literal = lexer1.FALSE, "false"
+		}
+		return &parser1.BooleanLiteral{Token: tok, Value: value.AsBool()}
+	default:
+		tok.Type, tok.Literal = lexer1.NULL, "null"
+		return &parser1.NullLiteral{Token: tok}
+	}
+}
+
+// constantCondition 报告条件是否是字面量，以及它的真假
+func constantCondition(expr parser1.Expression) (truthy bool, ok bool) {
+	value, ok := literalValue(expr)
+	if !ok {
+		return false, false
+	}
+	return value.IsTruthy(), true
+}
+
+// declaresVariables 报告语句块是否定义了变量（不进入嵌套函数体）。
+// 块不引入作用域，其中的定义在块之后仍然可见，这样的块不能作为死代码删除
+func (c *Compiler) declaresVariables(blocks ...*parser1.BlockStatement) bool {
+	declares := false
+	visit := func(node parser1.Node) bool {
+		switch node := node.(type) {
+		case *parser1.LetStatement, *parser1.ConstStatement, *parser1.ImportStatement:
+			declares = true
+		case *parser1.AssignmentStatement:
+			if !c.isDefined(node.Name.Value) {
+				declares = true
+			}
+		case *parser1.TryStatement:
+			if node.CatchParam != nil {
+				declares = true
+			}
+		case *parser1.FunctionLiteral:
+			if node.Name != nil {
+				declares = true
+			}
+			return false
+		}
+		return !declares
+	}
+	for _, block := range blocks {
+		if block != nil {
+			inspect(block, visit)
+		}
+	}
+	return declares
+}
+
+// isDefined 报告名字是否已在当前或外层符号表中定义，与Resolve不同，不会创建自由变量
+func (c *Compiler) isDefined(name string) bool {
+	for s := c.symbolTable; s != nil; s = s.Outer {
+		if _, ok := s.store[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// =============================================================================
+// AST遍历
+// =============================================================================
+
+// inspect 先序遍历AST，visit返回false时不进入该节点的子节点
+func inspect(node parser1.Node, visit func(parser1.Node) bool) {
+	if !visit(node) {
+		return
+	}
+	for _, child := range children(node) {
+		inspect(child, visit)
+	}
+}
+
+// children 返回节点的直接子节点，省略为nil的可选部分
+func children(node parser1.Node) []parser1.Node {
+	var nodes []parser1.Node
+	add := func(children ...parser1.Node) {
+		for _, child := range children {
+			if child != nil && !isNilNode(child) {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	addExprs := func(exprs []parser1.Expression) {
+		for _, expr := range exprs {
+			add(expr)
+		}
+	}
+
+	switch node := node.(type) {
+	case *parser1.Program:
+		for _, stmt := range node.Statements {
+			add(stmt)
+		}
+	case *parser1.BlockStatement:
+		for _, stmt := range node.Statements {
+			add(stmt)
+		}
+	case *parser1.LetStatement:
+		add(node.Value)
+	case *parser1.ConstStatement:
+		add(node.Value)
+	case *parser1.ReturnStatement:
+		add(node.ReturnValue)
+	case *parser1.ExpressionStatement:
+		add(node.Expression)
+	case *parser1.AssignmentStatement:
+		add(node.Value)
+	case *parser1.IndexAssignmentStatement:
+		add(node.Left, node.Value)
+	case *parser1.PropertyAssignmentStatement:
+		add(node.Left, node.Value)
+	case *parser1.IfStatement:
+		add(node.Condition, node.Consequence)
+		for _, elif := range node.ElifBranches {
+			add(elif.Condition, elif.Consequence)
+		}
+		add(node.Alternative)
+	case *parser1.WhileStatement:
+		add(node.Condition, node.Body)
+	case *parser1.ForStatement:
+		add(node.Init, node.Condition, node.Update, node.Body)
+	case *parser1.TryStatement:
+		add(node.Body, node.CatchBody, node.Finally)
+	case *parser1.ThrowStatement:
+		add(node.Value)
+	case *parser1.ExportStatement:
+		add(node.Declaration)
+	case *parser1.PrefixExpression:
+		add(node.Right)
+	case *parser1.InfixExpression:
+		add(node.Left, node.Right)
+	case *parser1.CallExpression:
+		add(node.Function)
+		addExprs(node.Arguments)
+	case *parser1.FunctionLiteral:
+		add(node.Body)
+	case *parser1.DecoratedFunction:
+		for _, decorator := range node.Decorators {
+			addExprs(decorator.Arguments)
+			for _, named := range decorator.Named {
+				add(named.Value)
+			}
+		}
+		add(node.Function)
+	case *parser1.ArrayLiteral:
+		addExprs(node.Elements)
+	case *parser1.ArrayConstructor:
+		add(node.Capacity, node.DefaultValue)
+	case *parser1.IndexExpression:
+		add(node.Left, node.Index)
+	case *parser1.PropertyExpression:
+		add(node.Object)
+	case *parser1.AwaitExpression:
+		add(node.Expression)
+	case *parser1.YieldExpression:
+		add(node.Expression)
+	case *parser1.ServiceCallExpression:
+		addExprs(node.Arguments)
+	case *parser1.PipeExpression:
+		add(node.Left, node.Right)
+	case *parser1.ObjectLiteral:
+		for _, entry := range node.Entries {
+			if entry.Kind == parser1.ObjectEntryComputed {
+				add(entry.Key)
+			}
+			if entry.Kind != parser1.ObjectEntryShorthand {
+				add(entry.Value)
+			}
+		}
+	}
+	return nodes
+}
+
+// isNilNode 报告接口中是否保存了nil指针（如未设置的 *BlockStatement 字段）
+func isNilNode(node parser1.Node) bool {
+	switch node := node.(type) {
+	case *parser1.BlockStatement:
+		return node == nil
+	case *parser1.FunctionLiteral:
+		return node == nil
+	case *parser1.PropertyExpression:
+		return node == nil
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package compiler1_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 常量折叠测试
+// =============================================================================
+
+func TestConstantFolding(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		output  string
+		absent  []string // 折叠后不应出现的指令
+		present []string // 反汇编中应出现的内容
+	}{
+		{
+			name:    "arithmetic",
+			source:  `print(1 + 2 * 3, 7 / 2, 7 % 3, 2147483647 + 1, -(-5))`,
+			output:  "7 3.5 1 2.147483648e+09 5\n",
+			absent:  []string{"ADD", "MUL", "DIV", "MOD", "NEG"},
+			present: []string{"=3.5", "=2.147483648e+09"},
+		},
+		{
+			name:   "comparison and logic",
+			source: `print(1 < 2, "a" >= "b", 1 == 1.0, "1" != 1, !0, !"x")`,
+			output: "true false true true true false\n",
+			absent: []string{"LT", "GTE", "EQ", "NEQ", "NOT"},
+		},
+		{
+			name:    "string concatenation",
+			source:  `print("v" + 1 + 2, "a" + "b")`,
+			output:  "v12 ab\n",
+			absent:  []string{"ADD"},
+			present: []string{`="v12"`},
+		},
+		{
+			name: "const bindings",
+			source: `const N = 2 * 3
+const NAME = "n=" + N
+function show() { return NAME }
+print(N + 1, show())`,
+			output:  "7 n=6\n",
+			absent:  []string{"ADD", "MUL", "GET_GLOBAL       R0"},
+			present: []string{"SET_GLOBAL"},
+		},
+		{
+			name: "reassigned const is not substituted",
+			source: `const N = 1
+N = 2
+print(N + 1)`,
+			output:  "3\n",
+			present: []string{"GET_GLOBAL", "ADD"},
+		},
+		{
+			name:    "runtime errors are kept",
+			source:  `try { print(1 / 0) } catch (e) { print(e.message) }`,
+			output:  "division by zero\n",
+			present: []string{"DIV"},
+		},
+		{
+			name: "dead branches",
+			source: `if (1 > 2) { print("a") } elif (2 > 1) { print("b") } else { print("c") }
+while (false) { print("never") }`,
+			output: "b\n",
+			absent: []string{"JUMP", `"a"`, `"c"`, `"never"`},
+		},
+		{
+			name: "infinite loop",
+			source: `let i = 0
+while (true) { i = i + 1; if (i == 3) { break } }
+print(i)`,
+			output: "3\n",
+			absent: []string{"true"},
+		},
+		{
+			name:    "identities on numbers",
+			source:  `let a = 3; let b = 4; print((a - b) * 1, 0 + (a * b), (a % b) / 1)`,
+			output:  "-1 12 3\n",
+			absent:  []string{"ADD", "DIV"},
+			present: []string{"SUB", "MUL", "MOD"},
+		},
+		{
+			name:    "identities keep string concatenation",
+			source:  `let s = "s"; print(s + 0); try { print(s * 1) } catch (e) { print("error") }`,
+			output:  "s0\nerror\n",
+			present: []string{"ADD", "MUL"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor, out := aqltest.NewExecutor()
+			function := aqltest.Compile(t, tt.source)
+			disassembly := vm.Disassemble(function)
+			for _, op := range tt.absent {
+				if strings.Contains(disassembly, op) {
+					t.Errorf("disassembly should not contain %q, got:\n%s", op, disassembly)
+				}
+			}
+			for _, want := range tt.present {
+				if !strings.Contains(disassembly, want) {
+					t.Errorf("disassembly should contain %q, got:\n%s", want, disassembly)
+				}
+			}
+
+			if _, err := executor.Execute(function, nil); err != nil {
+				t.Fatalf("execution failed: %v (output %q)", err, out.String())
+			}
+			if got := out.String(); got != tt.output {
+				t.Errorf("output should be %q, got %q", tt.output, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package compiler1
+
+import (
+	"fmt"
+
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// import / export 的编译
+//
+// import 只能出现在顶层，每个导入项编译为一条IMPORT指令并定义为全局变量：
+//
+//	import {a, b as c} from "./lib"   =>  IMPORT r K("./lib") K("a"); SET_GLOBAL r G(a)
+//	                                      IMPORT r K("./lib") K("b"); SET_GLOBAL r G(c)
+//	import * as lib from "./lib"      =>  IMPORT r K("./lib") -1;     SET_GLOBAL r G(lib)
+//
+// export 声明按普通声明编译，同时记录导出名对应的全局变量索引，由 Exports 返回给模块加载器。
+
+// compileImportStatement 编译import语句
+func (c *Compiler) compileImportStatement(stmt *parser1.ImportStatement) error {
+	if c.symbolTable.Outer != nil {
+		return &CompilationError{Message: "import must be at the top level", Node: stmt}
+	}
+
+	pathIndex := c.addConstant(vm.NewStringValue(stmt.Path.Value))
+	switch {
+	case stmt.Namespace != nil:
+		reg := c.allocateRegister()
+		c.emit(vm.OP_IMPORT, reg, pathIndex, -1)
+		c.defineVariable(stmt.Namespace.Value, reg)
+	case stmt.Specifiers != nil:
+		for _, spec := range stmt.Specifiers {
+			reg := c.allocateRegister()
+			c.emit(vm.OP_IMPORT, reg, pathIndex, c.addConstant(vm.NewStringValue(spec.Name.Value)))
+			c.defineVariable(spec.Alias.Value, reg)
+		}
+	default:
+		// 只执行模块，结果丢弃
+		c.emit(vm.OP_IMPORT, c.allocateRegister(), pathIndex, -1)
+	}
+
+	c.resetRegisters()
+	return nil
+}
+
+// compileExportStatement 编译export声明
+func (c *Compiler) compileExportStatement(stmt *parser1.ExportStatement) error {
+	if c.symbolTable.Outer != nil {
+		return &CompilationError{Message: "export must be at the top level", Node: stmt}
+	}
+
+	name := stmt.Name().Value
+	for _, export := range c.exports {
+		if export.Name == name {
+			return &CompilationError{Message: fmt.Sprintf("duplicate export %s", name), Node: stmt}
+		}
+	}
+
+	if err := c.compileStatement(stmt.Declaration); err != nil {
+		return err
+	}
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != GLOBAL_SCOPE {
+		return &CompilationError{Message: fmt.Sprintf("cannot export %s", name), Node: stmt}
+	}
+	c.exports = append(c.exports, vm.ModuleExport{Name: name, Index: symbol.Index})
+	return nil
+}
+
+// Exports 返回已编译的export声明，按声明顺序排列
+func (c *Compiler) Exports() []vm.ModuleExport {
+	return c.exports
+}
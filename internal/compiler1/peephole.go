@@ -0,0 +1,501 @@
+package compiler1
+
+import (
+	"fmt"
+
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 窥孔优化
+// =============================================================================
+
+// 设计原理：
+// - 在函数编译完成（leaveScope）后对指令流做局部改写，反复应用以下规则直到不再变化：
+//   1. 比较融合：EQ/LT 等比较紧跟读取其结果的 JUMP_IF_FALSE 时，合并为一条
+//      JUMP_IF_NOT_xx，比较结果仍写入原寄存器，不需要活跃性分析
+//   2. 跳转串联：跳转目标是无条件JUMP时直接跳到最终目标，被绕过后不可达的JUMP
+//      和跳到下一条指令的跳转删除
+//   3. MOVE链合并：X t, ...; MOVE d, t 且t之后不再被读取时改写为 X d, ...；
+//      MOVE r, r 和 SET_LOCAL r, r 删除
+//   4. 不可达指令删除：从入口和异常处理入口出发不可达的指令（如RETURN之后的隐式return）
+// - 删除指令后统一重映射相对跳转、异常处理表和行列号表，被删除位置的跳转落到其后第一条保留的指令
+// - 被跳转或异常处理表引用的位置是基本块边界，规则1和3不跨越边界
+// - 活跃性分析保守处理：未知指令视为读取全部寄存器；受保护区间内的指令在执行前
+//   就可能转到异常处理入口，因此处理入口活跃的寄存器在整个区间内都活跃；
+//   顶层函数结束时R0活跃（执行器把主函数的R0作为结果返回）
+// - 具名局部变量的寄存器不参与MOVE链合并，保持调试器中变量值的可观察性
+
+// PeepholeStats 窥孔优化统计，记录每条规则删除的指令数
+type PeepholeStats struct {
+	CompareFusion int // 与比较融合的JUMP_IF_FALSE
+	JumpThreading int // 串联后被绕过或跳到下一条指令的跳转
+	MoveChains    int // 合并到前一条指令或无效果的MOVE
+	Unreachable   int // 不可达的指令
+}
+
+// Total 返回删除的指令总数
+func (s PeepholeStats) Total() int {
+	return s.CompareFusion + s.JumpThreading + s.MoveChains + s.Unreachable
+}
+
+func (s PeepholeStats) String() string {
+	return fmt.Sprintf("compare fusion %d, jump threading %d, move chains %d, unreachable %d (%d instructions removed)",
+		s.CompareFusion, s.JumpThreading, s.MoveChains, s.Unreachable, s.Total())
+}
+
+// SetPeephole 启用或关闭窥孔优化（默认启用）
+func (c *Compiler) SetPeephole(enabled bool) {
+	c.noPeephole = !enabled
+}
+
+// PeepholeStats 返回本编译器编译的全部函数的窥孔优化统计
+func (c *Compiler) PeepholeStats() PeepholeStats {
+	return c.peepholeStats
+}
+
+// optimizeFunction 对编译完成的函数应用窥孔优化，topLevel表示程序的顶层函数
+func (c *Compiler) optimizeFunction(fn *vm.Function, topLevel bool) {
+	if c.noPeephole {
+		return
+	}
+	p := &peephole{fn: fn, topLevel: topLevel, stats: &c.peepholeStats}
+	for {
+		changed := p.fuseCompares()
+		changed = p.threadJumps() || changed
+		changed = p.collapseMoves() || changed
+		changed = p.removeUnreachable() || changed
+		if !changed {
+			return
+		}
+	}
+}
+
+// peephole 单个函数的窥孔优化状态
+type peephole struct {
+	fn       *vm.Function
+	topLevel bool
+	stats    *PeepholeStats
+}
+
+// isJump 报告指令是否是相对跳转
+func isJump(op vm.OpCode) bool {
+	switch op {
+	case vm.OP_JUMP, vm.OP_JUMP_IF_FALSE, vm.OP_JUMP_IF_TRUE, vm.OP_JUMP_IF_NOT_EQ, vm.OP_JUMP_IF_NOT_NEQ,
+		vm.OP_JUMP_IF_NOT_LT, vm.OP_JUMP_IF_NOT_GT, vm.OP_JUMP_IF_NOT_LTE, vm.OP_JUMP_IF_NOT_GTE:
+		return true
+	}
+	return false
+}
+
+// labels 标记被跳转或异常处理表引用的位置
+func (p *peephole) labels() []bool {
+	insts := p.fn.Instructions
+	labels := make([]bool, len(insts)+1)
+	mark := func(pc int) {
+		if pc >= 0 && pc < len(labels) {
+			labels[pc] = true
+		}
+	}
+	for pc, inst := range insts {
+		if isJump(inst.OpCode) {
+			mark(pc + inst.Bx)
+		}
+	}
+	for _, h := range p.fn.Handlers {
+		mark(h.StartPC)
+		mark(h.EndPC)
+		mark(h.HandlerPC)
+	}
+	return labels
+}
+
+// successors 返回正常控制流的后继位置，len(insts)表示执行到函数末尾
+func successors(pc int, inst vm.Instruction) []int {
+	switch {
+	case inst.OpCode == vm.OP_RETURN || inst.OpCode == vm.OP_HALT || inst.OpCode == vm.OP_THROW:
+		return nil
+	case inst.OpCode == vm.OP_JUMP:
+		return []int{pc + inst.Bx}
+	case isJump(inst.OpCode):
+		return []int{pc + 1, pc + inst.Bx}
+	default:
+		return []int{pc + 1}
+	}
+}
+
+// =============================================================================
+// 规则
+// =============================================================================
+
+// fuseCompares 将比较和读取其结果的JUMP_IF_FALSE融合为比较跳转指令
+func (p *peephole) fuseCompares() bool {
+	insts := p.fn.Instructions
+	labels := p.labels()
+	keep := keepAll(len(insts))
+	removed := 0
+	for pc := 0; pc+1 < len(insts); pc++ {
+		inst, next := insts[pc], insts[pc+1]
+		fused, ok := vm.CompareJumps[inst.OpCode]
+		if !ok || next.OpCode != vm.OP_JUMP_IF_FALSE || next.A != inst.A || labels[pc+1] {
+			continue
+		}
+		insts[pc] = vm.Instruction{OpCode: fused, A: inst.A, B: inst.B, C: inst.C, Bx: next.Bx + 1}
+		keep[pc+1] = false
+		removed++
+		pc++
+	}
+	p.stats.CompareFusion += removed
+	return p.compact(keep, removed)
+}
+
+// threadJumps 让跳转直接指向最终目标，并删除被绕过的JUMP和跳到下一条指令的跳转
+func (p *peephole) threadJumps() bool {
+	insts := p.fn.Instructions
+	changed := false
+	bypassed := make([]bool, len(insts))
+	for pc, inst := range insts {
+		if !isJump(inst.OpCode) {
+			continue
+		}
+		target := pc + inst.Bx
+		for hops := 0; hops < len(insts) && target >= 0 && target < len(insts) &&
+			insts[target].OpCode == vm.OP_JUMP && insts[target].Bx != 0; hops++ {
+			bypassed[target] = true
+			target += insts[target].Bx
+		}
+		if target != pc+inst.Bx {
+			insts[pc].Bx = target - pc
+			changed = true
+		}
+	}
+
+	// 被绕过后不再可达的JUMP随串联一起删除；比较跳转会写入结果寄存器，不能删除
+	reached := p.reachable()
+	keep := keepAll(len(insts))
+	removed := 0
+	for pc, inst := range insts {
+		switch {
+		case bypassed[pc] && !reached[pc]:
+		case (inst.OpCode == vm.OP_JUMP || inst.OpCode == vm.OP_JUMP_IF_FALSE || inst.OpCode == vm.OP_JUMP_IF_TRUE) && inst.Bx == 1:
+		default:
+			continue
+		}
+		keep[pc] = false
+		removed++
+	}
+	p.stats.JumpThreading += removed
+	return p.compact(keep, removed) || changed
+}
+
+// collapseMoves 把 MOVE d, t 合并到定义t的前一条指令，并删除无效果的移动
+func (p *peephole) collapseMoves() bool {
+	insts := p.fn.Instructions
+	labels := p.labels()
+	live := p.liveness()
+	keep := keepAll(len(insts))
+	removed := 0
+	for pc := 0; pc < len(insts); pc++ {
+		inst := insts[pc]
+		if (inst.OpCode == vm.OP_MOVE || inst.OpCode == vm.OP_SET_LOCAL) && inst.A == inst.B {
+			keep[pc] = false
+			removed++
+			continue
+		}
+		if pc+1 >= len(insts) || labels[pc+1] || !definesOnlyA(inst.OpCode) {
+			continue
+		}
+		next := insts[pc+1]
+		if next.OpCode != vm.OP_MOVE || next.B != inst.A || next.A == inst.A ||
+			p.isNamedLocal(inst.A) || live[pc+1].has(inst.A) {
+			continue
+		}
+		insts[pc].A = next.A
+		keep[pc+1] = false
+		removed++
+		pc++
+	}
+	p.stats.MoveChains += removed
+	return p.compact(keep, removed)
+}
+
+// removeUnreachable 删除从入口和异常处理入口都不可达的指令
+func (p *peephole) removeUnreachable() bool {
+	reached := p.reachable()
+	removed := 0
+	for _, r := range reached {
+		if !r {
+			removed++
+		}
+	}
+	p.stats.Unreachable += removed
+	return p.compact(reached, removed)
+}
+
+// reachable 返回从入口和异常处理入口出发可达的指令
+func (p *peephole) reachable() []bool {
+	insts := p.fn.Instructions
+	reached := make([]bool, len(insts))
+	work := []int{0}
+	for _, h := range p.fn.Handlers {
+		work = append(work, h.HandlerPC)
+	}
+	for len(work) > 0 {
+		pc := work[len(work)-1]
+		work = work[:len(work)-1]
+		if pc < 0 || pc >= len(insts) || reached[pc] {
+			continue
+		}
+		reached[pc] = true
+		work = append(work, successors(pc, insts[pc])...)
+	}
+	return reached
+}
+
+// isNamedLocal 报告寄存器是否保存具名局部变量
+func (p *peephole) isNamedLocal(reg int) bool {
+	names := p.fn.LocalNames
+	return reg < len(names) && names[reg] != ""
+}
+
+// =============================================================================
+// 删除指令与重映射
+// =============================================================================
+
+func keepAll(n int) []bool {
+	keep := make([]bool, n)
+	for i := range keep {
+		keep[i] = true
+	}
+	return keep
+}
+
+// compact 删除keep为false的指令，重映射跳转、异常处理表和行列号表
+func (p *peephole) compact(keep []bool, removed int) bool {
+	if removed == 0 {
+		return false
+	}
+	fn := p.fn
+	n := len(fn.Instructions)
+
+	// 被删除的位置映射到其后第一条保留的指令
+	newIndex := make([]int, n+1)
+	j := 0
+	for i := 0; i < n; i++ {
+		newIndex[i] = j
+		if keep[i] {
+			j++
+		}
+	}
+	newIndex[n] = j
+	remap := func(pc int) int {
+		if pc < 0 || pc > n {
+			return pc
+		}
+		return newIndex[pc]
+	}
+
+	insts := make([]vm.Instruction, 0, j)
+	var lines, columns []int
+	for pc, inst := range fn.Instructions {
+		if !keep[pc] {
+			continue
+		}
+		if isJump(inst.OpCode) {
+			inst.Bx = remap(pc+inst.Bx) - newIndex[pc]
+		}
+		insts = append(insts, inst)
+		if len(fn.LineNumbers) == n {
+			lines = append(lines, fn.LineNumbers[pc])
+		}
+		if len(fn.Columns) == n {
+			columns = append(columns, fn.Columns[pc])
+		}
+	}
+	fn.Instructions = insts
+	if len(fn.LineNumbers) == n {
+		fn.LineNumbers = lines
+	}
+	if len(fn.Columns) == n {
+		fn.Columns = columns
+	}
+	for i := range fn.Handlers {
+		h := &fn.Handlers[i]
+		h.StartPC, h.EndPC, h.HandlerPC = remap(h.StartPC), remap(h.EndPC), remap(h.HandlerPC)
+	}
+	return true
+}
+
+// =============================================================================
+// 寄存器活跃性
+// =============================================================================
+
+// regSet 寄存器位集合
+type regSet []uint64
+
+func (s regSet) add(r int) {
+	if r >= 0 && r/64 < len(s) {
+		s[r/64] |= 1 << (r % 64)
+	}
+}
+
+func (s regSet) remove(r int) {
+	if r >= 0 && r/64 < len(s) {
+		s[r/64] &^= 1 << (r % 64)
+	}
+}
+
+func (s regSet) has(r int) bool {
+	return r >= 0 && r/64 < len(s) && s[r/64]&(1<<(r%64)) != 0
+}
+
+// union 把other并入s，返回s是否变化
+func (s regSet) union(other regSet) bool {
+	changed := false
+	for i, w := range other {
+		if s[i]|w != s[i] {
+			s[i] |= w
+			changed = true
+		}
+	}
+	return changed
+}
+
+// liveness 返回每条指令执行后活跃的寄存器
+func (p *peephole) liveness() []regSet {
+	insts := p.fn.Instructions
+	n := len(insts)
+	words := (p.registerCount() + 63) / 64
+
+	liveIn := make([]regSet, n+1)
+	liveOut := make([]regSet, n)
+	for pc := range liveIn {
+		liveIn[pc] = make(regSet, words)
+	}
+	for pc := range liveOut {
+		liveOut[pc] = make(regSet, words)
+	}
+	if p.topLevel {
+		liveIn[n].add(0)
+	}
+
+	// exits 记录执行前就可能离开该指令的异常处理入口
+	exits := make([][]int, n)
+	for _, h := range p.fn.Handlers {
+		for pc := h.StartPC; pc < h.EndPC && pc < n; pc++ {
+			if pc >= 0 {
+				exits[pc] = append(exits[pc], h.HandlerPC)
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for pc := n - 1; pc >= 0; pc-- {
+			inst := insts[pc]
+			out := liveOut[pc]
+			if p.topLevel && (inst.OpCode == vm.OP_RETURN || inst.OpCode == vm.OP_HALT) {
+				out.add(0)
+			}
+			for _, next := range successors(pc, inst) {
+				if next >= 0 && next <= n {
+					out.union(liveIn[next])
+				}
+			}
+
+			in := make(regSet, words)
+			copy(in, out)
+			uses, useAll, def := registerEffects(inst)
+			in.remove(def)
+			if useAll {
+				for i := range in {
+					in[i] = ^uint64(0)
+				}
+			}
+			for _, r := range uses {
+				in.add(r)
+			}
+			for _, handler := range exits[pc] {
+				if handler >= 0 && handler < n {
+					in.union(liveIn[handler])
+				}
+			}
+			if liveIn[pc].union(in) {
+				changed = true
+			}
+		}
+	}
+	return liveOut
+}
+
+// registerCount 返回指令引用到的寄存器数量上限
+func (p *peephole) registerCount() int {
+	count := p.fn.MaxStackSize
+	for _, inst := range p.fn.Instructions {
+		uses, _, def := registerEffects(inst)
+		for _, r := range append(uses, def) {
+			if r+1 > count {
+				count = r + 1
+			}
+		}
+	}
+	return max(count, 1)
+}
+
+// definesOnlyA 报告指令是否只写入R(A)且A不作为输入，可以改写结果寄存器
+func definesOnlyA(op vm.OpCode) bool {
+	switch op {
+	case vm.OP_MOVE, vm.OP_LOADK, vm.OP_ADD, vm.OP_SUB, vm.OP_MUL, vm.OP_DIV, vm.OP_MOD,
+		vm.OP_EQ, vm.OP_NEQ, vm.OP_LT, vm.OP_GT, vm.OP_LTE, vm.OP_GTE, vm.OP_NOT, vm.OP_NEG,
+		vm.OP_GET_GLOBAL, vm.OP_GET_LOCAL, vm.OP_GET_UPVALUE, vm.OP_GET_FIELD, vm.OP_GET_INDEX,
+		vm.OP_ARRAY_GET, vm.OP_ARRAY_LEN, vm.OP_NEW_ARRAY, vm.OP_NEW_OBJECT, vm.OP_MAKE_CLOSURE,
+		vm.OP_IMPORT, vm.OP_CATCH:
+		return true
+	}
+	return false
+}
+
+// registerEffects 返回指令读取的寄存器、是否读取全部寄存器以及写入的寄存器（-1表示没有）
+func registerEffects(inst vm.Instruction) (uses []int, useAll bool, def int) {
+	span := func(from, to int) []int {
+		var regs []int
+		for r := from; r <= to; r++ {
+			regs = append(regs, r)
+		}
+		return regs
+	}
+
+	switch inst.OpCode {
+	case vm.OP_LOADK, vm.OP_GET_GLOBAL, vm.OP_GET_UPVALUE, vm.OP_NEW_ARRAY, vm.OP_NEW_OBJECT,
+		vm.OP_IMPORT, vm.OP_CATCH:
+		return nil, false, inst.A
+	case vm.OP_MOVE, vm.OP_GET_LOCAL, vm.OP_NOT, vm.OP_NEG, vm.OP_ARRAY_LEN, vm.OP_GET_FIELD,
+		vm.OP_AWAIT, vm.OP_YIELD, vm.OP_WEAK_REF, vm.OP_WEAK_GET:
+		return []int{inst.B}, false, inst.A
+	case vm.OP_ADD, vm.OP_SUB, vm.OP_MUL, vm.OP_DIV, vm.OP_MOD, vm.OP_EQ, vm.OP_NEQ, vm.OP_LT,
+		vm.OP_GT, vm.OP_LTE, vm.OP_GTE, vm.OP_NEW_ARRAY_WITH_CAPACITY, vm.OP_ARRAY_GET, vm.OP_GET_INDEX,
+		vm.OP_JUMP_IF_NOT_EQ, vm.OP_JUMP_IF_NOT_NEQ, vm.OP_JUMP_IF_NOT_LT, vm.OP_JUMP_IF_NOT_GT,
+		vm.OP_JUMP_IF_NOT_LTE, vm.OP_JUMP_IF_NOT_GTE:
+		return []int{inst.B, inst.C}, false, inst.A
+	case vm.OP_SET_LOCAL:
+		return []int{inst.A}, false, inst.B
+	case vm.OP_SET_GLOBAL, vm.OP_SET_UPVALUE, vm.OP_JUMP_IF_FALSE, vm.OP_JUMP_IF_TRUE, vm.OP_THROW:
+		return []int{inst.A}, false, -1
+	case vm.OP_ARRAY_SET, vm.OP_SET_INDEX:
+		return []int{inst.A, inst.B, inst.C}, false, -1
+	case vm.OP_SET_FIELD:
+		return []int{inst.A, inst.C}, false, -1
+	case vm.OP_SPREAD_OBJECT:
+		return []int{inst.A, inst.B}, false, -1
+	case vm.OP_CALL, vm.OP_ASYNC_CALL, vm.OP_SERVICE_CALL:
+		return span(inst.A, inst.A+inst.B-1), false, inst.A
+	case vm.OP_RETURN:
+		return span(inst.A, inst.A+inst.B-2), false, -1
+	case vm.OP_MAKE_CLOSURE:
+		return span(inst.B, inst.B+inst.C), false, inst.A
+	case vm.OP_JUMP, vm.OP_POP, vm.OP_HALT:
+		return nil, false, -1
+	default:
+		return nil, true, -1
+	}
+}
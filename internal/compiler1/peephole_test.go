@@ -0,0 +1,148 @@
+package compiler1_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/compiler1"
+	"github.com/zhnt/aql/internal/lexer1"
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 窥孔优化测试
+// =============================================================================
+
+// compilePeephole 编译源码，返回函数和窥孔优化统计
+func compilePeephole(t *testing.T, source string, enabled bool) (*vm.Function, compiler1.PeepholeStats) {
+	t.Helper()
+	aqltest.InitRuntime()
+	p := parser1.New(lexer1.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	c := compiler1.New()
+	c.SetPeephole(enabled)
+	function, err := c.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Verify(function); err != nil {
+		t.Fatalf("optimized=%v program should verify: %v", enabled, err)
+	}
+	return function, c.PeepholeStats()
+}
+
+func TestPeephole(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		output  string
+		removed func(compiler1.PeepholeStats) int // 应删除指令的规则
+		absent  []string
+		present []string
+	}{
+		{
+			name: "compare fusion",
+			source: `let i = 0
+while (i < 3) { if (i == 1) { i = i + 2 } else { i = i + 1 } }
+print(i)`,
+			output:  "3\n",
+			removed: func(s compiler1.PeepholeStats) int { return s.CompareFusion },
+			absent:  []string{"JUMP_IF_FALSE"},
+			present: []string{"JUMP_IF_NOT_LT", "JUMP_IF_NOT_EQ"},
+		},
+		{
+			name: "jump threading",
+			source: `let i = 0
+while (i < 5) {
+  i = i + 1
+  while (true) {
+    if (i > 2) { break }
+    break
+  }
+}
+print(i)`,
+			output:  "5\n",
+			removed: func(s compiler1.PeepholeStats) int { return s.JumpThreading },
+		},
+		{
+			name: "move chains",
+			source: `function f(a, b) {
+  let c = a + b
+  return c * 2
+}
+print(f(1, 2))`,
+			output:  "6\n",
+			removed: func(s compiler1.PeepholeStats) int { return s.MoveChains },
+		},
+		{
+			name: "unreachable after return",
+			source: `function f(n) {
+  return n * 2
+  print("never")
+}
+print(f(2))`,
+			output:  "4\n",
+			removed: func(s compiler1.PeepholeStats) int { return s.Unreachable },
+			absent:  []string{`="never"`},
+		},
+		{
+			name: "exception handlers are remapped",
+			source: `function f(n) {
+  try {
+    if (n > 1) { throw "big" }
+    return n
+  } catch (e) {
+    return e
+  }
+}
+print(f(1), f(2))`,
+			output:  "1 big\n",
+			removed: func(s compiler1.PeepholeStats) int { return s.Total() },
+			present: []string{"handler", "JUMP_IF_NOT_GT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, stats := compilePeephole(t, tt.source, false)
+			if stats.Total() != 0 {
+				t.Errorf("disabled peephole should not remove instructions, got %s", stats)
+			}
+			optimized, stats := compilePeephole(t, tt.source, true)
+			if tt.removed(stats) == 0 {
+				t.Errorf("rule should remove instructions, got %s", stats)
+			}
+			if len(optimized.Instructions) > len(plain.Instructions) {
+				t.Errorf("optimized program has %d instructions, unoptimized %d",
+					len(optimized.Instructions), len(plain.Instructions))
+			}
+
+			disassembly := vm.Disassemble(optimized)
+			for _, op := range tt.absent {
+				if strings.Contains(disassembly, op) {
+					t.Errorf("disassembly should not contain %q, got:\n%s", op, disassembly)
+				}
+			}
+			for _, want := range tt.present {
+				if !strings.Contains(disassembly, want) {
+					t.Errorf("disassembly should contain %q, got:\n%s", want, disassembly)
+				}
+			}
+
+			for _, function := range []*vm.Function{plain, optimized} {
+				executor, out := aqltest.NewExecutor()
+				if _, err := executor.Execute(function, nil); err != nil {
+					t.Fatalf("script failed: %v\noutput so far:\n%s", err, out.String())
+				}
+				if got := out.String(); got != tt.output {
+					t.Errorf("output should be %q, got %q", tt.output, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package compiler1_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/compiler1"
+	"github.com/zhnt/aql/internal/lexer1"
+	"github.com/zhnt/aql/internal/parser1"
+)
+
+// =============================================================================
+// 管道运算符测试
+// =============================================================================
+
+func TestPipe(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		output string
+	}{
+		{
+			name:   "call with arguments",
+			source: `function sub(a, b) { return a - b }; print(10 |> sub(3))`,
+			output: "7\n",
+		},
+		{
+			name:   "bare function",
+			source: `function double(n) { return n * 2 }; let f = double; print(4 |> double, 5 |> f)`,
+			output: "8 10\n",
+		},
+		{
+			name: "chaining",
+			source: `function add(a, b) { return a + b }
+function double(n) { return n * 2 }
+print(1 |> add(2) |> double |> add(1) |> str)`,
+			output: "7\n",
+		},
+		{
+			name: "property and function literal",
+			source: `let m = {inc: function(n) { return n + 1 }}
+print(1 |> m.inc, 2 |> function(n) { return n * n })`,
+			output: "2 4\n",
+		},
+		{
+			name: "evaluation order",
+			source: `function log(v) { print("eval", v); return v }
+function pair(a, b) { return [a, b] }
+print(log(1) |> pair(log(2)))`,
+			output: "eval 1\neval 2\n[1, 2]\n",
+		},
+		{
+			name:   "builtins",
+			source: `print([1, 2, 3] |> len, "x" |> type)`,
+			output: "3 string\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor, out := aqltest.NewExecutor()
+			if got := aqltest.Run(t, executor, out, tt.source); got != tt.output {
+				t.Errorf("output should be %q, got %q", tt.output, got)
+			}
+		})
+	}
+}
+
+func TestPipeIntoLiteral(t *testing.T) {
+	aqltest.InitRuntime()
+	for _, source := range []string{`1 |> 2`, `1 |> "f"`, `1 |> [print]`} {
+		p := parser1.New(lexer1.New(source))
+		program := p.ParseProgram()
+		if errs := p.Errors(); len(errs) > 0 {
+			t.Fatalf("%q: parse errors: %v", source, errs)
+		}
+		_, err := compiler1.New().Compile(program)
+		if err == nil || !strings.Contains(err.Error(), "cannot pipe into") {
+			t.Errorf("%q should fail to compile, got %v", source, err)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package compiler1
 
+import "github.com/zhnt/aql/internal/vm"
+
 // SymbolScope 符号作用域类型
 type SymbolScope string
 
@@ -35,6 +37,17 @@ func NewSymbolTable() *SymbolTable {
 	}
 }
 
+// NewBuiltinSymbolTable 创建全局符号表，并定义所有已注册的原生函数
+func NewBuiltinSymbolTable() *SymbolTable {
+	s := NewSymbolTable()
+	for i, native := range vm.NativeFunctions() {
+		if !native.Anonymous {
+			s.DefineBuiltin(i, native.Name)
+		}
+	}
+	return s
+}
+
 // NewEnclosedSymbolTable 创建封闭的符号表（用于函数作用域）
 func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	s := NewSymbolTable()
@@ -0,0 +1,22 @@
+package gc
+
+import "fmt"
+
+// DebugLogger GC调试信息输出函数，category为信息分类
+type DebugLogger func(category, message string)
+
+// debugLogger 当前的调试信息输出函数，nil表示不输出
+var debugLogger DebugLogger
+
+// SetDebugLogger 设置GC管理器的调试信息输出函数，nil表示关闭调试输出
+func SetDebugLogger(logger DebugLogger) {
+	debugLogger = logger
+}
+
+// debugf 输出GC调试信息
+func debugf(category, format string, args ...interface{}) {
+	if debugLogger == nil {
+		return
+	}
+	debugLogger(category, fmt.Sprintf(format, args...))
+}
@@ -500,22 +500,26 @@ func (ua *UnifiedAllocator) Deallocate(obj *GCObject) {
 
 	// 添加到合适的空闲列表
 	if sizeClass >= 0 {
-		// Size Class释放：添加到快速路径
 		block := &FreeBlock{
 			ptr:       ptr,
 			size:      totalSize,
 			sizeClass: sizeClass,
 			allocID:   atomic.LoadUint64(&ua.stats.LastAllocID),
-			next:      ua.fastPath[totalSize],
 		}
-		ua.fastPath[totalSize] = block
 
-		// 同时添加到Size Class的空闲链表
-		sca := ua.sizeClasses[sizeClass]
-		sca.mutex.Lock()
-		block.next = sca.freeList
-		sca.freeList = block
-		sca.mutex.Unlock()
+		// 一个块只能放进一个空闲链表，否则快速路径和Size Class会把同一块内存分配两次
+		if ua.enableFastPath {
+			// Size Class释放：添加到快速路径
+			block.next = ua.fastPath[totalSize]
+			ua.fastPath[totalSize] = block
+		} else {
+			// 未启用快速路径：添加到Size Class的空闲链表
+			sca := ua.sizeClasses[sizeClass]
+			sca.mutex.Lock()
+			block.next = sca.freeList
+			sca.freeList = block
+			sca.mutex.Unlock()
+		}
 	} else {
 		// 大对象释放：添加到普通空闲块列表
 		block := &FreeBlock{
@@ -0,0 +1,31 @@
+package gc
+
+import "testing"
+
+// =============================================================================
+// 统一分配器测试
+// =============================================================================
+
+func TestDeallocatedBlockReusedOnce(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		ua := NewUnifiedAllocator(false)
+		ua.EnableFastPath(fastPath)
+
+		freed := ua.Allocate(64, ObjectTypeString)
+		ua.Deallocate(freed)
+
+		// 释放的块只能被复用一次，分配数超过一页的块数以耗尽快速路径
+		seen := make(map[*GCObject]bool)
+		for i := 0; i < 256; i++ {
+			obj := ua.Allocate(64, ObjectTypeString)
+			if obj == nil {
+				t.Fatalf("fast path %v: allocation %d failed", fastPath, i)
+			}
+			if seen[obj] {
+				t.Fatalf("fast path %v: block %p allocated twice", fastPath, obj)
+			}
+			seen[obj] = true
+		}
+		ua.Destroy()
+	}
+}
@@ -1,7 +1,6 @@
 package gc
 
 import (
-	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -115,7 +114,7 @@ func NewUnifiedGCManager(allocator AQLAllocator, config *UnifiedGCConfig) *Unifi
 
 	// 如果没有提供分配器，创建新的统一分配器
 	if allocator == nil {
-		fmt.Printf("DEBUG [UnifiedGCManager] 创建新的统一分配器\n")
+		debugf("UnifiedGCManager", "创建新的统一分配器")
 		allocator = NewAQLUnifiedAllocator(true) // 启用调试
 	}
 
@@ -141,7 +140,7 @@ func NewUnifiedGCManager(allocator AQLAllocator, config *UnifiedGCConfig) *Unifi
 	// 启动GC工作线程
 	mgr.startWorkers()
 
-	fmt.Printf("DEBUG [UnifiedGCManager] GC管理器创建完成，使用分配器类型: %T\n", allocator)
+	debugf("UnifiedGCManager", "GC管理器创建完成，使用分配器类型: %T", allocator)
 
 	return mgr
 }
@@ -247,35 +246,35 @@ func (mgr *UnifiedGCManager) shouldTriggerGC() bool {
 	freedBytes := atomic.LoadUint64(&mgr.stats.FreedBytes)
 	liveBytes := allocatedBytes - freedBytes
 
-	fmt.Printf("DEBUG [shouldTriggerGC] 内存检查: allocated=%d, freed=%d, live=%d, limit=%d\n",
+	debugf("shouldTriggerGC", "内存检查: allocated=%d, freed=%d, live=%d, limit=%d",
 		allocatedBytes, freedBytes, liveBytes, mgr.config.MemoryPressureLimit)
 
 	if liveBytes > mgr.config.MemoryPressureLimit {
-		fmt.Printf("DEBUG [shouldTriggerGC] 触发GC: 内存压力过大\n")
+		debugf("shouldTriggerGC", "触发GC: 内存压力过大")
 		return true
 	}
 
 	// 检查对象数量
 	trackedObjects := mgr.markSweepGC.GetTrackedObjectCount()
-	fmt.Printf("DEBUG [shouldTriggerGC] 对象数量检查: tracked=%d, limit=%d\n",
+	debugf("shouldTriggerGC", "对象数量检查: tracked=%d, limit=%d",
 		trackedObjects, mgr.config.ObjectCountLimit)
 
 	if trackedObjects > mgr.config.ObjectCountLimit {
-		fmt.Printf("DEBUG [shouldTriggerGC] 触发GC: 对象数量过多\n")
+		debugf("shouldTriggerGC", "触发GC: 对象数量过多")
 		return true
 	}
 
 	// 检查时间间隔
 	timeSinceLastGC := time.Since(mgr.lastFullGC)
-	fmt.Printf("DEBUG [shouldTriggerGC] 时间检查: since_last=%v, interval=%v\n",
+	debugf("shouldTriggerGC", "时间检查: since_last=%v, interval=%v",
 		timeSinceLastGC, mgr.config.FullGCInterval)
 
 	if timeSinceLastGC > mgr.config.FullGCInterval {
-		fmt.Printf("DEBUG [shouldTriggerGC] 触发GC: 时间间隔过长\n")
+		debugf("shouldTriggerGC", "触发GC: 时间间隔过长")
 		return true
 	}
 
-	fmt.Printf("DEBUG [shouldTriggerGC] 不触发GC\n")
+	debugf("shouldTriggerGC", "不触发GC")
 	return false
 }
 
@@ -509,21 +508,21 @@ func (mgr *UnifiedGCManager) GetGCGeneration() uint64 {
 
 // Allocate 分配GC对象（统一入口）
 func (mgr *UnifiedGCManager) Allocate(size int, objType uint8) *GCObject {
-	fmt.Printf("DEBUG [UnifiedGCManager] Allocate被调用: size=%d, objType=%d\n", size, objType)
+	debugf("UnifiedGCManager", "Allocate被调用: size=%d, objType=%d", size, objType)
 
 	if !mgr.isEnabled {
-		fmt.Printf("DEBUG [UnifiedGCManager] GC管理器未启用\n")
+		debugf("UnifiedGCManager", "GC管理器未启用")
 		return nil
 	}
 
 	// 通过底层分配器分配普通内存
 	obj := mgr.allocator.Allocate(uint32(size), ObjectType(objType))
 	if obj == nil {
-		fmt.Printf("DEBUG [UnifiedGCManager] 分配失败\n")
+		debugf("UnifiedGCManager", "分配失败")
 		return nil
 	}
 
-	fmt.Printf("DEBUG [UnifiedGCManager] 分配成功: obj=%p\n", obj)
+	debugf("UnifiedGCManager", "分配成功: obj=%p", obj)
 
 	// 通知GC管理器有新对象分配
 	mgr.OnObjectAllocated(obj)
@@ -533,21 +532,21 @@ func (mgr *UnifiedGCManager) Allocate(size int, objType uint8) *GCObject {
 
 // AllocateIsolated 分配独立对象（避免内存复用）
 func (mgr *UnifiedGCManager) AllocateIsolated(size int, objType uint8) *GCObject {
-	fmt.Printf("DEBUG [UnifiedGCManager] AllocateIsolated被调用: size=%d, objType=%d\n", size, objType)
+	debugf("UnifiedGCManager", "AllocateIsolated被调用: size=%d, objType=%d", size, objType)
 
 	if !mgr.isEnabled {
-		fmt.Printf("DEBUG [UnifiedGCManager] GC管理器未启用\n")
+		debugf("UnifiedGCManager", "GC管理器未启用")
 		return nil
 	}
 
 	// 通过底层分配器分配独立内存
 	obj := mgr.allocator.AllocateIsolated(uint32(size), ObjectType(objType))
 	if obj == nil {
-		fmt.Printf("DEBUG [UnifiedGCManager] 独立分配失败\n")
+		debugf("UnifiedGCManager", "独立分配失败")
 		return nil
 	}
 
-	fmt.Printf("DEBUG [UnifiedGCManager] 独立分配成功: obj=%p\n", obj)
+	debugf("UnifiedGCManager", "独立分配成功: obj=%p", obj)
 
 	// 通知GC管理器有新对象分配
 	mgr.OnObjectAllocated(obj)
@@ -561,7 +560,7 @@ func (mgr *UnifiedGCManager) Deallocate(obj *GCObject) {
 		return
 	}
 
-	fmt.Printf("DEBUG [UnifiedGCManager] Deallocate被调用: obj=%p, refCount=%d\n", obj, obj.Header.RefCount())
+	debugf("UnifiedGCManager", "Deallocate被调用: obj=%p, refCount=%d", obj, obj.Header.RefCount())
 
 	// 通知GC管理器对象即将被释放
 	mgr.OnObjectFreed(obj)
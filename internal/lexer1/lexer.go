@@ -54,6 +54,14 @@ func (l *Lexer) peekChar() byte {
 	return l.input[l.readPosition]
 }
 
+// peekCharAt 查看下一个字符之后第offset个字符但不移动指针
+func (l *Lexer) peekCharAt(offset int) byte {
+	if l.readPosition+offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPosition+offset]
+}
+
 // skipWhitespace 跳过空白字符
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
@@ -202,7 +210,14 @@ func (l *Lexer) NextToken() Token {
 	case ':':
 		tok = NewToken(COLON, string(l.ch), line, column, l.position)
 	case '.':
-		tok = NewToken(DOT, string(l.ch), line, column, l.position)
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			position := l.position
+			l.readChar()
+			l.readChar()
+			tok = NewToken(ELLIPSIS, "...", line, column, position)
+		} else {
+			tok = NewToken(DOT, string(l.ch), line, column, l.position)
+		}
 	case '(':
 		tok = NewToken(LPAREN, string(l.ch), line, column, l.position)
 	case ')':
@@ -43,6 +43,7 @@ const (
 	SEMICOLON // ;
 	COLON     // :
 	DOT       // .
+	ELLIPSIS  // ...
 
 	// 括号
 	LPAREN   // (
@@ -163,6 +164,8 @@ func (t TokenType) String() string {
 		return "COLON"
 	case DOT:
 		return "DOT"
+	case ELLIPSIS:
+		return "ELLIPSIS"
 	case LPAREN:
 		return "LPAREN"
 	case RPAREN:
@@ -0,0 +1,364 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// MCP客户端
+// =============================================================================
+
+// ProtocolVersion 客户端请求的MCP协议版本
+const ProtocolVersion = "2024-11-05"
+
+// Implementation 客户端或服务器的名称和版本
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Tool 服务器提供的工具
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// Content 工具结果中的一项内容
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// ToolResult tools/call 的结果
+type ToolResult struct {
+	Content           []Content   `json:"content"`
+	StructuredContent interface{} `json:"structuredContent,omitempty"`
+	IsError           bool        `json:"isError,omitempty"`
+}
+
+// InitializeResult initialize 的结果
+type InitializeResult struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ServerInfo      Implementation         `json:"serverInfo"`
+	Instructions    string                 `json:"instructions,omitempty"`
+}
+
+// ServerConfig 以子进程启动的MCP服务器
+type ServerConfig struct {
+	Command string    // 可执行文件
+	Args    []string  // 参数
+	Env     []string  // 追加的环境变量（KEY=VALUE）
+	Dir     string    // 工作目录，空表示当前目录
+	Stderr  io.Writer // 服务器的stderr，nil时转发到os.Stderr
+}
+
+// Client MCP客户端，同时实现 vm.ServiceProvider：
+// @server.tool_name(args) 调用同名工具（工具名中的 - 和 . 可以写成 _）
+type Client struct {
+	conn   *Conn
+	closer io.Closer // 关闭写端，让服务器读到EOF
+	cmd    *exec.Cmd // 子进程，进程内连接时为nil
+
+	mu     sync.Mutex
+	server InitializeResult
+	tools  []Tool
+}
+
+// Start 启动服务器子进程，完成初始化握手并获取工具列表
+func Start(ctx context.Context, config ServerConfig) (*Client, error) {
+	if config.Command == "" {
+		return nil, fmt.Errorf("mcp: server command is empty")
+	}
+
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Dir = config.Dir
+	cmd.Env = append(os.Environ(), config.Env...)
+	cmd.Stderr = config.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("mcp: start %s: %w", config.Command, err)
+	}
+
+	client := newClient(stdout, stdin)
+	client.cmd = cmd
+	if err := client.Initialize(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewClient 在已建立的连接上创建客户端（如进程内管道），调用者需要再调用 Initialize
+func NewClient(r io.Reader, w io.WriteCloser) *Client {
+	return newClient(r, w)
+}
+
+func newClient(r io.Reader, w io.WriteCloser) *Client {
+	client := &Client{closer: w}
+	client.conn = NewConn(r, w, client.handle)
+	return client
+}
+
+// handle 响应服务器发来的请求：只支持 ping
+func (c *Client) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "ping":
+		return struct{}{}, nil
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + method}
+	}
+}
+
+// Initialize 执行初始化握手并获取工具列表
+func (c *Client) Initialize(ctx context.Context) error {
+	params := map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      Implementation{Name: "aql", Version: "0.1.0"},
+	}
+
+	var result InitializeResult
+	if err := c.conn.Call(ctx, "initialize", params, &result); err != nil {
+		return fmt.Errorf("mcp: initialize: %w", err)
+	}
+	if err := c.conn.Notify("notifications/initialized", nil); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.server = result
+	c.mu.Unlock()
+
+	_, err := c.ListTools(ctx)
+	return err
+}
+
+// ServerInfo 返回初始化时服务器报告的信息
+func (c *Client) ServerInfo() InitializeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.server
+}
+
+// ListTools 获取服务器的全部工具（自动翻页）并更新缓存
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		var params interface{}
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor,omitempty"`
+		}
+		if err := c.conn.Call(ctx, "tools/list", params, &page); err != nil {
+			return nil, fmt.Errorf("mcp: tools/list: %w", err)
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	c.mu.Lock()
+	c.tools = tools
+	c.mu.Unlock()
+	return tools, nil
+}
+
+// Tools 返回缓存的工具列表
+func (c *Client) Tools() []Tool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tools := make([]Tool, len(c.tools))
+	copy(tools, c.tools)
+	return tools
+}
+
+// CallTool 调用工具
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*ToolResult, error) {
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
+	params := map[string]interface{}{"name": name, "arguments": arguments}
+
+	var result ToolResult
+	if err := c.conn.Call(ctx, "tools/call", params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close 关闭连接并等待子进程退出，超时后强制结束
+func (c *Client) Close() error {
+	err := c.closer.Close()
+	if c.cmd == nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- c.cmd.Wait() }()
+	select {
+	case waitErr := <-exited:
+		if err == nil {
+			err = waitErr
+		}
+	case <-time.After(2 * time.Second):
+		c.cmd.Process.Kill()
+		<-exited
+	}
+	return err
+}
+
+// findTool 按名字查找工具，脚本中的 _ 可以匹配工具名中的 - 和 .
+func (c *Client) findTool(method string) (Tool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tool := range c.tools {
+		if tool.Name == method {
+			return tool, true
+		}
+	}
+	for _, tool := range c.tools {
+		if identifierName(tool.Name) == method {
+			return tool, true
+		}
+	}
+	return Tool{}, false
+}
+
+// identifierName 把工具名转换为可以出现在 @server.name() 中的标识符
+func identifierName(name string) string {
+	return strings.NewReplacer("-", "_", ".", "_").Replace(name)
+}
+
+// Call 实现 vm.ServiceProvider
+//
+// 参数映射：
+//   - 没有参数：空参数对象
+//   - 一个对象参数：作为工具的参数对象
+//   - 其他情况：按输入schema中 required 列表的顺序把位置参数映射为具名参数
+//
+// 结果映射：有 structuredContent 时返回它；内容全为文本时返回以换行连接的文本；
+// 否则返回内容数组。isError 的结果作为 ToolError 抛出。
+func (c *Client) Call(ctx context.Context, method string, args []interface{}) (interface{}, error) {
+	tool, ok := c.findTool(method)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", vm.ErrUnknownMethod, method)
+	}
+
+	arguments, err := toolArguments(tool, args)
+	if err != nil {
+		return nil, &vm.ServiceError{Name: "TypeError", Message: err.Error()}
+	}
+
+	result, err := c.CallTool(ctx, tool.Name, arguments)
+	if err != nil {
+		var rpcErr *Error
+		if errors.As(err, &rpcErr) {
+			return nil, &vm.ServiceError{
+				Name:    "MCPError",
+				Message: rpcErr.Message,
+				Details: map[string]interface{}{"code": rpcErr.Code},
+				Err:     err,
+			}
+		}
+		return nil, err
+	}
+
+	if result.IsError {
+		return nil, &vm.ServiceError{Name: "ToolError", Message: contentText(result.Content)}
+	}
+	if result.StructuredContent != nil {
+		return result.StructuredContent, nil
+	}
+
+	for _, content := range result.Content {
+		if content.Type != "text" {
+			items := make([]interface{}, len(result.Content))
+			for i, item := range result.Content {
+				items[i] = map[string]interface{}{
+					"type":     item.Type,
+					"text":     item.Text,
+					"data":     item.Data,
+					"mimeType": item.MimeType,
+				}
+			}
+			return items, nil
+		}
+	}
+	return contentText(result.Content), nil
+}
+
+// toolArguments 把脚本参数映射为工具的参数对象
+func toolArguments(tool Tool, args []interface{}) (map[string]interface{}, error) {
+	if len(args) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	if len(args) == 1 {
+		if object, ok := args[0].(map[string]interface{}); ok {
+			return object, nil
+		}
+	}
+
+	var names []string
+	if required, ok := tool.InputSchema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if s, ok := name.(string); ok {
+				names = append(names, s)
+			}
+		}
+	}
+	if len(args) > len(names) {
+		return nil, fmt.Errorf("tool %s takes %d positional argument(s) (%s), got %d; pass an object for optional parameters",
+			tool.Name, len(names), strings.Join(names, ", "), len(args))
+	}
+
+	arguments := make(map[string]interface{}, len(args))
+	for i, arg := range args {
+		arguments[names[i]] = arg
+	}
+	return arguments, nil
+}
+
+// contentText 连接所有文本内容
+func contentText(contents []Content) string {
+	texts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		if content.Type == "text" {
+			texts = append(texts, content.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
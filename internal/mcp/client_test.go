@@ -0,0 +1,144 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// fakeServer 测试用MCP服务器二进制（testdata/fakemcp）的路径
+var fakeServer string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "aql-mcp-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fakeServer = filepath.Join(dir, "fakemcp")
+	if runtime.GOOS == "windows" {
+		fakeServer += ".exe"
+	}
+	build := exec.Command("go", "build", "-o", fakeServer, "./testdata/fakemcp")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "build fake MCP server:", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// startFake 启动测试服务器，测试结束时关闭
+func startFake(t *testing.T) *Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := Start(ctx, ServerConfig{Command: fakeServer})
+	if err != nil {
+		t.Fatalf("start fake server: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// =============================================================================
+// 客户端测试
+// =============================================================================
+
+func TestClientHandshake(t *testing.T) {
+	client := startFake(t)
+
+	info := client.ServerInfo()
+	if info.ServerInfo.Name != "fakemcp" || info.ProtocolVersion != ProtocolVersion {
+		t.Errorf("unexpected server info: %+v", info)
+	}
+
+	var names []string
+	for _, tool := range client.Tools() {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, ","); got != "echo,add,read-file,fail,image,crash" {
+		t.Errorf("tools from both pages expected, got %s", got)
+	}
+}
+
+func TestClientCallTool(t *testing.T) {
+	client := startFake(t)
+
+	result, err := client.CallTool(context.Background(), "echo", map[string]interface{}{"text": "hello"})
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if len(result.Content) != 1 || result.Content[0].Text != "hello" || result.IsError {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	_, err = client.CallTool(context.Background(), "missing", nil)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeInvalidParams {
+		t.Errorf("unknown tool should return a JSON-RPC error, got %v", err)
+	}
+}
+
+func TestClientServerExit(t *testing.T) {
+	client := startFake(t)
+
+	_, err := client.CallTool(context.Background(), "crash", nil)
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("call should fail with ErrClosed when the server exits, got %v", err)
+	}
+	if _, err := client.CallTool(context.Background(), "echo", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("calls after exit should fail with ErrClosed, got %v", err)
+	}
+}
+
+func TestClientAsService(t *testing.T) {
+	client := startFake(t)
+
+	out, err := aqltest.RunScript(t, `
+print(@fake.echo("hi"))
+print(@fake.echo({text: "object"}))
+print(@fake.add(2, 3).sum)
+print(@fake.read_file("/tmp/x"))
+let parts = @fake.image()
+print(len(parts), parts[1].mimeType)
+"piped" |> @fake.echo() |> print
+try { @fake.fail() } catch (e) { print(e.name, e.message) }
+try { @fake.nope() } catch (e) { print(e.name, e.message) }
+try { @fake.echo(1, 2) } catch (e) { print(e.name) }
+`, map[string]vm.ServiceProvider{"fake": client})
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"hi",
+		"object",
+		"5",
+		"contents of /tmp/x",
+		"2 image/png",
+		"piped",
+		"ToolError @fake.fail: tool failed on purpose",
+		"ServiceError @fake.nope: service @fake has no method nope",
+		"TypeError",
+	}, "\n") + "\n"
+	if out != want {
+		t.Errorf("output should be\n%s\ngot\n%s", want, out)
+	}
+}
@@ -0,0 +1,273 @@
+// Package mcp 实现 Model Context Protocol 的stdio传输：JSON-RPC 2.0 连接、客户端和工具服务器
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// =============================================================================
+// JSON-RPC 2.0
+// =============================================================================
+
+// 设计原理：
+// - stdio传输中每条消息是一行JSON（不含内嵌换行），两端都可以发起请求
+// - Conn 在独立的goroutine中读取消息：响应按ID交给等待中的调用，请求和通知交给 Handler
+// - 连接断开时所有等待中的调用以 ErrClosed 结束
+
+// 标准错误码
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// ErrClosed 连接已关闭
+var ErrClosed = errors.New("mcp: connection closed")
+
+// Error JSON-RPC错误对象
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Error 实现 error
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// message 一条JSON-RPC消息（请求、通知或响应）
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Handler 处理对端发来的请求或通知
+// 返回 *Error 时原样作为错误响应，其他错误作为内部错误；通知的返回值被忽略
+type Handler func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)
+
+// Conn 双向JSON-RPC连接
+type Conn struct {
+	w       io.Writer
+	writeMu sync.Mutex
+	handler Handler
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *message
+	err     error         // 连接关闭的原因
+	done    chan struct{} // 读循环结束时关闭
+}
+
+// NewConn 在r/w上创建连接并开始读取，handler为nil时对端请求返回 MethodNotFound
+func NewConn(r io.Reader, w io.Writer, handler Handler) *Conn {
+	c := &Conn{
+		w:       w,
+		handler: handler,
+		pending: make(map[int64]chan *message),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(bufio.NewReader(r))
+	return c
+}
+
+// Done 返回读循环结束时关闭的channel
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err 返回连接关闭的原因，连接仍然打开时返回nil
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Call 发送请求并等待响应，响应结果解码到result（可以为nil）
+func (c *Conn) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	reply := make(chan *message, 1)
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	rawParams, err := marshalParams(params)
+	if err != nil {
+		return err
+	}
+	request := &message{JSONRPC: "2.0", ID: json.RawMessage(strconv.FormatInt(id, 10)), Method: method, Params: rawParams}
+	if err := c.write(request); err != nil {
+		return err
+	}
+
+	select {
+	case response := <-reply:
+		if response == nil {
+			return c.Err()
+		}
+		if response.Error != nil {
+			return response.Error
+		}
+		if result == nil || len(response.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(response.Result, result)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify 发送通知（不等待响应）
+func (c *Conn) Notify(method string, params interface{}) error {
+	rawParams, err := marshalParams(params)
+	if err != nil {
+		return err
+	}
+	return c.write(&message{JSONRPC: "2.0", Method: method, Params: rawParams})
+}
+
+// write 以一行JSON写出消息
+func (c *Conn) write(msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.w.Write(data); err != nil {
+		return fmt.Errorf("mcp: write: %w", err)
+	}
+	return nil
+}
+
+// readLoop 读取消息直到出错，然后结束所有等待中的调用
+func (c *Conn) readLoop(r *bufio.Reader) {
+	var err error
+	for {
+		var line []byte
+		line, err = r.ReadBytes('\n')
+		if len(line) > 0 {
+			c.dispatch(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if err == io.EOF {
+		err = ErrClosed
+	}
+	c.mu.Lock()
+	c.err = err
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// dispatch 处理一行消息
+func (c *Conn) dispatch(line []byte) {
+	var msg message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		if len(bytes.TrimSpace(line)) > 0 {
+			c.write(&message{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: CodeParseError, Message: err.Error()}})
+		}
+		return
+	}
+
+	if msg.Method == "" {
+		// 响应
+		id, err := strconv.ParseInt(string(msg.ID), 10, 64)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		reply, ok := c.pending[id]
+		c.mu.Unlock()
+		if ok {
+			reply <- &msg
+		}
+		return
+	}
+
+	if len(msg.ID) == 0 {
+		// 通知
+		if c.handler != nil {
+			go c.handler(context.Background(), msg.Method, msg.Params)
+		}
+		return
+	}
+
+	go c.respond(msg)
+}
+
+// respond 调用handler处理请求并写回响应
+func (c *Conn) respond(request message) {
+	response := &message{JSONRPC: "2.0", ID: request.ID}
+	if c.handler == nil {
+		response.Error = &Error{Code: CodeMethodNotFound, Message: "method not found: " + request.Method}
+		c.write(response)
+		return
+	}
+
+	result, err := c.handler(context.Background(), request.Method, request.Params)
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		response.Error = rpcErr
+	} else {
+		if result == nil {
+			result = struct{}{}
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			response.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+		} else {
+			response.Result = data
+		}
+	}
+	c.write(response)
+}
+
+// marshalParams 编码请求参数，nil编码为省略
+func marshalParams(params interface{}) (json.RawMessage, error) {
+	if params == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: encode params: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,147 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// =============================================================================
+// MCP工具服务器
+// =============================================================================
+
+// ToolHandler 工具实现，返回的错误作为 isError 结果交给客户端；
+// 返回 *Error（如参数不符合inputSchema时的 CodeInvalidParams）时作为JSON-RPC错误响应
+type ToolHandler func(ctx context.Context, arguments map[string]interface{}) (*ToolResult, error)
+
+// Server 通过stdio提供工具的MCP服务器
+type Server struct {
+	info Implementation
+
+	mu       sync.Mutex
+	tools    map[string]Tool
+	handlers map[string]ToolHandler
+}
+
+// NewServer 创建服务器
+func NewServer(name, version string) *Server {
+	return &Server{
+		info:     Implementation{Name: name, Version: version},
+		tools:    make(map[string]Tool),
+		handlers: make(map[string]ToolHandler),
+	}
+}
+
+// AddTool 注册工具，同名工具会被替换
+func (s *Server) AddTool(tool Tool, handler ToolHandler) {
+	if tool.InputSchema == nil {
+		tool.InputSchema = map[string]interface{}{"type": "object"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tools[tool.Name] = tool
+	s.handlers[tool.Name] = handler
+}
+
+// Tools 按名字顺序返回已注册的工具
+func (s *Server) Tools() []Tool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tools := make([]Tool, 0, len(s.tools))
+	for _, tool := range s.tools {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// Serve 在r/w上处理请求，直到对端关闭输入或ctx结束
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	conn := NewConn(r, w, s.handle)
+	select {
+	case <-conn.Done():
+		if err := conn.Err(); err != ErrClosed {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handle 分发客户端请求
+func (s *Server) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		var request struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(params, &request)
+
+		version := ProtocolVersion
+		if request.ProtocolVersion != "" {
+			// 客户端请求的版本由客户端自行判断是否兼容
+			version = request.ProtocolVersion
+		}
+		return InitializeResult{
+			ProtocolVersion: version,
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+			ServerInfo:      s.info,
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.Tools()}, nil
+	case "tools/call":
+		return s.callTool(ctx, params)
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + method}
+	}
+}
+
+// callTool 处理 tools/call
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var request struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+
+	s.mu.Lock()
+	handler, ok := s.handlers[request.Name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("unknown tool: %s", request.Name)}
+	}
+
+	if request.Arguments == nil {
+		request.Arguments = map[string]interface{}{}
+	}
+	result, err := handler(ctx, request.Arguments)
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return nil, rpcErr
+	}
+	if err != nil {
+		return &ToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	if result.Content == nil {
+		result.Content = []Content{}
+	}
+	return result, nil
+}
+
+// TextResult 创建只含一段文本的工具结果
+func TextResult(text string) *ToolResult {
+	return &ToolResult{Content: []Content{{Type: "text", Text: text}}}
+}
@@ -0,0 +1,77 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// 服务器测试
+// =============================================================================
+
+// serveInProcess 通过管道把客户端连接到进程内的服务器
+func serveInProcess(t *testing.T, server *Server) *Client {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	go func() {
+		server.Serve(context.Background(), serverIn, serverOut)
+		serverOut.Close()
+	}()
+
+	client := NewClient(clientIn, clientOut)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Initialize(ctx); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestServerTools(t *testing.T) {
+	server := NewServer("test", "1.0")
+	server.AddTool(Tool{Name: "upper"}, func(ctx context.Context, arguments map[string]interface{}) (*ToolResult, error) {
+		text, _ := arguments["text"].(string)
+		return TextResult(text + "!"), nil
+	})
+	server.AddTool(Tool{Name: "broken"}, func(ctx context.Context, arguments map[string]interface{}) (*ToolResult, error) {
+		return nil, errors.New("no luck")
+	})
+	server.AddTool(Tool{Name: "strict"}, func(ctx context.Context, arguments map[string]interface{}) (*ToolResult, error) {
+		return nil, &Error{Code: CodeInvalidParams, Message: "strict: missing argument text"}
+	})
+
+	client := serveInProcess(t, server)
+	if info := client.ServerInfo(); info.ServerInfo.Name != "test" || info.ProtocolVersion != ProtocolVersion {
+		t.Errorf("unexpected server info: %+v", info)
+	}
+	if tools := client.Tools(); len(tools) != 3 || tools[0].Name != "broken" || tools[2].Name != "upper" {
+		t.Errorf("tools should be listed by name, got %+v", tools)
+	}
+
+	result, err := client.CallTool(context.Background(), "upper", map[string]interface{}{"text": "hi"})
+	if err != nil || contentText(result.Content) != "hi!" {
+		t.Errorf("unexpected result %+v, err %v", result, err)
+	}
+
+	result, err = client.CallTool(context.Background(), "broken", nil)
+	if err != nil || !result.IsError || contentText(result.Content) != "no luck" {
+		t.Errorf("handler errors should become isError results, got %+v, err %v", result, err)
+	}
+
+	_, err = client.CallTool(context.Background(), "missing", nil)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeInvalidParams {
+		t.Errorf("unknown tool should return a JSON-RPC error, got %v", err)
+	}
+
+	// 处理函数返回的 *Error 不变成 isError 结果
+	_, err = client.CallTool(context.Background(), "strict", nil)
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeInvalidParams || rpcErr.Message != "strict: missing argument text" {
+		t.Errorf("a handler's JSON-RPC error should be returned as is, got %v", err)
+	}
+}
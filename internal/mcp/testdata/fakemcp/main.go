@@ -0,0 +1,130 @@
+// fakemcp 测试用的最小MCP服务器：按行读取JSON-RPC请求，提供固定的几个工具
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type request struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+var out = json.NewEncoder(os.Stdout)
+
+func main() {
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		var req request
+		if err := json.Unmarshal(in.Bytes(), &req); err != nil {
+			reply(json.RawMessage("null"), nil, map[string]interface{}{"code": -32700, "message": err.Error()})
+			continue
+		}
+		if len(req.ID) == 0 {
+			continue // 通知
+		}
+		handle(req)
+	}
+}
+
+func handle(req request) {
+	switch req.Method {
+	case "initialize":
+		// 握手完成之前发送一条日志通知，客户端应忽略它
+		out.Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "notifications/message",
+			"params":  map[string]interface{}{"level": "info", "data": "starting"},
+		})
+		reply(req.ID, map[string]interface{}{
+			"protocolVersion": "2024-11-05",
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "fakemcp", "version": "1.0.0"},
+		}, nil)
+	case "tools/list":
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(req.Params, &params)
+		if params.Cursor == "" {
+			reply(req.ID, map[string]interface{}{"tools": []interface{}{
+				tool("echo", "text"),
+				tool("add", "a", "b"),
+			}, "nextCursor": "page2"}, nil)
+		} else {
+			reply(req.ID, map[string]interface{}{"tools": []interface{}{
+				tool("read-file", "path"),
+				tool("fail"),
+				tool("image"),
+				tool("crash"),
+			}}, nil)
+		}
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		json.Unmarshal(req.Params, &params)
+		callTool(req.ID, params.Name, params.Arguments)
+	default:
+		reply(req.ID, nil, map[string]interface{}{"code": -32601, "message": "method not found: " + req.Method})
+	}
+}
+
+func callTool(id json.RawMessage, name string, args map[string]interface{}) {
+	switch name {
+	case "echo":
+		reply(id, text(fmt.Sprint(args["text"])), nil)
+	case "add":
+		a, _ := args["a"].(float64)
+		b, _ := args["b"].(float64)
+		result := text(fmt.Sprint(a + b))
+		result["structuredContent"] = map[string]interface{}{"sum": a + b}
+		reply(id, result, nil)
+	case "read-file":
+		reply(id, text("contents of "+fmt.Sprint(args["path"])), nil)
+	case "fail":
+		result := text("tool failed on purpose")
+		result["isError"] = true
+		reply(id, result, nil)
+	case "image":
+		reply(id, map[string]interface{}{"content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "a picture"},
+			map[string]interface{}{"type": "image", "data": "aGk=", "mimeType": "image/png"},
+		}}, nil)
+	case "crash":
+		os.Exit(3)
+	default:
+		reply(id, nil, map[string]interface{}{"code": -32602, "message": "unknown tool: " + name})
+	}
+}
+
+func tool(name string, required ...string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for _, param := range required {
+		properties[param] = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"name":        name,
+		"description": "fake " + name,
+		"inputSchema": map[string]interface{}{"type": "object", "properties": properties, "required": required},
+	}
+}
+
+func text(s string) map[string]interface{} {
+	return map[string]interface{}{"content": []interface{}{map[string]interface{}{"type": "text", "text": s}}}
+}
+
+func reply(id json.RawMessage, result interface{}, rpcErr interface{}) {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		msg["error"] = rpcErr
+	} else {
+		msg["result"] = result
+	}
+	out.Encode(msg)
+}
@@ -0,0 +1,159 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhnt/aql/internal/compiler1"
+	"github.com/zhnt/aql/internal/lexer1"
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 模块加载器：路径解析、编译和缓存
+// =============================================================================
+
+// 设计原理：
+// - 以 ./ 或 ../ 开头的路径相对于导入方文件所在目录解析，绝对路径原样使用，
+//   其他路径依次在搜索路径中查找；没有扩展名时补上 .aql
+// - 模块按绝对路径缓存，同一文件只编译一次，多次导入得到同一个 vm.Module
+// - 模块带有执行状态，一个 Loader 只应提供给一个 Executor
+
+// Extension 模块源文件的扩展名
+const Extension = ".aql"
+
+// PathEnv 搜索路径环境变量，多个目录以系统路径分隔符分隔
+const PathEnv = "AQL_PATH"
+
+// Loader 从文件系统加载模块，实现 vm.ModuleLoader
+type Loader struct {
+	searchPath []string
+	modules    map[string]*vm.Module // 按绝对路径缓存
+}
+
+// NewLoader 创建使用给定搜索路径的加载器
+func NewLoader(searchPath ...string) *Loader {
+	return &Loader{
+		searchPath: searchPath,
+		modules:    make(map[string]*vm.Module),
+	}
+}
+
+// SearchPathFromEnv 返回 AQL_PATH 中的目录
+func SearchPathFromEnv() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv(PathEnv)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// SearchPath 返回搜索路径
+func (l *Loader) SearchPath() []string {
+	return l.searchPath
+}
+
+// AddPath 在搜索路径末尾追加目录
+func (l *Loader) AddPath(dirs ...string) {
+	l.searchPath = append(l.searchPath, dirs...)
+}
+
+// Resolve 返回spec对应模块文件的绝对路径，from为导入方的源文件路径
+func (l *Loader) Resolve(spec, from string) (string, error) {
+	if spec == "" {
+		return "", errors.New("empty module path")
+	}
+	if filepath.Ext(spec) == "" {
+		spec += Extension
+	}
+
+	var candidates []string
+	switch {
+	case filepath.IsAbs(spec):
+		candidates = []string{spec}
+	case isRelative(spec):
+		dir := "."
+		if from != "" {
+			dir = filepath.Dir(from)
+		}
+		candidates = []string{filepath.Join(dir, spec)}
+	default:
+		for _, dir := range l.searchPath {
+			candidates = append(candidates, filepath.Join(dir, spec))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return filepath.Abs(candidate)
+		}
+	}
+	if isRelative(spec) || filepath.IsAbs(spec) {
+		return "", fmt.Errorf("module %s not found", candidates[0])
+	}
+	return "", fmt.Errorf("module %s not found in search path [%s]", spec, strings.Join(l.searchPath, string(filepath.ListSeparator)))
+}
+
+// isRelative 判断路径是否相对于导入方
+func isRelative(spec string) bool {
+	return spec == "." || spec == ".." ||
+		strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../") ||
+		strings.HasPrefix(spec, "."+string(filepath.Separator)) || strings.HasPrefix(spec, ".."+string(filepath.Separator))
+}
+
+// Load 解析并编译模块，已加载的模块直接从缓存返回
+func (l *Loader) Load(spec, from string) (*vm.Module, error) {
+	path, err := l.Resolve(spec, from)
+	if err != nil {
+		return nil, err
+	}
+	if module, ok := l.modules[path]; ok {
+		return module, nil
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	main, exports, err := Compile(path, string(source))
+	if err != nil {
+		return nil, err
+	}
+
+	module := vm.NewModule(path, main, exports)
+	l.modules[path] = module
+	return module, nil
+}
+
+// Compile 把模块源码编译为顶层函数和导出表，错误带有 file:line:column 位置
+func Compile(path, source string) (*vm.Function, []vm.ModuleExport, error) {
+	p := parser1.New(lexer1.New(source))
+	program := p.ParseProgram()
+	if parseErrors := p.ParseErrors(); len(parseErrors) > 0 {
+		msgs := make([]string, len(parseErrors))
+		for i, pe := range parseErrors {
+			msgs[i] = fmt.Sprintf("%s:%d:%d: 语法错误: %s", path, pe.Line, pe.Column, pe.Message)
+		}
+		return nil, nil, errors.New(strings.Join(msgs, "\n"))
+	}
+
+	comp := compiler1.New()
+	comp.SetSource(path)
+	main, err := comp.Compile(program)
+	if err != nil {
+		var ce *compiler1.CompilationError
+		if errors.As(err, &ce) {
+			if line, column := ce.Position(); line > 0 {
+				return nil, nil, fmt.Errorf("%s:%d:%d: %s", path, line, column, ce.Error())
+			}
+		}
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return main, comp.Exports(), nil
+}
@@ -0,0 +1,136 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+)
+
+// writeFiles 在临时目录中创建文件，返回目录路径
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// runMain 用新的Executor运行dir中的main.aql，返回print输出
+func runMain(t *testing.T, dir string, loader *Loader) (string, error) {
+	t.Helper()
+	aqltest.InitRuntime()
+
+	path := filepath.Join(dir, "main.aql")
+	source, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, _, err := Compile(path, string(source))
+	if err != nil {
+		t.Fatalf("compile main.aql: %v", err)
+	}
+
+	executor, out := aqltest.NewExecutor()
+	executor.SetModuleLoader(loader)
+	_, err = executor.Execute(main, nil)
+	return out.String(), err
+}
+
+// =============================================================================
+// 模块加载测试
+// =============================================================================
+
+func TestImportExport(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.aql": `
+import {add, current as sum} from "./lib/counter"
+import * as counter from "./lib/counter.aql"
+import {greet} from "greet"
+let total = 100
+print(add(2), add(3), sum(), total)
+print(counter.current(), counter.step)
+print(greet("aql"))
+`,
+		"lib/counter.aql": `
+let total = 0
+export const step = 1
+export function add(n) { total = total + n; return total }
+export function current() { return total }
+print("counter loaded")
+`,
+		"std/greet.aql": `export function greet(name) { return "hello " + name }`,
+	})
+
+	loader := NewLoader(filepath.Join(dir, "std"))
+	got, err := runMain(t, dir, loader)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	// 模块只执行一次，模块的全局变量 total 与主程序的 total 互不影响
+	want := "counter loaded\n2 5 5 100\n5 1\nhello aql\n"
+	if got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+
+	first, err := loader.Load("./lib/counter", filepath.Join(dir, "main.aql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := loader.Load(filepath.Join(dir, "lib", "counter.aql"), "")
+	if err != nil || first != second {
+		t.Errorf("the same file should load as the same module, got %p and %p (%v)", first, second, err)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"main.aql": `import {a} from "./a"`,
+				"a.aql":    "import {b} from \"./b\"\nexport function a() {}",
+				"b.aql":    "import {a} from \"./a\"\nexport function b() {}",
+			},
+			want: "import cycle: a.aql -> b.aql -> a.aql",
+		},
+		{
+			name:  "missing export",
+			files: map[string]string{"main.aql": `import {nope} from "./lib"`, "lib.aql": `export let x = 1`},
+			want:  "module ./lib has no export nope",
+		},
+		{
+			name:  "not found",
+			files: map[string]string{"main.aql": `import {x} from "nowhere"`},
+			want:  "module nowhere.aql not found in search path",
+		},
+		{
+			name:  "syntax error",
+			files: map[string]string{"main.aql": `import {x} from "./bad"`, "bad.aql": "export let x = \n"},
+			want:  "bad.aql:2:1: 语法错误",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			_, err := runMain(t, dir, NewLoader())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error should mention %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package parser1
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/zhnt/aql/internal/lexer1"
@@ -25,6 +26,35 @@ type Expression interface {
 	expressionNode()
 }
 
+// NodeToken 返回节点携带的token，用于错误定位
+// 所有AST节点都以Token字段记录其起始token；Program取第一条语句的token
+func NodeToken(node Node) (lexer1.Token, bool) {
+	if program, ok := node.(*Program); ok {
+		if len(program.Statements) == 0 {
+			return lexer1.Token{}, false
+		}
+		return NodeToken(program.Statements[0])
+	}
+
+	v := reflect.ValueOf(node)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return lexer1.Token{}, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return lexer1.Token{}, false
+	}
+
+	field := v.FieldByName("Token")
+	if !field.IsValid() {
+		return lexer1.Token{}, false
+	}
+	tok, ok := field.Interface().(lexer1.Token)
+	return tok, ok
+}
+
 // =============================================================================
 // 程序和语句节点
 // =============================================================================
@@ -164,6 +194,26 @@ func (ias *IndexAssignmentStatement) String() string {
 	return out.String()
 }
 
+// PropertyAssignmentStatement 属性赋值语句节点 (obj.field = value)
+type PropertyAssignmentStatement struct {
+	Token lexer1.Token        // = token
+	Left  *PropertyExpression // 被赋值的属性表达式 (obj.field)
+	Value Expression          // 值表达式
+}
+
+func (pas *PropertyAssignmentStatement) statementNode()       {}
+func (pas *PropertyAssignmentStatement) expressionNode()      {} // 同时作为表达式
+func (pas *PropertyAssignmentStatement) TokenLiteral() string { return pas.Token.Literal }
+func (pas *PropertyAssignmentStatement) String() string {
+	var out strings.Builder
+	out.WriteString(pas.Left.String())
+	out.WriteString(" = ")
+	if pas.Value != nil {
+		out.WriteString(pas.Value.String())
+	}
+	return out.String()
+}
+
 // BlockStatement 代码块语句节点
 type BlockStatement struct {
 	Token      lexer1.Token // { token
@@ -290,6 +340,123 @@ func (cs *ContinueStatement) statementNode()       {}
 func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
 func (cs *ContinueStatement) String() string       { return "continue" }
 
+// TryStatement try/catch/finally语句节点
+type TryStatement struct {
+	Token      lexer1.Token    // TRY token
+	Body       *BlockStatement // 受保护的代码块
+	CatchParam *Identifier     // catch绑定的异常变量（可省略）
+	CatchBody  *BlockStatement // catch代码块（无catch时为nil）
+	Finally    *BlockStatement // finally代码块（无finally时为nil）
+}
+
+func (ts *TryStatement) statementNode()       {}
+func (ts *TryStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TryStatement) String() string {
+	var out strings.Builder
+	out.WriteString("try ")
+	out.WriteString(ts.Body.String())
+	if ts.CatchBody != nil {
+		out.WriteString(" catch ")
+		if ts.CatchParam != nil {
+			out.WriteString("(")
+			out.WriteString(ts.CatchParam.String())
+			out.WriteString(") ")
+		}
+		out.WriteString(ts.CatchBody.String())
+	}
+	if ts.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(ts.Finally.String())
+	}
+	return out.String()
+}
+
+// ThrowStatement throw语句节点
+type ThrowStatement struct {
+	Token lexer1.Token // THROW token
+	Value Expression   // 抛出的值
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return "throw " + ts.Value.String()
+}
+
+// ImportSpecifier 导入项 (name 或 name as alias)
+type ImportSpecifier struct {
+	Name  *Identifier // 模块导出的名字
+	Alias *Identifier // 本地名字，没有 as 时与Name相同
+}
+
+func (is *ImportSpecifier) String() string {
+	if is.Alias.Value == is.Name.Value {
+		return is.Name.Value
+	}
+	return is.Name.Value + " as " + is.Alias.Value
+}
+
+// ImportStatement import语句节点
+//
+//	import {a, b as c} from "./lib.aql"  导入指定的导出
+//	import * as lib from "./lib.aql"     导入全部导出组成的对象
+//	import "./lib.aql"                   只执行模块
+type ImportStatement struct {
+	Token      lexer1.Token       // IMPORT token
+	Specifiers []*ImportSpecifier // 花括号中的导入项
+	Namespace  *Identifier        // import * as 的名字
+	Path       *StringLiteral     // 模块路径
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	var out strings.Builder
+	out.WriteString("import ")
+	switch {
+	case is.Namespace != nil:
+		out.WriteString("* as " + is.Namespace.Value + " from ")
+	case is.Specifiers != nil:
+		names := make([]string, len(is.Specifiers))
+		for i, spec := range is.Specifiers {
+			names[i] = spec.String()
+		}
+		out.WriteString("{" + strings.Join(names, ", ") + "} from ")
+	}
+	out.WriteString(is.Path.String())
+	return out.String()
+}
+
+// ExportStatement export声明节点，包装 let/const、具名函数或带装饰器的函数声明
+type ExportStatement struct {
+	Token       lexer1.Token // EXPORT token
+	Declaration Statement    // 被导出的声明
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return "export " + es.Declaration.String()
+}
+
+// Name 返回导出的名字
+func (es *ExportStatement) Name() *Identifier {
+	switch decl := es.Declaration.(type) {
+	case *LetStatement:
+		return decl.Name
+	case *ConstStatement:
+		return decl.Name
+	case *ExpressionStatement:
+		switch expr := decl.Expression.(type) {
+		case *FunctionLiteral:
+			return expr.Name
+		case *DecoratedFunction:
+			return expr.Function.Name
+		}
+	}
+	return nil
+}
+
 // =============================================================================
 // 表达式节点
 // =============================================================================
@@ -570,6 +737,63 @@ func (sce *ServiceCallExpression) String() string {
 	return out.String()
 }
 
+// Decorator 函数声明上的装饰器 (@name 或 @name(args))
+type Decorator struct {
+	Token     lexer1.Token     // @ token
+	Name      *Identifier      // 装饰器函数名
+	Arguments []Expression     // 位置参数
+	Named     []*NamedArgument // 具名参数 (key=value)
+}
+
+func (d *Decorator) String() string {
+	var out strings.Builder
+	out.WriteString("@")
+	out.WriteString(d.Name.String())
+	if d.Arguments != nil || d.Named != nil {
+		var args []string
+		for _, a := range d.Arguments {
+			args = append(args, a.String())
+		}
+		for _, n := range d.Named {
+			args = append(args, n.Name.String()+"="+n.Value.String())
+		}
+		out.WriteString("(")
+		out.WriteString(strings.Join(args, ", "))
+		out.WriteString(")")
+	}
+	return out.String()
+}
+
+// NamedArgument 装饰器的具名参数
+type NamedArgument struct {
+	Name  *Identifier
+	Value Expression
+}
+
+// DecoratedFunction 带装饰器的具名函数声明
+//
+//	@a @b(x) function f() {}
+//
+// 等价于先定义f，再执行 f = a(b(f, x))：离函数最近的装饰器最先应用，
+// 具名参数合并为一个对象放在位置参数之后
+type DecoratedFunction struct {
+	Token      lexer1.Token     // 第一个 @ token
+	Decorators []*Decorator     // 按源码顺序排列
+	Function   *FunctionLiteral // 被装饰的函数
+}
+
+func (df *DecoratedFunction) expressionNode()      {}
+func (df *DecoratedFunction) TokenLiteral() string { return df.Token.Literal }
+func (df *DecoratedFunction) String() string {
+	var out strings.Builder
+	for _, d := range df.Decorators {
+		out.WriteString(d.String())
+		out.WriteString(" ")
+	}
+	out.WriteString(df.Function.String())
+	return out.String()
+}
+
 // PipeExpression 管道表达式节点 (data |> func())
 type PipeExpression struct {
 	Token lexer1.Token // |> token
@@ -589,22 +813,52 @@ func (pe *PipeExpression) String() string {
 	return out.String()
 }
 
+// ObjectEntryKind 对象字面量条目类型
+type ObjectEntryKind int
+
+const (
+	ObjectEntryKeyValue  ObjectEntryKind = iota // key: value / "key": value / 1: value
+	ObjectEntryShorthand                        // {name}，等价于 {name: name}
+	ObjectEntryComputed                         // {[expr]: value}
+	ObjectEntrySpread                           // {...expr}
+)
+
+// ObjectEntry 对象字面量中的一个条目
+type ObjectEntry struct {
+	Kind  ObjectEntryKind // 条目类型
+	Key   Expression      // 键（Spread条目为nil）
+	Value Expression      // 值（Shorthand条目与Key相同，Spread条目为被展开的表达式）
+}
+
+func (oe *ObjectEntry) String() string {
+	switch oe.Kind {
+	case ObjectEntryShorthand:
+		return oe.Key.String()
+	case ObjectEntryComputed:
+		return "[" + oe.Key.String() + "]: " + oe.Value.String()
+	case ObjectEntrySpread:
+		return "..." + oe.Value.String()
+	default:
+		return oe.Key.String() + ": " + oe.Value.String()
+	}
+}
+
 // ObjectLiteral 对象字面量节点
 type ObjectLiteral struct {
-	Token lexer1.Token              // { token
-	Pairs map[Expression]Expression // 键值对
+	Token   lexer1.Token   // { token
+	Entries []*ObjectEntry // 按源码顺序排列的条目
 }
 
 func (ol *ObjectLiteral) expressionNode()      {}
 func (ol *ObjectLiteral) TokenLiteral() string { return ol.Token.Literal }
 func (ol *ObjectLiteral) String() string {
 	var out strings.Builder
-	var pairs []string
-	for key, value := range ol.Pairs {
-		pairs = append(pairs, key.String()+": "+value.String())
+	var entries []string
+	for _, entry := range ol.Entries {
+		entries = append(entries, entry.String())
 	}
 	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString(strings.Join(entries, ", "))
 	out.WriteString("}")
 	return out.String()
 }
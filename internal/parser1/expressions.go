@@ -1,6 +1,7 @@
 package parser1
 
 import (
+	"fmt"
 	"strconv"
 
 	"github.com/zhnt/aql/internal/lexer1"
@@ -42,7 +43,7 @@ func (p *Parser) parseIntegerLiteral() Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := "could not parse " + p.curToken.Literal + " as integer"
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, msg)
 		return nil
 	}
 
@@ -57,7 +58,7 @@ func (p *Parser) parseFloatLiteral() Expression {
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
 		msg := "could not parse " + p.curToken.Literal + " as float"
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, msg)
 		return nil
 	}
 
@@ -293,31 +294,91 @@ func (p *Parser) parseIndexExpression(left Expression) Expression {
 // parseObjectLiteral 解析对象字面量
 func (p *Parser) parseObjectLiteral() Expression {
 	obj := &ObjectLiteral{Token: p.curToken}
-	obj.Pairs = make(map[Expression]Expression)
+	obj.Entries = []*ObjectEntry{}
 
 	for !p.peekTokenIs(lexer1.RBRACE) && !p.peekTokenIs(lexer1.EOF) {
 		p.nextToken()
-		key := p.parseExpression(LOWEST)
+		entry := p.parseObjectEntry()
+		if entry == nil {
+			return nil
+		}
 
-		if !p.expectPeek(lexer1.COLON) {
+		obj.Entries = append(obj.Entries, entry)
+
+		if !p.peekTokenIs(lexer1.RBRACE) && !p.expectPeek(lexer1.COMMA) {
 			return nil
 		}
+	}
 
+	if !p.expectPeek(lexer1.RBRACE) {
+		return nil
+	}
+
+	return obj
+}
+
+// parseObjectEntry 解析对象字面量中的单个条目，curToken为条目的第一个token
+func (p *Parser) parseObjectEntry() *ObjectEntry {
+	switch p.curToken.Type {
+	case lexer1.ELLIPSIS:
+		// 展开条目: ...expr
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		return &ObjectEntry{Kind: ObjectEntrySpread, Value: value}
+
+	case lexer1.LBRACKET:
+		// 计算键: [expr]: value
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if key == nil || !p.expectPeek(lexer1.RBRACKET) || !p.expectPeek(lexer1.COLON) {
+			return nil
+		}
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		return &ObjectEntry{Kind: ObjectEntryComputed, Key: key, Value: value}
 
-		obj.Pairs[key] = value
+	case lexer1.IDENT:
+		key := &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		// 简写: {name} 等价于 {name: name}
+		if p.peekTokenIs(lexer1.COMMA) || p.peekTokenIs(lexer1.RBRACE) {
+			return &ObjectEntry{Kind: ObjectEntryShorthand, Key: key, Value: key}
+		}
+		return p.parseObjectEntryValue(key)
 
-		if !p.peekTokenIs(lexer1.RBRACE) && !p.expectPeek(lexer1.COMMA) {
+	case lexer1.STRING:
+		return p.parseObjectEntryValue(&StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+
+	case lexer1.INT:
+		key := p.parseIntegerLiteral()
+		if key == nil {
 			return nil
 		}
+		return p.parseObjectEntryValue(key)
+
+	default:
+		p.addError(p.curToken, "invalid object key: "+p.curToken.Literal)
+		return nil
 	}
+}
 
-	if !p.expectPeek(lexer1.RBRACE) {
+// parseObjectEntryValue 解析键之后的 ": value" 部分
+func (p *Parser) parseObjectEntryValue(key Expression) *ObjectEntry {
+	if !p.expectPeek(lexer1.COLON) {
 		return nil
 	}
 
-	return obj
+	p.nextToken()
+	value := p.parseExpression(LOWEST)
+	if value == nil {
+		return nil
+	}
+	return &ObjectEntry{Kind: ObjectEntryKeyValue, Key: key, Value: value}
 }
 
 // parsePropertyExpression 解析属性访问表达式
@@ -355,15 +416,25 @@ func (p *Parser) parseYieldExpression() Expression {
 	return exp
 }
 
-// parseServiceCallExpression 解析AI服务调用表达式
-func (p *Parser) parseServiceCallExpression() Expression {
-	exp := &ServiceCallExpression{Token: p.curToken}
+// parseAtExpression 解析以@开头的表达式
+// @name.method(...) 是服务调用；@name 或 @name(...) 后跟函数声明是装饰器
+func (p *Parser) parseAtExpression() Expression {
+	token := p.curToken
 
 	if !p.expectPeek(lexer1.IDENT) {
 		return nil
 	}
 
-	exp.Service = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	name := &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(lexer1.DOT) {
+		return p.parseServiceCallExpression(token, name)
+	}
+	return p.parseDecoratedFunction(token, name)
+}
+
+// parseServiceCallExpression 解析AI服务调用表达式，当前token为服务名
+func (p *Parser) parseServiceCallExpression(token lexer1.Token, service *Identifier) Expression {
+	exp := &ServiceCallExpression{Token: token, Service: service}
 
 	if !p.expectPeek(lexer1.DOT) {
 		return nil
@@ -384,6 +455,86 @@ func (p *Parser) parseServiceCallExpression() Expression {
 	return exp
 }
 
+// parseDecoratedFunction 解析装饰器序列和其后的具名函数声明，当前token为第一个装饰器名
+func (p *Parser) parseDecoratedFunction(token lexer1.Token, name *Identifier) Expression {
+	exp := &DecoratedFunction{Token: token}
+
+	for {
+		decorator := p.parseDecorator(token, name)
+		if decorator == nil {
+			return nil
+		}
+		exp.Decorators = append(exp.Decorators, decorator)
+
+		if !p.peekTokenIs(lexer1.AT_SYMBOL) {
+			break
+		}
+		p.nextToken()
+		token = p.curToken
+		if !p.expectPeek(lexer1.IDENT) {
+			return nil
+		}
+		name = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if p.peekTokenIs(lexer1.DOT) {
+			p.addError(p.peekToken, "service call cannot be used as a decorator")
+			return nil
+		}
+	}
+
+	var fn Expression
+	switch {
+	case p.peekTokenIs(lexer1.FUNCTION):
+		p.nextToken()
+		fn = p.parseFunctionLiteral()
+	case p.peekTokenIs(lexer1.ASYNC):
+		p.nextToken()
+		fn = p.parseAsyncFunctionLiteral()
+	default:
+		p.addError(p.peekToken, fmt.Sprintf("decorator @%s must be followed by a function declaration, got %s",
+			name.Value, p.peekToken.Type))
+		return nil
+	}
+
+	funcLit, ok := fn.(*FunctionLiteral)
+	if !ok || funcLit == nil {
+		return nil
+	}
+	if funcLit.Name == nil {
+		p.addError(funcLit.Token, "decorated function must have a name")
+		return nil
+	}
+	exp.Function = funcLit
+	return exp
+}
+
+// parseDecorator 解析单个装饰器的参数部分，当前token为装饰器名
+func (p *Parser) parseDecorator(token lexer1.Token, name *Identifier) *Decorator {
+	decorator := &Decorator{Token: token, Name: name}
+	if !p.peekTokenIs(lexer1.LPAREN) {
+		return decorator
+	}
+	p.nextToken()
+
+	args := p.parseExpressionList(lexer1.RPAREN)
+	if args == nil {
+		return nil
+	}
+	decorator.Arguments = []Expression{}
+	for _, arg := range args {
+		// name=value 被解析为赋值表达式
+		if assign, ok := arg.(*AssignmentStatement); ok {
+			decorator.Named = append(decorator.Named, &NamedArgument{Name: assign.Name, Value: assign.Value})
+			continue
+		}
+		if len(decorator.Named) > 0 {
+			p.addError(token, fmt.Sprintf("decorator @%s: positional argument follows named argument", name.Value))
+			return nil
+		}
+		decorator.Arguments = append(decorator.Arguments, arg)
+	}
+	return decorator
+}
+
 // parsePipeExpression 解析管道表达式
 func (p *Parser) parsePipeExpression(left Expression) Expression {
 	exp := &PipeExpression{Token: p.curToken, Left: left}
@@ -420,9 +571,20 @@ func (p *Parser) parseAssignmentExpression(left Expression) Expression {
 		p.nextToken()
 		exp.Value = p.parseExpression(LOWEST)
 
+		return exp
+	case *PropertyExpression:
+		// 属性赋值: obj.field = value
+		exp := &PropertyAssignmentStatement{
+			Token: p.curToken, // = token
+			Left:  leftExpr,
+		}
+
+		p.nextToken()
+		exp.Value = p.parseExpression(LOWEST)
+
 		return exp
 	default:
-		p.errors = append(p.errors, "invalid assignment target")
+		p.addError(p.curToken, "invalid assignment target")
 		return nil
 	}
 }
@@ -55,7 +55,8 @@ type Parser struct {
 	curToken  lexer1.Token
 	peekToken lexer1.Token
 
-	errors []string
+	errors      []string
+	parseErrors []*ParseError
 
 	prefixParseFns map[lexer1.TokenType]prefixParseFn
 	infixParseFns  map[lexer1.TokenType]infixParseFn
@@ -93,7 +94,9 @@ func New(l *lexer1.Lexer) *Parser {
 	p.registerPrefix(lexer1.LBRACE, p.parseObjectLiteral)
 	p.registerPrefix(lexer1.AWAIT, p.parseAwaitExpression)
 	p.registerPrefix(lexer1.YIELD, p.parseYieldExpression)
-	p.registerPrefix(lexer1.AT_SYMBOL, p.parseServiceCallExpression)
+	p.registerPrefix(lexer1.AT_SYMBOL, p.parseAtExpression)
+	// type 尚未用于类型声明，在表达式中按普通标识符解析（内建函数 type）
+	p.registerPrefix(lexer1.TYPE, p.parseIdentifier)
 
 	p.infixParseFns = make(map[lexer1.TokenType]infixParseFn)
 	p.registerInfix(lexer1.PLUS, p.parseInfixExpression)
@@ -183,6 +186,14 @@ func (p *Parser) parseStatement() Statement {
 		return p.parseBreakStatement()
 	case lexer1.CONTINUE:
 		return p.parseContinueStatement()
+	case lexer1.TRY:
+		return p.parseTryStatement()
+	case lexer1.THROW:
+		return p.parseThrowStatement()
+	case lexer1.IMPORT:
+		return p.parseImportStatement()
+	case lexer1.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -451,6 +462,161 @@ func (p *Parser) parseContinueStatement() *ContinueStatement {
 	return stmt
 }
 
+// parseTryStatement 解析try语句: try { } catch (e) { } finally { }
+// catch 与 finally 至少出现一个，catch 的异常变量可省略
+func (p *Parser) parseTryStatement() *TryStatement {
+	stmt := &TryStatement{Token: p.curToken}
+
+	if !p.expectPeek(lexer1.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(lexer1.CATCH) {
+		p.nextToken()
+
+		if p.peekTokenIs(lexer1.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(lexer1.IDENT) {
+				return nil
+			}
+			stmt.CatchParam = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectPeek(lexer1.RPAREN) {
+				return nil
+			}
+		}
+
+		if !p.expectPeek(lexer1.LBRACE) {
+			return nil
+		}
+		stmt.CatchBody = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(lexer1.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(lexer1.LBRACE) {
+			return nil
+		}
+		stmt.Finally = p.parseBlockStatement()
+	}
+
+	if stmt.CatchBody == nil && stmt.Finally == nil {
+		p.addError(stmt.Token, "try statement requires catch or finally")
+		return nil
+	}
+
+	return stmt
+}
+
+// parseThrowStatement 解析throw语句
+func (p *Parser) parseThrowStatement() *ThrowStatement {
+	stmt := &ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(lexer1.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseImportStatement 解析import语句
+func (p *Parser) parseImportStatement() Statement {
+	stmt := &ImportStatement{Token: p.curToken}
+
+	switch {
+	case p.peekTokenIs(lexer1.LBRACE):
+		p.nextToken()
+		stmt.Specifiers = []*ImportSpecifier{}
+		for !p.peekTokenIs(lexer1.RBRACE) {
+			if !p.expectPeek(lexer1.IDENT) {
+				return nil
+			}
+			spec := &ImportSpecifier{Name: &Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+			spec.Alias = spec.Name
+			if p.peekTokenIs(lexer1.IDENT) && p.peekToken.Literal == "as" {
+				p.nextToken()
+				if !p.expectPeek(lexer1.IDENT) {
+					return nil
+				}
+				spec.Alias = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			}
+			stmt.Specifiers = append(stmt.Specifiers, spec)
+			if !p.peekTokenIs(lexer1.COMMA) {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expectPeek(lexer1.RBRACE) || !p.expectPeek(lexer1.FROM) {
+			return nil
+		}
+	case p.peekTokenIs(lexer1.ASTERISK):
+		p.nextToken()
+		if !p.peekTokenIs(lexer1.IDENT) || p.peekToken.Literal != "as" {
+			p.addError(p.peekToken, fmt.Sprintf("expected as after import *, got %s", p.peekToken.Literal))
+			return nil
+		}
+		p.nextToken()
+		if !p.expectPeek(lexer1.IDENT) {
+			return nil
+		}
+		stmt.Namespace = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(lexer1.FROM) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(lexer1.STRING) {
+		return nil
+	}
+	stmt.Path = &StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(lexer1.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseExportStatement 解析export声明，只能导出 let/const 和具名函数
+func (p *Parser) parseExportStatement() Statement {
+	stmt := &ExportStatement{Token: p.curToken}
+	p.nextToken()
+
+	// 解析失败的声明返回带类型的nil，需要逐个判断
+	switch p.curToken.Type {
+	case lexer1.LET:
+		if decl := p.parseLetStatement(); decl != nil {
+			stmt.Declaration = decl
+		}
+	case lexer1.CONST:
+		if decl := p.parseConstStatement(); decl != nil {
+			stmt.Declaration = decl
+		}
+	case lexer1.FUNCTION, lexer1.ASYNC, lexer1.AT_SYMBOL:
+		if decl := p.parseExpressionStatement(); decl != nil && decl.Expression != nil {
+			stmt.Declaration = decl
+		}
+	default:
+		p.addError(p.curToken, fmt.Sprintf("export must be followed by let, const or a function declaration, got %s", p.curToken.Literal))
+		return nil
+	}
+
+	if stmt.Declaration == nil {
+		return nil
+	}
+	if stmt.Name() == nil {
+		p.addError(stmt.Token, "exported function must have a name")
+		return nil
+	}
+	return stmt
+}
+
 // parseForInitStatement 解析for循环的初始化语句（不自动消费分号）
 func (p *Parser) parseForInitStatement() Statement {
 	switch p.curToken.Type {
@@ -563,22 +729,48 @@ func (p *Parser) parseBlockStatement() *BlockStatement {
 	return block
 }
 
+// ParseError 带位置信息的解析错误
+type ParseError struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", pe.Line, pe.Column, pe.Message)
+}
+
 // Errors 返回解析错误
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// ParseErrors 返回带位置信息的解析错误
+func (p *Parser) ParseErrors() []*ParseError {
+	return p.parseErrors
+}
+
+// addError 在指定token位置记录解析错误
+func (p *Parser) addError(tok lexer1.Token, msg string) {
+	p.errors = append(p.errors, msg)
+	p.parseErrors = append(p.parseErrors, &ParseError{
+		Message: msg,
+		Line:    tok.Line,
+		Column:  tok.Column,
+	})
+}
+
 // peekError 记录peek错误
 func (p *Parser) peekError(t lexer1.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken, msg)
 }
 
 // noPrefixParseFnError 记录前缀解析函数缺失错误
 func (p *Parser) noPrefixParseFnError(t lexer1.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, msg)
 }
 
 // curTokenIs 检查当前token类型
@@ -0,0 +1,181 @@
+package parser1
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zhnt/aql/internal/lexer1"
+)
+
+// =============================================================================
+// 解析器测试
+// =============================================================================
+
+// parse 解析源码，出错时测试失败
+func parse(t *testing.T, source string) *Program {
+	t.Helper()
+	p := New(lexer1.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors for %q: %v", source, errs)
+	}
+	return program
+}
+
+// parseExpression 解析单个表达式语句，返回其表达式
+func parseExpression(t *testing.T, source string) Expression {
+	t.Helper()
+	program := parse(t, source)
+	if len(program.Statements) != 1 {
+		t.Fatalf("%q should parse to 1 statement, got %d", source, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ExpressionStatement)
+	if !ok {
+		t.Fatalf("%q should be an expression statement, got %T", source, program.Statements[0])
+	}
+	return stmt.Expression
+}
+
+func TestObjectLiteralEntries(t *testing.T) {
+	expr := parseExpression(t, `({z: 0, name, [k]: 1, ["x" + 1]: 2, "quoted key": 3, 7: "seven", ...base, b: 20})`)
+	object, ok := expr.(*ObjectLiteral)
+	if !ok {
+		t.Fatalf("expression should be *ObjectLiteral, got %T", expr)
+	}
+
+	want := []struct {
+		kind ObjectEntryKind
+		str  string
+	}{
+		{ObjectEntryKeyValue, "z: 0"},
+		{ObjectEntryShorthand, "name"},
+		{ObjectEntryComputed, "[k]: 1"},
+		{ObjectEntryComputed, `[("x" + 1)]: 2`},
+		{ObjectEntryKeyValue, `"quoted key": 3`},
+		{ObjectEntryKeyValue, `7: "seven"`},
+		{ObjectEntrySpread, "...base"},
+		{ObjectEntryKeyValue, "b: 20"},
+	}
+	if len(object.Entries) != len(want) {
+		t.Fatalf("object should have %d entries, got %d: %s", len(want), len(object.Entries), object)
+	}
+	for i, entry := range object.Entries {
+		if entry.Kind != want[i].kind || entry.String() != want[i].str {
+			t.Errorf("entry %d should be kind %d %q, got kind %d %q", i, want[i].kind, want[i].str, entry.Kind, entry.String())
+		}
+	}
+	if entry := object.Entries[1]; entry.Key != entry.Value {
+		t.Errorf("shorthand entry should use the key as its value")
+	}
+	if entry := object.Entries[6]; entry.Key != nil {
+		t.Errorf("spread entry should have no key, got %s", entry.Key)
+	}
+}
+
+func TestObjectLiteralString(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`({})`, "{}"},
+		{`({b: 1, a: 2})`, "{b: 1, a: 2}"},
+		{`({a: 1, b,})`, "{a: 1, b}"},
+		{`({...x, [k]: {n: 1}})`, "{...x, [k]: {n: 1}}"},
+	}
+
+	for _, tt := range tests {
+		// 多次解析结果一致，且保持源码顺序
+		for i := 0; i < 3; i++ {
+			if got := parseExpression(t, tt.source).String(); got != tt.want {
+				t.Errorf("%q should print as %q, got %q", tt.source, tt.want, got)
+			}
+		}
+	}
+}
+
+func TestObjectLiteralErrors(t *testing.T) {
+	for _, source := range []string{`({[k] 1})`, `({a 1})`, `({...})`} {
+		p := New(lexer1.New(source))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q should fail to parse", source)
+		}
+	}
+}
+
+func TestDecorators(t *testing.T) {
+	expr := parseExpression(t, `@timing @retry(3, backoff=2, jitter=true) @cache() function f(x) { return x }`)
+	decorated, ok := expr.(*DecoratedFunction)
+	if !ok {
+		t.Fatalf("expression should be *DecoratedFunction, got %T", expr)
+	}
+	if decorated.Function.Name == nil || decorated.Function.Name.Value != "f" {
+		t.Errorf("decorated function should be f, got %s", decorated.Function)
+	}
+
+	want := []string{"@timing", "@retry(3, backoff=2, jitter=true)", "@cache()"}
+	if len(decorated.Decorators) != len(want) {
+		t.Fatalf("there should be %d decorators, got %d", len(want), len(decorated.Decorators))
+	}
+	for i, decorator := range decorated.Decorators {
+		if decorator.String() != want[i] {
+			t.Errorf("decorator %d should be %q, got %q", i, want[i], decorator.String())
+		}
+	}
+	// @timing 没有参数列表，@cache() 有空参数列表
+	if retry := decorated.Decorators[1]; len(retry.Arguments) != 1 || len(retry.Named) != 2 || retry.Named[0].Name.Value != "backoff" {
+		t.Errorf("@retry should have 1 positional and 2 named arguments, got %v %v", retry.Arguments, retry.Named)
+	}
+	if decorated.Decorators[0].Arguments != nil || decorated.Decorators[2].Arguments == nil {
+		t.Errorf("only @cache() should have an argument list")
+	}
+
+	if async := parseExpression(t, `@log async function g() {}`).(*DecoratedFunction); !async.Function.IsAsync {
+		t.Errorf("async functions can be decorated")
+	}
+}
+
+func TestDecoratorOrServiceCall(t *testing.T) {
+	if _, ok := parseExpression(t, `@llm.chat("hi")`).(*ServiceCallExpression); !ok {
+		t.Errorf("@name.method() should be a service call")
+	}
+
+	// 装饰器的参数和函数体中的 @ 仍然是服务调用
+	program := parse(t, "@cache(@cfg.ttl())\nfunction f() { return @llm.chat(\"x\") }\nlet r = @llm.chat(\"y\")")
+	if len(program.Statements) != 2 {
+		t.Fatalf("there should be 2 statements, got %d", len(program.Statements))
+	}
+	decorated, ok := program.Statements[0].(*ExpressionStatement).Expression.(*DecoratedFunction)
+	if !ok {
+		t.Fatalf("first statement should be a decorated function, got %s", program.Statements[0])
+	}
+	if _, ok := decorated.Decorators[0].Arguments[0].(*ServiceCallExpression); !ok {
+		t.Errorf("decorator argument should be a service call, got %T", decorated.Decorators[0].Arguments[0])
+	}
+}
+
+func TestDecoratorErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`@cache let x = 1`, "decorator @cache must be followed by a function declaration"},
+		{`@cache function() {}`, "decorated function must have a name"},
+		{`@cache @llm.chat() function f() {}`, "service call cannot be used as a decorator"},
+		{`@retry(backoff=2, 3) function f() {}`, "positional argument follows named argument"},
+		{`@ function f() {}`, ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer1.New(tt.source))
+		p.ParseProgram()
+		errs := p.Errors()
+		if len(errs) == 0 {
+			t.Errorf("%q should fail to parse", tt.source)
+			continue
+		}
+		if !strings.Contains(errs[0], tt.want) {
+			t.Errorf("%q should fail with %q, got %v", tt.source, tt.want, errs)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package service 提供AI服务调用（@service.method()）的服务提供者实现
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// MockMethod mock服务方法的实现
+type MockMethod func(args []interface{}) (interface{}, error)
+
+// MockCall 一次被记录的调用
+type MockCall struct {
+	Method string
+	Args   []interface{}
+}
+
+// MockProvider 确定性的进程内服务，用于测试和离线运行
+//
+// 默认方法：
+//
+//	echo(args...)      返回唯一的参数，多个参数时返回数组
+//	chat(prompt)       返回 "mock reply: <prompt>"，prompt 也可以是 [{role, content}] 消息数组
+//	complete(prompt)   同 chat
+//	chat_stream(prompt) 以流的形式逐词产出 chat 的回复
+//	embed(text)        返回由文本哈希得到的8维向量
+//	fail(message)      以 message 失败
+type MockProvider struct {
+	mu      sync.Mutex
+	methods map[string]MockMethod
+	calls   []MockCall
+}
+
+// NewMockProvider 创建带默认方法的mock服务
+func NewMockProvider() *MockProvider {
+	m := &MockProvider{methods: make(map[string]MockMethod)}
+	m.Handle("echo", mockEcho)
+	m.Handle("chat", mockChat)
+	m.Handle("complete", mockChat)
+	m.Handle("chat_stream", mockChatStream)
+	m.Handle("embed", mockEmbed)
+	m.Handle("fail", mockFail)
+	return m
+}
+
+// Handle 注册或替换方法
+func (m *MockProvider) Handle(method string, fn MockMethod) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.methods[method] = fn
+}
+
+// Methods 返回已注册的方法名（按字母顺序）
+func (m *MockProvider) Methods() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.methods))
+	for name := range m.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Calls 返回按顺序记录的全部调用
+func (m *MockProvider) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	calls := make([]MockCall, len(m.calls))
+	copy(calls, m.calls)
+	return calls
+}
+
+// Call 实现 vm.ServiceProvider
+func (m *MockProvider) Call(ctx context.Context, method string, args []interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	fn, ok := m.methods[method]
+	m.calls = append(m.calls, MockCall{Method: method, Args: args})
+	m.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", vm.ErrUnknownMethod, method)
+	}
+	return fn(args)
+}
+
+func mockEcho(args []interface{}) (interface{}, error) {
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return args, nil
+}
+
+func mockChat(args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expects a prompt")
+	}
+	return "mock reply: " + promptText(args[0]), nil
+}
+
+func mockChatStream(args []interface{}) (interface{}, error) {
+	reply, err := mockChat(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按空格切分，片段保留结尾的空格，拼接后与 chat 的回复相同
+	var tokens []interface{}
+	text := reply.(string)
+	for text != "" {
+		end := strings.IndexByte(text, ' ')
+		if end < 0 {
+			end = len(text) - 1
+		}
+		tokens = append(tokens, text[:end+1])
+		text = text[end+1:]
+	}
+	return NewSliceStream(tokens...), nil
+}
+
+func mockEmbed(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expects 1 argument, got %d", len(args))
+	}
+
+	h := fnv.New64a()
+	fmt.Fprint(h, args[0])
+	sum := h.Sum64()
+
+	vector := make([]interface{}, 8)
+	for i := range vector {
+		vector[i] = float64((sum>>(i*8))&0xff) / 255
+	}
+	return vector, nil
+}
+
+func mockFail(args []interface{}) (interface{}, error) {
+	message := "mock failure"
+	if len(args) > 0 {
+		message = fmt.Sprint(args[0])
+	}
+	return nil, fmt.Errorf("%s", message)
+}
+
+// promptText 取出提示文本：字符串原样返回，消息数组取最后一条消息的content
+func promptText(prompt interface{}) string {
+	switch prompt := prompt.(type) {
+	case string:
+		return prompt
+	case []interface{}:
+		if len(prompt) == 0 {
+			return ""
+		}
+		if message, ok := prompt[len(prompt)-1].(map[string]interface{}); ok {
+			return fmt.Sprint(message["content"])
+		}
+	}
+	return fmt.Sprint(prompt)
+}
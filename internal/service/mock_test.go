@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 服务调用测试
+// =============================================================================
+
+func TestServiceCalls(t *testing.T) {
+	mock := NewMockProvider()
+	out, err := aqltest.RunScript(t, `
+print(@ai.chat("hello"))
+print(@ai.chat([{role: "user", content: "from messages"}]))
+print(@ai.echo({a: [1, 2.5, "s", null, true]}))
+print(@ai.echo(1, "two"))
+print(@ai.embed("x") == @ai.embed("x"), len(@ai.embed("y")))
+`, map[string]vm.ServiceProvider{"ai": mock})
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	want := "mock reply: hello\n" +
+		"mock reply: from messages\n" +
+		"{a: [1, 2.5, s, nil, true]}\n" +
+		"[1, two]\n" +
+		"true 8\n"
+	if out != want {
+		t.Errorf("output should be %q, got %q", want, out)
+	}
+
+	// 参数按Go值记录：整数为int64，对象为map
+	calls := mock.Calls()
+	if len(calls) != 7 {
+		t.Fatalf("there should be 7 calls, got %d", len(calls))
+	}
+	wantArgs := []interface{}{map[string]interface{}{"a": []interface{}{int64(1), 2.5, "s", nil, true}}}
+	if calls[2].Method != "echo" || !reflect.DeepEqual(calls[2].Args, wantArgs) {
+		t.Errorf("echo should receive %#v, got %s %#v", wantArgs, calls[2].Method, calls[2].Args)
+	}
+}
+
+func TestServiceErrors(t *testing.T) {
+	out, err := aqltest.RunScript(t, `
+try { @ai.fail("quota exceeded") } catch (e) { print(e.name, e.service, e.method, e.message) }
+try { @ai.missing() } catch (e) { print(e.message) }
+try { @nobody.chat("x") } catch (e) { print(e.message) }
+try { @ai.echo(print) } catch (e) { print(e.name, e.message) }
+`, map[string]vm.ServiceProvider{"ai": NewMockProvider()})
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	want := "ServiceError ai fail @ai.fail: quota exceeded\n" +
+		"@ai.missing: service @ai has no method missing\n" +
+		"@nobody.chat: unknown service @nobody\n" +
+		"TypeError @ai.echo: argument 1: cannot convert function to a Go value\n"
+	if out != want {
+		t.Errorf("output should be %q, got %q", want, out)
+	}
+
+	// 未捕获的服务错误保留 *ServiceError
+	_, err = aqltest.RunScript(t, `@ai.fail("down")`, map[string]vm.ServiceProvider{"ai": NewMockProvider()})
+	var serviceErr *vm.ServiceError
+	if !errors.As(err, &serviceErr) || serviceErr.Service != "ai" || serviceErr.Method != "fail" {
+		t.Errorf("an uncaught failure should be a ServiceError for @ai.fail, got %v", err)
+	}
+}
+
+func TestServiceHandlers(t *testing.T) {
+	mock := NewMockProvider()
+	mock.Handle("classify", func(args []interface{}) (interface{}, error) {
+		return map[string]interface{}{"label": "positive", "score": 0.9, "tags": []string{"a", "b"}}, nil
+	})
+	mock.Handle("chat", func(args []interface{}) (interface{}, error) {
+		return "replaced", nil
+	})
+	out, err := aqltest.RunScript(t, `
+let r = @ai.classify("great")
+print(r.label, r.score, r.tags)
+print(@ai.chat("x"))
+`, map[string]vm.ServiceProvider{"ai": mock})
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	if want := "positive 0.9 [a, b]\nreplaced\n"; out != want {
+		t.Errorf("output should be %q, got %q", want, out)
+	}
+
+	want := []string{"chat", "chat_stream", "classify", "complete", "echo", "embed", "fail"}
+	if got := mock.Methods(); !reflect.DeepEqual(got, want) {
+		t.Errorf("methods should be %v, got %v", want, got)
+	}
+
+	// 取消的context不会调用方法
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := mock.Call(ctx, "echo", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("a cancelled call should fail with context.Canceled, got %v", err)
+	}
+}
+
+func TestPipeIntoService(t *testing.T) {
+	out, err := aqltest.RunScript(t, `
+function shout(s) { return s + "!" }
+print("hi" |> shout |> @ai.chat())
+print([1, 2] |> @ai.echo(3))
+`, map[string]vm.ServiceProvider{"ai": NewMockProvider()})
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	// 管道左侧的值作为服务调用的第一个参数
+	if want := "mock reply: hi!\n[[1, 2], 3]\n"; out != want {
+		t.Errorf("output should be %q, got %q", want, out)
+	}
+}
+
+func TestAsyncServiceCalls(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	mock := NewMockProvider()
+	mock.Handle("slow", func(args []interface{}) (interface{}, error) {
+		time.Sleep(delay)
+		return "slow " + args[0].(string), nil
+	})
+
+	start := time.Now()
+	out, err := aqltest.RunScript(t, `
+async function ask(q) { return @ai.slow(q) }
+async function failing() {
+    try { return @ai.fail("down") } catch (e) { return e.name + ": " + e.message }
+}
+print(await all([ask("a"), ask("b"), ask("c"), failing()]))
+`, map[string]vm.ServiceProvider{"ai": mock})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	if want := "[slow a, slow b, slow c, ServiceError: @ai.fail: down]\n"; out != want {
+		t.Errorf("output should be %q, got %q", want, out)
+	}
+	// 异步任务中的服务调用在后台并发执行，总耗时接近一次调用
+	if elapsed >= 2*delay {
+		t.Errorf("three calls from async tasks should run concurrently, took %v", elapsed)
+	}
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// OpenAIConfig OpenAI兼容服务的配置
+type OpenAIConfig struct {
+	BaseURL     string        // API根地址，默认 https://api.openai.com/v1
+	APIKey      string        // Bearer令牌，为空时不发送Authorization头
+	Model       string        // 默认模型
+	Temperature *float64      // 默认温度，nil表示使用服务端默认值
+	MaxTokens   int           // 默认最大生成长度，0表示不限制
+	Timeout     time.Duration // 单次请求超时（流式请求包括读取整个流），0表示不超时
+	Client      *http.Client  // 自定义HTTP客户端，nil时使用http.DefaultClient
+}
+
+// 默认配置
+const (
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	DefaultOpenAIModel   = "gpt-4o-mini"
+)
+
+// OpenAIConfigFromEnv 从环境变量读取配置
+//
+//	AQL_LLM_BASE_URL     API根地址
+//	AQL_LLM_MODEL        模型
+//	AQL_LLM_TEMPERATURE  温度
+//	AQL_LLM_TIMEOUT      超时（Go时长格式，如 30s）
+//	AQL_LLM_API_KEY      API密钥，未设置时使用 OPENAI_API_KEY
+//
+// 返回的 ok 表示是否设置了地址或密钥
+func OpenAIConfigFromEnv() (config OpenAIConfig, ok bool, err error) {
+	config.BaseURL = os.Getenv("AQL_LLM_BASE_URL")
+	config.Model = os.Getenv("AQL_LLM_MODEL")
+	config.APIKey = os.Getenv("AQL_LLM_API_KEY")
+	if config.APIKey == "" {
+		config.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+
+	if value := os.Getenv("AQL_LLM_TEMPERATURE"); value != "" {
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return config, false, fmt.Errorf("AQL_LLM_TEMPERATURE: %w", err)
+		}
+		config.Temperature = &temperature
+	}
+	if value := os.Getenv("AQL_LLM_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return config, false, fmt.Errorf("AQL_LLM_TIMEOUT: %w", err)
+		}
+		config.Timeout = timeout
+	}
+
+	return config, config.BaseURL != "" || config.APIKey != "", nil
+}
+
+// OpenAIProvider 通过HTTP调用OpenAI风格 chat/completions 接口的服务
+//
+// 方法：
+//
+//	chat(prompt [, options])       返回回复文本；prompt 为字符串或 [{role, content}] 消息数组
+//	complete(prompt [, options])   同 chat
+//	chat_raw(prompt [, options])   返回完整的响应对象
+//	chat_stream(prompt [, options]) 以SSE流式请求，返回逐个产出文本片段的协程
+//
+// options 支持 model、temperature、max_tokens、system，覆盖配置中的默认值。
+// 失败时返回 *vm.ServiceError：HTTP错误为 HTTPError（带 status 字段），
+// 超时为 TimeoutError，响应无法解析为 ResponseError。
+type OpenAIProvider struct {
+	config OpenAIConfig
+}
+
+// NewOpenAIProvider 创建OpenAI兼容服务
+func NewOpenAIProvider(config OpenAIConfig) *OpenAIProvider {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultOpenAIBaseURL
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	if config.Model == "" {
+		config.Model = DefaultOpenAIModel
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &OpenAIProvider{config: config}
+}
+
+// Config 返回补齐默认值后的配置
+func (p *OpenAIProvider) Config() OpenAIConfig {
+	return p.config
+}
+
+// chatMessage 对话消息
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatRequest chat/completions 请求体
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+}
+
+// apiErrorBody OpenAI风格的错误响应体
+type apiErrorBody struct {
+	Error struct {
+		Message string      `json:"message"`
+		Type    string      `json:"type"`
+		Code    interface{} `json:"code"`
+	} `json:"error"`
+}
+
+// Call 实现 vm.ServiceProvider
+func (p *OpenAIProvider) Call(ctx context.Context, method string, args []interface{}) (interface{}, error) {
+	switch method {
+	case "chat", "complete":
+		raw, err := p.chat(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		return replyText(raw)
+	case "chat_raw":
+		return p.chat(ctx, args)
+	case "chat_stream":
+		return p.stream(ctx, args)
+	default:
+		return nil, fmt.Errorf("%w: %s", vm.ErrUnknownMethod, method)
+	}
+}
+
+// chat 发送chat/completions请求并返回解码后的JSON响应
+func (p *OpenAIProvider) chat(ctx context.Context, args []interface{}) (map[string]interface{}, error) {
+	request, err := p.buildRequest(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := p.post(ctx, "/chat/completions", request, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// buildRequest 根据脚本参数和默认配置构造请求
+func (p *OpenAIProvider) buildRequest(args []interface{}) (*chatRequest, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("expects (prompt [, options]), got %d argument(s)", len(args))
+	}
+
+	request := &chatRequest{
+		Model:       p.config.Model,
+		Temperature: p.config.Temperature,
+		MaxTokens:   p.config.MaxTokens,
+	}
+
+	var system string
+	if len(args) == 2 && args[1] != nil {
+		options, ok := args[1].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("options must be an object")
+		}
+		for key, value := range options {
+			switch key {
+			case "model":
+				request.Model = fmt.Sprint(value)
+			case "temperature":
+				temperature, ok := toFloat(value)
+				if !ok {
+					return nil, fmt.Errorf("options.temperature must be a number")
+				}
+				request.Temperature = &temperature
+			case "max_tokens":
+				maxTokens, ok := toFloat(value)
+				if !ok {
+					return nil, fmt.Errorf("options.max_tokens must be a number")
+				}
+				request.MaxTokens = int(maxTokens)
+			case "system":
+				system = fmt.Sprint(value)
+			default:
+				return nil, fmt.Errorf("unknown option %q", key)
+			}
+		}
+	}
+
+	messages, err := toMessages(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if system != "" {
+		messages = append([]chatMessage{{Role: "system", Content: system}}, messages...)
+	}
+	request.Messages = messages
+	return request, nil
+}
+
+// post 发送JSON请求，2xx响应解码到out，其他情况返回 *vm.ServiceError
+func (p *OpenAIProvider) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	response, cancel, err := p.send(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return transportError(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return &vm.ServiceError{
+			Name:    "ResponseError",
+			Message: fmt.Sprintf("invalid JSON response: %v", err),
+			Err:     err,
+		}
+	}
+	return nil
+}
+
+// send 发送JSON请求并检查状态码，调用者负责关闭响应体并调用cancel
+func (p *OpenAIProvider) send(ctx context.Context, path string, body interface{}) (*http.Response, context.CancelFunc, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if p.config.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.config.Timeout)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if p.config.APIKey != "" {
+		request.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	}
+
+	response, err := p.config.Client.Do(request)
+	if err != nil {
+		cancel()
+		return nil, nil, transportError(err)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer cancel()
+		defer response.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+		return nil, nil, httpError(response.StatusCode, data)
+	}
+	return response, cancel, nil
+}
+
+// httpError 把非2xx响应转换为 HTTPError
+func httpError(status int, body []byte) error {
+	details := map[string]interface{}{"status": status}
+	message := fmt.Sprintf("HTTP %d", status)
+
+	var apiErr apiErrorBody
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+		message = fmt.Sprintf("HTTP %d: %s", status, apiErr.Error.Message)
+		if apiErr.Error.Type != "" {
+			details["type"] = apiErr.Error.Type
+		}
+		if apiErr.Error.Code != nil {
+			details["code"] = apiErr.Error.Code
+		}
+	} else if text := strings.TrimSpace(string(body)); text != "" {
+		message = fmt.Sprintf("HTTP %d: %s", status, text)
+	}
+
+	return &vm.ServiceError{Name: "HTTPError", Message: message, Details: details}
+}
+
+// transportError 把网络层错误转换为 TimeoutError 或 NetworkError
+func transportError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &vm.ServiceError{Name: "TimeoutError", Message: "request timed out", Err: err}
+	}
+	return &vm.ServiceError{Name: "NetworkError", Message: err.Error(), Err: err}
+}
+
+// replyText 取出响应中第一个选择的回复文本
+func replyText(raw map[string]interface{}) (interface{}, error) {
+	choices, _ := raw["choices"].([]interface{})
+	if len(choices) == 0 {
+		return nil, &vm.ServiceError{Name: "ResponseError", Message: "response has no choices"}
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	message, _ := choice["message"].(map[string]interface{})
+	content, ok := message["content"].(string)
+	if !ok {
+		return nil, &vm.ServiceError{Name: "ResponseError", Message: "response choice has no message content"}
+	}
+	return content, nil
+}
+
+// toMessages 把prompt参数转换为消息列表
+func toMessages(prompt interface{}) ([]chatMessage, error) {
+	switch prompt := prompt.(type) {
+	case string:
+		return []chatMessage{{Role: "user", Content: prompt}}, nil
+	case []interface{}:
+		messages := make([]chatMessage, 0, len(prompt))
+		for i, item := range prompt {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("message %d must be an object", i)
+			}
+			role, _ := entry["role"].(string)
+			content, _ := entry["content"].(string)
+			if role == "" {
+				role = "user"
+			}
+			messages = append(messages, chatMessage{Role: role, Content: content})
+		}
+		return messages, nil
+	default:
+		return nil, fmt.Errorf("prompt must be a string or an array of messages")
+	}
+}
+
+// toFloat 把转换后的AQL数值转为float64
+func toFloat(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	default:
+		return 0, false
+	}
+}
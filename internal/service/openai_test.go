@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 本地OpenAI兼容服务桩
+// =============================================================================
+
+// fakeOpenAI 用httptest实现的chat/completions服务，回复 "echo: <最后一条消息>"
+type fakeOpenAI struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []fakeRequest
+
+	status int           // 非0时直接以该状态码和body应答
+	body   string        // status非0时的响应体
+	delay  time.Duration // 应答前的延迟
+}
+
+// fakeRequest 服务桩收到的请求
+type fakeRequest struct {
+	Path          string
+	Authorization string
+	Body          map[string]interface{}
+}
+
+func newFakeOpenAI(t *testing.T) *fakeOpenAI {
+	f := &fakeOpenAI{}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOpenAI) serve(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, fakeRequest{
+		Path:          r.URL.Path,
+		Authorization: r.Header.Get("Authorization"),
+		Body:          body,
+	})
+	status, errBody, delay := f.status, f.body, f.delay
+	f.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != 0 {
+		w.WriteHeader(status)
+		w.Write([]byte(errBody))
+		return
+	}
+
+	messages, _ := body["messages"].([]interface{})
+	last := ""
+	if len(messages) > 0 {
+		last, _ = messages[len(messages)-1].(map[string]interface{})["content"].(string)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":    "chatcmpl-test",
+		"model": body["model"],
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"message":       map[string]interface{}{"role": "assistant", "content": "echo: " + last},
+			"finish_reason": "stop",
+		}},
+	})
+}
+
+func (f *fakeOpenAI) lastRequest(t *testing.T) fakeRequest {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		t.Fatal("fake server received no requests")
+	}
+	return f.requests[len(f.requests)-1]
+}
+
+// =============================================================================
+// OpenAIProvider测试
+// =============================================================================
+
+func TestOpenAIChatRequest(t *testing.T) {
+	server := newFakeOpenAI(t)
+	temperature := 0.2
+	provider := NewOpenAIProvider(OpenAIConfig{
+		BaseURL:     server.URL + "/v1/",
+		APIKey:      "sk-test",
+		Model:       "test-model",
+		Temperature: &temperature,
+	})
+
+	reply, err := provider.Call(context.Background(), "chat", []interface{}{"hello"})
+	if err != nil {
+		t.Fatalf("chat failed: %v", err)
+	}
+	if reply != "echo: hello" {
+		t.Errorf("reply should be %q, got %q", "echo: hello", reply)
+	}
+
+	request := server.lastRequest(t)
+	if request.Path != "/v1/chat/completions" {
+		t.Errorf("path should be /v1/chat/completions, got %s", request.Path)
+	}
+	if request.Authorization != "Bearer sk-test" {
+		t.Errorf("authorization header should carry the API key, got %q", request.Authorization)
+	}
+	if request.Body["model"] != "test-model" {
+		t.Errorf("model should be test-model, got %v", request.Body["model"])
+	}
+	if request.Body["temperature"] != 0.2 {
+		t.Errorf("temperature should be 0.2, got %v", request.Body["temperature"])
+	}
+}
+
+func TestOpenAIChatOptions(t *testing.T) {
+	server := newFakeOpenAI(t)
+	provider := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL, Model: "default-model"})
+
+	messages := []interface{}{
+		map[string]interface{}{"role": "user", "content": "first"},
+		map[string]interface{}{"role": "assistant", "content": "ok"},
+		map[string]interface{}{"role": "user", "content": "second"},
+	}
+	options := map[string]interface{}{
+		"model":       "other-model",
+		"temperature": int64(1),
+		"max_tokens":  int64(16),
+		"system":      "be brief",
+	}
+	reply, err := provider.Call(context.Background(), "complete", []interface{}{messages, options})
+	if err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if reply != "echo: second" {
+		t.Errorf("reply should answer the last message, got %q", reply)
+	}
+
+	request := server.lastRequest(t)
+	if request.Authorization != "" {
+		t.Errorf("no authorization header expected without API key, got %q", request.Authorization)
+	}
+	if request.Body["model"] != "other-model" || request.Body["max_tokens"] != 16.0 || request.Body["temperature"] != 1.0 {
+		t.Errorf("options should override defaults, got %v", request.Body)
+	}
+	sent := request.Body["messages"].([]interface{})
+	if len(sent) != 4 || sent[0].(map[string]interface{})["role"] != "system" {
+		t.Errorf("system prompt should be prepended, got %v", sent)
+	}
+}
+
+func TestOpenAIUnknownMethod(t *testing.T) {
+	provider := NewOpenAIProvider(OpenAIConfig{BaseURL: "http://127.0.0.1:0"})
+	_, err := provider.Call(context.Background(), "translate", []interface{}{"x"})
+	if !errors.Is(err, vm.ErrUnknownMethod) {
+		t.Errorf("unknown method should wrap ErrUnknownMethod, got %v", err)
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		delay    time.Duration
+		wantName string
+		wantText string
+	}{
+		{"api error", 429, `{"error": {"message": "rate limited", "type": "rate_limit_error"}}`, 0, "HTTPError", "HTTP 429: rate limited"},
+		{"plain error", 502, "bad gateway", 0, "HTTPError", "HTTP 502: bad gateway"},
+		{"invalid json", 200, "not json", 0, "ResponseError", "invalid JSON response"},
+		{"no choices", 200, `{"choices": []}`, 0, "ResponseError", "no choices"},
+		{"timeout", 0, "", time.Second, "TimeoutError", "timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeOpenAI(t)
+			server.status, server.body, server.delay = tt.status, tt.body, tt.delay
+			provider := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL, Timeout: 50 * time.Millisecond})
+
+			_, err := provider.Call(context.Background(), "chat", []interface{}{"hi"})
+			var serviceErr *vm.ServiceError
+			if !errors.As(err, &serviceErr) {
+				t.Fatalf("expected *vm.ServiceError, got %T: %v", err, err)
+			}
+			if serviceErr.Name != tt.wantName {
+				t.Errorf("error name should be %s, got %s", tt.wantName, serviceErr.Name)
+			}
+			if !strings.Contains(serviceErr.Message, tt.wantText) {
+				t.Errorf("error message should contain %q, got %q", tt.wantText, serviceErr.Message)
+			}
+			if tt.status >= 300 && serviceErr.Details["status"] != tt.status {
+				t.Errorf("status detail should be %d, got %v", tt.status, serviceErr.Details["status"])
+			}
+		})
+	}
+}
+
+func TestOpenAIFromScript(t *testing.T) {
+	server := newFakeOpenAI(t)
+	provider := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL})
+
+	out, err := aqltest.RunScript(t, `
+let reply = @llm.chat("ping")
+print(reply)
+print("pong" |> @llm.chat({model: "piped"}))
+`, map[string]vm.ServiceProvider{"llm": provider})
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	if out != "echo: ping\necho: pong\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+	if model := server.lastRequest(t).Body["model"]; model != "piped" {
+		t.Errorf("piped options should reach the request, got model %v", model)
+	}
+}
+
+func TestOpenAIErrorCatchableFromScript(t *testing.T) {
+	server := newFakeOpenAI(t)
+	server.status, server.body = 401, `{"error": {"message": "invalid api key", "code": "invalid_api_key"}}`
+	provider := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL})
+
+	out, err := aqltest.RunScript(t, `
+try {
+    @llm.chat("hi")
+} catch (e) {
+    print(e.name, e.status, e.code, e.service, e.method)
+    print(e.message)
+}
+`, map[string]vm.ServiceProvider{"llm": provider})
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	want := "HTTPError 401 invalid_api_key llm chat\n@llm.chat: HTTP 401: invalid api key\n"
+	if out != want {
+		t.Errorf("output should be %q, got %q", want, out)
+	}
+}
+
+func TestOpenAILongReply(t *testing.T) {
+	server := newFakeOpenAI(t)
+	provider := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL})
+
+	out, err := aqltest.RunScript(t, `
+let prompt = "abcdefghij"
+for (let i = 0; i < 8; i = i + 1) { prompt = prompt + prompt }
+print(len(@llm.chat(prompt)))
+`, map[string]vm.ServiceProvider{"llm": provider})
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	if out != "2566\n" {
+		t.Errorf("replies longer than 1KB should survive intact, got %q", out)
+	}
+}
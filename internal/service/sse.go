@@ -0,0 +1,211 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// server-sent events
+// =============================================================================
+
+// SSEEvent 一个server-sent事件
+type SSEEvent struct {
+	Event string // 事件类型，未指定时为空（即 "message"）
+	Data  string // 数据，多个data行以换行连接
+	ID    string // 最近一次的事件ID
+	Retry int    // 服务端建议的重连间隔（毫秒），未指定时为0
+}
+
+// SSEReader 按 text/event-stream 格式逐个读取事件
+// 支持 \n、\r\n 行结束，忽略注释行（以冒号开头）和未知字段，流结束时不完整的事件被丢弃
+type SSEReader struct {
+	r      *bufio.Reader
+	lastID string
+}
+
+// NewSSEReader 创建事件读取器
+func NewSSEReader(r io.Reader) *SSEReader {
+	return &SSEReader{r: bufio.NewReader(r)}
+}
+
+// Next 读取下一个事件，流结束时返回 io.EOF
+func (s *SSEReader) Next() (SSEEvent, error) {
+	var event SSEEvent
+	var data strings.Builder
+	hasData := false
+
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return SSEEvent{}, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			// 空行分发事件；没有data的事件被忽略
+			if !hasData {
+				event = SSEEvent{}
+				continue
+			}
+			event.Data = data.String()
+			event.ID = s.lastID
+			return event, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				s.lastID = value
+			}
+		case "retry":
+			if retry, err := strconv.Atoi(value); err == nil {
+				event.Retry = retry
+			}
+		}
+
+		if err == io.EOF {
+			return SSEEvent{}, io.EOF
+		}
+	}
+}
+
+// =============================================================================
+// OpenAI流式回复
+// =============================================================================
+
+// chatStreamRequest 带 stream 标志的 chat/completions 请求
+type chatStreamRequest struct {
+	*chatRequest
+	Stream bool `json:"stream"`
+}
+
+// chatStream 把 chat/completions 的SSE流转换为文本片段流，实现 vm.ServiceStream
+type chatStream struct {
+	events *SSEReader
+	body   io.Closer
+	cancel context.CancelFunc
+}
+
+// stream 发送流式请求并返回片段流
+func (p *OpenAIProvider) stream(ctx context.Context, args []interface{}) (vm.ServiceStream, error) {
+	request, err := p.buildRequest(args)
+	if err != nil {
+		return nil, err
+	}
+
+	response, cancel, err := p.send(ctx, "/chat/completions", chatStreamRequest{chatRequest: request, Stream: true})
+	if err != nil {
+		return nil, err
+	}
+	return newChatStream(response, cancel), nil
+}
+
+func newChatStream(response *http.Response, cancel context.CancelFunc) *chatStream {
+	return &chatStream{events: NewSSEReader(response.Body), body: response.Body, cancel: cancel}
+}
+
+// Next 返回下一个非空的内容片段，收到 [DONE] 或流结束时返回 io.EOF
+func (cs *chatStream) Next() (interface{}, error) {
+	for {
+		event, err := cs.events.Next()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, transportError(err)
+		}
+
+		if strings.TrimSpace(event.Data) == "[DONE]" {
+			return nil, io.EOF
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Error *struct {
+				Message string `json:"message"`
+				Type    string `json:"type"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			return nil, &vm.ServiceError{
+				Name:    "ResponseError",
+				Message: fmt.Sprintf("invalid stream chunk: %v", err),
+				Err:     err,
+			}
+		}
+		if chunk.Error != nil {
+			return nil, &vm.ServiceError{
+				Name:    "StreamError",
+				Message: chunk.Error.Message,
+				Details: map[string]interface{}{"type": chunk.Error.Type},
+			}
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			return chunk.Choices[0].Delta.Content, nil
+		}
+	}
+}
+
+// Close 关闭响应体并释放请求的context
+func (cs *chatStream) Close() error {
+	err := cs.body.Close()
+	cs.cancel()
+	return err
+}
+
+// =============================================================================
+// 内存中的流
+// =============================================================================
+
+// sliceStream 依次返回固定元素的流
+type sliceStream struct {
+	items []interface{}
+}
+
+// NewSliceStream 创建依次返回items的流，常用于mock服务
+func NewSliceStream(items ...interface{}) vm.ServiceStream {
+	return &sliceStream{items: items}
+}
+
+// Next 实现 vm.ServiceStream
+func (s *sliceStream) Next() (interface{}, error) {
+	if len(s.items) == 0 {
+		return nil, io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
+
+// Close 实现 vm.ServiceStream
+func (s *sliceStream) Close() error {
+	s.items = nil
+	return nil
+}
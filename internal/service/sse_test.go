@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// SSEReader测试
+// =============================================================================
+
+func TestSSEReaderEvents(t *testing.T) {
+	stream := ": keep-alive comment\n" +
+		"data: first\n" +
+		"\n" +
+		"event: update\r\n" +
+		"id: 7\r\n" +
+		"retry: 1500\r\n" +
+		"data: line one\r\n" +
+		"data:line two\r\n" +
+		"\r\n" +
+		"id: 8\n" +
+		"\n" +
+		"data: third\n" +
+		"\n" +
+		"data: incomplete"
+
+	reader := NewSSEReader(strings.NewReader(stream))
+	want := []SSEEvent{
+		{Data: "first"},
+		{Event: "update", Data: "line one\nline two", ID: "7", Retry: 1500},
+		{Data: "third", ID: "8"},
+	}
+	for i, expected := range want {
+		event, err := reader.Next()
+		if err != nil {
+			t.Fatalf("event %d: unexpected error %v", i, err)
+		}
+		if event != expected {
+			t.Errorf("event %d should be %+v, got %+v", i, expected, event)
+		}
+	}
+
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("incomplete trailing event should be dropped with io.EOF, got %v", err)
+	}
+}
+
+func TestSSEReaderEmpty(t *testing.T) {
+	reader := NewSSEReader(strings.NewReader(""))
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("empty stream should return io.EOF, got %v", err)
+	}
+}
+
+// =============================================================================
+// 本地流式服务桩
+// =============================================================================
+
+// newFakeStream 以SSE格式逐条发送chunks并在每条之后flush的服务桩
+// chunk为字符串时作为内容片段，否则原样编码为data
+func newFakeStream(t *testing.T, chunks ...interface{}) (*httptest.Server, *map[string]interface{}) {
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+
+		for _, chunk := range chunks {
+			data := chunk
+			if text, ok := chunk.(string); ok {
+				data = map[string]interface{}{
+					"choices": []interface{}{map[string]interface{}{
+						"delta": map[string]interface{}{"content": text},
+					}},
+				}
+			}
+			encoded, _ := json.Marshal(data)
+			fmt.Fprintf(w, "data: %s\n\n", encoded)
+			flusher.Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return server, &request
+}
+
+// =============================================================================
+// 流式调用测试
+// =============================================================================
+
+func TestOpenAIChatStream(t *testing.T) {
+	// 角色片段没有内容，应被跳过
+	roleOnly := map[string]interface{}{
+		"choices": []interface{}{map[string]interface{}{"delta": map[string]interface{}{"role": "assistant"}}},
+	}
+	server, request := newFakeStream(t, roleOnly, "Hel", "lo", " world")
+	provider := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL})
+
+	result, err := provider.Call(context.Background(), "chat_stream", []interface{}{"hi"})
+	if err != nil {
+		t.Fatalf("chat_stream failed: %v", err)
+	}
+	stream, ok := result.(vm.ServiceStream)
+	if !ok {
+		t.Fatalf("chat_stream should return a vm.ServiceStream, got %T", result)
+	}
+	defer stream.Close()
+
+	var tokens []string
+	for {
+		token, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+		tokens = append(tokens, token.(string))
+	}
+
+	if got := strings.Join(tokens, "|"); got != "Hel|lo| world" {
+		t.Errorf("tokens should be Hel|lo| world, got %s", got)
+	}
+	if (*request)["stream"] != true {
+		t.Errorf("request should set stream: true, got %v", *request)
+	}
+}
+
+func TestStreamFromScript(t *testing.T) {
+	server, _ := newFakeStream(t, "a", "b", "c")
+	provider := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL})
+
+	out, err := aqltest.RunScript(t, `
+let s = @llm.chat_stream("x")
+print(status(s))
+let text = ""
+for (let token = next(s); status(s) != "dead"; token = next(s)) {
+    text = text + "[" + token + "]"
+}
+print(text, status(s))
+`, map[string]vm.ServiceProvider{"llm": provider})
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	if out != "suspended\n[a][b][c] dead\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestStreamErrorCatchableFromScript(t *testing.T) {
+	failure := map[string]interface{}{"error": map[string]interface{}{"message": "overloaded", "type": "server_error"}}
+	server, _ := newFakeStream(t, "partial", failure)
+	provider := NewOpenAIProvider(OpenAIConfig{BaseURL: server.URL})
+
+	out, err := aqltest.RunScript(t, `
+let s = @llm.chat_stream("x")
+print(next(s))
+try {
+    next(s)
+} catch (e) {
+    print(e.name, e["type"], e.message)
+}
+print(status(s))
+`, map[string]vm.ServiceProvider{"llm": provider})
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	want := "partial\nStreamError server_error @llm.chat_stream: overloaded\ndead\n"
+	if out != want {
+		t.Errorf("output should be %q, got %q", want, out)
+	}
+}
+
+func TestMockChatStream(t *testing.T) {
+	mock := NewMockProvider()
+	result, err := mock.Call(context.Background(), "chat_stream", []interface{}{"a b"})
+	if err != nil {
+		t.Fatalf("chat_stream failed: %v", err)
+	}
+
+	stream := result.(vm.ServiceStream)
+	var text strings.Builder
+	for {
+		token, err := stream.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		text.WriteString(token.(string))
+	}
+
+	reply, _ := mock.Call(context.Background(), "chat", []interface{}{"a b"})
+	if text.String() != reply {
+		t.Errorf("streamed tokens should join to %q, got %q", reply, text.String())
+	}
+}
@@ -0,0 +1,526 @@
+package vm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// =============================================================================
+// 汇编器：把反汇编文本重新转换为函数
+// =============================================================================
+
+// 设计原理：
+// - 输入格式与 Disassemble 的输出相同，VM测试可以手写字节码而不经过编译器：
+//     function add (params=2, stack=3)        函数头，括号部分可省略
+//       source add.aql
+//       constant K0 "hello"                   常量：nil、true、false、整数、浮点数、字符串、
+//                                             <native name>、<function name>
+//       locals R0=a R1=b                      局部变量名
+//       globals G0=total                      全局变量名（主函数）
+//       upvalue U0 n (local R1)               捕获描述：local Rn、upvalue Un 或 global Gn
+//       handler [L1, L2) -> L3                异常处理表项
+//       ; line 3                              之后的指令属于源码第3行
+//     L1:                                     标签
+//       0000  ADD  R2, R0, R1                 指令，前导序号仅供阅读
+// - 第一个函数为主函数，其余函数通过 <function name> 常量引用，汇编后注册到 FunctionRegistry；
+//   函数名的 #n 后缀只用于区分重名函数，不属于函数名
+// - 跳转操作数写标签或 @pc，汇编为相对偏移；";" 之后为注释
+// - 未写 stack 时按指令使用的最大寄存器计算栈大小
+
+var (
+	asmLabelPattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*:$`)
+	asmLinePattern    = regexp.MustCompile(`^;\s*line\s+(\d+)$`)
+	asmUpvaluePattern = regexp.MustCompile(`^U(\d+)\s+(\S+)\s+\((local R|upvalue U|global G)(\d+)\)$`)
+	asmHandlerPattern = regexp.MustCompile(`^\[\s*(\S+)\s*,\s*(\S+)\s*\)\s*->\s*(\S+)$`)
+	asmFunctionSuffix = regexp.MustCompile(`#\d+$`)
+)
+
+// opCodesByName 助记符到操作码的映射
+var opCodesByName = func() map[string]OpCode {
+	m := make(map[string]OpCode, len(opCodeNames))
+	for op, name := range opCodeNames {
+		m[name] = op
+	}
+	return m
+}()
+
+// asmFunction 汇编中的函数
+type asmFunction struct {
+	fn        *Function
+	key       string // 含 #n 后缀的函数名，用于 <function name> 引用
+	line      int    // 函数头所在行
+	hasStack  bool
+	constants int            // 函数头声明的常量数量，-1表示未声明
+	srcLine   int            // 当前 "; line N" 指定的源码行
+	labels    map[string]int // 标签 -> 指令位置
+	jumps     []asmFixup     // 待解析的跳转
+	handlers  []asmHandler   // 待解析的异常处理表项
+	functions []asmFixup     // 待解析的函数常量
+}
+
+// asmFixup 需要在函数解析完成后回填的引用
+type asmFixup struct {
+	index int    // 指令位置或常量下标
+	name  string // 标签或函数名
+	line  int
+}
+
+// asmHandler 标签形式的异常处理表项
+type asmHandler struct {
+	start, end, handler string
+	line                int
+}
+
+// Assemble 把汇编文本转换为主函数，嵌套函数注册到全局函数注册表
+func Assemble(source string) (*Function, error) {
+	var functions []*asmFunction
+	var current *asmFunction
+
+	for i, raw := range strings.Split(source, "\n") {
+		lineNo := i + 1
+		text := strings.TrimSpace(raw)
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, ";") {
+			if m := asmLinePattern.FindStringSubmatch(text); m != nil && current != nil {
+				current.srcLine, _ = strconv.Atoi(m[1])
+			}
+			continue
+		}
+		text = strings.TrimSpace(stripAsmComment(text))
+
+		directive, rest, _ := strings.Cut(text, " ")
+		rest = strings.TrimSpace(rest)
+		if directive == "function" {
+			af, err := parseAsmHeader(rest, lineNo)
+			if err != nil {
+				return nil, err
+			}
+			for _, other := range functions {
+				if other.key == af.key {
+					return nil, asmError(lineNo, "function %s is already defined on line %d", af.key, other.line)
+				}
+			}
+			functions = append(functions, af)
+			current = af
+			continue
+		}
+		if current == nil {
+			// 没有函数头时指令属于隐式的主函数
+			current = newAsmFunction("main", lineNo)
+			functions = append(functions, current)
+		}
+
+		var err error
+		switch {
+		case asmLabelPattern.MatchString(text):
+			name := strings.TrimSuffix(text, ":")
+			if _, dup := current.labels[name]; dup {
+				return nil, asmError(lineNo, "label %s is already defined", name)
+			}
+			current.labels[name] = len(current.fn.Instructions)
+		case directive == "source":
+			current.fn.Source = rest
+		case directive == "constant":
+			err = current.parseConstant(rest, lineNo)
+		case directive == "locals":
+			current.fn.LocalNames, err = parseAsmNames(rest, "R", current.fn.LocalNames, lineNo)
+		case directive == "globals":
+			current.fn.GlobalNames, err = parseAsmNames(rest, "G", current.fn.GlobalNames, lineNo)
+		case directive == "upvalue":
+			err = current.parseUpvalue(rest, lineNo)
+		case directive == "handler":
+			m := asmHandlerPattern.FindStringSubmatch(rest)
+			if m == nil {
+				return nil, asmError(lineNo, "handler should look like [start, end) -> handler, got %q", rest)
+			}
+			current.handlers = append(current.handlers, asmHandler{m[1], m[2], m[3], lineNo})
+		default:
+			err = current.parseInstruction(text, lineNo)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(functions) == 0 {
+		return nil, fmt.Errorf("no function to assemble")
+	}
+	return linkAsmFunctions(functions)
+}
+
+// linkAsmFunctions 解析标签、注册嵌套函数并回填函数常量
+func linkAsmFunctions(functions []*asmFunction) (*Function, error) {
+	ids := make(map[string]int, len(functions))
+	for i, af := range functions {
+		if err := af.resolveLabels(); err != nil {
+			return nil, err
+		}
+		// 函数头中的 constants 只用于核对，常量表由 constant 行决定
+		if af.constants >= 0 && af.constants != len(af.fn.Constants) {
+			return nil, asmError(af.line, "function %s declares %d constants but defines %d", af.key, af.constants, len(af.fn.Constants))
+		}
+		if !af.hasStack {
+			af.fn.MaxStackSize = asmStackSize(af.fn)
+		}
+		if i > 0 {
+			ids[af.key] = RegisterFunction(af.fn)
+		}
+	}
+
+	for _, af := range functions {
+		for _, ref := range af.functions {
+			id, ok := ids[ref.name]
+			if !ok {
+				if ref.name == functions[0].key {
+					return nil, asmError(ref.line, "the main function cannot be referenced as a constant")
+				}
+				return nil, asmError(ref.line, "undefined function %s", ref.name)
+			}
+			af.fn.Constants[ref.index] = NewFunctionValueGCFromID(id)
+		}
+	}
+	return functions[0].fn, nil
+}
+
+func newAsmFunction(key string, line int) *asmFunction {
+	fn := NewFunction(asmFunctionSuffix.ReplaceAllString(key, ""))
+	return &asmFunction{fn: fn, key: key, line: line, constants: -1, labels: map[string]int{}}
+}
+
+// parseAsmHeader 解析函数头 "name (params=N, stack=S, constants=C, vararg, async, generator)"
+func parseAsmHeader(text string, line int) (*asmFunction, error) {
+	name, attrs := text, ""
+	if i := strings.Index(text, " ("); i >= 0 && strings.HasSuffix(text, ")") {
+		name, attrs = text[:i], text[i+2:len(text)-1]
+	}
+	if name == "" {
+		return nil, asmError(line, "function name is missing")
+	}
+	af := newAsmFunction(name, line)
+
+	constants := -1
+	for _, attr := range strings.Split(attrs, ",") {
+		attr = strings.TrimSpace(attr)
+		key, value, hasValue := strings.Cut(attr, "=")
+		switch {
+		case attr == "":
+		case attr == "vararg":
+			af.fn.IsVarArg = true
+		case attr == "async":
+			af.fn.IsAsync = true
+		case attr == "generator":
+			af.fn.IsGenerator = true
+		case hasValue && (key == "params" || key == "stack" || key == "constants"):
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, asmError(line, "%s should be a non-negative integer, got %q", key, value)
+			}
+			switch key {
+			case "params":
+				af.fn.ParamCount = n
+			case "stack":
+				af.fn.MaxStackSize, af.hasStack = n, true
+			default:
+				constants = n
+			}
+		default:
+			return nil, asmError(line, "unknown function attribute %q", attr)
+		}
+	}
+	af.constants = constants
+	return af, nil
+}
+
+// parseConstant 解析 "K<n> literal"，n 必须按顺序递增
+func (af *asmFunction) parseConstant(text string, line int) error {
+	index, literal, _ := strings.Cut(text, " ")
+	n, err := parseAsmIndex(index, "K")
+	if err != nil {
+		return asmError(line, "%v", err)
+	}
+	if n != len(af.fn.Constants) {
+		return asmError(line, "constant K%d should be K%d", n, len(af.fn.Constants))
+	}
+
+	literal = strings.TrimSpace(literal)
+	if name, ok := strings.CutPrefix(literal, "<function "); ok && strings.HasSuffix(name, ">") {
+		af.functions = append(af.functions, asmFixup{index: n, name: strings.TrimSuffix(name, ">"), line: line})
+		af.fn.Constants = append(af.fn.Constants, NewNilValueGC())
+		return nil
+	}
+	value, err := parseAsmLiteral(literal)
+	if err != nil {
+		return asmError(line, "%v", err)
+	}
+	af.fn.Constants = append(af.fn.Constants, value)
+	return nil
+}
+
+// parseAsmLiteral 解析常量字面量（函数引用除外）
+func parseAsmLiteral(literal string) (ValueGC, error) {
+	switch literal {
+	case "nil":
+		return NewNilValueGC(), nil
+	case "true":
+		return NewBoolValueGC(true), nil
+	case "false":
+		return NewBoolValueGC(false), nil
+	}
+	if strings.HasPrefix(literal, `"`) {
+		s, err := strconv.Unquote(literal)
+		if err != nil {
+			return NewNilValueGC(), fmt.Errorf("invalid string literal %s", literal)
+		}
+		return NewStringValueGC(s), nil
+	}
+	if name, ok := strings.CutPrefix(literal, "<native "); ok && strings.HasSuffix(name, ">") {
+		name = strings.TrimSuffix(name, ">")
+		index, ok := GlobalNativeRegistry.Lookup(name)
+		if !ok {
+			return NewNilValueGC(), fmt.Errorf("unknown native function: %s", name)
+		}
+		return NewNativeFunctionValueGC(index), nil
+	}
+	if n, err := strconv.ParseInt(literal, 10, 32); err == nil {
+		return NewSmallIntValueGC(int32(n)), nil
+	}
+	if f, err := strconv.ParseFloat(literal, 64); err == nil {
+		return NewDoubleValueGC(f), nil
+	}
+	return NewNilValueGC(), fmt.Errorf("invalid constant %q", literal)
+}
+
+// parseAsmNames 解析 "R0=a R2=b" 形式的变量名表
+func parseAsmNames(text, prefix string, names []string, line int) ([]string, error) {
+	for _, item := range strings.Fields(text) {
+		index, name, ok := strings.Cut(item, "=")
+		n, err := parseAsmIndex(index, prefix)
+		if !ok || name == "" || err != nil {
+			return nil, asmError(line, "name should look like %s0=name, got %q", prefix, item)
+		}
+		for len(names) <= n {
+			names = append(names, "")
+		}
+		names[n] = name
+	}
+	return names, nil
+}
+
+// parseUpvalue 解析 "U<n> name (local Rx|upvalue Ux|global Gx)"
+func (af *asmFunction) parseUpvalue(text string, line int) error {
+	m := asmUpvaluePattern.FindStringSubmatch(text)
+	if m == nil {
+		return asmError(line, "upvalue should look like U0 name (local R1), got %q", text)
+	}
+	if n, _ := strconv.Atoi(m[1]); n != len(af.fn.Upvalues) {
+		return asmError(line, "upvalue U%d should be U%d", n, len(af.fn.Upvalues))
+	}
+	index, _ := strconv.Atoi(m[4])
+	kind := map[string]UpvalueKind{"local R": UpvalueLocal, "upvalue U": UpvalueOuter, "global G": UpvalueGlobal}[m[3]]
+	af.fn.Upvalues = append(af.fn.Upvalues, UpvalueDesc{Name: m[2], Kind: kind, Index: index})
+	return nil
+}
+
+// parseInstruction 解析 "[pc] MNEMONIC operand, ..."
+func (af *asmFunction) parseInstruction(text string, line int) error {
+	fields := strings.Fields(text)
+	if _, err := strconv.Atoi(fields[0]); err == nil {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return asmError(line, "missing instruction")
+	}
+	mnemonic := fields[0]
+	var operands []string
+	if args := strings.TrimSpace(strings.Join(fields[1:], " ")); args != "" {
+		for _, arg := range strings.Split(args, ",") {
+			operands = append(operands, strings.TrimSpace(arg))
+		}
+	}
+
+	pc := len(af.fn.Instructions)
+	inst, err := af.instruction(pc, mnemonic, operands, line)
+	if err != nil {
+		return err
+	}
+	af.fn.Instructions = append(af.fn.Instructions, inst)
+	af.fn.LineNumbers = append(af.fn.LineNumbers, af.srcLine)
+	af.fn.Columns = append(af.fn.Columns, 0)
+	return nil
+}
+
+// instruction 按操作码的操作数声明解析操作数
+func (af *asmFunction) instruction(pc int, mnemonic string, operands []string, line int) (Instruction, error) {
+	op, ok := opCodesByName[mnemonic]
+	if !ok {
+		// OP_<n> a, b, c, bx：反汇编对未知操作码的原始输出
+		code, isRaw := strings.CutPrefix(mnemonic, "OP_")
+		n, err := strconv.ParseUint(code, 10, 8)
+		if !isRaw || err != nil {
+			return Instruction{}, asmError(line, "unknown instruction %s", mnemonic)
+		}
+		if len(operands) != 4 {
+			return Instruction{}, asmError(line, "%s expects 4 raw operands, got %d", mnemonic, len(operands))
+		}
+		fields := make([]int, 4)
+		for i, operand := range operands {
+			if fields[i], err = strconv.Atoi(operand); err != nil {
+				return Instruction{}, asmError(line, "invalid raw operand %q", operand)
+			}
+		}
+		return Instruction{OpCode: OpCode(n), A: fields[0], B: fields[1], C: fields[2], Bx: fields[3]}, nil
+	}
+
+	specs := opCodeOperands[op]
+	if len(operands) != len(specs) {
+		return Instruction{}, asmError(line, "%s expects %d operands, got %d", mnemonic, len(specs), len(operands))
+	}
+	inst := Instruction{OpCode: op}
+	for i, spec := range specs {
+		var v int
+		var err error
+		operand := operands[i]
+		switch spec.kind {
+		case operandRegister:
+			v, err = parseAsmIndex(operand, "R")
+		case operandConstant:
+			if op == OP_IMPORT && operand == "*" {
+				v = -1
+			} else {
+				v, err = parseAsmIndex(operand, "K")
+			}
+		case operandGlobal:
+			v, err = parseAsmIndex(operand, "G")
+		case operandUpvalue:
+			v, err = parseAsmIndex(operand, "U")
+		case operandJump:
+			af.jumps = append(af.jumps, asmFixup{index: pc, name: operand, line: line})
+		default:
+			v, err = strconv.Atoi(operand)
+		}
+		if err != nil {
+			return Instruction{}, asmError(line, "%s operand %d: %v", mnemonic, i+1, err)
+		}
+		switch spec.field {
+		case fieldA:
+			inst.A = v
+		case fieldB:
+			inst.B = v
+		case fieldC:
+			inst.C = v
+		default:
+			inst.Bx = v
+		}
+	}
+	return inst, nil
+}
+
+// resolveLabels 回填跳转偏移和异常处理表
+func (af *asmFunction) resolveLabels() error {
+	target := func(name string, line int) (int, error) {
+		if pc, ok := strings.CutPrefix(name, "@"); ok {
+			n, err := strconv.Atoi(pc)
+			if err != nil {
+				return 0, asmError(line, "invalid instruction position %s", name)
+			}
+			return n, nil
+		}
+		pc, ok := af.labels[name]
+		if !ok {
+			return 0, asmError(line, "undefined label %s", name)
+		}
+		return pc, nil
+	}
+
+	for _, jump := range af.jumps {
+		pc, err := target(jump.name, jump.line)
+		if err != nil {
+			return err
+		}
+		af.fn.Instructions[jump.index].Bx = pc - jump.index
+	}
+	for _, h := range af.handlers {
+		start, err := target(h.start, h.line)
+		if err != nil {
+			return err
+		}
+		end, err := target(h.end, h.line)
+		if err != nil {
+			return err
+		}
+		handler, err := target(h.handler, h.line)
+		if err != nil {
+			return err
+		}
+		af.fn.Handlers = append(af.fn.Handlers, ExceptionHandler{StartPC: start, EndPC: end, HandlerPC: handler})
+	}
+	return nil
+}
+
+// asmStackSize 按指令使用的寄存器计算栈大小
+func asmStackSize(fn *Function) int {
+	size := fn.ParamCount
+	use := func(reg int) {
+		if reg+1 > size {
+			size = reg + 1
+		}
+	}
+	for _, inst := range fn.Instructions {
+		for _, spec := range opCodeOperands[inst.OpCode] {
+			if spec.kind == operandRegister {
+				use(spec.field.value(inst))
+			}
+		}
+		// 调用和闭包指令隐式使用其后的连续寄存器
+		switch inst.OpCode {
+		case OP_CALL, OP_ASYNC_CALL, OP_SERVICE_CALL:
+			use(inst.A + inst.B - 1)
+		case OP_MAKE_CLOSURE:
+			use(inst.B + inst.C)
+		case OP_RETURN:
+			use(inst.A + inst.B - 1)
+		}
+	}
+	for i := range fn.LocalNames {
+		use(i)
+	}
+	return size
+}
+
+// parseAsmIndex 解析 R3、K0 等带前缀的非负索引
+func parseAsmIndex(text, prefix string) (int, error) {
+	digits, ok := strings.CutPrefix(text, prefix)
+	n, err := strconv.Atoi(digits)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("expected %s<n>, got %q", prefix, text)
+	}
+	return n, nil
+}
+
+// stripAsmComment 去掉 ";" 开始的注释，字符串常量中的 ";" 除外
+func stripAsmComment(text string) string {
+	inString := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case ';':
+			if !inString {
+				return text[:i]
+			}
+		}
+	}
+	return text
+}
+
+func asmError(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
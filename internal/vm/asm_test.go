@@ -0,0 +1,124 @@
+package vm_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhnt/aql/internal/vm"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/asm")
+
+// =============================================================================
+// 汇编器测试
+// =============================================================================
+
+// TestAssembleGolden 汇编 testdata/asm 中的程序并运行，输出与 .golden 文件比较
+func TestAssembleGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "asm", "*.aqlasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no assembler test found")
+	}
+
+	for _, path := range files {
+		name := strings.TrimSuffix(filepath.Base(path), ".aqlasm")
+		t.Run(name, func(t *testing.T) {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+			function, err := vm.Assemble(string(source))
+			if err != nil {
+				t.Fatalf("assemble: %v", err)
+			}
+
+			results, err := executor.Execute(function, nil)
+			for _, result := range results {
+				out.WriteString("=> " + result.String() + "\n")
+			}
+			if err != nil {
+				out.WriteString("error: " + err.Error() + "\n")
+			}
+
+			golden := strings.TrimSuffix(path, ".aqlasm") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, out.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Errorf("output differs from %s:\nwant:\n%s\ngot:\n%s", golden, want, out.Bytes())
+			}
+
+			// 反汇编再汇编应得到相同的程序
+			text := vm.Disassemble(function)
+			again, err := vm.Assemble(text)
+			if err != nil {
+				t.Fatalf("reassemble: %v\n%s", err, text)
+			}
+			if got := vm.Disassemble(again); got != text {
+				t.Errorf("reassembled program differs:\nwant:\n%s\ngot:\n%s", text, got)
+			}
+		})
+	}
+}
+
+// TestAssembleDisassembly 编译 examples 和 testdata 中的程序，反汇编后重新汇编，两次反汇编结果应相同
+func TestAssembleDisassembly(t *testing.T) {
+	newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	for _, path := range sourceFiles(t) {
+		function := compileFile(path)
+		if function == nil {
+			continue
+		}
+		t.Run(strings.TrimPrefix(path, "../../"), func(t *testing.T) {
+			text := vm.Disassemble(function)
+			assembled, err := vm.Assemble(text)
+			if err != nil {
+				t.Fatalf("assemble: %v", err)
+			}
+			if got := vm.Disassemble(assembled); got != text {
+				t.Errorf("disassembly changed after assembling:\nwant:\n%s\ngot:\n%s", text, got)
+			}
+		})
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"unknown instruction", "NOPE R0", "line 1: unknown instruction NOPE"},
+		{"operand count", "MOVE R0", "line 1: MOVE expects 2 operands, got 1"},
+		{"operand kind", "LOADK R0, R1", `LOADK operand 2: expected K<n>, got "R1"`},
+		{"undefined label", "JUMP done", "line 1: undefined label done"},
+		{"constant order", "function main\n  constant K1 1", "line 2: constant K1 should be K0"},
+		{"undefined function", "function main\n  constant K0 <function nope>", "line 2: undefined function nope"},
+		{"unknown native", "function main\n  constant K0 <native nope>", "unknown native function: nope"},
+		{"constant count", "function main (constants=2)\n  constant K0 1", "declares 2 constants but defines 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := vm.Assemble(tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error should mention %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
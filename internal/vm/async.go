@@ -0,0 +1,599 @@
+package vm
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// async/await 与事件循环
+// =============================================================================
+
+// 设计原理：
+// - 调用 async 函数不执行函数体，而是创建一个异步任务（以协程承载）并返回promise，
+//   任务在事件循环中启动，函数返回时兑现promise，未捕获的异常拒绝promise
+// - 任务中的 await 遇到未完成的promise时挂起任务，promise完成后任务重新进入就绪队列
+// - 脚本顶层的 await 在当前线程驱动事件循环，直到promise完成
+// - 事件循环是单线程的：就绪回调按FIFO顺序执行，定时器按（到期时间，创建顺序）执行，
+//   宿主goroutine只能通过 Hold 返回的投递函数把完成回调交给事件循环线程
+// - 确定性模式下定时器使用虚拟时钟，Go 提交的工作按提交顺序在事件循环线程上执行，
+//   同一脚本每次运行的调度顺序完全一致，便于测试
+
+// ValueGCTypePromise promise类型（内联存储promise ID）
+const ValueGCTypePromise ValueTypeGC = ValueGCTypeCoroutine + 1
+
+// PromiseState promise状态
+type PromiseState int
+
+const (
+	PromisePending   PromiseState = iota // 未完成
+	PromiseFulfilled                     // 已兑现
+	PromiseRejected                      // 已拒绝
+)
+
+// String 返回状态名
+func (s PromiseState) String() string {
+	switch s {
+	case PromisePending:
+		return "pending"
+	case PromiseFulfilled:
+		return "fulfilled"
+	case PromiseRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// Promise 异步结果
+// Resolve/Reject 必须在事件循环线程上调用（原生函数中或 Hold/Go 的完成回调中）
+type Promise struct {
+	ID     int
+	State  PromiseState
+	Result ValueGC // 兑现值或拒绝原因
+
+	executor   *Executor
+	callbacks  []func(*Promise) // 完成后按注册顺序执行的回调
+	delivering int              // 已进入就绪队列、尚未执行的回调数量
+	handled    bool             // 是否有await或组合器观察了结果
+	failure    error            // 异步任务失败时的原始错误（带调用栈）
+}
+
+// NewPromiseValueGC 创建promise值
+func NewPromiseValueGC(id int) ValueGC {
+	return ValueGC{
+		typeAndFlags: uint64(ValueGCTypePromise) | ValueGCFlagInline,
+		data:         uint64(id),
+	}
+}
+
+// IsPromise 判断是否为promise
+func (v ValueGC) IsPromise() bool { return v.Type() == ValueGCTypePromise }
+
+// AsPromiseID 获取promise ID
+func (v ValueGC) AsPromiseID() int { return int(v.data) }
+
+// NewPromise 创建未完成的promise
+func (e *Executor) NewPromise() *Promise {
+	if e.promises == nil {
+		e.promises = make(map[int]*Promise)
+	}
+	e.nextPromiseID++
+	p := &Promise{
+		ID:       e.nextPromiseID,
+		State:    PromisePending,
+		Result:   NewNilValueGC(),
+		executor: e,
+	}
+	e.promises[p.ID] = p
+	return p
+}
+
+// Promise 根据promise值查找promise
+func (e *Executor) Promise(v ValueGC) (*Promise, error) {
+	if !v.IsPromise() {
+		return nil, fmt.Errorf("expected promise, got %s", TypeName(v))
+	}
+	p, exists := e.promises[v.AsPromiseID()]
+	if !exists {
+		return nil, fmt.Errorf("promise #%d not found", v.AsPromiseID())
+	}
+	return p, nil
+}
+
+// retain 在异步操作完成前保持values可达，返回释放函数
+// 用于只被定时器或promise回调等Go状态引用的脚本值，CollectUnreachable 把它们当作根
+func (e *Executor) retain(values ...ValueGC) (release func()) {
+	if e.retained == nil {
+		e.retained = make(map[int][]ValueGC)
+	}
+	e.nextRetainID++
+	id := e.nextRetainID
+	e.retained[id] = values
+	return func() { delete(e.retained, id) }
+}
+
+// Value 返回promise的脚本值
+func (p *Promise) Value() ValueGC {
+	return NewPromiseValueGC(p.ID)
+}
+
+// Resolve 以value兑现promise；value本身是promise时跟随它的结果
+func (p *Promise) Resolve(value ValueGC) {
+	if p.State != PromisePending {
+		return
+	}
+	if value.IsPromise() {
+		if other, err := p.executor.Promise(value); err == nil && other != p {
+			other.then(func(other *Promise) {
+				p.failure = other.failure
+				p.settle(other.State, other.Result)
+			})
+			return
+		}
+	}
+	p.settle(PromiseFulfilled, value)
+}
+
+// Reject 以reason拒绝promise
+func (p *Promise) Reject(reason ValueGC) {
+	if p.State != PromisePending {
+		return
+	}
+	p.settle(PromiseRejected, reason)
+}
+
+// settle 完成promise并把回调放入就绪队列
+func (p *Promise) settle(state PromiseState, result ValueGC) {
+	p.State = state
+	p.Result = result
+	callbacks := p.callbacks
+	p.callbacks = nil
+	for _, callback := range callbacks {
+		p.deliver(callback)
+	}
+	if state == PromiseRejected && !p.handled {
+		loop := p.executor.Loop()
+		loop.rejected = append(loop.rejected, p)
+	}
+}
+
+// then 注册完成回调并标记结果已被观察；已完成时回调直接进入就绪队列
+func (p *Promise) then(callback func(*Promise)) {
+	p.handled = true
+	p.watch(callback)
+}
+
+// watch 注册完成回调但不标记结果已被观察，无人处理的拒绝仍会被报告
+func (p *Promise) watch(callback func(*Promise)) {
+	if p.State == PromisePending {
+		p.callbacks = append(p.callbacks, callback)
+		return
+	}
+	p.deliver(callback)
+}
+
+func (p *Promise) deliver(callback func(*Promise)) {
+	p.delivering++
+	p.executor.Loop().Enqueue(func() {
+		p.delivering--
+		callback(p)
+	})
+}
+
+// err 返回拒绝原因对应的Go错误，异步任务失败时保留原始调用栈
+func (p *Promise) err() error {
+	if p.failure != nil {
+		return p.failure
+	}
+	return &ThrowError{Value: p.Result}
+}
+
+// =============================================================================
+// 异步任务
+// =============================================================================
+
+// startAsync 以已准备好参数和upvalue的栈帧创建异步任务，返回任务的promise值
+func (e *Executor) startAsync(frame *StackFrame) ValueGC {
+	co := e.createCoroutine(frame)
+	co.promise = e.NewPromise()
+
+	if e.tasks == nil {
+		e.tasks = make(map[*Coroutine]bool)
+	}
+	e.tasks[co] = true
+
+	e.Loop().Enqueue(func() {
+		e.stepTask(co, NewNilValueGC(), false)
+	})
+	return co.promise.Value()
+}
+
+// stepTask 运行异步任务直到下一次挂起或结束
+func (e *Executor) stepTask(co *Coroutine, value ValueGC, throw bool) {
+	result, err := e.resume(co, value, throw)
+	switch {
+	case err != nil:
+		delete(e.tasks, co)
+		co.promise.failure = err
+		co.promise.Reject(exceptionValue(err))
+	case co.Status == CoroutineDead:
+		delete(e.tasks, co)
+		co.promise.Resolve(result)
+	}
+}
+
+// executeAwait AWAIT A B : R(A) := await R(B)
+// 非promise值直接作为结果；异步任务中遇到未完成的promise时挂起任务，
+// 在任务之外（脚本顶层）则驱动事件循环直到promise完成
+func (e *Executor) executeAwait(inst Instruction) error {
+	frame := e.CurrentFrame
+	value := frame.GetRegister(inst.B)
+
+	if !value.IsPromise() {
+		if err := e.setRegisterWithGC(frame, inst.A, value); err != nil {
+			return err
+		}
+		frame.PC++
+		return nil
+	}
+
+	p, err := e.Promise(value)
+	if err != nil {
+		return err
+	}
+	p.handled = true
+
+	if p.State == PromisePending {
+		if co := e.currentCoroutine(); co != nil && co.promise != nil {
+			p.then(func(p *Promise) {
+				e.stepTask(co, p.Result, p.State == PromiseRejected)
+			})
+			e.suspend(co)
+			return nil
+		}
+
+		if !e.Loop().runUntil(func() bool { return p.State != PromisePending }) {
+			return fmt.Errorf("await: promise #%d can never settle, the event loop is idle", p.ID)
+		}
+	}
+
+	if p.State == PromiseRejected {
+		return p.err()
+	}
+	if err := e.setRegisterWithGC(frame, inst.A, p.Result); err != nil {
+		return err
+	}
+	frame.PC++
+	return nil
+}
+
+// Await 驱动事件循环直到promise完成，返回兑现值；被拒绝时返回拒绝原因对应的错误
+// 非promise值原样返回。不能在异步任务内部调用（任务应使用await挂起）
+func (e *Executor) Await(v ValueGC) (ValueGC, error) {
+	if !v.IsPromise() {
+		return v, nil
+	}
+	p, err := e.Promise(v)
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	p.handled = true
+
+	if !e.Loop().runUntil(func() bool { return p.State != PromisePending }) {
+		return NewNilValueGC(), fmt.Errorf("await: promise #%d can never settle, the event loop is idle", p.ID)
+	}
+	if p.State == PromiseRejected {
+		return NewNilValueGC(), p.err()
+	}
+	return p.Result, nil
+}
+
+// drainEventLoop 主函数结束后运行事件循环直到空闲，返回第一个无人处理的拒绝
+func (e *Executor) drainEventLoop() error {
+	if e.loop == nil {
+		return nil
+	}
+	e.loop.Run()
+
+	rejected := e.loop.rejected
+	e.loop.rejected = nil
+	for _, p := range rejected {
+		if !p.handled {
+			unhandled := *newRuntimeError(nil, p.err())
+			unhandled.Message = "unhandled promise rejection: " + unhandled.Message
+			return &unhandled
+		}
+	}
+	return nil
+}
+
+// =============================================================================
+// 事件循环
+// =============================================================================
+
+// EventLoop 执行器的单线程事件循环
+type EventLoop struct {
+	ready  []func()   // 就绪回调，FIFO
+	timers timerQueue // 定时器，按到期时间和创建顺序排列
+
+	completions chan func() // 宿主goroutine投递的完成回调
+	pending     int         // 已 Hold、尚未投递完成回调的宿主操作数量
+
+	deterministic bool
+	clock         time.Duration // 确定性模式下的虚拟时钟
+	start         time.Time
+	timerSeq      uint64
+
+	rejected []*Promise // 拒绝时还没有被观察的promise
+}
+
+// Loop 返回执行器的事件循环
+func (e *Executor) Loop() *EventLoop {
+	if e.loop == nil {
+		e.loop = &EventLoop{
+			completions: make(chan func(), 64),
+			start:       time.Now(),
+		}
+	}
+	return e.loop
+}
+
+// SetDeterministic 开启或关闭确定性模式
+// 确定性模式下定时器使用虚拟时钟（不实际等待），Go 提交的工作在事件循环线程上按顺序执行
+func (l *EventLoop) SetDeterministic(deterministic bool) {
+	l.deterministic = deterministic
+}
+
+// Deterministic 是否处于确定性模式
+func (l *EventLoop) Deterministic() bool {
+	return l.deterministic
+}
+
+// Now 返回事件循环创建以来经过的时间（确定性模式下为虚拟时间）
+func (l *EventLoop) Now() time.Duration {
+	if l.deterministic {
+		return l.clock
+	}
+	return time.Since(l.start)
+}
+
+// Enqueue 把回调放入就绪队列（事件循环线程）
+func (l *EventLoop) Enqueue(fn func()) {
+	l.ready = append(l.ready, fn)
+}
+
+// SetTimeout 在delay之后执行fn（事件循环线程），返回取消函数
+// 取消的定时器不会执行，也不会让事件循环继续等待
+func (l *EventLoop) SetTimeout(delay time.Duration, fn func()) func() {
+	if delay < 0 {
+		delay = 0
+	}
+	l.timerSeq++
+	t := &timer{deadline: l.Now() + delay, seq: l.timerSeq, fn: fn}
+	heap.Push(&l.timers, t)
+	return func() { t.cancelled = true }
+}
+
+// Hold 登记一个由宿主goroutine完成的外部操作，返回投递函数
+// 投递函数可以在任意goroutine调用一次，传入的回调在事件循环线程上执行；
+// 事件循环在所有登记的操作投递之前不会进入空闲
+func (l *EventLoop) Hold() func(func()) {
+	l.pending++
+	var once sync.Once
+	return func(complete func()) {
+		once.Do(func() {
+			l.completions <- complete
+		})
+	}
+}
+
+// Go 执行后台工作：work 在独立goroutine中运行（确定性模式下按提交顺序在事件循环线程上运行），
+// 它返回的完成回调在事件循环线程上执行，用于兑现或拒绝promise
+func (l *EventLoop) Go(work func() func()) {
+	if l.deterministic {
+		l.Enqueue(func() {
+			if complete := work(); complete != nil {
+				complete()
+			}
+		})
+		return
+	}
+
+	post := l.Hold()
+	go func() {
+		post(work())
+	}()
+}
+
+// Run 运行事件循环直到没有就绪回调、定时器和未完成的宿主操作
+func (l *EventLoop) Run() {
+	for l.RunOnce() {
+	}
+}
+
+// runUntil 运行事件循环直到done返回true；循环空闲而done仍为false时返回false
+func (l *EventLoop) runUntil(done func() bool) bool {
+	for !done() {
+		if !l.RunOnce() {
+			return false
+		}
+	}
+	return true
+}
+
+// RunOnce 执行一个就绪回调、宿主完成回调或到期定时器；没有任何待处理工作时返回false
+// 就绪回调优先，其次是已投递的完成回调，最后是定时器（必要时等待）
+func (l *EventLoop) RunOnce() bool {
+	if len(l.ready) > 0 {
+		fn := l.ready[0]
+		l.ready[0] = nil
+		l.ready = l.ready[1:]
+		fn()
+		return true
+	}
+
+	select {
+	case complete := <-l.completions:
+		l.runCompletion(complete)
+		return true
+	default:
+	}
+
+	for l.timers.Len() > 0 && l.timers[0].cancelled {
+		heap.Pop(&l.timers)
+	}
+	if l.timers.Len() > 0 {
+		next := l.timers[0]
+		if l.deterministic {
+			if next.deadline > l.clock {
+				l.clock = next.deadline
+			}
+		} else if wait := next.deadline - l.Now(); wait > 0 {
+			if l.pending > 0 {
+				// 等待定时器到期期间宿主操作可能先完成
+				waitTimer := time.NewTimer(wait)
+				defer waitTimer.Stop()
+				select {
+				case complete := <-l.completions:
+					l.runCompletion(complete)
+					return true
+				case <-waitTimer.C:
+				}
+			} else {
+				time.Sleep(wait)
+			}
+		}
+		heap.Pop(&l.timers)
+		next.fn()
+		return true
+	}
+
+	if l.pending > 0 {
+		l.runCompletion(<-l.completions)
+		return true
+	}
+	return false
+}
+
+func (l *EventLoop) runCompletion(complete func()) {
+	l.pending--
+	if complete != nil {
+		complete()
+	}
+}
+
+// timer 定时器
+type timer struct {
+	deadline  time.Duration
+	seq       uint64
+	fn        func()
+	cancelled bool
+}
+
+// timerQueue 定时器最小堆
+type timerQueue []*timer
+
+func (q timerQueue) Len() int { return len(q) }
+func (q timerQueue) Less(i, j int) bool {
+	if q[i].deadline != q[j].deadline {
+		return q[i].deadline < q[j].deadline
+	}
+	return q[i].seq < q[j].seq
+}
+func (q timerQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *timerQueue) Push(x interface{}) { *q = append(*q, x.(*timer)) }
+func (q *timerQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
+
+// =============================================================================
+// 异步内建函数
+// =============================================================================
+
+func init() {
+	asyncBuiltins := []struct {
+		name  string
+		arity int
+		fn    NativeFunc
+	}{
+		{"sleep", 1, builtinSleep},
+		{"all", 1, builtinAll},
+	}
+
+	for _, b := range asyncBuiltins {
+		if _, err := RegisterNative(b.name, b.arity, b.fn); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+// builtinSleep sleep(ms): 返回在ms毫秒后兑现为nil的promise
+func builtinSleep(vm *Executor, args []ValueGC) (ValueGC, error) {
+	var ms float64
+	switch {
+	case args[0].IsSmallInt():
+		ms = float64(args[0].AsSmallInt())
+	case args[0].IsDouble():
+		ms = args[0].AsDouble()
+	default:
+		return NewNilValueGC(), fmt.Errorf("expected number of milliseconds, got %s", TypeName(args[0]))
+	}
+
+	p := vm.NewPromise()
+	vm.Loop().SetTimeout(time.Duration(ms*float64(time.Millisecond)), func() {
+		p.Resolve(NewNilValueGC())
+	})
+	return p.Value(), nil
+}
+
+// builtinAll all(promises): 返回按顺序兑现为结果数组的promise，任意一个被拒绝时以同样的原因拒绝
+func builtinAll(vm *Executor, args []ValueGC) (ValueGC, error) {
+	_, elements, err := args[0].AsArrayData()
+	if err != nil {
+		return NewNilValueGC(), fmt.Errorf("expected array of promises, got %s", TypeName(args[0]))
+	}
+
+	result := vm.NewPromise()
+	values := make([]ValueGC, len(elements))
+	remaining := len(elements)
+
+	for i, element := range elements {
+		if !element.IsPromise() {
+			values[i] = element
+			remaining--
+			continue
+		}
+		p, err := vm.Promise(element)
+		if err != nil {
+			return NewNilValueGC(), err
+		}
+		index := i
+		p.then(func(p *Promise) {
+			if p.State == PromiseRejected {
+				if result.State == PromisePending {
+					result.failure = p.failure
+					result.Reject(p.Result)
+				}
+				return
+			}
+			values[index] = p.Result
+			remaining--
+			if remaining == 0 {
+				result.Resolve(NewArrayValueGC(values))
+			}
+		})
+	}
+
+	if remaining == 0 {
+		result.Resolve(NewArrayValueGC(values))
+	}
+	return result.Value(), nil
+}
@@ -0,0 +1,113 @@
+package vm_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// async/await 测试
+// =============================================================================
+
+func TestAsyncSchedule(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	loop := executor.Loop()
+	loop.SetDeterministic(true)
+	got := aqltest.Run(t, executor, out, `
+async function worker(name, ms) {
+    print("start", name)
+    await sleep(ms)
+    print("end", name)
+    return name
+}
+let a = worker("a", 30)
+let b = worker("b", 10)
+let c = worker("c", 10)
+print(type(a), "spawned")
+print(await all([a, b, c, 4]))
+`)
+	// 任务按创建顺序启动，到期时间相同的定时器按创建顺序执行
+	want := "promise spawned\n" +
+		"start a\nstart b\nstart c\n" +
+		"end b\nend c\nend a\n" +
+		"[a, b, c, 4]\n"
+	if got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+	// 虚拟时钟不实际等待
+	if now := loop.Now(); now != 30*time.Millisecond {
+		t.Errorf("virtual clock should be at 30ms, got %v", now)
+	}
+}
+
+func TestAwaitRejection(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	executor.Loop().SetDeterministic(true)
+	got := aqltest.Run(t, executor, out, `
+async function fail(ms) {
+    await sleep(ms)
+    throw {name: "Failure", message: "after " + str(ms)}
+}
+async function guarded() {
+    try { await fail(5) } catch (e) { return "caught " + e.message }
+}
+print(await guarded())
+try { await all([sleep(1), fail(2)]) } catch (e) { print(e.name, e.message) }
+`)
+	if want := "caught after 5\nFailure after 2\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestUnhandledRejection(t *testing.T) {
+	function := aqltest.Compile(t, `
+async function fail() { throw "lost" }
+fail()
+print("main done")
+`)
+	executor, out := aqltest.NewExecutor()
+	executor.Loop().SetDeterministic(true)
+	_, err := executor.Execute(function, nil)
+	if err == nil || !strings.Contains(err.Error(), "unhandled promise rejection: uncaught exception: lost") {
+		t.Errorf("the rejection should be reported after main returns, got %v", err)
+	}
+	if got := out.String(); got != "main done\n" {
+		t.Errorf("main should finish first, got %q", got)
+	}
+}
+
+func TestHostResolvesPromise(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	// fetch 在宿主goroutine中完成，结果通过事件循环兑现promise
+	fetch := aqltest.Native{Name: "fetch", Arity: 1, Fn: func(e *vm.Executor, args []vm.ValueGC) (vm.ValueGC, error) {
+		p := e.NewPromise()
+		key := args[0].ToString()
+		e.Loop().Go(func() func() {
+			time.Sleep(time.Millisecond)
+			result := strings.ToUpper(key)
+			return func() {
+				if key == "bad" {
+					p.Reject(vm.NewErrorValueGC("FetchError", "no "+key))
+					return
+				}
+				p.Resolve(vm.NewStringValueGC(result))
+			}
+		})
+		return p.Value(), nil
+	}}
+	got := aqltest.RunWithNatives(t, executor, out, `
+async function both() {
+    let results = await all([fetch("x"), fetch("y")])
+    return results[0] + results[1]
+}
+print(await both())
+try { await fetch("bad") } catch (e) { print(e.name, e.message) }
+`, fetch)
+	if want := "XY\nFetchError no bad\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,167 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// =============================================================================
+// 默认内建函数
+// =============================================================================
+
+func init() {
+	registerDefaultBuiltins(GlobalNativeRegistry)
+}
+
+// registerDefaultBuiltins 注册默认内建函数
+func registerDefaultBuiltins(nr *NativeRegistry) {
+	builtins := []struct {
+		name  string
+		arity int
+		fn    NativeFunc
+	}{
+		{"print", -1, builtinPrint},
+		{"len", 1, builtinLen},
+		{"type", 1, builtinType},
+		{"str", 1, builtinStr},
+		{"int", 1, builtinInt},
+		{"float", 1, builtinFloat},
+		{"assert", -1, builtinAssert},
+	}
+
+	for _, b := range builtins {
+		if _, err := nr.Register(b.name, b.arity, b.fn); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+// builtinPrint print(args...): 以空格分隔输出所有参数并换行
+func builtinPrint(vm *Executor, args []ValueGC) (ValueGC, error) {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.ToString()
+	}
+	if _, err := fmt.Fprintln(vm.Stdout(), strings.Join(parts, " ")); err != nil {
+		return NewNilValueGC(), err
+	}
+	return NewNilValueGC(), nil
+}
+
+// builtinLen len(x): 字符串的字符数、数组的元素数或对象的字段数
+func builtinLen(vm *Executor, args []ValueGC) (ValueGC, error) {
+	arg := args[0]
+	switch {
+	case arg.IsString():
+		return NewSmallIntValueGC(int32(utf8.RuneCountInString(arg.AsString()))), nil
+	case arg.IsArray():
+		return ArrayLengthValueGC(arg)
+	case arg.IsObject():
+		n, err := ObjectLengthValueGC(arg)
+		if err != nil {
+			return NewNilValueGC(), err
+		}
+		return NewSmallIntValueGC(int32(n)), nil
+	default:
+		return NewNilValueGC(), fmt.Errorf("object of type %s has no len", TypeName(arg))
+	}
+}
+
+// builtinType type(x): 返回值的类型名
+func builtinType(vm *Executor, args []ValueGC) (ValueGC, error) {
+	return NewStringValueGC(TypeName(args[0])), nil
+}
+
+// builtinStr str(x): 转换为字符串
+func builtinStr(vm *Executor, args []ValueGC) (ValueGC, error) {
+	if args[0].IsString() {
+		return args[0], nil
+	}
+	return NewStringValueGC(args[0].ToString()), nil
+}
+
+// builtinInt int(x): 转换为整数（浮点数向零截断）
+func builtinInt(vm *Executor, args []ValueGC) (ValueGC, error) {
+	arg := args[0]
+	switch arg.Type() {
+	case ValueGCTypeSmallInt:
+		return arg, nil
+	case ValueGCTypeDouble:
+		f := arg.AsDouble()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return NewNilValueGC(), fmt.Errorf("cannot convert %s to int", arg.ToString())
+		}
+		return NewNumberValueGC(math.Trunc(f)), nil
+	case ValueGCTypeBool:
+		if arg.AsBool() {
+			return NewSmallIntValueGC(1), nil
+		}
+		return NewSmallIntValueGC(0), nil
+	case ValueGCTypeString:
+		s := strings.TrimSpace(arg.AsString())
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return NewNumberValueGC(float64(i)), nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return NewNumberValueGC(math.Trunc(f)), nil
+		}
+		return NewNilValueGC(), fmt.Errorf("invalid literal for int: %q", arg.AsString())
+	default:
+		return NewNilValueGC(), fmt.Errorf("cannot convert %s to int", TypeName(arg))
+	}
+}
+
+// builtinFloat float(x): 转换为浮点数
+func builtinFloat(vm *Executor, args []ValueGC) (ValueGC, error) {
+	arg := args[0]
+	switch arg.Type() {
+	case ValueGCTypeSmallInt:
+		return NewDoubleValueGC(float64(arg.AsSmallInt())), nil
+	case ValueGCTypeDouble:
+		return arg, nil
+	case ValueGCTypeBool:
+		if arg.AsBool() {
+			return NewDoubleValueGC(1), nil
+		}
+		return NewDoubleValueGC(0), nil
+	case ValueGCTypeString:
+		f, err := strconv.ParseFloat(strings.TrimSpace(arg.AsString()), 64)
+		if err != nil {
+			return NewNilValueGC(), fmt.Errorf("invalid literal for float: %q", arg.AsString())
+		}
+		return NewDoubleValueGC(f), nil
+	default:
+		return NewNilValueGC(), fmt.Errorf("cannot convert %s to float", TypeName(arg))
+	}
+}
+
+// builtinAssert assert(cond, message?): 条件为假时报错
+func builtinAssert(vm *Executor, args []ValueGC) (ValueGC, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return NewNilValueGC(), fmt.Errorf("expects 1 or 2 arguments, got %d", len(args))
+	}
+	if args[0].ToBool() {
+		return NewNilValueGC(), nil
+	}
+	if len(args) == 2 {
+		return NewNilValueGC(), fmt.Errorf("assertion failed: %s", args[1].ToString())
+	}
+	return NewNilValueGC(), fmt.Errorf("assertion failed")
+}
+
+// TypeName 返回脚本可见的类型名
+func TypeName(v ValueGC) string {
+	switch v.Type() {
+	case ValueGCTypeSmallInt:
+		return "int"
+	case ValueGCTypeDouble:
+		return "float"
+	case ValueGCTypeFunction, ValueGCTypeCallable, ValueGCTypeClosure, ValueGCTypeNativeFunction:
+		return "function"
+	default:
+		return v.Type().String()
+	}
+}
@@ -0,0 +1,120 @@
+package vm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 内建函数测试
+// =============================================================================
+
+func TestBuiltins(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	got := aqltest.Run(t, executor, out, `
+print(len("héllo"), len([1, 2, 3]), len({a: 1}))
+print(type(1), type(1.5), type("s"), type([]), type({}), type(null), type(true), type(print), type(function() {}))
+print(str(12) + "!", str([1, "a"]), int(3.9), int("42"), int(true), float(2), float("2.5"))
+print("a", 1, 2.5, true, null, [1, [2]])
+assert(1 == 1, "fine")
+let p = print
+p("via variable")
+`)
+	want := "5 3 1\n" +
+		"int float string array object nil bool function function\n" +
+		"12! [1, a] 3 42 1 2 2.5\n" +
+		"a 1 2.5 true nil [1, [2]]\n" +
+		"via variable\n"
+	if got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{`assert(1 == 2, "math is broken")`, "assert(): assertion failed: math is broken"},
+		{`assert(false)`, "assert(): assertion failed"},
+		{`len(1)`, "len(): object of type int has no len"},
+		{`int("x")`, `int(): invalid literal for int: "x"`},
+		{`float([])`, "float(): cannot convert array to float"},
+		{`type()`, "type() expects 1 argument(s), got 0"},
+	}
+
+	for _, tt := range tests {
+		function := aqltest.Compile(t, tt.source)
+		executor, _ := aqltest.NewExecutor()
+		if _, err := executor.Execute(function, nil); err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s should fail with %q, got %v", tt.source, tt.message, err)
+		}
+	}
+}
+
+func TestNativeRegistry(t *testing.T) {
+	registry := vm.NewNativeRegistry()
+	one := func(e *vm.Executor, args []vm.ValueGC) (vm.ValueGC, error) { return vm.NewSmallIntValueGC(1), nil }
+	two := func(e *vm.Executor, args []vm.ValueGC) (vm.ValueGC, error) { return vm.NewSmallIntValueGC(2), nil }
+
+	first, err := registry.Register("f", 0, one)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := registry.Register("g", -1, one)
+	// 同名注册替换实现但保留下标
+	if index, err := registry.Register("f", 1, two); err != nil || index != first {
+		t.Errorf("re-registering f should keep index %d, got %d (error %v)", first, index, err)
+	}
+	if index, ok := registry.Lookup("g"); !ok || index != second {
+		t.Errorf("g should be found at %d, got %d", second, index)
+	}
+	if native, err := registry.Get(first); err != nil || native.Arity != 1 {
+		t.Errorf("f should be replaced, got %+v (error %v)", native, err)
+	}
+
+	for _, bad := range []struct {
+		name  string
+		arity int
+		fn    vm.NativeFunc
+	}{{"", 0, one}, {"h", 0, nil}, {"h", -2, one}} {
+		if _, err := registry.Register(bad.name, bad.arity, bad.fn); err == nil {
+			t.Errorf("registering %q with arity %d should fail", bad.name, bad.arity)
+		}
+	}
+	if _, err := registry.Get(99); err == nil {
+		t.Error("unknown index should fail")
+	}
+
+	anonymous, _ := registry.RegisterAnonymous("closure", 0, one, nil)
+	if functions := registry.Functions(); len(functions) != 2 {
+		t.Errorf("anonymous natives should not be listed, got %d functions", len(functions))
+	}
+	registry.Release(anonymous)
+	if _, err := registry.Get(anonymous); err == nil {
+		t.Error("released native should not be found")
+	}
+}
+
+func TestHostNative(t *testing.T) {
+	// 编译器只能看到编译前注册的原生函数
+	_, err := vm.RegisterNative("host_join", -1, func(e *vm.Executor, args []vm.ValueGC) (vm.ValueGC, error) {
+		parts := make([]string, len(args))
+		for i, arg := range args {
+			parts[i] = arg.ToString()
+		}
+		return vm.NewStringValueGC(strings.Join(parts, "-")), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executor, out := aqltest.NewExecutor()
+	got := aqltest.Run(t, executor, out, `print(host_join("a", 1, true), type(host_join))`)
+	if want := "a-1-true function\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,516 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// =============================================================================
+// 字节码文件格式
+// =============================================================================
+
+// 文件布局：
+//   magic "AQLC" | version uint16 | checksum uint32 | 函数数量 | 函数表...
+// checksum 为其后全部内容的 CRC32（IEEE），加载时先校验再解析。
+// 函数表中第0项为主函数，其余为通过常量引用到的嵌套函数。
+// 函数常量在文件中以函数表下标表示，加载时重新注册到FunctionRegistry。
+// 每个函数记录依次为：基础信息、指令、常量、异常处理表、行号表、列号表、upvalue描述、
+// 局部变量名和全局变量名。
+
+// BytecodeMagic 字节码文件魔数
+const BytecodeMagic = "AQLC"
+
+// BytecodeVersion 当前字节码格式版本
+const BytecodeVersion uint16 = 5
+
+// 常量类型标签
+const (
+	constTagNil byte = iota
+	constTagSmallInt
+	constTagDouble
+	constTagString
+	constTagBool
+	constTagFunction
+	constTagNative
+)
+
+// WriteBytecode 将主函数及其引用的嵌套函数序列化到w
+func WriteBytecode(w io.Writer, main *Function) error {
+	if main == nil {
+		return fmt.Errorf("cannot serialize nil function")
+	}
+
+	functions, index, err := collectFunctions(main)
+	if err != nil {
+		return err
+	}
+
+	// 先写入缓冲区以计算校验和
+	bw := &bytecodeWriter{w: &bytes.Buffer{}}
+	bw.uvarint(uint64(len(functions)))
+	for _, fn := range functions {
+		bw.writeFunction(fn, index)
+	}
+	if bw.err != nil {
+		return bw.err
+	}
+
+	var header [len(BytecodeMagic) + 6]byte
+	copy(header[:], BytecodeMagic)
+	binary.LittleEndian.PutUint16(header[len(BytecodeMagic):], BytecodeVersion)
+	binary.LittleEndian.PutUint32(header[len(BytecodeMagic)+2:], crc32.ChecksumIEEE(bw.w.Bytes()))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(bw.w.Bytes())
+	return err
+}
+
+// ReadBytecode 从r读取字节码并重建函数，嵌套函数会重新注册到全局函数注册表，返回前用 Verify 校验
+func ReadBytecode(r io.Reader) (*Function, error) {
+	var header [len(BytecodeMagic) + 6]byte
+	if _, err := io.ReadFull(r, header[:len(BytecodeMagic)]); err != nil {
+		return nil, fmt.Errorf("read bytecode header: %w", err)
+	}
+	if magic := header[:len(BytecodeMagic)]; string(magic) != BytecodeMagic {
+		return nil, fmt.Errorf("invalid bytecode magic: %q", magic)
+	}
+	if _, err := io.ReadFull(r, header[len(BytecodeMagic):]); err != nil {
+		return nil, fmt.Errorf("read bytecode header: %w", err)
+	}
+	if version := binary.LittleEndian.Uint16(header[len(BytecodeMagic):]); version != BytecodeVersion {
+		return nil, fmt.Errorf("unsupported bytecode version: %d (expected %d)", version, BytecodeVersion)
+	}
+
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read bytecode: %w", err)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[len(BytecodeMagic)+2:]) {
+		return nil, errors.New("bytecode checksum mismatch")
+	}
+
+	br := &bytecodeReader{r: bytes.NewReader(payload)}
+	count := br.uvarint()
+	if br.err != nil {
+		return nil, fmt.Errorf("read bytecode header: %w", br.err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("bytecode contains no functions")
+	}
+
+	// 先为所有函数分配ID，常量中的函数引用才能在读取时直接解析
+	functions := make([]*Function, count)
+	ids := make([]int, count)
+	for i := range functions {
+		functions[i] = NewFunction("")
+		if i > 0 {
+			ids[i] = RegisterFunction(functions[i])
+		}
+	}
+
+	for _, fn := range functions {
+		br.readFunction(fn, ids)
+		if br.err != nil {
+			return nil, fmt.Errorf("read function: %w", br.err)
+		}
+	}
+	if br.r.Len() > 0 {
+		return nil, fmt.Errorf("%d bytes of trailing data after functions", br.r.Len())
+	}
+
+	// 文件内容可能被篡改或由其他工具生成，执行前校验
+	if err := Verify(functions[0]); err != nil {
+		return nil, err
+	}
+
+	return functions[0], nil
+}
+
+// collectFunctions 从主函数出发按常量引用收集所有函数
+func collectFunctions(main *Function) ([]*Function, map[*Function]int, error) {
+	functions := []*Function{main}
+	index := map[*Function]int{main: 0}
+
+	for i := 0; i < len(functions); i++ {
+		for _, constant := range functions[i].Constants {
+			if !constant.IsFunction() {
+				continue
+			}
+			id := constant.AsFunctionID()
+			if id == 0 {
+				return nil, nil, fmt.Errorf("function %s: cannot serialize non-registered function constant", functions[i].Name)
+			}
+			fn, err := GetFunction(id)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, seen := index[fn]; !seen {
+				index[fn] = len(functions)
+				functions = append(functions, fn)
+			}
+		}
+	}
+
+	return functions, index, nil
+}
+
+// =============================================================================
+// 写入器
+// =============================================================================
+
+type bytecodeWriter struct {
+	w   *bytes.Buffer
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (bw *bytecodeWriter) bytes(b []byte) {
+	if bw.err != nil {
+		return
+	}
+	_, bw.err = bw.w.Write(b)
+}
+
+func (bw *bytecodeWriter) byte(b byte) {
+	if bw.err != nil {
+		return
+	}
+	bw.err = bw.w.WriteByte(b)
+}
+
+func (bw *bytecodeWriter) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(bw.buf[:8], v)
+	bw.bytes(bw.buf[:8])
+}
+
+func (bw *bytecodeWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(bw.buf[:], v)
+	bw.bytes(bw.buf[:n])
+}
+
+func (bw *bytecodeWriter) varint(v int64) {
+	n := binary.PutVarint(bw.buf[:], v)
+	bw.bytes(bw.buf[:n])
+}
+
+func (bw *bytecodeWriter) bool(b bool) {
+	if b {
+		bw.byte(1)
+	} else {
+		bw.byte(0)
+	}
+}
+
+func (bw *bytecodeWriter) string(s string) {
+	bw.uvarint(uint64(len(s)))
+	bw.bytes([]byte(s))
+}
+
+func (bw *bytecodeWriter) writeFunction(fn *Function, index map[*Function]int) {
+	bw.string(fn.Name)
+	bw.uvarint(uint64(fn.ParamCount))
+	bw.bool(fn.IsVarArg)
+	bw.bool(fn.IsAsync)
+	bw.bool(fn.IsGenerator)
+	bw.uvarint(uint64(fn.MaxStackSize))
+	bw.string(fn.Source)
+
+	bw.uvarint(uint64(len(fn.Instructions)))
+	for _, inst := range fn.Instructions {
+		bw.byte(byte(inst.OpCode))
+		bw.varint(int64(inst.A))
+		bw.varint(int64(inst.B))
+		bw.varint(int64(inst.C))
+		bw.varint(int64(inst.Bx))
+	}
+
+	bw.uvarint(uint64(len(fn.Constants)))
+	for _, constant := range fn.Constants {
+		bw.writeConstant(constant, index)
+	}
+
+	bw.uvarint(uint64(len(fn.Handlers)))
+	for _, handler := range fn.Handlers {
+		bw.uvarint(uint64(handler.StartPC))
+		bw.uvarint(uint64(handler.EndPC))
+		bw.uvarint(uint64(handler.HandlerPC))
+	}
+
+	bw.ints(fn.LineNumbers)
+	bw.ints(fn.Columns)
+
+	bw.uvarint(uint64(len(fn.Upvalues)))
+	for _, upvalue := range fn.Upvalues {
+		bw.string(upvalue.Name)
+		bw.byte(byte(upvalue.Kind))
+		bw.uvarint(uint64(upvalue.Index))
+	}
+
+	bw.strings(fn.LocalNames)
+	bw.strings(fn.GlobalNames)
+}
+
+// strings 写入长度和每个字符串，用于变量名表
+func (bw *bytecodeWriter) strings(values []string) {
+	bw.uvarint(uint64(len(values)))
+	for _, v := range values {
+		bw.string(v)
+	}
+}
+
+// ints 写入长度和每个元素，用于行号和列号表
+func (bw *bytecodeWriter) ints(values []int) {
+	bw.uvarint(uint64(len(values)))
+	for _, v := range values {
+		bw.uvarint(uint64(v))
+	}
+}
+
+func (bw *bytecodeWriter) writeConstant(v ValueGC, index map[*Function]int) {
+	switch v.Type() {
+	case ValueGCTypeNil:
+		bw.byte(constTagNil)
+	case ValueGCTypeSmallInt:
+		bw.byte(constTagSmallInt)
+		bw.varint(int64(v.AsSmallInt()))
+	case ValueGCTypeDouble:
+		bw.byte(constTagDouble)
+		bw.uint64(math.Float64bits(v.AsDouble()))
+	case ValueGCTypeString:
+		bw.byte(constTagString)
+		bw.string(v.AsString())
+	case ValueGCTypeBool:
+		bw.byte(constTagBool)
+		bw.bool(v.AsBool())
+	case ValueGCTypeFunction:
+		fn, err := GetFunction(v.AsFunctionID())
+		if err != nil {
+			bw.err = err
+			return
+		}
+		bw.byte(constTagFunction)
+		bw.uvarint(uint64(index[fn]))
+	case ValueGCTypeNativeFunction:
+		// 原生函数按名字保存，加载时在当前宿主的注册表中重新解析
+		native := v.AsNativeFunction()
+		if native == nil {
+			bw.err = fmt.Errorf("invalid native function constant")
+			return
+		}
+		if native.Anonymous {
+			bw.err = fmt.Errorf("cannot serialize runtime-created native function %s", native.Name)
+			return
+		}
+		bw.byte(constTagNative)
+		bw.string(native.Name)
+	default:
+		if bw.err == nil {
+			bw.err = fmt.Errorf("cannot serialize constant of type %s", v.Type())
+		}
+	}
+}
+
+// =============================================================================
+// 读取器
+// =============================================================================
+
+type bytecodeReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (br *bytecodeReader) bytes(n int) []byte {
+	if br.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	_, br.err = io.ReadFull(br.r, b)
+	return b
+}
+
+func (br *bytecodeReader) byte() byte {
+	if br.err != nil {
+		return 0
+	}
+	var b byte
+	b, br.err = br.r.ReadByte()
+	return b
+}
+
+func (br *bytecodeReader) uint64() uint64 {
+	b := br.bytes(8)
+	if br.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (br *bytecodeReader) uvarint() uint64 {
+	if br.err != nil {
+		return 0
+	}
+	var v uint64
+	v, br.err = binary.ReadUvarint(br.r)
+	return v
+}
+
+func (br *bytecodeReader) varint() int64 {
+	if br.err != nil {
+		return 0
+	}
+	var v int64
+	v, br.err = binary.ReadVarint(br.r)
+	return v
+}
+
+func (br *bytecodeReader) bool() bool {
+	return br.byte() != 0
+}
+
+func (br *bytecodeReader) string() string {
+	n := br.uvarint()
+	if br.err != nil {
+		return ""
+	}
+	if n > math.MaxInt32 {
+		br.err = errors.New("string length out of range")
+		return ""
+	}
+	return string(br.bytes(int(n)))
+}
+
+// count 读取一个长度字段，并防止损坏文件导致超大分配
+func (br *bytecodeReader) count() int {
+	n := br.uvarint()
+	if br.err == nil && n > 1<<24 {
+		br.err = fmt.Errorf("count %d out of range", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (br *bytecodeReader) readFunction(fn *Function, ids []int) {
+	fn.Name = br.string()
+	fn.ParamCount = int(br.uvarint())
+	fn.IsVarArg = br.bool()
+	fn.IsAsync = br.bool()
+	fn.IsGenerator = br.bool()
+	fn.MaxStackSize = int(br.uvarint())
+	fn.Source = br.string()
+
+	numInstructions := br.count()
+	fn.Instructions = make([]Instruction, 0, numInstructions)
+	for i := 0; i < numInstructions && br.err == nil; i++ {
+		fn.Instructions = append(fn.Instructions, Instruction{
+			OpCode: OpCode(br.byte()),
+			A:      int(br.varint()),
+			B:      int(br.varint()),
+			C:      int(br.varint()),
+			Bx:     int(br.varint()),
+		})
+	}
+
+	numConstants := br.count()
+	fn.Constants = make([]ValueGC, 0, numConstants)
+	for i := 0; i < numConstants && br.err == nil; i++ {
+		fn.Constants = append(fn.Constants, br.readConstant(ids))
+	}
+
+	numHandlers := br.count()
+	for i := 0; i < numHandlers && br.err == nil; i++ {
+		fn.Handlers = append(fn.Handlers, ExceptionHandler{
+			StartPC:   int(br.uvarint()),
+			EndPC:     int(br.uvarint()),
+			HandlerPC: int(br.uvarint()),
+		})
+	}
+
+	fn.LineNumbers = br.ints()
+	fn.Columns = br.ints()
+
+	numUpvalues := br.count()
+	for i := 0; i < numUpvalues && br.err == nil; i++ {
+		fn.Upvalues = append(fn.Upvalues, UpvalueDesc{
+			Name:  br.string(),
+			Kind:  UpvalueKind(br.byte()),
+			Index: int(br.uvarint()),
+		})
+	}
+
+	fn.LocalNames = br.strings()
+	fn.GlobalNames = br.strings()
+}
+
+// strings 读取由 bytecodeWriter.strings 写入的字符串表
+func (br *bytecodeReader) strings() []string {
+	n := br.count()
+	var values []string
+	for i := 0; i < n && br.err == nil; i++ {
+		values = append(values, br.string())
+	}
+	return values
+}
+
+// ints 读取由 bytecodeWriter.ints 写入的整数表
+func (br *bytecodeReader) ints() []int {
+	n := br.count()
+	values := make([]int, 0, n)
+	for i := 0; i < n && br.err == nil; i++ {
+		values = append(values, int(br.uvarint()))
+	}
+	return values
+}
+
+func (br *bytecodeReader) readConstant(ids []int) ValueGC {
+	tag := br.byte()
+	if br.err != nil {
+		return NewNilValueGC()
+	}
+
+	switch tag {
+	case constTagNil:
+		return NewNilValueGC()
+	case constTagSmallInt:
+		return NewSmallIntValueGC(int32(br.varint()))
+	case constTagDouble:
+		return NewDoubleValueGC(math.Float64frombits(br.uint64()))
+	case constTagString:
+		s := br.string()
+		if br.err != nil {
+			return NewNilValueGC()
+		}
+		return NewStringValueGC(s)
+	case constTagBool:
+		return NewBoolValueGC(br.bool())
+	case constTagFunction:
+		idx := br.uvarint()
+		if br.err != nil {
+			return NewNilValueGC()
+		}
+		if idx == 0 || idx >= uint64(len(ids)) {
+			br.err = fmt.Errorf("function reference %d out of range", idx)
+			return NewNilValueGC()
+		}
+		return NewFunctionValueGCFromID(ids[idx])
+	case constTagNative:
+		name := br.string()
+		if br.err != nil {
+			return NewNilValueGC()
+		}
+		index, ok := GlobalNativeRegistry.Lookup(name)
+		if !ok {
+			br.err = fmt.Errorf("unknown native function: %s", name)
+			return NewNilValueGC()
+		}
+		return NewNativeFunctionValueGC(index)
+	default:
+		br.err = fmt.Errorf("unknown constant tag: %d", tag)
+		return NewNilValueGC()
+	}
+}
@@ -0,0 +1,223 @@
+package vm_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhnt/aql/internal/compiler1"
+	"github.com/zhnt/aql/internal/lexer1"
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// compileFile 编译源文件，无法解析或编译的文件返回nil
+func compileFile(path string) *vm.Function {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	p := parser1.New(lexer1.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil
+	}
+	c := compiler1.New()
+	c.SetSource(path)
+	function, err := c.Compile(program)
+	if err != nil {
+		return nil
+	}
+	return function
+}
+
+// sourceFiles 返回 examples 和 testdata 下的全部 .aql 文件
+func sourceFiles(t *testing.T) []string {
+	t.Helper()
+	var files []string
+	for _, root := range []string{"../../examples", "../../testdata"} {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && filepath.Ext(path) == ".aql" {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// compareFunctions 逐字段比较两个函数，函数常量递归比较
+func compareFunctions(t *testing.T, where string, want, got *vm.Function) {
+	t.Helper()
+	if want.Name != got.Name || want.ParamCount != got.ParamCount || want.IsVarArg != got.IsVarArg ||
+		want.IsAsync != got.IsAsync || want.IsGenerator != got.IsGenerator ||
+		want.MaxStackSize != got.MaxStackSize || want.Source != got.Source {
+		t.Errorf("%s: header differs: want %+v, got %+v", where,
+			[]any{want.Name, want.ParamCount, want.IsVarArg, want.IsAsync, want.IsGenerator, want.MaxStackSize, want.Source},
+			[]any{got.Name, got.ParamCount, got.IsVarArg, got.IsAsync, got.IsGenerator, got.MaxStackSize, got.Source})
+	}
+	for _, field := range []struct {
+		name      string
+		want, got any
+	}{
+		{"instructions", want.Instructions, got.Instructions},
+		{"handlers", want.Handlers, got.Handlers},
+		{"line numbers", want.LineNumbers, got.LineNumbers},
+		{"columns", want.Columns, got.Columns},
+		{"upvalues", want.Upvalues, got.Upvalues},
+		{"local names", want.LocalNames, got.LocalNames},
+		{"global names", want.GlobalNames, got.GlobalNames},
+	} {
+		if reflect.ValueOf(field.want).Len() == 0 && reflect.ValueOf(field.got).Len() == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(field.want, field.got) {
+			t.Errorf("%s: %s differ:\nwant %v\ngot  %v", where, field.name, field.want, field.got)
+		}
+	}
+
+	if len(want.Constants) != len(got.Constants) {
+		t.Errorf("%s: constant count should be %d, got %d", where, len(want.Constants), len(got.Constants))
+		return
+	}
+	for i, constant := range want.Constants {
+		loaded := got.Constants[i]
+		if constant.Type() != loaded.Type() {
+			t.Errorf("%s: constant %d should be %s, got %s", where, i, constant.Type(), loaded.Type())
+			continue
+		}
+		if !constant.IsFunction() {
+			if constant.String() != loaded.String() {
+				t.Errorf("%s: constant %d should be %s, got %s", where, i, constant, loaded)
+			}
+			continue
+		}
+		wantFn, err := vm.GetFunction(constant.AsFunctionID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotFn, err := vm.GetFunction(loaded.AsFunctionID())
+		if err != nil {
+			t.Errorf("%s: constant %d is not registered: %v", where, i, err)
+			continue
+		}
+		compareFunctions(t, where+"/"+wantFn.Name, wantFn, gotFn)
+	}
+}
+
+// =============================================================================
+// 字节码格式测试
+// =============================================================================
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+
+	compiled := 0
+	for _, path := range sourceFiles(t) {
+		function := compileFile(path)
+		if function == nil {
+			continue
+		}
+		compiled++
+		t.Run(strings.TrimPrefix(path, "../../"), func(t *testing.T) {
+			var first bytes.Buffer
+			if err := vm.WriteBytecode(&first, function); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			loaded, err := vm.ReadBytecode(bytes.NewReader(first.Bytes()))
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			compareFunctions(t, function.Name, function, loaded)
+
+			var second bytes.Buffer
+			if err := vm.WriteBytecode(&second, loaded); err != nil {
+				t.Fatalf("rewrite: %v", err)
+			}
+			if !bytes.Equal(first.Bytes(), second.Bytes()) {
+				t.Errorf("rewriting the loaded function should produce identical bytes (%d vs %d)", first.Len(), second.Len())
+			}
+		})
+	}
+	if compiled == 0 {
+		t.Fatal("no example compiled")
+	}
+}
+
+func TestBytecodeClosureRuns(t *testing.T) {
+	executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	p := parser1.New(lexer1.New(`
+function counter(start) {
+    let n = start
+    return function() { n = n + 1; return n }
+}
+let next = counter(10)
+next()
+print(next())
+`))
+	function, err := compiler1.New().Compile(p.ParseProgram())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := vm.WriteBytecode(&buf, function); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := vm.ReadBytecode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.Execute(loaded, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "12\n" {
+		t.Errorf("output should be %q, got %q", "12\n", got)
+	}
+}
+
+func TestBytecodeErrors(t *testing.T) {
+	newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	function := compileFile("../../examples/functions.aql")
+	if function == nil {
+		t.Fatal("examples/functions.aql should compile")
+	}
+	var buf bytes.Buffer
+	if err := vm.WriteBytecode(&buf, function); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	corrupt := func(offset int, value byte) []byte {
+		data := append([]byte(nil), valid...)
+		data[offset] = value
+		return data
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"bad magic", corrupt(0, 'X'), "invalid bytecode magic"},
+		{"wrong version", corrupt(4, 99), "unsupported bytecode version"},
+		{"corrupted payload", corrupt(len(valid)-1, valid[len(valid)-1]^0xff), "checksum mismatch"},
+		{"truncated", valid[:len(valid)/2], "checksum mismatch"},
+		{"short header", valid[:6], "read bytecode header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := vm.ReadBytecode(bytes.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error should mention %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -110,3 +110,132 @@ func (uv *Upvalue) String() string {
 	}
 	return fmt.Sprintf("upvalue:%s(%s)", uv.Name, status)
 }
+
+// =============================================================================
+// 保持可调用对象存活
+// =============================================================================
+
+// pin 让执行器持有value指向的Callable或Closure，直到 CollectUnreachable 发现它不可达；
+// ValueGC只以整数保存对象地址，Go GC不会把它当作引用，没有其他Go指针时对象会被提前释放
+func (e *Executor) pin(value ValueGC) {
+	var object interface{}
+	switch value.Type() {
+	case ValueGCTypeCallable:
+		object = value.AsCallable()
+	case ValueGCTypeClosure:
+		object = value.AsClosure()
+	default:
+		return
+	}
+
+	e.collectIfGrown()
+	if e.pinned == nil {
+		e.pinned = make(map[uint64]interface{})
+	}
+	e.pinned[value.data] = object
+}
+
+// =============================================================================
+// 从Go调用AQL函数
+// =============================================================================
+
+// Call 调用AQL函数值（函数、闭包或原生函数）并返回结果
+// 可以在原生函数中重入调用；生成器返回协程，async函数返回promise（可用 Await 等待）。
+// 被调用函数中未捕获的异常以 RuntimeError 返回，原生函数把它原样返回即可继续向脚本传播。
+func (e *Executor) Call(fn ValueGC, args []ValueGC) (ValueGC, error) {
+	if fn.IsNativeFunction() {
+		native := fn.AsNativeFunction()
+		if native == nil {
+			return NewNilValueGC(), fmt.Errorf("invalid native function")
+		}
+		if native.Arity >= 0 && len(args) != native.Arity {
+			return NewNilValueGC(), fmt.Errorf("%s() expects %d argument(s), got %d", native.Name, native.Arity, len(args))
+		}
+		return native.Fn(e, args)
+	}
+
+	frame, err := newCallFrame(fn, args)
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	if frame.Function.IsGenerator {
+		return e.newCoroutine(frame), nil
+	}
+	if frame.Function.IsAsync {
+		return e.startAsync(frame), nil
+	}
+
+	return e.runFrame(frame, args)
+}
+
+// runFrame 同步执行没有调用者的栈帧直到返回，args仅用于跟踪
+func (e *Executor) runFrame(frame *StackFrame, args []ValueGC) (ValueGC, error) {
+	if e.CallDepth >= e.MaxCallDepth {
+		return NewNilValueGC(), fmt.Errorf("stack overflow: max call depth %d exceeded", e.MaxCallDepth)
+	}
+
+	if e.enableGCOpt && e.gcOptimizer != nil {
+		e.gcOptimizer.OnStackFrameCreate(frame)
+	}
+
+	savedFrame, savedDepth := e.CurrentFrame, e.CallDepth
+	e.suspended = append(e.suspended, savedFrame)
+	e.CurrentFrame = frame
+	e.CallDepth++
+	if e.tracing {
+		e.tracer.OnCall(frame.Function.Name, args, e.CallDepth)
+	}
+
+	// 栈帧没有调用者，返回时 run 结束，返回值留在 R(0)
+	err := e.run()
+	e.CurrentFrame, e.CallDepth = savedFrame, savedDepth
+	e.suspended = e.suspended[:len(e.suspended)-1]
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	return frame.GetRegister(0), nil
+}
+
+// newCallFrame 为函数值创建没有调用者的栈帧，参数和upvalue已就绪
+func newCallFrame(fn ValueGC, args []ValueGC) (*StackFrame, error) {
+	var function *Function
+	var upvalues []*Upvalue
+
+	switch {
+	case fn.IsFunction():
+		f, ok := fn.AsFunction().(*Function)
+		if !ok || f == nil {
+			return nil, fmt.Errorf("invalid function type")
+		}
+		function = f
+	case fn.IsCallable():
+		callable := fn.AsCallable()
+		if callable == nil || callable.Function == nil {
+			return nil, fmt.Errorf("invalid callable")
+		}
+		function, upvalues = callable.Function, callable.Upvalues
+	case fn.IsClosure():
+		closure := fn.AsClosure()
+		if closure == nil || closure.Function == nil {
+			return nil, fmt.Errorf("invalid closure")
+		}
+		function = closure.Function
+		for name, value := range closure.Captures {
+			upvalues = append(upvalues, &Upvalue{Value: value, IsClosed: true, Name: name})
+		}
+	default:
+		return nil, fmt.Errorf("attempted to call non-function value")
+	}
+
+	frame := NewStackFrame(function, nil, -1)
+	frame.SetParameters(args)
+	if len(upvalues) > 0 {
+		frame.Upvalues = upvalues
+	}
+
+	// 与CALL指令一致：递归引用放在参数之后的固定寄存器
+	if recursiveRefIndex := function.ParamCount + 8; recursiveRefIndex < len(frame.Registers) {
+		frame.SetRegister(recursiveRefIndex, fn)
+	}
+	return frame, nil
+}
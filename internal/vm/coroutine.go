@@ -0,0 +1,568 @@
+package vm
+
+import (
+	"fmt"
+)
+
+// =============================================================================
+// 协程（生成器）
+// =============================================================================
+
+// 设计原理：
+// - 函数体中含有 yield 的函数编译为生成器（Function.IsGenerator），调用它不执行函数体，
+//   而是创建一个拥有独立 StackFrame 链的协程并返回协程值
+// - 协程保存在执行器的协程表中，ValueGC 只内联存储协程ID
+// - resume 在当前执行器上切换到协程的栈帧运行，直到 YIELD 挂起或函数返回，然后切回调用方
+// - yield 只能出现在生成器函数自身的函数体中，因此挂起时协程的栈帧链只有一帧
+// - 流式服务调用的结果也是协程：它没有栈帧，每次恢复从服务流读取下一项，读完即结束
+// - 协程表按可达性回收：GC时从调用栈（包括嵌套调用挂起的外层栈帧）、全局变量、
+//   运行中的协程和异步任务出发标记，不可达的协程被销毁，
+//   销毁前关闭其栈帧的upvalue，与函数返回时的处理一致；
+//   promise表、执行器创建的原生闭包和运行时加载的代码块在同一遍标记中回收；
+//   原生闭包通过 Trace 标记其Go状态中的值，函数值和栈帧标记其所属模块的全局变量；
+//   执行器创建的Callable和Closure只由ValueGC中的整数地址引用，不可达时才解除持有，交给Go GC释放
+
+// ValueGCTypeCoroutine 协程类型（内联存储协程ID）
+const ValueGCTypeCoroutine ValueTypeGC = ValueGCTypeNativeFunction + 1
+
+// CoroutineStatus 协程状态
+type CoroutineStatus int
+
+const (
+	CoroutineSuspended CoroutineStatus = iota // 已创建或已挂起，可以恢复
+	CoroutineRunning                          // 正在运行（包括恢复了其他协程的协程）
+	CoroutineDead                             // 已返回或因错误终止
+)
+
+// String 返回状态名
+func (s CoroutineStatus) String() string {
+	switch s {
+	case CoroutineSuspended:
+		return "suspended"
+	case CoroutineRunning:
+		return "running"
+	case CoroutineDead:
+		return "dead"
+	default:
+		return "unknown"
+	}
+}
+
+// Coroutine 协程
+type Coroutine struct {
+	ID     int
+	Name   string          // 生成器函数名
+	Status CoroutineStatus // 当前状态
+
+	frame   *StackFrame   // 协程的栈帧（挂起时为恢复点）
+	resumer *StackFrame   // 恢复本协程的调用方栈帧（运行时有效）
+	yielded bool          // 最近一次运行是否以 YIELD 或 AWAIT 挂起结束
+	value   ValueGC       // 最近一次 yield 或 return 的值
+	promise *Promise      // 异步任务的结果promise，生成器为nil
+	source  *streamSource // 流式服务调用的数据源，生成器和异步任务为nil
+}
+
+// NewCoroutineValueGC 创建协程值
+func NewCoroutineValueGC(id int) ValueGC {
+	return ValueGC{
+		typeAndFlags: uint64(ValueGCTypeCoroutine) | ValueGCFlagInline,
+		data:         uint64(id),
+	}
+}
+
+// IsCoroutine 判断是否为协程
+func (v ValueGC) IsCoroutine() bool { return v.Type() == ValueGCTypeCoroutine }
+
+// AsCoroutineID 获取协程ID
+func (v ValueGC) AsCoroutineID() int { return int(v.data) }
+
+// Coroutine 根据协程值查找协程
+func (e *Executor) Coroutine(v ValueGC) (*Coroutine, error) {
+	if !v.IsCoroutine() {
+		return nil, fmt.Errorf("expected coroutine, got %s", TypeName(v))
+	}
+	co, exists := e.coroutines[v.AsCoroutineID()]
+	if !exists {
+		return nil, fmt.Errorf("coroutine #%d not found", v.AsCoroutineID())
+	}
+	return co, nil
+}
+
+// newCoroutine 以已准备好参数和upvalue的栈帧创建协程并登记到协程表
+func (e *Executor) newCoroutine(frame *StackFrame) ValueGC {
+	co := e.createCoroutine(frame)
+	if e.coroutines == nil {
+		e.coroutines = make(map[int]*Coroutine)
+	}
+	e.coroutines[co.ID] = co
+	return NewCoroutineValueGC(co.ID)
+}
+
+// createCoroutine 以frame为最底层栈帧创建协程
+func (e *Executor) createCoroutine(frame *StackFrame) *Coroutine {
+	frame.Caller = nil
+	frame.ReturnAddr = -1
+
+	e.nextCoroutineID++
+	co := &Coroutine{
+		ID:     e.nextCoroutineID,
+		Name:   frame.Function.Name,
+		Status: CoroutineSuspended,
+		frame:  frame,
+		value:  NewNilValueGC(),
+	}
+
+	if e.enableGCOpt && e.gcOptimizer != nil {
+		e.gcOptimizer.OnStackFrameCreate(frame)
+	}
+	e.tracef("COROUTINE", "创建协程 #%d (%s)", co.ID, co.Name)
+	return co
+}
+
+// Resume 恢复协程，返回它yield或return的值
+// 首次恢复时value被忽略；之后value作为挂起处yield表达式的结果
+func (e *Executor) Resume(co *Coroutine, value ValueGC) (ValueGC, error) {
+	return e.resume(co, value, false)
+}
+
+// resume 恢复协程；throw为true时在挂起处抛出value而不是把它作为表达式结果
+func (e *Executor) resume(co *Coroutine, value ValueGC, throw bool) (ValueGC, error) {
+	switch co.Status {
+	case CoroutineDead:
+		return NewNilValueGC(), fmt.Errorf("cannot resume dead coroutine")
+	case CoroutineRunning:
+		return NewNilValueGC(), fmt.Errorf("cannot resume running coroutine")
+	}
+
+	if co.source != nil {
+		return e.resumeStream(co)
+	}
+
+	if e.CallDepth >= e.MaxCallDepth {
+		return NewNilValueGC(), fmt.Errorf("stack overflow: max call depth %d exceeded", e.MaxCallDepth)
+	}
+
+	frame := co.frame
+	if throw {
+		// 异常从挂起处的指令抛出，由该处的异常处理项捕获
+		frame.PC--
+	} else if frame.PC > 0 {
+		// 从YIELD/AWAIT之后继续，指令 A 寄存器接收恢复值
+		suspendInst := frame.Function.Instructions[frame.PC-1]
+		if err := e.setRegisterWithGC(frame, suspendInst.A, value); err != nil {
+			return NewNilValueGC(), err
+		}
+	}
+
+	savedFrame, savedDepth := e.CurrentFrame, e.CallDepth
+	co.resumer = savedFrame
+	co.Status = CoroutineRunning
+	co.yielded = false
+	e.running = append(e.running, co)
+
+	e.CurrentFrame = frame
+	e.CallDepth++
+	if e.tracing {
+		e.tracer.OnCall(co.Name, []ValueGC{value}, e.CallDepth)
+	}
+
+	var err error
+	if throw {
+		err = e.raise(&ThrowError{Value: value})
+	}
+	if err == nil {
+		err = e.run()
+	}
+
+	e.running = e.running[:len(e.running)-1]
+	co.resumer = nil
+	e.CurrentFrame, e.CallDepth = savedFrame, savedDepth
+
+	if err != nil {
+		// 展开时已销毁协程内的嵌套栈帧，只剩协程自身的栈帧
+		co.Status = CoroutineDead
+		co.closeFrames(e, frame)
+		return NewNilValueGC(), err
+	}
+
+	if co.yielded {
+		co.Status = CoroutineSuspended
+	} else {
+		// 函数返回：executeReturn 已关闭upvalue并把返回值写入R(0)
+		co.Status = CoroutineDead
+		co.value = frame.GetRegister(0)
+		co.frame = nil
+	}
+	e.tracef("COROUTINE", "协程 #%d 切出，状态: %s", co.ID, co.Status)
+	return co.value, nil
+}
+
+// run 执行当前栈帧链直到其最底层的栈帧返回或协程挂起（CurrentFrame 变为nil）
+// 出错时先在栈帧链内查找异常处理项，未被处理的错误以 RuntimeError 返回
+func (e *Executor) run() error {
+	for e.CurrentFrame != nil {
+		if err := e.executeStep(); err != nil {
+			if err := e.raise(err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// raise 在当前栈帧抛出错误：被异常处理项捕获时返回nil，否则返回 RuntimeError
+func (e *Executor) raise(err error) error {
+	// 调用栈在展开之前记录，未被捕获时指向抛出位置
+	runtimeErr := newRuntimeError(e.CurrentFrame, err)
+	if e.unwind(runtimeErr.Value) {
+		return nil
+	}
+	if e.tracing {
+		e.tracer.OnError(e.CurrentFrame, runtimeErr)
+	}
+	return runtimeErr
+}
+
+// executeYield YIELD A B : 挂起当前协程并交出R(B)，恢复时 R(A) := 恢复值
+func (e *Executor) executeYield(inst Instruction) error {
+	frame := e.CurrentFrame
+	co := e.currentCoroutine()
+	if co == nil || co.promise != nil {
+		return fmt.Errorf("yield outside of a coroutine")
+	}
+
+	co.value = frame.GetRegister(inst.B)
+	if e.tracing {
+		e.tracer.OnReturn(co.Name, []ValueGC{co.value}, e.CallDepth)
+	}
+
+	e.suspend(co)
+	return nil
+}
+
+// currentCoroutine 返回当前栈帧所属的协程（当前栈帧必须是协程的最底层栈帧），否则返回nil
+func (e *Executor) currentCoroutine() *Coroutine {
+	if len(e.running) == 0 || e.CurrentFrame == nil || e.CurrentFrame.Caller != nil {
+		return nil
+	}
+	return e.running[len(e.running)-1]
+}
+
+// suspend 挂起当前协程，Resume 负责恢复调用方
+func (e *Executor) suspend(co *Coroutine) {
+	co.yielded = true
+	co.frame = e.CurrentFrame
+	co.frame.PC++
+	e.CurrentFrame = nil
+}
+
+// closeFrames 协程终止或被回收时销毁它的栈帧链
+func (co *Coroutine) closeFrames(e *Executor, top *StackFrame) {
+	for frame := top; frame != nil; frame = frame.Caller {
+		frame.CloseUpvalues()
+		if e.enableGCOpt && e.gcOptimizer != nil {
+			e.gcOptimizer.OnStackFrameDestroy(frame)
+		}
+	}
+	co.frame = nil
+}
+
+// =============================================================================
+// 协程回收
+// =============================================================================
+
+// CollectUnreachable 回收不可达的协程、promise、原生闭包和代码块，返回回收的协程数量
+func (e *Executor) CollectUnreachable() int {
+	if len(e.coroutines) == 0 && len(e.promises) == 0 && len(e.natives) == 0 && len(e.chunks) == 0 && len(e.pinned) == 0 {
+		return 0
+	}
+
+	marker := &coroutineMarker{
+		executor: e,
+		marked:   make(map[int]bool),
+		promises: make(map[int]bool),
+		natives:  make(map[int]bool),
+		modules:  make(map[*Module]bool),
+		visited:  make(map[uint64]bool),
+	}
+	marker.markFrames(e.CurrentFrame)
+	for _, frame := range e.suspended {
+		marker.markFrames(frame)
+	}
+	for _, co := range e.running {
+		marker.marked[co.ID] = true
+		marker.markFrames(co.resumer)
+	}
+	for _, global := range e.Globals {
+		marker.markValue(global)
+	}
+	for _, module := range e.modules {
+		marker.markModule(module)
+	}
+	for task := range e.tasks {
+		marker.markFrames(task.frame)
+	}
+	for _, values := range e.retained {
+		for _, value := range values {
+			marker.markValue(value)
+		}
+	}
+	for id, p := range e.promises {
+		// 回调已排队的promise仍会被读取结果
+		if p.delivering > 0 {
+			marker.markValue(NewPromiseValueGC(id))
+		}
+	}
+
+	for id := range e.promises {
+		if !marker.promises[id] {
+			delete(e.promises, id)
+		}
+	}
+	for index := range e.natives {
+		if !marker.natives[index] {
+			GlobalNativeRegistry.Release(index)
+			delete(e.natives, index)
+		}
+	}
+	for module, chunk := range e.chunks {
+		if !marker.modules[module] && !marker.natives[chunk.loader] {
+			chunk.unregister()
+			delete(e.chunks, module)
+		}
+	}
+	for address := range e.pinned {
+		if !marker.visited[address] {
+			delete(e.pinned, address)
+		}
+	}
+
+	collected := 0
+	for id, co := range e.coroutines {
+		if marker.marked[id] || co.Status == CoroutineRunning {
+			continue
+		}
+		if co.frame != nil {
+			co.closeFrames(e, co.frame)
+		}
+		if co.source != nil {
+			co.source.close()
+		}
+		delete(e.coroutines, id)
+		collected++
+	}
+
+	if collected > 0 {
+		e.tracef("COROUTINE", "回收了 %d 个不可达协程", collected)
+	}
+	return collected
+}
+
+// Close 释放执行器登记在进程级注册表中的资源：原生闭包、运行时加载的代码块的函数，
+// 并关闭未读完的服务流。短期使用的执行器（如每次工具调用创建一个）用完后应调用，
+// 否则这些资源要等 CollectUnreachable 才会释放；关闭后执行器不能再使用
+func (e *Executor) Close() {
+	for index := range e.natives {
+		GlobalNativeRegistry.Release(index)
+	}
+	e.natives = nil
+	for _, chunk := range e.chunks {
+		chunk.unregister()
+	}
+	e.chunks = nil
+	for _, co := range e.coroutines {
+		if co.source != nil {
+			co.source.close()
+		}
+	}
+}
+
+// collectThreshold 执行器持有的原生闭包、代码块和可调用对象达到该数量后，创建新的之前先回收不可达的部分
+const collectThreshold = 1024
+
+// collectIfGrown 持有的原生闭包、代码块和可调用对象自上次回收后翻倍时回收一次，
+// 避免反复创建闭包、包装函数或执行eval的脚本在GC触发前无限增长
+func (e *Executor) collectIfGrown() {
+	owned := len(e.natives) + len(e.chunks) + len(e.pinned)
+	if owned >= collectThreshold && owned >= e.collectAt {
+		e.CollectUnreachable()
+		e.collectAt = 2 * (len(e.natives) + len(e.chunks) + len(e.pinned))
+	}
+}
+
+// coroutineMarker 从根集合出发标记可达的协程、promise、原生闭包和模块
+type coroutineMarker struct {
+	executor *Executor
+	marked   map[int]bool     // 可达的协程ID
+	promises map[int]bool     // 可达的promise ID
+	natives  map[int]bool     // 可达的原生闭包下标
+	modules  map[*Module]bool // 可达的模块
+	visited  map[uint64]bool  // 已遍历的堆对象
+}
+
+// markFrames 标记栈帧链中寄存器和upvalue引用的值
+func (m *coroutineMarker) markFrames(frame *StackFrame) {
+	for f := frame; f != nil; f = f.Caller {
+		m.markFunction(f.Function)
+		for _, value := range f.Registers {
+			m.markValue(value)
+		}
+		for _, upvalue := range f.Upvalues {
+			if upvalue != nil {
+				m.markValue(upvalue.Get())
+			}
+		}
+	}
+}
+
+// markFunction 标记函数所属模块：函数执行时读写该模块的全局变量
+func (m *coroutineMarker) markFunction(function *Function) {
+	if function != nil {
+		m.markModule(function.Module)
+	}
+}
+
+// markModule 标记模块的全局变量，module为nil表示主程序
+func (m *coroutineMarker) markModule(module *Module) {
+	if module == nil || m.modules[module] {
+		return
+	}
+	m.modules[module] = true
+	for _, global := range module.Globals {
+		m.markValue(global)
+	}
+}
+
+// markValue 标记值及其引用的值
+func (m *coroutineMarker) markValue(v ValueGC) {
+	switch v.Type() {
+	case ValueGCTypeCoroutine:
+		id := v.AsCoroutineID()
+		if m.marked[id] {
+			return
+		}
+		m.marked[id] = true
+		if co, exists := m.executor.coroutines[id]; exists {
+			m.markFrames(co.frame)
+			m.markValue(co.value)
+		}
+	case ValueGCTypePromise:
+		id := v.AsPromiseID()
+		if m.promises[id] {
+			return
+		}
+		m.promises[id] = true
+		if p, exists := m.executor.promises[id]; exists {
+			m.markValue(p.Result)
+		}
+	case ValueGCTypeNativeFunction:
+		index := int(v.data)
+		if !m.executor.natives[index] || m.natives[index] {
+			return
+		}
+		m.natives[index] = true
+		if native := v.AsNativeFunction(); native != nil && native.Trace != nil {
+			native.Trace(m.markValue)
+		}
+	case ValueGCTypeFunction:
+		if function, ok := v.AsFunction().(*Function); ok {
+			m.markFunction(function)
+		}
+	case ValueGCTypeArray, ValueGCTypeObject, ValueGCTypeCallable, ValueGCTypeClosure:
+		if m.visited[v.data] {
+			return
+		}
+		m.visited[v.data] = true
+		m.markChildren(v)
+	}
+}
+
+// markChildren 标记容器和闭包引用的值
+func (m *coroutineMarker) markChildren(v ValueGC) {
+	switch v.Type() {
+	case ValueGCTypeArray:
+		if _, elements, err := v.AsArrayData(); err == nil {
+			for _, element := range elements {
+				m.markValue(element)
+			}
+		}
+	case ValueGCTypeObject:
+		if _, values, err := v.AsObjectEntries(); err == nil {
+			for _, value := range values {
+				m.markValue(value)
+			}
+		}
+	case ValueGCTypeCallable:
+		if callable := v.AsCallable(); callable != nil {
+			m.markFunction(callable.Function)
+			for _, upvalue := range callable.Upvalues {
+				if upvalue != nil {
+					m.markValue(upvalue.Get())
+				}
+			}
+		}
+	case ValueGCTypeClosure:
+		if closure := v.AsClosure(); closure != nil {
+			m.markFunction(closure.Function)
+			for _, capture := range closure.Captures {
+				m.markValue(capture)
+			}
+		}
+	}
+}
+
+// =============================================================================
+// 协程内建函数
+// =============================================================================
+
+func init() {
+	coroutineBuiltins := []struct {
+		name  string
+		arity int
+		fn    NativeFunc
+	}{
+		{"next", 1, builtinNext},
+		{"resume", -1, builtinResume},
+		{"status", 1, builtinStatus},
+	}
+
+	for _, b := range coroutineBuiltins {
+		if _, err := RegisterNative(b.name, b.arity, b.fn); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+// builtinNext next(co): 恢复协程，返回下一个yield的值（协程结束时为返回值）
+func builtinNext(vm *Executor, args []ValueGC) (ValueGC, error) {
+	co, err := vm.Coroutine(args[0])
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	return vm.Resume(co, NewNilValueGC())
+}
+
+// builtinResume resume(co, [value]): 恢复协程并把value作为挂起处yield表达式的结果
+func builtinResume(vm *Executor, args []ValueGC) (ValueGC, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return NewNilValueGC(), fmt.Errorf("expects 1 or 2 arguments, got %d", len(args))
+	}
+	co, err := vm.Coroutine(args[0])
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	value := NewNilValueGC()
+	if len(args) == 2 {
+		value = args[1]
+	}
+	return vm.Resume(co, value)
+}
+
+// builtinStatus status(co): 返回 "suspended"、"running" 或 "dead"
+func builtinStatus(vm *Executor, args []ValueGC) (ValueGC, error) {
+	co, err := vm.Coroutine(args[0])
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	return NewStringValueGC(co.Status.String()), nil
+}
@@ -0,0 +1,143 @@
+package vm_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 协程测试
+// =============================================================================
+
+// registerCollector 注册 @gc.collect() 服务，在脚本执行中途回收不可达的协程和promise
+func registerCollector(t *testing.T, executor *vm.Executor) {
+	t.Helper()
+	err := executor.RegisterService("gc", vm.ServiceFunc(func(ctx context.Context, method string, args []interface{}) (interface{}, error) {
+		return executor.CollectUnreachable(), nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectKeepsSuspendedFrames(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	registerCollector(t, executor)
+	got := aqltest.Run(t, executor, out, `
+function count() {
+    let i = 0
+    while (true) {
+        i = i + 1
+        yield i
+    }
+}
+function main() {
+    let g = count()
+    next(g)
+    eval("@gc.collect()")
+    print(next(g), status(g))
+}
+main()
+`)
+	// g只被eval挂起的栈帧引用，回收时不能关闭
+	if want := "2 suspended\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestCollectKeepsClosures(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	collect := aqltest.Native{Name: "collect", Arity: 0, Fn: func(e *vm.Executor, args []vm.ValueGC) (vm.ValueGC, error) {
+		e.CollectUnreachable()
+		runtime.GC()
+		return vm.NewNilValueGC(), nil
+	}}
+	got := aqltest.RunWithNatives(t, executor, out, `
+function mk(n) { return function() { return n } }
+let keep = mk(7)
+let sum = 0
+for (let i = 0; i < 3000; i = i + 1) { sum = sum + mk(i)() }
+collect()
+for (let i = 0; i < 3000; i = i + 1) { sum = sum + mk(i)() }
+print(keep(), sum)
+`, collect)
+	// keep只被全局变量引用，Go GC释放它之后内存会被新的闭包复用
+	if want := "7 8997000\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	got := aqltest.Run(t, executor, out, `
+function range(n) {
+    for (let i = 0; i < n; i = i + 1) { yield i }
+    return "done"
+}
+let g = range(2)
+print(type(g), status(g))
+print(next(g), next(g), next(g), status(g))
+
+function echo() {
+    let total = 0
+    while (true) {
+        let v = yield total
+        total = total + v
+    }
+}
+let e = echo()
+print(next(e), resume(e, 5), resume(e, 10))
+
+let self = null
+function peek() { yield status(self) }
+self = peek()
+print(next(self), status(self))
+
+let a = range(3)
+let b = range(3)
+print(next(a), next(a), next(b))
+try { next(g) } catch (err) { print(err.message) }
+try { next(1) } catch (err) { print(err.message) }
+`)
+	want := "coroutine suspended\n" +
+		"0 1 done dead\n" +
+		"0 5 15\n" +
+		"running suspended\n" +
+		"0 1 0\n" +
+		"next(): cannot resume dead coroutine\n" +
+		"next(): expected coroutine, got int\n"
+	if got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestCollectClosesGeneratorUpvalues(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	registerCollector(t, executor)
+	got := aqltest.Run(t, executor, out, `
+let getter = null
+function make() {
+    let hidden = 41
+    hidden = hidden + 1
+    getter = function() { return hidden }
+    yield 1
+    hidden = 0
+}
+function start() {
+    let g = make()
+    next(g)
+}
+start()
+@gc.collect()
+let filler = [1, 2, 3, 4]
+print(getter())
+`)
+	// 不可达的挂起协程被回收时关闭upvalue，它创建的闭包仍然可用
+	if want := "42\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,675 @@
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// 装饰器库：retry / timeout / cache / rate_limit
+// =============================================================================
+
+// 设计原理：
+// - 每个装饰器是接收目标、返回包装函数的原生函数，既可以直接调用 retry(f, 3, 100)，
+//   也可以写成 @retry(3, 100) function f() {}；具名参数 @retry(max=3) 以选项对象传入
+// - 目标可以是任意可调用值，也可以是 "@service.method" 字符串，此时包装的是服务调用
+// - 同步调用中的等待（重试退避、限流）和计时通过执行器的 Clock 完成，测试中换成 ManualClock
+//   即可不实际等待；目标返回promise时，重试和超时改由事件循环定时器驱动，不阻塞事件循环
+// - 每个包装函数单独记录指标，键为 "装饰器:目标名"，同一键的后续包装函数（如多个匿名函数）
+//   依次加 "#2"、"#3" 后缀；宿主用 DecoratorMetrics 读取，脚本用 decorator_metrics()
+// - 包装函数是执行器的原生闭包，它持有的目标函数和缓存结果通过 Trace 报告给 CollectUnreachable
+
+// Clock 装饰器使用的时钟
+type Clock interface {
+	Now() time.Time
+	// Sleep 等待d，ctx结束时提前返回ctx的错误
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SystemClock 使用系统时间的时钟
+var SystemClock Clock = systemClock{}
+
+// ManualClock 手动推进的时钟：Sleep立即返回并把时间向前推进
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock 创建从start开始的手动时钟
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+// Now 返回当前时间
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep 把时间推进d
+func (c *ManualClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.Advance(d)
+	return nil
+}
+
+// Advance 把时间推进d
+func (c *ManualClock) Advance(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// SetClock 设置装饰器使用的时钟，nil恢复为SystemClock
+func (e *Executor) SetClock(clock Clock) {
+	e.clock = clock
+}
+
+// Clock 返回装饰器使用的时钟
+func (e *Executor) Clock() Clock {
+	if e.clock == nil {
+		return SystemClock
+	}
+	return e.clock
+}
+
+// =============================================================================
+// 指标
+// =============================================================================
+
+// DecoratorStats 包装函数的调用指标
+type DecoratorStats struct {
+	Calls     int64         // 调用次数
+	Errors    int64         // 最终失败的调用次数（含异步调用被拒绝）
+	Retries   int64         // 重试次数
+	Timeouts  int64         // 超时次数
+	Hits      int64         // 缓存命中次数
+	Misses    int64         // 缓存未命中次数
+	Throttled int64         // 因限流而等待的调用次数
+	Cached    int64         // 缓存中的条目数（含尚未清除的过期条目）
+	Latency   time.Duration // 累计耗时（按Clock计时，异步调用计到promise完成）
+}
+
+// DecoratorMetrics 返回所有包装函数的指标快照，按包装函数的指标键索引
+func (e *Executor) DecoratorMetrics() map[string]DecoratorStats {
+	metrics := make(map[string]DecoratorStats, len(e.decoratorStats))
+	for key, stats := range e.decoratorStats {
+		metrics[key] = *stats
+	}
+	return metrics
+}
+
+// newDecoratorStats 为新的包装函数创建指标，返回其指标键：
+// key已被之前的包装函数使用时，第n个包装函数的键为 "key#n"
+func (e *Executor) newDecoratorStats(key string) (string, *DecoratorStats) {
+	if e.decoratorStats == nil {
+		e.decoratorStats = make(map[string]*DecoratorStats)
+		e.decoratorCount = make(map[string]int)
+	}
+	e.decoratorCount[key]++
+	if n := e.decoratorCount[key]; n > 1 {
+		key = fmt.Sprintf("%s#%d", key, n)
+	}
+	stats := &DecoratorStats{}
+	e.decoratorStats[key] = stats
+	return key, stats
+}
+
+// =============================================================================
+// 包装目标
+// =============================================================================
+
+// decoratorTarget 被包装的函数或服务方法
+type decoratorTarget struct {
+	name    string
+	fn      ValueGC
+	service string
+	method  string
+}
+
+// newDecoratorTarget 解析装饰器的第一个参数
+func newDecoratorTarget(v ValueGC) (*decoratorTarget, error) {
+	if v.IsString() {
+		service, method, err := splitServiceName(strings.TrimPrefix(v.AsString(), "@"))
+		if err != nil {
+			return nil, err
+		}
+		return &decoratorTarget{name: "@" + service + "." + method, service: service, method: method}, nil
+	}
+
+	var name string
+	switch {
+	case v.IsNativeFunction():
+		if native := v.AsNativeFunction(); native != nil {
+			name = native.Name
+		}
+	case v.IsFunction():
+		if fn, ok := v.AsFunction().(*Function); ok && fn != nil {
+			name = fn.Name
+		}
+	case v.IsCallable():
+		if callable := v.AsCallable(); callable != nil && callable.Function != nil {
+			name = callable.Function.Name
+		}
+	case v.IsClosure():
+		if closure := v.AsClosure(); closure != nil && closure.Function != nil {
+			name = closure.Function.Name
+		}
+	default:
+		return nil, fmt.Errorf("expected function or \"@service.method\", got %s", TypeName(v))
+	}
+	if name == "" {
+		name = "anonymous"
+	}
+	return &decoratorTarget{name: name, fn: CopyValueGC(v)}, nil
+}
+
+// call 调用目标
+func (t *decoratorTarget) call(e *Executor, args []ValueGC) (ValueGC, error) {
+	if t.service != "" {
+		return e.CallService(t.service, t.method, args)
+	}
+	return e.Call(t.fn, args)
+}
+
+// wrap 创建名为name（即指标键）的包装函数：调用次数、耗时和失败次数在这里统一记录
+// trace 标记call额外持有的脚本值，目标本身总是被标记
+func (t *decoratorTarget) wrap(e *Executor, name string, stats *DecoratorStats, call NativeFunc, trace func(mark func(ValueGC))) (ValueGC, error) {
+	return e.NewNativeClosure(name, -1, func(e *Executor, args []ValueGC) (ValueGC, error) {
+		clock := e.Clock()
+		start := clock.Now()
+		stats.Calls++
+
+		result, err := call(e, args)
+		if err != nil {
+			stats.Latency += clock.Now().Sub(start)
+			stats.Errors++
+			return NewNilValueGC(), err
+		}
+		if !result.IsPromise() {
+			stats.Latency += clock.Now().Sub(start)
+			return result, nil
+		}
+
+		p, err := e.Promise(result)
+		if err != nil {
+			return NewNilValueGC(), err
+		}
+		p.watch(func(p *Promise) {
+			stats.Latency += clock.Now().Sub(start)
+			if p.State == PromiseRejected {
+				stats.Errors++
+			}
+		})
+		return result, nil
+	}, func(mark func(ValueGC)) {
+		mark(t.fn)
+		if trace != nil {
+			trace(mark)
+		}
+	})
+}
+
+// decoratorArgs 解析目标和选项：位置参数按names的顺序，或者一个选项对象（具名参数）
+// aliases 是选项对象中可以使用的别名；缺少的选项不出现在结果中
+func decoratorArgs(decorator string, args []ValueGC, names []string, aliases map[string]string) (*decoratorTarget, map[string]float64, error) {
+	if len(args) == 0 {
+		return nil, nil, fmt.Errorf("%s expects a function to wrap", decorator)
+	}
+	target, err := newDecoratorTarget(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := make(map[string]float64, len(names))
+	rest := args[1:]
+	if len(rest) == 1 && rest[0].IsObject() {
+		keys, values, err := rest[0].AsObjectEntries()
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, key := range keys {
+			name := key
+			if alias, ok := aliases[key]; ok {
+				name = alias
+			}
+			if !containsName(names, name) {
+				return nil, nil, fmt.Errorf("%s: unknown option %q (expected %s)", decorator, key, strings.Join(names, ", "))
+			}
+			n, err := values[i].ToNumber()
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: option %s must be a number, got %s", decorator, key, TypeName(values[i]))
+			}
+			options[name] = n
+		}
+		return target, options, nil
+	}
+
+	if len(rest) > len(names) {
+		return nil, nil, fmt.Errorf("%s expects at most %d option(s) (%s), got %d", decorator, len(names), strings.Join(names, ", "), len(rest))
+	}
+	for i, value := range rest {
+		n, err := value.ToNumber()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s must be a number, got %s", decorator, names[i], TypeName(value))
+		}
+		options[names[i]] = n
+	}
+	return target, options, nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// milliseconds 把毫秒数转换为时长
+func milliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// rejectWithError 以Go错误拒绝promise，保留原始错误
+func rejectWithError(p *Promise, err error) {
+	p.failure = err
+	p.Reject(exceptionValue(err))
+}
+
+// =============================================================================
+// 装饰器内建函数
+// =============================================================================
+
+func init() {
+	decoratorBuiltins := []struct {
+		name  string
+		arity int
+		fn    NativeFunc
+	}{
+		{"retry", -1, builtinRetry},
+		{"timeout", -1, builtinTimeout},
+		{"cache", -1, builtinCache},
+		{"rate_limit", -1, builtinRateLimit},
+		{"decorator_metrics", 0, builtinDecoratorMetrics},
+	}
+
+	for _, b := range decoratorBuiltins {
+		if _, err := RegisterNative(b.name, b.arity, b.fn); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+// builtinRetry retry(f, max = 3, backoff = 0): 失败时最多共尝试max次，
+// 第n次重试前等待 backoff * 2^(n-1) 毫秒；f返回promise时以被拒绝为失败
+func builtinRetry(vm *Executor, args []ValueGC) (ValueGC, error) {
+	target, options, err := decoratorArgs("retry", args, []string{"max", "backoff"},
+		map[string]string{"maxAttempts": "max", "attempts": "max", "delay": "backoff"})
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	max := 3
+	if n, ok := options["max"]; ok {
+		max = int(n)
+	}
+	if max < 1 {
+		return NewNilValueGC(), fmt.Errorf("retry: max must be at least 1, got %d", max)
+	}
+	backoff := milliseconds(options["backoff"])
+	delay := func(attempt int) time.Duration {
+		return backoff << (attempt - 1)
+	}
+
+	name, stats := vm.newDecoratorStats("retry:" + target.name)
+	wrapper, err := target.wrap(vm, name, stats, func(e *Executor, args []ValueGC) (ValueGC, error) {
+		for attempt := 1; ; attempt++ {
+			result, err := target.call(e, args)
+			if err == nil && result.IsPromise() {
+				return retryAsync(e, target, args, result, attempt, max, delay, stats), nil
+			}
+			if err == nil || attempt >= max {
+				return result, err
+			}
+			stats.Retries++
+			if err := e.Clock().Sleep(e.Context(), delay(attempt)); err != nil {
+				return NewNilValueGC(), err
+			}
+		}
+	}, nil)
+	return wrapper, err
+}
+
+// retryAsync 目标返回promise后的重试：被拒绝时由事件循环定时器安排下一次尝试
+func retryAsync(e *Executor, target *decoratorTarget, args []ValueGC, first ValueGC, attempt, max int,
+	delay func(int) time.Duration, stats *DecoratorStats) ValueGC {
+	result := e.NewPromise()
+	// 等待重试期间目标和参数只被定时器回调引用
+	release := e.retain(append([]ValueGC{target.fn}, args...)...)
+	result.watch(func(*Promise) { release() })
+
+	var settle func(attempt int, value ValueGC, err error)
+	settle = func(attempt int, value ValueGC, err error) {
+		failed := func(failure error, reason ValueGC) {
+			if attempt >= max {
+				result.failure = failure
+				result.Reject(reason)
+				return
+			}
+			stats.Retries++
+			e.Loop().SetTimeout(delay(attempt), func() {
+				value, err := target.call(e, args)
+				settle(attempt+1, value, err)
+			})
+		}
+
+		switch {
+		case err != nil:
+			failed(err, exceptionValue(err))
+		case !value.IsPromise():
+			result.Resolve(value)
+		default:
+			p, err := e.Promise(value)
+			if err != nil {
+				failed(err, exceptionValue(err))
+				return
+			}
+			p.then(func(p *Promise) {
+				if p.State == PromiseFulfilled {
+					result.Resolve(p.Result)
+				} else {
+					failed(p.failure, p.Result)
+				}
+			})
+		}
+	}
+
+	settle(attempt, first, nil)
+	return result.Value()
+}
+
+// builtinTimeout timeout(f, ms): 调用超过ms毫秒时抛出 TimeoutError
+// 同步调用期间执行器的context带有截止时间：服务调用随之取消，执行循环在调用和向后跳转时
+// 检查它，因此死循环也会在到期时停止；返回后再按Clock检查耗时；
+// f返回promise时，到期仍未完成的promise被 TimeoutError 拒绝
+func builtinTimeout(vm *Executor, args []ValueGC) (ValueGC, error) {
+	target, options, err := decoratorArgs("timeout", args, []string{"ms"}, nil)
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	ms, ok := options["ms"]
+	if !ok || ms <= 0 {
+		return NewNilValueGC(), fmt.Errorf("timeout: ms must be a positive number of milliseconds")
+	}
+	limit := milliseconds(ms)
+
+	name, stats := vm.newDecoratorStats("timeout:" + target.name)
+	timeoutError := func() error {
+		stats.Timeouts++
+		message := fmt.Sprintf("%s timed out after %v", target.name, limit)
+		return &ThrowError{Value: NewErrorValueGC("TimeoutError", message)}
+	}
+
+	wrapper, err := target.wrap(vm, name, stats, func(e *Executor, args []ValueGC) (ValueGC, error) {
+		parent := e.ctx
+		ctx, cancel := context.WithTimeout(e.Context(), limit)
+		defer cancel()
+
+		clock := e.Clock()
+		start := clock.Now()
+		e.ctx = ctx
+		result, err := target.call(e, args)
+		e.ctx = parent
+
+		elapsed := clock.Now().Sub(start)
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return NewNilValueGC(), timeoutError()
+			}
+			return NewNilValueGC(), err
+		}
+		if elapsed > limit {
+			return NewNilValueGC(), timeoutError()
+		}
+		if !result.IsPromise() {
+			return result, nil
+		}
+
+		p, err := e.Promise(result)
+		if err != nil {
+			return NewNilValueGC(), err
+		}
+		if p.State != PromisePending {
+			return result, nil
+		}
+		limited := e.NewPromise()
+		cancelTimer := e.Loop().SetTimeout(limit-elapsed, func() {
+			rejectWithError(limited, timeoutError())
+		})
+		p.then(func(p *Promise) {
+			cancelTimer()
+			if limited.State == PromisePending {
+				limited.failure = p.failure
+				limited.settle(p.State, p.Result)
+			}
+		})
+		return limited.Value(), nil
+	}, nil)
+	return wrapper, err
+}
+
+// cacheSweepThreshold 带ttl的缓存条目数达到该值后开始清理过期条目
+const cacheSweepThreshold = 64
+
+// cacheEntry 缓存的结果
+type cacheEntry struct {
+	value   ValueGC
+	expires time.Time // 零值表示永不过期
+}
+
+// builtinCache cache(f, ttl = 0): 按参数缓存结果ttl毫秒（0表示永久）
+// 参数不能转换为普通值（如函数）时不缓存；失败的调用和被拒绝的promise不缓存
+func builtinCache(vm *Executor, args []ValueGC) (ValueGC, error) {
+	target, options, err := decoratorArgs("cache", args, []string{"ttl"}, nil)
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	ttl := milliseconds(options["ttl"])
+	if ttl < 0 {
+		return NewNilValueGC(), fmt.Errorf("cache: ttl must not be negative")
+	}
+
+	name, stats := vm.newDecoratorStats("cache:" + target.name)
+	entries := make(map[string]*cacheEntry)
+	evict := func(key string, entry *cacheEntry) {
+		if entries[key] == entry {
+			delete(entries, key)
+			entry.value.DecRef()
+			stats.Cached = int64(len(entries))
+		}
+	}
+	// 过期条目在命中时才会被发现，条目数自上次清理后翻倍时清除所有过期条目
+	sweepAt := cacheSweepThreshold
+	sweep := func(now time.Time) {
+		for key, entry := range entries {
+			if !entry.expires.IsZero() && !now.Before(entry.expires) {
+				evict(key, entry)
+			}
+		}
+		sweepAt = max(2*len(entries), cacheSweepThreshold)
+	}
+
+	wrapper, err := target.wrap(vm, name, stats, func(e *Executor, args []ValueGC) (ValueGC, error) {
+		key, ok := cacheKey(args)
+		if !ok {
+			stats.Misses++
+			return target.call(e, args)
+		}
+
+		now := e.Clock().Now()
+		if entry, found := entries[key]; found {
+			if entry.expires.IsZero() || now.Before(entry.expires) {
+				stats.Hits++
+				return entry.value, nil
+			}
+			evict(key, entry)
+		}
+		stats.Misses++
+
+		result, err := target.call(e, args)
+		if err != nil {
+			return NewNilValueGC(), err
+		}
+		entry := &cacheEntry{value: CopyValueGC(result)}
+		if ttl > 0 {
+			entry.expires = now.Add(ttl)
+		}
+		entries[key] = entry
+		if ttl > 0 && len(entries) >= sweepAt {
+			sweep(now)
+		}
+		stats.Cached = int64(len(entries))
+
+		if result.IsPromise() {
+			if p, err := e.Promise(result); err == nil {
+				p.watch(func(p *Promise) {
+					if p.State == PromiseRejected {
+						evict(key, entry)
+					}
+				})
+			}
+		}
+		return result, nil
+	}, func(mark func(ValueGC)) {
+		for _, entry := range entries {
+			mark(entry.value)
+		}
+	})
+	return wrapper, err
+}
+
+// cacheKey 把参数编码为缓存键
+func cacheKey(args []ValueGC) (string, bool) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		value, err := ToGoValue(arg)
+		if err != nil {
+			return "", false
+		}
+		values[i] = value
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// builtinRateLimit rate_limit(f, n, per = 1000): 任意per毫秒内最多调用n次，
+// 超出时按Clock等待到最早的一次调用移出窗口
+func builtinRateLimit(vm *Executor, args []ValueGC) (ValueGC, error) {
+	target, options, err := decoratorArgs("rate_limit", args, []string{"n", "per"},
+		map[string]string{"calls": "n", "limit": "n", "period": "per"})
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	n, ok := options["n"]
+	if !ok || n < 1 {
+		return NewNilValueGC(), fmt.Errorf("rate_limit: n must be at least 1")
+	}
+	per := time.Second
+	if ms, ok := options["per"]; ok {
+		per = milliseconds(ms)
+	}
+	if per <= 0 {
+		return NewNilValueGC(), fmt.Errorf("rate_limit: per must be a positive number of milliseconds")
+	}
+
+	var calls []time.Time // 窗口内的调用时间，按时间顺序
+	name, stats := vm.newDecoratorStats("rate_limit:" + target.name)
+	wrapper, err := target.wrap(vm, name, stats, func(e *Executor, args []ValueGC) (ValueGC, error) {
+		clock := e.Clock()
+		now := clock.Now()
+		for len(calls) > 0 && !calls[0].Add(per).After(now) {
+			calls = calls[1:]
+		}
+		if len(calls) >= int(n) {
+			stats.Throttled++
+			if err := clock.Sleep(e.Context(), calls[0].Add(per).Sub(now)); err != nil {
+				return NewNilValueGC(), err
+			}
+			now = clock.Now()
+			for len(calls) > 0 && !calls[0].Add(per).After(now) {
+				calls = calls[1:]
+			}
+		}
+		calls = append(calls, now)
+		return target.call(e, args)
+	}, nil)
+	return wrapper, err
+}
+
+// builtinDecoratorMetrics decorator_metrics(): 返回所有包装函数的指标对象
+func builtinDecoratorMetrics(vm *Executor, args []ValueGC) (ValueGC, error) {
+	metrics := vm.DecoratorMetrics()
+	keys := make([]string, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := NewObjectValueGC(len(keys))
+	for _, key := range keys {
+		stats := metrics[key]
+		fields := []struct {
+			name  string
+			value int64
+		}{
+			{"calls", stats.Calls},
+			{"errors", stats.Errors},
+			{"retries", stats.Retries},
+			{"timeouts", stats.Timeouts},
+			{"hits", stats.Hits},
+			{"misses", stats.Misses},
+			{"throttled", stats.Throttled},
+			{"cached", stats.Cached},
+		}
+		entry := NewObjectValueGC(len(fields) + 1)
+		for _, field := range fields {
+			ObjectSetValueGC(entry, field.name, NewNumberValueGC(float64(field.value)))
+		}
+		ObjectSetValueGC(entry, "latency_ms", NewNumberValueGC(float64(stats.Latency)/float64(time.Millisecond)))
+		ObjectSetValueGC(result, key, entry)
+	}
+	return result, nil
+}
@@ -0,0 +1,324 @@
+package vm_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// newExecutor 创建使用指定时钟的执行器
+func newExecutor(clock vm.Clock) (*vm.Executor, *bytes.Buffer) {
+	executor, out := aqltest.NewExecutor()
+	executor.SetClock(clock)
+	return executor, out
+}
+
+// =============================================================================
+// 装饰器测试
+// =============================================================================
+
+func TestRetryBackoff(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := vm.NewManualClock(start)
+	executor, out := newExecutor(clock)
+
+	got := aqltest.Run(t, executor, out, `
+let attempts = 0
+@retry(max=4, backoff=100)
+function flaky() {
+    attempts = attempts + 1
+    if (attempts < 4) { throw "fail" }
+    return attempts
+}
+print(flaky())
+
+@retry(2)
+function always() { throw {name: "Boom", message: "still failing"} }
+try { always() } catch (e) { print(e.name, e.message) }
+`)
+	if got != "4\nBoom still failing\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+	// 100 + 200 + 400 毫秒的退避，always 没有退避
+	if elapsed := clock.Now().Sub(start); elapsed != 700*time.Millisecond {
+		t.Errorf("backoff should advance the clock by 700ms, got %v", elapsed)
+	}
+
+	metrics := executor.DecoratorMetrics()
+	if stats := metrics["retry:flaky"]; stats.Calls != 1 || stats.Retries != 3 || stats.Errors != 0 {
+		t.Errorf("unexpected retry:flaky metrics: %+v", stats)
+	}
+	if stats := metrics["retry:always"]; stats.Retries != 1 || stats.Errors != 1 {
+		t.Errorf("unexpected retry:always metrics: %+v", stats)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	clock := vm.NewManualClock(time.Unix(0, 0))
+	executor, out := newExecutor(clock)
+	advance := aqltest.Native{Name: "advance", Arity: 1, Fn: func(e *vm.Executor, args []vm.ValueGC) (vm.ValueGC, error) {
+		ms, _ := args[0].ToNumber()
+		clock.Advance(time.Duration(ms) * time.Millisecond)
+		return vm.NewNilValueGC(), nil
+	}}
+
+	got := aqltest.RunWithNatives(t, executor, out, `
+let computed = 0
+@cache(ttl=1000)
+function lookup(key) {
+    computed = computed + 1
+    return {key: key, n: computed}
+}
+print(lookup("a").n, lookup("a").n, lookup("b").n)
+advance(999)
+print(lookup("a").n)
+advance(1)
+print(lookup("a").n)
+`, advance)
+	if got != "1 1 2\n1\n3\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+	if stats := executor.DecoratorMetrics()["cache:lookup"]; stats.Hits != 2 || stats.Misses != 3 {
+		t.Errorf("unexpected cache metrics: %+v", stats)
+	}
+}
+
+func TestCacheSweepsExpiredEntries(t *testing.T) {
+	clock := vm.NewManualClock(time.Unix(0, 0))
+	executor, out := newExecutor(clock)
+	advance := aqltest.Native{Name: "advance", Arity: 1, Fn: func(e *vm.Executor, args []vm.ValueGC) (vm.ValueGC, error) {
+		ms, _ := args[0].ToNumber()
+		clock.Advance(time.Duration(ms) * time.Millisecond)
+		return vm.NewNilValueGC(), nil
+	}}
+
+	aqltest.RunWithNatives(t, executor, out, `
+@cache(ttl=10)
+function id(x) { return x }
+for (let i = 0; i < 1000; i = i + 1) {
+    id(i)
+    advance(1)
+}
+`, advance)
+	// 每个键只查询一次，过期条目只能由清理移除
+	stats := executor.DecoratorMetrics()["cache:id"]
+	if stats.Misses != 1000 || stats.Cached > 64 {
+		t.Errorf("expired entries should be swept, got %+v", stats)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := vm.NewManualClock(start)
+	executor, out := newExecutor(clock)
+
+	got := aqltest.Run(t, executor, out, `
+@rate_limit(2, 1000)
+function ping(i) { return i }
+let results = []
+for (let i = 0; i < 5; i = i + 1) { results[i] = ping(i) }
+print(results)
+`)
+	if got != "[0, 1, 2, 3, 4]\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+	// 第3、5次调用各等待一个窗口
+	if elapsed := clock.Now().Sub(start); elapsed != 2*time.Second {
+		t.Errorf("rate limit should advance the clock by 2s, got %v", elapsed)
+	}
+	if stats := executor.DecoratorMetrics()["rate_limit:ping"]; stats.Calls != 5 || stats.Throttled != 2 {
+		t.Errorf("unexpected rate limit metrics: %+v", stats)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	clock := vm.NewManualClock(time.Unix(0, 0))
+	executor, out := newExecutor(clock)
+	executor.Loop().SetDeterministic(true)
+	busy := aqltest.Native{Name: "busy", Arity: 1, Fn: func(e *vm.Executor, args []vm.ValueGC) (vm.ValueGC, error) {
+		ms, _ := args[0].ToNumber()
+		clock.Advance(time.Duration(ms) * time.Millisecond)
+		return args[0], nil
+	}}
+
+	got := aqltest.RunWithNatives(t, executor, out, `
+let work = timeout(busy, 100)
+print(work(50))
+try { work(150) } catch (e) { print(e.name) }
+
+@timeout(50)
+async function slow() { await sleep(100); return "late" }
+@timeout(500)
+async function quick() { await sleep(10); return "quick" }
+print(await quick())
+try { await slow() } catch (e) { print(e.name, e.message) }
+`, busy)
+	want := "50\nTimeoutError\nquick\nTimeoutError slow timed out after 50ms\n"
+	if got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+	if stats := executor.DecoratorMetrics()["timeout:busy"]; stats.Calls != 2 || stats.Timeouts != 1 || stats.Errors != 1 {
+		t.Errorf("unexpected timeout metrics: %+v", stats)
+	}
+}
+
+func TestTimeoutInterruptsLoop(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	function := aqltest.Compile(t, `
+let rounds = 0
+function spin() { while (true) { rounds = rounds + 1 } }
+let limited = timeout(spin, 50)
+try { limited() } catch (e) { print(e.name, e.message) }
+print(rounds > 0)
+`)
+
+	// 截止时间由执行循环检查，脚本不能一直占住执行器
+	done := make(chan error, 1)
+	go func() {
+		_, err := executor.Execute(function, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("script failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout should stop an endless loop")
+	}
+	if want := "TimeoutError spin timed out after 50ms\ntrue\n"; out.String() != want {
+		t.Errorf("output should be %q, got %q", want, out.String())
+	}
+}
+
+func TestDecorateClosures(t *testing.T) {
+	executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	got := aqltest.Run(t, executor, out, `
+function counter(step) {
+    let n = 0
+    return function() {
+        n = n + step
+        return n
+    }
+}
+let next = retry(counter(5), 1)
+print(next(), next())
+
+function outer() {
+    let base = 3
+    @retry(2)
+    function inner() { return base }
+    @cache
+    function twice(x) { return x * base * 2 }
+    return inner() + twice(1) + twice(1)
+}
+print(outer(), outer())
+`)
+	if want := "5 10\n15 15\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestCollectWrappers(t *testing.T) {
+	executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	registerCollector(t, executor)
+	base := vm.GlobalNativeRegistry.AnonymousCount()
+
+	got := aqltest.Run(t, executor, out, `
+function count() {
+    let i = 0
+    while (true) {
+        i = i + 1
+        yield i
+    }
+}
+function make() {
+    let g = count()
+    let f = function() { return next(g) }
+    return retry(f, 1)
+}
+let step = make()
+print(step())
+@gc.collect()
+print(step())
+for (let i = 0; i < 100; i = i + 1) { cache(make()) }
+`)
+	// 生成器只被包装函数持有的目标闭包引用，回收时不能关闭
+	if want := "1\n2\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+	executor.CollectUnreachable()
+	if live := vm.GlobalNativeRegistry.AnonymousCount() - base; live != 1 {
+		t.Errorf("only step should stay registered, got %d wrappers", live)
+	}
+}
+
+func TestDecoratorMetricsPerWrapper(t *testing.T) {
+	executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	got := aqltest.Run(t, executor, out, `
+let ok = retry(function() { return 1 }, 2)
+let failing = retry(function() { throw "no" }, 2)
+ok()
+try { failing() } catch (e) { print(e) }
+function outer() {
+    @retry(2)
+    function inner() { return 1 }
+    return inner()
+}
+outer()
+outer()
+let m = decorator_metrics()
+print(m["retry:<anonymous>"].errors, m["retry:<anonymous>#2"].errors, m["retry:inner"].calls, m["retry:inner#2"].calls)
+`)
+	// 匿名函数和每次调用outer创建的包装函数各自记录指标
+	if want := "no\n0 1 1 1\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestDecoratedServiceCall(t *testing.T) {
+	executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	calls := 0
+	executor.RegisterService("llm", vm.ServiceFunc(func(ctx context.Context, method string, args []interface{}) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("overloaded")
+		}
+		return "reply to " + args[0].(string), nil
+	}))
+
+	got := aqltest.Run(t, executor, out, `
+let ask = cache(retry("@llm.chat", 2))
+print(ask("hi"))
+print(ask("hi"))
+let m = decorator_metrics()
+print(m["retry:@llm.chat"].retries, m["cache:retry:@llm.chat"].hits)
+`)
+	if got != "reply to hi\nreply to hi\n1 1\n" || calls != 2 {
+		t.Errorf("unexpected output %q after %d service calls", got, calls)
+	}
+}
+
+func TestDecoratorArgumentErrors(t *testing.T) {
+	executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	got := aqltest.Run(t, executor, out, `
+try { retry(1) } catch (e) { print(e.message) }
+try { retry(print, {tries: 2}) } catch (e) { print(e.message) }
+try { timeout(print) } catch (e) { print(e.message) }
+`)
+	for _, want := range []string{
+		"expected function or \"@service.method\", got int",
+		"unknown option \"tries\"",
+		"ms must be a positive number",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should mention %q, got %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// =============================================================================
+// 反汇编器
+// =============================================================================
+
+// 设计原理：
+// - 每个操作码声明其 A/B/C/Bx 字段的含义（寄存器、常量、全局变量、upvalue、跳转目标或数字），
+//   反汇编按声明把操作数格式化为 R1、K0、G2、U0、L3 等符号形式
+// - 能解析出名字或值的操作数在行尾注释中给出：寄存器和全局变量取编译器记录的变量名，
+//   常量显示其值，upvalue取捕获描述中的名字
+// - 跳转目标和异常处理区间的边界统一编号为标签 L1、L2...，源码行变化时插入 "; line N" 注释
+// - 从主函数出发，按常量引用顺序递归输出 FunctionRegistry 中的嵌套函数，每个函数只输出一次；
+//   嵌套函数与主函数共用全局变量，全局变量名取自主函数
+// - 函数头之后依次列出常量表、变量名、upvalue和异常处理表，重名函数带 #n 后缀，
+//   因此输出包含重建函数所需的全部信息（列号除外），可以由 Assemble 重新汇编
+
+// operandKind 操作数的含义
+type operandKind uint8
+
+const (
+	operandRegister operandKind = iota // 寄存器 R(x)
+	operandConstant                    // 常量 K(x)
+	operandGlobal                      // 全局变量 G(x)
+	operandUpvalue                     // upvalue U(x)
+	operandJump                        // 相对跳转，目标为 pc + x
+	operandNumber                      // 数量等普通整数
+)
+
+// operandField 指令中的操作数字段
+type operandField uint8
+
+const (
+	fieldA operandField = iota
+	fieldB
+	fieldC
+	fieldBx
+)
+
+// operand 操作数声明
+type operand struct {
+	field operandField
+	kind  operandKind
+}
+
+var (
+	opRR   = []operand{{fieldA, operandRegister}, {fieldB, operandRegister}}
+	opRRR  = []operand{{fieldA, operandRegister}, {fieldB, operandRegister}, {fieldC, operandRegister}}
+	opR    = []operand{{fieldA, operandRegister}}
+	opRnn  = []operand{{fieldA, operandRegister}, {fieldB, operandNumber}, {fieldC, operandNumber}}
+	opRJmp = []operand{{fieldA, operandRegister}, {fieldBx, operandJump}}
+
+	opRRRJmp = []operand{{fieldA, operandRegister}, {fieldB, operandRegister}, {fieldC, operandRegister}, {fieldBx, operandJump}}
+)
+
+// opCodeOperands 每个操作码的操作数声明，未列出的操作码没有操作数
+var opCodeOperands = map[OpCode][]operand{
+	OP_MOVE:                    opRR,
+	OP_LOADK:                   {{fieldA, operandRegister}, {fieldBx, operandConstant}},
+	OP_ADD:                     opRRR,
+	OP_SUB:                     opRRR,
+	OP_MUL:                     opRRR,
+	OP_DIV:                     opRRR,
+	OP_MOD:                     opRRR,
+	OP_CALL:                    opRnn,
+	OP_RETURN:                  {{fieldA, operandRegister}, {fieldB, operandNumber}},
+	OP_EQ:                      opRRR,
+	OP_NEQ:                     opRRR,
+	OP_LT:                      opRRR,
+	OP_GT:                      opRRR,
+	OP_LTE:                     opRRR,
+	OP_GTE:                     opRRR,
+	OP_NOT:                     opRR,
+	OP_NEG:                     opRR,
+	OP_GET_GLOBAL:              {{fieldA, operandRegister}, {fieldBx, operandGlobal}},
+	OP_SET_GLOBAL:              {{fieldA, operandRegister}, {fieldBx, operandGlobal}},
+	OP_GET_LOCAL:               opRR,
+	OP_SET_LOCAL:               opRR,
+	OP_JUMP:                    {{fieldBx, operandJump}},
+	OP_JUMP_IF_FALSE:           opRJmp,
+	OP_JUMP_IF_TRUE:            opRJmp,
+	OP_NEW_ARRAY:               {{fieldA, operandRegister}, {fieldB, operandNumber}},
+	OP_NEW_ARRAY_WITH_CAPACITY: opRRR,
+	OP_ARRAY_GET:               opRRR,
+	OP_ARRAY_SET:               opRRR,
+	OP_ARRAY_LEN:               opRR,
+	OP_GC_WRITE_BARRIER:        opRR,
+	OP_GC_INC_REF:              opR,
+	OP_GC_DEC_REF:              opR,
+	OP_GC_ALLOC:                {{fieldA, operandRegister}, {fieldB, operandNumber}},
+	OP_GC_CHECK:                opR,
+	OP_GC_PIN:                  opR,
+	OP_GC_UNPIN:                opR,
+	OP_MAKE_CLOSURE:            {{fieldA, operandRegister}, {fieldB, operandRegister}, {fieldC, operandNumber}},
+	OP_GET_UPVALUE:             {{fieldA, operandRegister}, {fieldB, operandUpvalue}},
+	OP_SET_UPVALUE:             {{fieldA, operandRegister}, {fieldB, operandUpvalue}},
+	OP_CLOSE_UPVALUE:           opR,
+	OP_WEAK_REF:                opRR,
+	OP_WEAK_GET:                opRR,
+	OP_ASYNC_CALL:              opRnn,
+	OP_AWAIT:                   opRR,
+	OP_YIELD:                   opRR,
+	OP_NEW_OBJECT:              {{fieldA, operandRegister}, {fieldB, operandNumber}},
+	OP_GET_FIELD:               {{fieldA, operandRegister}, {fieldB, operandRegister}, {fieldC, operandConstant}},
+	OP_SET_FIELD:               {{fieldA, operandRegister}, {fieldB, operandConstant}, {fieldC, operandRegister}},
+	OP_GET_INDEX:               opRRR,
+	OP_SET_INDEX:               opRRR,
+	OP_SPREAD_OBJECT:           opRR,
+	OP_THROW:                   opR,
+	OP_CATCH:                   opR,
+	OP_SERVICE_CALL:            {{fieldA, operandRegister}, {fieldB, operandNumber}, {fieldC, operandConstant}},
+	OP_IMPORT:                  {{fieldA, operandRegister}, {fieldB, operandConstant}, {fieldC, operandConstant}},
+	OP_JUMP_IF_NOT_EQ:          opRRRJmp,
+	OP_JUMP_IF_NOT_NEQ:         opRRRJmp,
+	OP_JUMP_IF_NOT_LT:          opRRRJmp,
+	OP_JUMP_IF_NOT_GT:          opRRRJmp,
+	OP_JUMP_IF_NOT_LTE:         opRRRJmp,
+	OP_JUMP_IF_NOT_GTE:         opRRRJmp,
+}
+
+// value 返回指令中该字段的值
+func (f operandField) value(inst Instruction) int {
+	switch f {
+	case fieldA:
+		return inst.A
+	case fieldB:
+		return inst.B
+	case fieldC:
+		return inst.C
+	default:
+		return inst.Bx
+	}
+}
+
+// disassembler 一次反汇编的状态
+type disassembler struct {
+	sb      strings.Builder
+	names   map[*Function]string // 输出中的函数名，重名函数带 #n 后缀
+	globals []string             // 主函数的全局变量名
+}
+
+// Disassemble 返回函数及其嵌套函数的反汇编文本，输出可以由 Assemble 重新汇编
+func Disassemble(main *Function) string {
+	d := &disassembler{names: map[*Function]string{}, globals: main.GlobalNames}
+	functions := reachableFunctions(main)
+
+	count := map[string]int{}
+	for _, fn := range functions {
+		count[fn.Name]++
+	}
+	seq := map[string]int{}
+	for _, fn := range functions {
+		d.names[fn] = fn.Name
+		if count[fn.Name] > 1 {
+			seq[fn.Name]++
+			d.names[fn] = fmt.Sprintf("%s#%d", fn.Name, seq[fn.Name])
+		}
+	}
+
+	for i, fn := range functions {
+		if i > 0 {
+			d.sb.WriteString("\n")
+		}
+		d.function(fn)
+	}
+	return d.sb.String()
+}
+
+// reachableFunctions 从主函数出发按常量引用顺序广度优先收集函数，每个函数只出现一次
+func reachableFunctions(main *Function) []*Function {
+	seen := map[*Function]bool{main: true}
+	functions := []*Function{main}
+	for i := 0; i < len(functions); i++ {
+		for _, constant := range functions[i].Constants {
+			if !constant.IsFunction() {
+				continue
+			}
+			if nested, err := GetFunction(constant.AsFunctionID()); err == nil && !seen[nested] {
+				seen[nested] = true
+				functions = append(functions, nested)
+			}
+		}
+	}
+	return functions
+}
+
+// function 输出单个函数：头部、常量表、变量名、upvalue、异常处理表和指令
+func (d *disassembler) function(fn *Function) {
+	sb := &d.sb
+	flags := ""
+	if fn.IsVarArg {
+		flags += ", vararg"
+	}
+	if fn.IsAsync {
+		flags += ", async"
+	}
+	if fn.IsGenerator {
+		flags += ", generator"
+	}
+	fmt.Fprintf(sb, "function %s (params=%d, stack=%d, constants=%d%s)\n",
+		d.names[fn], fn.ParamCount, fn.MaxStackSize, len(fn.Constants), flags)
+	if fn.Source != "" {
+		fmt.Fprintf(sb, "  source %s\n", fn.Source)
+	}
+	for i, constant := range fn.Constants {
+		fmt.Fprintf(sb, "  constant K%d %s\n", i, d.constant(constant))
+	}
+	writeNames(sb, "locals", "R", fn.LocalNames)
+	writeNames(sb, "globals", "G", fn.GlobalNames)
+
+	labels := jumpLabels(fn)
+	label := func(pc int) string {
+		if name, ok := labels[pc]; ok {
+			return name
+		}
+		return fmt.Sprintf("@%d", pc)
+	}
+
+	for i, upvalue := range fn.Upvalues {
+		fmt.Fprintf(sb, "  upvalue U%d %s (%s)\n", i, upvalue.Name, upvalue.describe())
+	}
+	for _, handler := range fn.Handlers {
+		fmt.Fprintf(sb, "  handler [%s, %s) -> %s\n", label(handler.StartPC), label(handler.EndPC), label(handler.HandlerPC))
+	}
+
+	line := 0
+	for pc, inst := range fn.Instructions {
+		if name, ok := labels[pc]; ok {
+			fmt.Fprintf(sb, "%s:\n", name)
+		}
+		if l, _ := fn.PositionAt(pc); l > 0 && l != line {
+			line = l
+			fmt.Fprintf(sb, "  ; line %d\n", line)
+		}
+
+		operands, notes := d.operands(fn, pc, inst, label)
+		text := fmt.Sprintf("  %04d  %-16s %s", pc, inst.OpCode, strings.Join(operands, ", "))
+		if len(notes) > 0 {
+			text = fmt.Sprintf("%-48s ; %s", text, strings.Join(notes, ", "))
+		}
+		sb.WriteString(strings.TrimRight(text, " "))
+		sb.WriteString("\n")
+	}
+	if name, ok := labels[len(fn.Instructions)]; ok {
+		fmt.Fprintf(sb, "%s:\n", name)
+	}
+}
+
+// writeNames 输出变量名表，如 "locals R0=a R2=b"，跳过没有名字的索引
+func writeNames(sb *strings.Builder, directive, prefix string, names []string) {
+	var items []string
+	for i, name := range names {
+		if name != "" {
+			items = append(items, fmt.Sprintf("%s%d=%s", prefix, i, name))
+		}
+	}
+	if len(items) > 0 {
+		fmt.Fprintf(sb, "  %s %s\n", directive, strings.Join(items, " "))
+	}
+}
+
+// operands 格式化指令的操作数，并返回能解析出名字或值的操作数注释
+func (d *disassembler) operands(fn *Function, pc int, inst Instruction, label func(int) string) ([]string, []string) {
+	if _, known := opCodeNames[inst.OpCode]; !known {
+		// 未知操作码按原始字段输出，便于排查损坏的字节码
+		return []string{
+			strconv.Itoa(inst.A), strconv.Itoa(inst.B), strconv.Itoa(inst.C), strconv.Itoa(inst.Bx),
+		}, nil
+	}
+
+	var operands, notes []string
+	note := func(text string) {
+		for _, n := range notes {
+			if n == text {
+				return
+			}
+		}
+		notes = append(notes, text)
+	}
+	for _, spec := range opCodeOperands[inst.OpCode] {
+		v := spec.field.value(inst)
+		switch spec.kind {
+		case operandRegister:
+			operands = append(operands, fmt.Sprintf("R%d", v))
+			if v >= 0 && v < len(fn.LocalNames) && fn.LocalNames[v] != "" {
+				note(fmt.Sprintf("R%d=%s", v, fn.LocalNames[v]))
+			}
+		case operandConstant:
+			if inst.OpCode == OP_IMPORT && v < 0 {
+				operands = append(operands, "*")
+				continue
+			}
+			operands = append(operands, fmt.Sprintf("K%d", v))
+			if v >= 0 && v < len(fn.Constants) {
+				note(fmt.Sprintf("K%d=%s", v, d.constant(fn.Constants[v])))
+			}
+		case operandGlobal:
+			operands = append(operands, fmt.Sprintf("G%d", v))
+			if v >= 0 && v < len(d.globals) && d.globals[v] != "" {
+				note(fmt.Sprintf("G%d=%s", v, d.globals[v]))
+			}
+		case operandUpvalue:
+			operands = append(operands, fmt.Sprintf("U%d", v))
+			if v >= 0 && v < len(fn.Upvalues) {
+				note(fmt.Sprintf("U%d=%s", v, fn.Upvalues[v].Name))
+			}
+		case operandJump:
+			operands = append(operands, label(pc+v))
+		default:
+			operands = append(operands, strconv.Itoa(v))
+		}
+	}
+	return operands, notes
+}
+
+// jumpLabels 为跳转目标和异常处理区间边界按位置顺序分配标签
+func jumpLabels(fn *Function) map[int]string {
+	targets := map[int]bool{}
+	for pc, inst := range fn.Instructions {
+		for _, spec := range opCodeOperands[inst.OpCode] {
+			if spec.kind == operandJump {
+				targets[pc+spec.field.value(inst)] = true
+			}
+		}
+	}
+	for _, handler := range fn.Handlers {
+		targets[handler.StartPC] = true
+		targets[handler.EndPC] = true
+		targets[handler.HandlerPC] = true
+	}
+
+	var pcs []int
+	for pc := range targets {
+		if pc >= 0 && pc <= len(fn.Instructions) {
+			pcs = append(pcs, pc)
+		}
+	}
+	sort.Ints(pcs)
+
+	labels := make(map[int]string, len(pcs))
+	for i, pc := range pcs {
+		labels[pc] = fmt.Sprintf("L%d", i+1)
+	}
+	return labels
+}
+
+// describe 返回捕获变量在外层函数中的位置描述
+func (u UpvalueDesc) describe() string {
+	switch u.Kind {
+	case UpvalueLocal:
+		return fmt.Sprintf("local R%d", u.Index)
+	case UpvalueOuter:
+		return fmt.Sprintf("upvalue U%d", u.Index)
+	case UpvalueGlobal:
+		return fmt.Sprintf("global G%d", u.Index)
+	default:
+		return fmt.Sprintf("kind %d, index %d", u.Kind, u.Index)
+	}
+}
+
+// constant 返回常量的字面量表示：字符串带引号，浮点数总带小数点或指数，函数显示为名字
+func (d *disassembler) constant(v ValueGC) string {
+	switch {
+	case v.IsString():
+		return strconv.Quote(v.AsString())
+	case v.IsDouble():
+		text := strconv.FormatFloat(v.AsDouble(), 'g', -1, 64)
+		if !strings.ContainsAny(text, ".eIN") {
+			text += ".0"
+		}
+		return text
+	case v.IsFunction():
+		if fn, err := GetFunction(v.AsFunctionID()); err == nil {
+			if name, ok := d.names[fn]; ok {
+				return fmt.Sprintf("<function %s>", name)
+			}
+			return fmt.Sprintf("<function %s>", fn.Name)
+		}
+		return fmt.Sprintf("<function #%d>", v.AsFunctionID())
+	case v.IsNativeFunction():
+		if native := v.AsNativeFunction(); native != nil {
+			return fmt.Sprintf("<native %s>", native.Name)
+		}
+	}
+	return v.String()
+}
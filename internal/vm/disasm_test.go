@@ -0,0 +1,62 @@
+package vm_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhnt/aql/internal/compiler1"
+	"github.com/zhnt/aql/internal/lexer1"
+	"github.com/zhnt/aql/internal/parser1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 反汇编测试
+// =============================================================================
+
+func TestDisassemble(t *testing.T) {
+	newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	p := parser1.New(lexer1.New(`let total = 0
+function counter(start) {
+    let n = start
+    return function() { n = n + 1; total = total + n; return n }
+}
+if (total > 1) { print("big") }
+try { throw "x" } catch (e) { print(e) }
+`))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	c := compiler1.New()
+	c.SetSource("counter.aql")
+	function, err := c.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := vm.Disassemble(function)
+	for _, want := range []string{
+		"function main (params=0,",
+		"  source counter.aql\n",
+		"  handler [L3, L4) -> L4\n",
+		"  ; line 6\n",
+		"JUMP_IF_NOT_GT   R6, R4, R5, L1",
+		"; G0=total",
+		`K6="big"`,
+		"=<native print>",
+		"function counter (params=1,",
+		"GET_LOCAL        R1, R0                  ; R1=n, R0=start",
+		"MAKE_CLOSURE     R4, R2, 1",
+		"  upvalue U0 n (local R1)\n",
+		"SET_GLOBAL       R2, G0                  ; G0=total",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("disassembly should contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "\nfunction <anonymous>") != 1 {
+		t.Errorf("each nested function should be listed once, got:\n%s", got)
+	}
+}
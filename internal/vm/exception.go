@@ -0,0 +1,142 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// =============================================================================
+// 异常处理
+// =============================================================================
+
+// 设计原理：
+// - 每个 Function 带有一张静态异常处理表，编译器按从内到外的顺序生成，执行时不需要压栈/出栈
+// - THROW 和执行期间的内部错误都走同一条展开路径：在当前栈帧查找覆盖PC的处理项，
+//   找不到就关闭upvalue、销毁栈帧并回到调用者继续查找
+// - 找到处理项后异常值暂存在执行器中，处理入口的 CATCH 指令把它取到寄存器
+// - 内部错误（除零、越界、调用非函数等）转换为 {name, message} 形式的错误对象，脚本可以正常捕获
+
+// ThrowError THROW 指令抛出的脚本异常
+type ThrowError struct {
+	Value ValueGC // 被抛出的值
+}
+
+// Error 返回异常描述，错误对象显示为 "name: message"
+func (te *ThrowError) Error() string {
+	return "uncaught exception: " + describeException(te.Value)
+}
+
+// 内部错误信息到错误名称的映射，按顺序匹配
+var runtimeErrorNames = []struct {
+	pattern string
+	name    string
+}{
+	{"by zero", "ZeroDivisionError"},
+	{"index", "IndexError"},
+	{"non-function", "TypeError"},
+	{"cannot", "TypeError"},
+	{"not an object", "TypeError"},
+	{"stack overflow", "StackOverflowError"},
+}
+
+// NewErrorValueGC 创建错误对象 {name: name, message: message}
+func NewErrorValueGC(name, message string) ValueGC {
+	errValue := NewObjectValueGC(2)
+	ObjectSetValueGC(errValue, "name", NewStringValueGC(name))
+	ObjectSetValueGC(errValue, "message", NewStringValueGC(message))
+	return errValue
+}
+
+// exceptionValue 将执行错误转换为脚本可见的异常值
+func exceptionValue(err error) ValueGC {
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr.Value
+	}
+	var throwErr *ThrowError
+	if errors.As(err, &throwErr) {
+		return throwErr.Value
+	}
+	var serviceErr *ServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.Value()
+	}
+
+	message := err.Error()
+	name := "RuntimeError"
+	lower := strings.ToLower(message)
+	for _, entry := range runtimeErrorNames {
+		if strings.Contains(lower, entry.pattern) {
+			name = entry.name
+			break
+		}
+	}
+	return NewErrorValueGC(name, message)
+}
+
+// describeException 返回异常值的描述
+func describeException(value ValueGC) string {
+	if value.IsObject() {
+		message, hasMessage, _ := ObjectGetValueGC(value, "message")
+		if hasMessage {
+			if name, hasName, _ := ObjectGetValueGC(value, "name"); hasName {
+				return fmt.Sprintf("%s: %s", name.ToString(), message.ToString())
+			}
+			return message.ToString()
+		}
+	}
+	return value.ToString()
+}
+
+// executeThrow THROW A : 抛出R(A)
+func (e *Executor) executeThrow(inst Instruction) error {
+	return &ThrowError{Value: e.CurrentFrame.GetRegister(inst.A)}
+}
+
+// executeCatch CATCH A : R(A) := 当前捕获的异常
+func (e *Executor) executeCatch(inst Instruction) error {
+	frame := e.CurrentFrame
+	if !e.hasException {
+		return fmt.Errorf("CATCH without pending exception")
+	}
+
+	value := e.exception
+	e.exception = NewNilValueGC()
+	e.hasException = false
+
+	if err := e.setRegisterWithGC(frame, inst.A, value); err != nil {
+		return err
+	}
+	frame.PC++
+	return nil
+}
+
+// unwind 沿调用链查找异常处理项，找到时跳转到处理入口并返回true
+// 没有找到处理项的栈帧会被销毁；全部未处理时返回false，调用者负责中止执行
+func (e *Executor) unwind(value ValueGC) bool {
+	frame := e.CurrentFrame
+	for frame != nil {
+		if handler, ok := frame.Function.FindHandler(frame.PC); ok {
+			e.tracef("THROW", "异常由 %s 在 PC=%d 处理", frame.Function.Name, handler.HandlerPC)
+			frame.PC = handler.HandlerPC
+			e.CurrentFrame = frame
+			e.exception = value
+			e.hasException = true
+			return true
+		}
+
+		if frame.Caller == nil {
+			return false
+		}
+
+		// 销毁没有处理项的栈帧
+		frame.CloseUpvalues()
+		if e.enableGCOpt && e.gcOptimizer != nil {
+			e.gcOptimizer.OnStackFrameDestroy(frame)
+		}
+		e.CallDepth--
+		frame = frame.Caller
+	}
+	return false
+}
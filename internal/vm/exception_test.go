@@ -0,0 +1,113 @@
+package vm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 异常处理测试
+// =============================================================================
+
+func TestTryCatchFinally(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	got := aqltest.Run(t, executor, out, `
+function attempt(fail) {
+    try {
+        print("try")
+        if (fail) { throw "boom" }
+        return "returned"
+    } catch (e) {
+        print("catch", e)
+        return "caught"
+    } finally {
+        print("finally")
+    }
+}
+print(attempt(false))
+print(attempt(true))
+
+try {
+    try { throw {name: "Custom", message: "inner"} } finally { print("inner finally") }
+} catch (e) {
+    print(e.name, e.message)
+}
+
+try {
+    try { throw 1 } catch (e) { throw e + 1 }
+} catch (e) {
+    print("rethrown", e)
+}
+`)
+	want := "try\nfinally\nreturned\n" +
+		"try\ncatch boom\nfinally\ncaught\n" +
+		"inner finally\nCustom inner\n" +
+		"rethrown 2\n"
+	if got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestRuntimeErrorsAreCatchable(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	got := aqltest.Run(t, executor, out, `
+try { print(1 / 0) } catch (e) { print(e.name) }
+try { print([1][5]) } catch (e) { print(e.name) }
+try { let n = 3; n() } catch (e) { print(e.name) }
+try { let o = null; print(o.x) } catch (e) { print(e.name) }
+function down(n) { return down(n + 1) }
+try { down(0) } catch (e) { print(e.name) }
+print("still running")
+`)
+	want := "ZeroDivisionError\nIndexError\nTypeError\nTypeError\nStackOverflowError\nstill running\n"
+	if got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestUnwindClosesUpvalues(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	got := aqltest.Run(t, executor, out, `
+let saved = []
+function inner(n) {
+    let local = n * 10
+    saved[len(saved)] = function() { return local }
+    if (n > 0) { return inner(n - 1) }
+    throw "bottom"
+}
+try { inner(2) } catch (e) { print(e) }
+let filler = [7, 8, 9]
+print(saved[0](), saved[1](), saved[2]())
+`)
+	// 展开时被销毁的栈帧必须关闭upvalue，闭包之后仍能读到各自的值
+	if want := "bottom\n20 10 0\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestUncaughtException(t *testing.T) {
+	function := aqltest.Compile(t, `
+function f() { throw {name: "Custom", message: "nobody catches this"} }
+f()
+`)
+	executor, _ := aqltest.NewExecutor()
+	_, err := executor.Execute(function, nil)
+
+	var runtimeErr *vm.RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("uncaught exceptions should be runtime errors, got %v", err)
+	}
+	var throwErr *vm.ThrowError
+	if !errors.As(err, &throwErr) {
+		t.Fatalf("the cause should be the thrown value, got %v", runtimeErr.Cause)
+	}
+	if want := "uncaught exception: Custom: nobody catches this"; runtimeErr.Message != want {
+		t.Errorf("message should be %q, got %q", want, runtimeErr.Message)
+	}
+	if len(runtimeErr.StackTrace) != 2 || runtimeErr.StackTrace[0].Function != "f" {
+		t.Errorf("the stack trace should start in f, got %v", runtimeErr.StackTrace)
+	}
+}
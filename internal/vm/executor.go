@@ -1,7 +1,10 @@
 package vm
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"unsafe"
 )
 
@@ -12,9 +15,56 @@ type Executor struct {
 	CallDepth    int
 	Globals      []ValueGC // 全局变量存储
 
+	suspended []*StackFrame // 嵌套执行（runFrame）期间被挂起的外层栈帧，最后一项为最内层
+
 	// GC 优化组件
 	gcOptimizer *GCOptimizer // GC优化器
 	enableGCOpt bool         // 是否启用GC优化
+
+	stdout io.Writer // 内建函数的输出目标，nil表示os.Stdout
+
+	// 异常处理
+	exception    ValueGC // 已被处理项捕获、等待CATCH取出的异常值
+	hasException bool    // exception 是否有效
+
+	// 协程
+	coroutines      map[int]*Coroutine // 协程表，按ID索引
+	nextCoroutineID int                // 最近分配的协程ID
+	running         []*Coroutine       // 正在运行的协程，最后一项为当前协程
+
+	// 异步任务
+	loop          *EventLoop          // 事件循环，首次使用时创建
+	promises      map[int]*Promise    // promise表，按ID索引
+	nextPromiseID int                 // 最近分配的promise ID
+	tasks         map[*Coroutine]bool // 尚未结束的异步任务
+	retained      map[int][]ValueGC   // 只被Go回调引用、在异步操作完成前需要保持可达的值
+	nextRetainID  int                 // 最近分配的 retained 键
+
+	// AI服务
+	services map[string]ServiceProvider // 已注册的服务提供者，按服务名索引
+	ctx      context.Context            // 服务调用使用的context，nil表示Background
+
+	// 原生闭包
+	natives   map[int]bool // 本执行器创建、尚未释放的原生闭包下标
+	collectAt int          // 原生闭包、代码块和可调用对象的总数达到该值时在创建前先回收
+
+	// 可调用对象
+	pinned map[uint64]interface{} // 本执行器创建的Callable和Closure，按地址索引，保证Go GC不释放仍可达的对象
+
+	// 装饰器
+	clock          Clock                      // 装饰器等待和计时使用的时钟，nil表示SystemClock
+	decoratorStats map[string]*DecoratorStats // 包装函数的调用指标，按指标键索引
+	decoratorCount map[string]int             // 每个 "装饰器:目标名" 已创建的包装函数数量
+
+	// 模块
+	moduleLoader ModuleLoader             // import 使用的加载器，nil表示不支持import
+	modules      []*Module                // 已执行过顶层代码的模块
+	importing    []*Module                // 正在执行顶层代码的模块，用于检测循环导入
+	chunks       map[*Module]*loadedChunk // 运行时加载、尚未回收的代码块
+
+	// 执行跟踪
+	tracer  Tracer // 跟踪器，默认为创建时的包级默认跟踪器
+	tracing bool   // tracer 是否会产生输出，为false时跳过格式化
 }
 
 // NewExecutor 创建新的执行器
@@ -29,6 +79,7 @@ func NewExecutor() *Executor {
 
 	// 初始化GC优化器
 	executor.gcOptimizer = NewGCOptimizer(executor, &DefaultGCOptimizerConfig)
+	executor.SetTracer(defaultTracer)
 
 	return executor
 }
@@ -44,9 +95,23 @@ func NewExecutorWithGCConfig(gcConfig *GCOptimizerConfig) *Executor {
 	}
 
 	executor.gcOptimizer = NewGCOptimizer(executor, gcConfig)
+	executor.SetTracer(defaultTracer)
 	return executor
 }
 
+// SetStdout 设置内建函数（如print）的输出目标
+func (e *Executor) SetStdout(w io.Writer) {
+	e.stdout = w
+}
+
+// Stdout 返回内建函数的输出目标
+func (e *Executor) Stdout() io.Writer {
+	if e.stdout == nil {
+		return os.Stdout
+	}
+	return e.stdout
+}
+
 // DisableGCOptimization 禁用GC优化
 func (e *Executor) DisableGCOptimization() {
 	e.enableGCOpt = false
@@ -72,11 +137,13 @@ func (e *Executor) Execute(function *Function, args []ValueGC) ([]ValueGC, error
 	e.CallDepth = 1
 
 	// 执行主循环
-	for e.CurrentFrame != nil {
-		err := e.executeStep()
-		if err != nil {
-			return nil, err
-		}
+	if err := e.run(); err != nil {
+		return nil, err
+	}
+
+	// 运行主函数结束后仍未完成的异步任务
+	if err := e.drainEventLoop(); err != nil {
+		return nil, err
 	}
 
 	// 返回主函数的结果
@@ -100,6 +167,14 @@ func (e *Executor) executeStep() error {
 	}
 
 	instruction := frame.GetInstruction()
+	if e.tracing {
+		e.tracer.OnInstruction(frame, instruction)
+	}
+	if e.ctx != nil {
+		if err := e.checkContext(instruction); err != nil {
+			return err
+		}
+	}
 
 	switch instruction.OpCode {
 	case OP_MOVE:
@@ -124,6 +199,9 @@ func (e *Executor) executeStep() error {
 		return e.executeJumpIfFalse(instruction)
 	case OP_JUMP_IF_TRUE:
 		return e.executeJumpIfTrue(instruction)
+	case OP_JUMP_IF_NOT_EQ, OP_JUMP_IF_NOT_NEQ, OP_JUMP_IF_NOT_LT,
+		OP_JUMP_IF_NOT_GT, OP_JUMP_IF_NOT_LTE, OP_JUMP_IF_NOT_GTE:
+		return e.executeCompareJump(instruction)
 	case OP_GET_GLOBAL:
 		return e.executeGetGlobal(instruction)
 	case OP_SET_GLOBAL:
@@ -170,6 +248,30 @@ func (e *Executor) executeStep() error {
 		return e.executeArraySet(instruction)
 	case OP_ARRAY_LEN:
 		return e.executeArrayLen(instruction)
+	case OP_NEW_OBJECT:
+		return e.executeNewObject(instruction)
+	case OP_GET_FIELD:
+		return e.executeGetField(instruction)
+	case OP_SET_FIELD:
+		return e.executeSetField(instruction)
+	case OP_GET_INDEX:
+		return e.executeGetIndex(instruction)
+	case OP_SET_INDEX:
+		return e.executeSetIndex(instruction)
+	case OP_SPREAD_OBJECT:
+		return e.executeSpreadObject(instruction)
+	case OP_THROW:
+		return e.executeThrow(instruction)
+	case OP_CATCH:
+		return e.executeCatch(instruction)
+	case OP_YIELD:
+		return e.executeYield(instruction)
+	case OP_AWAIT:
+		return e.executeAwait(instruction)
+	case OP_SERVICE_CALL:
+		return e.executeServiceCall(instruction)
+	case OP_IMPORT:
+		return e.executeImport(instruction)
 	case OP_GC_WRITE_BARRIER:
 		return e.executeGCWriteBarrier(instruction)
 	case OP_GC_INC_REF:
@@ -202,11 +304,11 @@ func (e *Executor) executeStep() error {
 func (e *Executor) executeMove(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [MOVE] A=%d, B=%d\n", inst.A, inst.B)
-	fmt.Printf("DEBUG [MOVE] 当前栈帧: %s (PC: %d)\n", frame.Function.Name, frame.PC)
+	e.tracef("MOVE", "A=%d, B=%d", inst.A, inst.B)
+	e.tracef("MOVE", "当前栈帧: %s (PC: %d)", frame.Function.Name, frame.PC)
 
 	srcValue := frame.GetRegister(inst.B)
-	fmt.Printf("DEBUG [MOVE] 从寄存器[%d]获取值，类型: %s\n", inst.B, srcValue.Type())
+	e.tracef("MOVE", "从寄存器[%d]获取值，类型: %s", inst.B, srcValue.Type())
 
 	// GC优化：管理引用计数
 	if e.enableGCOpt && e.gcOptimizer != nil {
@@ -216,11 +318,11 @@ func (e *Executor) executeMove(inst Instruction) error {
 
 	err := frame.SetRegister(inst.A, srcValue)
 	if err != nil {
-		fmt.Printf("DEBUG [MOVE] 设置寄存器[%d]失败: %v\n", inst.A, err)
+		e.tracef("MOVE", "设置寄存器[%d]失败: %v", inst.A, err)
 		return err
 	}
 
-	fmt.Printf("DEBUG [MOVE] 成功移动到寄存器[%d]，类型: %s\n", inst.A, srcValue.Type())
+	e.tracef("MOVE", "成功移动到寄存器[%d]，类型: %s", inst.A, srcValue.Type())
 
 	frame.PC++
 	return nil
@@ -230,11 +332,11 @@ func (e *Executor) executeMove(inst Instruction) error {
 func (e *Executor) executeLoadK(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [LOADK] A=%d, Bx=%d\n", inst.A, inst.Bx)
-	fmt.Printf("DEBUG [LOADK] 当前栈帧: %s (PC: %d)\n", frame.Function.Name, frame.PC)
+	e.tracef("LOADK", "A=%d, Bx=%d", inst.A, inst.Bx)
+	e.tracef("LOADK", "当前栈帧: %s (PC: %d)", frame.Function.Name, frame.PC)
 
 	konstValue := frame.GetConstant(inst.Bx)
-	fmt.Printf("DEBUG [LOADK] 加载常量[%d]，类型: %s\n", inst.Bx, konstValue.Type())
+	e.tracef("LOADK", "加载常量[%d]，类型: %s", inst.Bx, konstValue.Type())
 
 	// GC优化：管理引用计数
 	if e.enableGCOpt && e.gcOptimizer != nil {
@@ -244,11 +346,11 @@ func (e *Executor) executeLoadK(inst Instruction) error {
 
 	err := frame.SetRegister(inst.A, konstValue)
 	if err != nil {
-		fmt.Printf("DEBUG [LOADK] 设置寄存器[%d]失败: %v\n", inst.A, err)
+		e.tracef("LOADK", "设置寄存器[%d]失败: %v", inst.A, err)
 		return err
 	}
 
-	fmt.Printf("DEBUG [LOADK] 成功加载到寄存器[%d]，类型: %s\n", inst.A, konstValue.Type())
+	e.tracef("LOADK", "成功加载到寄存器[%d]，类型: %s", inst.A, konstValue.Type())
 
 	frame.PC++
 	return nil
@@ -267,13 +369,14 @@ func (e *Executor) executePop(inst Instruction) error {
 // executeGetGlobal 执行GET_GLOBAL指令: R(A) := G(Bx)
 func (e *Executor) executeGetGlobal(inst Instruction) error {
 	frame := e.CurrentFrame
+	globals := *e.globals()
 
 	// 确保全局变量索引有效
-	if inst.Bx >= len(e.Globals) {
+	if inst.Bx >= len(globals) {
 		return fmt.Errorf("undefined global variable at index %d", inst.Bx)
 	}
 
-	globalValue := e.Globals[inst.Bx]
+	globalValue := globals[inst.Bx]
 
 	// GC优化：管理引用计数
 	if e.enableGCOpt && e.gcOptimizer != nil {
@@ -293,21 +396,22 @@ func (e *Executor) executeGetGlobal(inst Instruction) error {
 // executeSetGlobal 执行SET_GLOBAL指令: G(Bx) := R(A)
 func (e *Executor) executeSetGlobal(inst Instruction) error {
 	frame := e.CurrentFrame
+	globals := e.globals()
 
 	registerValue := frame.GetRegister(inst.A)
 
 	// 扩展全局变量数组（如果需要）
-	for len(e.Globals) <= inst.Bx {
-		e.Globals = append(e.Globals, NewNilValueGC())
+	for len(*globals) <= inst.Bx {
+		*globals = append(*globals, NewNilValueGC())
 	}
 
 	// GC优化：管理全局变量引用计数
 	if e.enableGCOpt && e.gcOptimizer != nil {
-		oldValue := e.Globals[inst.Bx]
+		oldValue := (*globals)[inst.Bx]
 		e.gcOptimizer.OnRegisterSet(oldValue, registerValue)
 	}
 
-	e.Globals[inst.Bx] = registerValue
+	(*globals)[inst.Bx] = registerValue
 
 	frame.PC++
 	return nil
@@ -317,13 +421,13 @@ func (e *Executor) executeSetGlobal(inst Instruction) error {
 func (e *Executor) executeGetLocal(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [GET_LOCAL] A=%d, B=%d\n", inst.A, inst.B)
-	fmt.Printf("DEBUG [GET_LOCAL] 当前栈帧: %s (PC: %d)\n", frame.Function.Name, frame.PC)
+	e.tracef("GET_LOCAL", "A=%d, B=%d", inst.A, inst.B)
+	e.tracef("GET_LOCAL", "当前栈帧: %s (PC: %d)", frame.Function.Name, frame.PC)
 
 	// 在当前实现中，局部变量也存储在寄存器中
 	// 这是一个简化的实现，实际上可能需要专门的局部变量存储
 	localValue := frame.GetRegister(inst.B)
-	fmt.Printf("DEBUG [GET_LOCAL] 从寄存器[%d]获取值，类型: %s\n", inst.B, localValue.Type())
+	e.tracef("GET_LOCAL", "从寄存器[%d]获取值，类型: %s", inst.B, localValue.Type())
 
 	// GC优化：管理引用计数
 	if e.enableGCOpt && e.gcOptimizer != nil {
@@ -333,11 +437,11 @@ func (e *Executor) executeGetLocal(inst Instruction) error {
 
 	err := frame.SetRegister(inst.A, localValue)
 	if err != nil {
-		fmt.Printf("DEBUG [GET_LOCAL] 设置寄存器[%d]失败: %v\n", inst.A, err)
+		e.tracef("GET_LOCAL", "设置寄存器[%d]失败: %v", inst.A, err)
 		return err
 	}
 
-	fmt.Printf("DEBUG [GET_LOCAL] 成功设置寄存器[%d]，类型: %s\n", inst.A, localValue.Type())
+	e.tracef("GET_LOCAL", "成功设置寄存器[%d]，类型: %s", inst.A, localValue.Type())
 
 	frame.PC++
 	return nil
@@ -347,11 +451,11 @@ func (e *Executor) executeGetLocal(inst Instruction) error {
 func (e *Executor) executeSetLocal(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [SET_LOCAL] A=%d, B=%d\n", inst.A, inst.B)
-	fmt.Printf("DEBUG [SET_LOCAL] 当前栈帧: %s (PC: %d)\n", frame.Function.Name, frame.PC)
+	e.tracef("SET_LOCAL", "A=%d, B=%d", inst.A, inst.B)
+	e.tracef("SET_LOCAL", "当前栈帧: %s (PC: %d)", frame.Function.Name, frame.PC)
 
 	registerValue := frame.GetRegister(inst.A)
-	fmt.Printf("DEBUG [SET_LOCAL] 从寄存器[%d]获取值，类型: %s\n", inst.A, registerValue.Type())
+	e.tracef("SET_LOCAL", "从寄存器[%d]获取值，类型: %s", inst.A, registerValue.Type())
 
 	// GC优化：管理引用计数
 	if e.enableGCOpt && e.gcOptimizer != nil {
@@ -361,16 +465,32 @@ func (e *Executor) executeSetLocal(inst Instruction) error {
 
 	err := frame.SetRegister(inst.B, registerValue)
 	if err != nil {
-		fmt.Printf("DEBUG [SET_LOCAL] 设置寄存器[%d]失败: %v\n", inst.B, err)
+		e.tracef("SET_LOCAL", "设置寄存器[%d]失败: %v", inst.B, err)
 		return err
 	}
 
-	fmt.Printf("DEBUG [SET_LOCAL] 成功设置寄存器[%d]，类型: %s\n", inst.B, registerValue.Type())
+	e.tracef("SET_LOCAL", "成功设置寄存器[%d]，类型: %s", inst.B, registerValue.Type())
 
 	frame.PC++
 	return nil
 }
 
+// checkContext 在调用和向后跳转时检查执行器的context
+// 循环和递归都要经过这两类指令，超时或取消因此能打断死循环，而不是等函数自己返回
+func (e *Executor) checkContext(inst Instruction) error {
+	switch inst.OpCode {
+	case OP_CALL:
+	case OP_JUMP, OP_JUMP_IF_FALSE, OP_JUMP_IF_TRUE, OP_JUMP_IF_NOT_EQ, OP_JUMP_IF_NOT_NEQ,
+		OP_JUMP_IF_NOT_LT, OP_JUMP_IF_NOT_GT, OP_JUMP_IF_NOT_LTE, OP_JUMP_IF_NOT_GTE:
+		if inst.Bx >= 0 {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return e.ctx.Err()
+}
+
 // executeJump 执行JUMP指令: PC := PC + Bx
 func (e *Executor) executeJump(inst Instruction) error {
 	frame := e.CurrentFrame
@@ -410,6 +530,52 @@ func (e *Executor) executeJumpIfTrue(inst Instruction) error {
 	return nil
 }
 
+// executeCompareJump 执行比较跳转指令: R(A) := R(B) op R(C); if !R(A) then PC := PC + Bx
+func (e *Executor) executeCompareJump(inst Instruction) error {
+	frame := e.CurrentFrame
+
+	valueB := frame.GetRegister(inst.B)
+	valueC := frame.GetRegister(inst.C)
+
+	var result ValueGC
+	var err error
+	switch inst.OpCode {
+	case OP_JUMP_IF_NOT_EQ:
+		result = NewBoolValueGC(valueB.Equal(valueC))
+	case OP_JUMP_IF_NOT_NEQ:
+		result = NewBoolValueGC(!valueB.Equal(valueC))
+	case OP_JUMP_IF_NOT_LT:
+		result, err = LessThanValuesGC(valueB, valueC)
+	case OP_JUMP_IF_NOT_GT:
+		result, err = GreaterThanValuesGC(valueB, valueC)
+	case OP_JUMP_IF_NOT_LTE:
+		result, err = LessEqualValuesGC(valueB, valueC)
+	default:
+		result, err = GreaterEqualValuesGC(valueB, valueC)
+	}
+	if err != nil {
+		return err
+	}
+
+	// GC优化：管理引用计数
+	if e.enableGCOpt && e.gcOptimizer != nil {
+		oldValue := frame.GetRegister(inst.A)
+		e.gcOptimizer.OnRegisterSet(oldValue, result)
+	}
+
+	if err := frame.SetRegister(inst.A, result); err != nil {
+		return err
+	}
+
+	// 比较结果为假时跳转
+	if !result.IsTruthy() {
+		frame.PC += inst.Bx
+	} else {
+		frame.PC++
+	}
+	return nil
+}
+
 // executeAdd 执行ADD指令: R(A) := R(B) + R(C)（优化版）
 func (e *Executor) executeAdd(inst Instruction) error {
 	frame := e.CurrentFrame
@@ -765,8 +931,8 @@ func (e *Executor) executeNEG(inst Instruction) error {
 func (e *Executor) executeCall(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [CALL] A=%d, B=%d, C=%d\n", inst.A, inst.B, inst.C)
-	fmt.Printf("DEBUG [CALL] 当前栈帧: %s (PC: %d)\n", frame.Function.Name, frame.PC)
+	e.tracef("CALL", "A=%d, B=%d, C=%d", inst.A, inst.B, inst.C)
+	e.tracef("CALL", "当前栈帧: %s (PC: %d)", frame.Function.Name, frame.PC)
 
 	// 检查调用深度
 	if e.CallDepth >= e.MaxCallDepth {
@@ -775,36 +941,41 @@ func (e *Executor) executeCall(inst Instruction) error {
 
 	// 获取函数或闭包
 	funcValue := frame.GetRegister(inst.A)
-	fmt.Printf("DEBUG [CALL] 函数值类型: %s\n", funcValue.Type())
+	e.tracef("CALL", "函数值类型: %s", funcValue.Type())
 
 	var targetFunc *Function
 	var callable *Callable
 	var closure *Closure
 
+	if funcValue.IsNativeFunction() {
+		// 原生Go函数，直接在当前栈帧中执行
+		return e.callNative(inst, funcValue)
+	}
+
 	if funcValue.IsFunction() {
 		// 普通函数
-		fmt.Printf("DEBUG [CALL] 调用普通函数\n")
+		e.tracef("CALL", "调用普通函数")
 		targetFuncInterface := funcValue.AsFunction()
 		var ok bool
 		targetFunc, ok = targetFuncInterface.(*Function)
 		if !ok {
-			fmt.Printf("DEBUG [CALL] 错误: 无法转换为Function类型\n")
+			e.tracef("CALL", "错误: 无法转换为Function类型")
 			return fmt.Errorf("invalid function type")
 		}
-		fmt.Printf("DEBUG [CALL] 目标函数: %s\n", targetFunc.Name)
+		e.tracef("CALL", "目标函数: %s", targetFunc.Name)
 	} else if funcValue.IsCallable() {
 		// 新的Callable类型（统一的可调用对象）
-		fmt.Printf("DEBUG [CALL] 调用Callable对象\n")
+		e.tracef("CALL", "调用Callable对象")
 
 		callable = funcValue.AsCallable()
 		if callable == nil {
-			fmt.Printf("DEBUG [CALL] 错误: AsCallable返回nil\n")
+			e.tracef("CALL", "错误: AsCallable返回nil")
 			return fmt.Errorf("invalid callable")
 		}
 
 		targetFunc = callable.Function
 		if targetFunc == nil {
-			fmt.Printf("DEBUG [CALL] 错误: Callable中的函数为nil\n")
+			e.tracef("CALL", "错误: Callable中的函数为nil")
 			return fmt.Errorf("callable function is nil")
 		}
 
@@ -813,28 +984,28 @@ func (e *Executor) executeCall(inst Instruction) error {
 		if targetFunc.Name != "" {
 			funcName = targetFunc.Name
 		}
-		fmt.Printf("DEBUG [CALL] Callable函数: %s\n", funcName)
-		fmt.Printf("DEBUG [CALL] Callable upvalue数量: %d\n", len(callable.Upvalues))
+		e.tracef("CALL", "Callable函数: %s", funcName)
+		e.tracef("CALL", "Callable upvalue数量: %d", len(callable.Upvalues))
 
 		// 只打印upvalue的名称，避免调用String()方法
 		for i, upvalue := range callable.Upvalues {
 			if upvalue != nil {
-				fmt.Printf("DEBUG [CALL] upvalue[%d]: %s\n", i, upvalue.Name)
+				e.tracef("CALL", "upvalue[%d]: %s", i, upvalue.Name)
 			}
 		}
 	} else if funcValue.IsClosure() {
 		// 旧的闭包类型（即将废弃）
-		fmt.Printf("DEBUG [CALL] 调用闭包（旧版本）\n")
+		e.tracef("CALL", "调用闭包（旧版本）")
 
 		closure = funcValue.AsClosure()
 		if closure == nil {
-			fmt.Printf("DEBUG [CALL] 错误: AsClosure返回nil\n")
+			e.tracef("CALL", "错误: AsClosure返回nil")
 			return fmt.Errorf("invalid closure")
 		}
 
 		targetFunc = closure.Function
 		if targetFunc == nil {
-			fmt.Printf("DEBUG [CALL] 错误: 闭包中的函数为nil\n")
+			e.tracef("CALL", "错误: 闭包中的函数为nil")
 			return fmt.Errorf("closure function is nil")
 		}
 
@@ -843,26 +1014,26 @@ func (e *Executor) executeCall(inst Instruction) error {
 		if targetFunc.Name != "" {
 			funcName = targetFunc.Name
 		}
-		fmt.Printf("DEBUG [CALL] 闭包函数: %s\n", funcName)
-		fmt.Printf("DEBUG [CALL] 闭包捕获变量数量: %d\n", len(closure.Captures))
+		e.tracef("CALL", "闭包函数: %s", funcName)
+		e.tracef("CALL", "闭包捕获变量数量: %d", len(closure.Captures))
 
 		// 只打印捕获变量的名称，避免调用String()方法
 		for name := range closure.Captures {
-			fmt.Printf("DEBUG [CALL] 捕获变量名: %s\n", name)
+			e.tracef("CALL", "捕获变量名: %s", name)
 		}
 	} else {
-		fmt.Printf("DEBUG [CALL] 错误: 尝试调用非函数值: %s\n", funcValue.Type())
+		e.tracef("CALL", "错误: 尝试调用非函数值: %s", funcValue.Type())
 		return fmt.Errorf("attempted to call non-function value")
 	}
 
 	// 获取参数
 	argCount := inst.B - 1
-	fmt.Printf("DEBUG [CALL] 参数数量: %d\n", argCount)
+	e.tracef("CALL", "参数数量: %d", argCount)
 	args := make([]ValueGC, argCount)
 	for i := 0; i < argCount; i++ {
 		args[i] = frame.GetRegister(inst.A + 1 + i)
 		// 只打印参数类型，避免String()方法可能的递归
-		fmt.Printf("DEBUG [CALL] 参数[%d] 类型: %s\n", i, args[i].Type())
+		e.tracef("CALL", "参数[%d] 类型: %s", i, args[i].Type())
 	}
 
 	// 创建新栈帧
@@ -870,8 +1041,8 @@ func (e *Executor) executeCall(inst Instruction) error {
 	newFrame.SetParameters(args)
 	newFrame.ExpectedRets = inst.C
 
-	fmt.Printf("DEBUG [CALL] 创建新栈帧: %s\n", newFrame.Function.Name)
-	fmt.Printf("DEBUG [CALL] 新栈帧寄存器数量: %d\n", len(newFrame.Registers))
+	e.tracef("CALL", "创建新栈帧: %s", newFrame.Function.Name)
+	e.tracef("CALL", "新栈帧寄存器数量: %d", len(newFrame.Registers))
 
 	// 为了支持递归调用，将函数对象自身设置到函数名对应的寄存器位置
 	// 函数名的寄存器索引是参数数量（因为参数从0开始，函数名在参数之后）
@@ -879,26 +1050,26 @@ func (e *Executor) executeCall(inst Instruction) error {
 	recursiveRefIndex := targetFunc.ParamCount + 8 // 在参数后留出足够的临时寄存器空间
 	if recursiveRefIndex < len(newFrame.Registers) {
 		newFrame.SetRegister(recursiveRefIndex, funcValue)
-		fmt.Printf("DEBUG [CALL] 设置递归函数引用到寄存器[%d]\n", recursiveRefIndex)
+		e.tracef("CALL", "设置递归函数引用到寄存器[%d]", recursiveRefIndex)
 	}
 
 	// 如果是Callable或闭包调用，设置捕获的变量
 	if callable != nil {
-		fmt.Printf("DEBUG [CALL] 处理Callable upvalue...\n")
+		e.tracef("CALL", "处理Callable upvalue...")
 
 		// 直接设置upvalue到新栈帧
 		if len(callable.Upvalues) > 0 {
-			fmt.Printf("DEBUG [CALL] 设置upvalue到新栈帧...\n")
+			e.tracef("CALL", "设置upvalue到新栈帧...")
 
 			newFrame.Upvalues = callable.Upvalues
-			fmt.Printf("DEBUG [CALL] 成功设置%d个upvalue到新栈帧\n", len(callable.Upvalues))
+			e.tracef("CALL", "成功设置%d个upvalue到新栈帧", len(callable.Upvalues))
 		}
 	} else if closure != nil {
-		fmt.Printf("DEBUG [CALL] 处理闭包upvalue（旧版本）...\n")
+		e.tracef("CALL", "处理闭包upvalue（旧版本）...")
 
 		// 尝试设置upvalue（实验性）
 		if len(closure.Captures) > 0 {
-			fmt.Printf("DEBUG [CALL] 尝试设置upvalue到新栈帧...\n")
+			e.tracef("CALL", "尝试设置upvalue到新栈帧...")
 
 			upvalues := make([]*Upvalue, len(closure.Captures))
 			index := 0
@@ -911,14 +1082,32 @@ func (e *Executor) executeCall(inst Instruction) error {
 				}
 				upvalues[index] = upvalue
 
-				fmt.Printf("DEBUG [CALL] 设置upvalue[%d]: %s (类型: %s)\n",
+				e.tracef("CALL", "设置upvalue[%d]: %s (类型: %s)",
 					index, name, value.Type())
 				index++
 			}
 
 			newFrame.Upvalues = upvalues
-			fmt.Printf("DEBUG [CALL] 成功设置%d个upvalue到新栈帧\n", len(upvalues))
+			e.tracef("CALL", "成功设置%d个upvalue到新栈帧", len(upvalues))
+		}
+	}
+
+	// 生成器函数：不执行函数体，返回拥有该栈帧的协程
+	if targetFunc.IsGenerator {
+		if err := e.setRegisterWithGC(frame, inst.A, e.newCoroutine(newFrame)); err != nil {
+			return err
+		}
+		frame.PC++
+		return nil
+	}
+
+	// 异步函数：不执行函数体，启动异步任务并返回它的promise
+	if targetFunc.IsAsync {
+		if err := e.setRegisterWithGC(frame, inst.A, e.startAsync(newFrame)); err != nil {
+			return err
 		}
+		frame.PC++
+		return nil
 	}
 
 	// GC优化：管理栈帧生命周期
@@ -930,7 +1119,11 @@ func (e *Executor) executeCall(inst Instruction) error {
 	e.CurrentFrame = newFrame
 	e.CallDepth++
 
-	fmt.Printf("DEBUG [CALL] 切换到新栈帧，调用深度: %d\n", e.CallDepth)
+	if e.tracing {
+		e.tracer.OnCall(targetFunc.Name, args, e.CallDepth)
+	}
+
+	e.tracef("CALL", "切换到新栈帧，调用深度: %d", e.CallDepth)
 
 	return nil
 }
@@ -939,32 +1132,32 @@ func (e *Executor) executeCall(inst Instruction) error {
 func (e *Executor) executeMakeClosure(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [MAKE_CLOSURE] A=%d, B=%d, C=%d\n", inst.A, inst.B, inst.C)
+	e.tracef("MAKE_CLOSURE", "A=%d, B=%d, C=%d", inst.A, inst.B, inst.C)
 
 	// 获取函数对象
 	funcValue := frame.GetRegister(inst.B)
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 函数值类型: %s\n", funcValue.Type())
+	e.tracef("MAKE_CLOSURE", "函数值类型: %s", funcValue.Type())
 
 	if !funcValue.IsFunction() {
-		fmt.Printf("DEBUG [MAKE_CLOSURE] 错误: 寄存器[%d]不是函数\n", inst.B)
+		e.tracef("MAKE_CLOSURE", "错误: 寄存器[%d]不是函数", inst.B)
 		return fmt.Errorf("expected function in MAKE_CLOSURE")
 	}
 
 	// 获取Function对象
 	var targetFunc *Function
 	funcInterface := funcValue.AsFunction()
-	fmt.Printf("DEBUG [MAKE_CLOSURE] AsFunction返回: %p\n", funcInterface)
+	e.tracef("MAKE_CLOSURE", "AsFunction返回: %p", funcInterface)
 
 	if targetFunc = funcInterface.(*Function); targetFunc == nil {
-		fmt.Printf("DEBUG [MAKE_CLOSURE] 错误: 无法转换为Function类型\n")
+		e.tracef("MAKE_CLOSURE", "错误: 无法转换为Function类型")
 		return fmt.Errorf("invalid function in MAKE_CLOSURE")
 	}
 
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 目标函数: %s (地址: %p)\n", targetFunc.Name, targetFunc)
+	e.tracef("MAKE_CLOSURE", "目标函数: %s (地址: %p)", targetFunc.Name, targetFunc)
 
 	// 获取捕获变量数量
 	captureCount := inst.C
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 捕获变量数量: %d\n", captureCount)
+	e.tracef("MAKE_CLOSURE", "捕获变量数量: %d", captureCount)
 
 	// 获取捕获变量值
 	captures := make(map[string]ValueGC)
@@ -975,13 +1168,14 @@ func (e *Executor) executeMakeClosure(inst Instruction) error {
 		captureValue := frame.GetRegister(inst.B + 1 + i)
 		captureName := fmt.Sprintf("capture_%d", i) // 临时的变量名
 		captures[captureName] = captureValue
-		fmt.Printf("DEBUG [MAKE_CLOSURE] 捕获变量[%d] 名称: %s, 类型: %s\n", i, captureName, captureValue.Type())
+		e.tracef("MAKE_CLOSURE", "捕获变量[%d] 名称: %s, 类型: %s", i, captureName, captureValue.Type())
 	}
 
 	// 创建闭包ValueGC（堆分配，安全）
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 创建闭包，函数: %p\n", targetFunc)
+	e.tracef("MAKE_CLOSURE", "创建闭包，函数: %p", targetFunc)
 	closureValue := NewClosureValueGC(targetFunc, captures)
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 闭包创建成功，类型: %s\n", closureValue.Type())
+	e.pin(closureValue)
+	e.tracef("MAKE_CLOSURE", "闭包创建成功，类型: %s", closureValue.Type())
 
 	// GC优化：管理引用计数
 	if e.enableGCOpt && e.gcOptimizer != nil {
@@ -991,11 +1185,11 @@ func (e *Executor) executeMakeClosure(inst Instruction) error {
 
 	err := frame.SetRegister(inst.A, closureValue)
 	if err != nil {
-		fmt.Printf("DEBUG [MAKE_CLOSURE] 存储到寄存器失败: %v\n", err)
+		e.tracef("MAKE_CLOSURE", "存储到寄存器失败: %v", err)
 		return err
 	}
 
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 闭包存储到寄存器[%d]成功\n", inst.A)
+	e.tracef("MAKE_CLOSURE", "闭包存储到寄存器[%d]成功", inst.A)
 
 	frame.PC++
 	return nil
@@ -1005,8 +1199,8 @@ func (e *Executor) executeMakeClosure(inst Instruction) error {
 func (e *Executor) executeReturn(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [RETURN] A=%d, B=%d\n", inst.A, inst.B)
-	fmt.Printf("DEBUG [RETURN] 当前栈帧: %s (PC: %d)\n", frame.Function.Name, frame.PC)
+	e.tracef("RETURN", "A=%d, B=%d", inst.A, inst.B)
+	e.tracef("RETURN", "当前栈帧: %s (PC: %d)", frame.Function.Name, frame.PC)
 
 	// 获取返回值数量
 	// 根据Lua规范: RETURN A B 返回 R(A), ..., R(A+B-2)
@@ -1022,13 +1216,17 @@ func (e *Executor) executeReturn(inst Instruction) error {
 		retCount = inst.B
 	}
 
-	fmt.Printf("DEBUG [RETURN] 返回值数量: %d\n", retCount)
+	e.tracef("RETURN", "返回值数量: %d", retCount)
 
 	returnValues := make([]ValueGC, retCount)
 	for i := 0; i < retCount; i++ {
 		returnValues[i] = frame.GetRegister(inst.A + i)
 		// 只打印返回值类型，避免String()方法的递归问题
-		fmt.Printf("DEBUG [RETURN] 返回值[%d] 类型: %s\n", i, returnValues[i].Type())
+		e.tracef("RETURN", "返回值[%d] 类型: %s", i, returnValues[i].Type())
+	}
+
+	if e.tracing {
+		e.tracer.OnReturn(frame.Function.Name, returnValues, e.CallDepth)
 	}
 
 	// GC优化：管理栈帧销毁
@@ -1037,14 +1235,14 @@ func (e *Executor) executeReturn(inst Instruction) error {
 	}
 
 	// 关闭upvalue（栈帧销毁时）
-	fmt.Printf("DEBUG [RETURN] 关闭当前栈帧的upvalue...\n")
+	e.tracef("RETURN", "关闭当前栈帧的upvalue...")
 	frame.CloseUpvalues()
 
 	// 恢复调用者栈帧
 	caller := frame.Caller
 
 	if caller == nil {
-		fmt.Printf("DEBUG [RETURN] 主函数返回，程序结束\n")
+		e.tracef("RETURN", "主函数返回，程序结束")
 		// 主函数返回，设置返回值到寄存器0以便Execute方法获取
 		if len(returnValues) > 0 {
 			err := frame.SetRegister(0, returnValues[0])
@@ -1056,14 +1254,14 @@ func (e *Executor) executeReturn(inst Instruction) error {
 		return nil
 	}
 
-	fmt.Printf("DEBUG [RETURN] 恢复调用者栈帧: %s\n", caller.Function.Name)
+	e.tracef("RETURN", "恢复调用者栈帧: %s", caller.Function.Name)
 
 	// 设置返回值到调用者的寄存器
 	// CALL指令的A寄存器位置存储返回值
 	// 使用当前frame的ReturnAddr，而不是caller的ReturnAddr
 	if frame.ReturnAddr > 0 {
 		callInst := caller.Function.Instructions[frame.ReturnAddr-1]
-		fmt.Printf("DEBUG [RETURN] 设置返回值到调用者寄存器[%d]\n", callInst.A)
+		e.tracef("RETURN", "设置返回值到调用者寄存器[%d]", callInst.A)
 
 		for i, retVal := range returnValues {
 			if i < caller.ExpectedRets {
@@ -1073,13 +1271,13 @@ func (e *Executor) executeReturn(inst Instruction) error {
 					e.gcOptimizer.OnRegisterSet(oldValue, retVal)
 				}
 				caller.SetRegister(callInst.A+i, retVal)
-				fmt.Printf("DEBUG [RETURN] 设置返回值[%d]到寄存器[%d] (类型: %s)\n",
+				e.tracef("RETURN", "设置返回值[%d]到寄存器[%d] (类型: %s)",
 					i, callInst.A+i, retVal.Type())
 			}
 		}
 		// 恢复调用者上下文
 		caller.PC = frame.ReturnAddr
-		fmt.Printf("DEBUG [RETURN] 恢复调用者PC: %d\n", caller.PC)
+		e.tracef("RETURN", "恢复调用者PC: %d", caller.PC)
 	} else {
 		// 从主函数返回的情况
 		for i, retVal := range returnValues {
@@ -1097,7 +1295,7 @@ func (e *Executor) executeReturn(inst Instruction) error {
 	e.CurrentFrame = caller
 	e.CallDepth--
 
-	fmt.Printf("DEBUG [RETURN] 返回完成，调用深度: %d\n", e.CallDepth)
+	e.tracef("RETURN", "返回完成，调用深度: %d", e.CallDepth)
 
 	return nil
 }
@@ -1123,22 +1321,30 @@ func (e *Executor) updateVariableReferences(oldArray, newArray ValueGC) error {
 	}
 
 	oldObjPtr := uintptr(oldArray.data)
-	fmt.Printf("DEBUG [updateVariableReferences] 更新引用: 旧对象=%p -> 新对象=%p\n",
+	e.tracef("updateVariableReferences", "更新引用: 旧对象=%p -> 新对象=%p",
 		unsafe.Pointer(oldObjPtr), unsafe.Pointer(uintptr(newArray.data)))
 
 	// 更新全局变量
 	for i, globalVar := range e.Globals {
 		if globalVar.IsGCManaged() && uintptr(globalVar.data) == oldObjPtr {
-			fmt.Printf("DEBUG [updateVariableReferences] 更新全局变量[%d]\n", i)
+			e.tracef("updateVariableReferences", "更新全局变量[%d]", i)
 			e.Globals[i] = newArray
 		}
 	}
+	for _, module := range e.allModules() {
+		for i, globalVar := range module.Globals {
+			if globalVar.IsGCManaged() && uintptr(globalVar.data) == oldObjPtr {
+				e.tracef("updateVariableReferences", "更新模块 %s 全局变量[%d]", module.Path, i)
+				module.Globals[i] = newArray
+			}
+		}
+	}
 
 	// 更新当前栈帧的寄存器
 	if e.CurrentFrame != nil {
 		for i, regValue := range e.CurrentFrame.Registers {
 			if regValue.IsGCManaged() && uintptr(regValue.data) == oldObjPtr {
-				fmt.Printf("DEBUG [updateVariableReferences] 更新寄存器[%d]\n", i)
+				e.tracef("updateVariableReferences", "更新寄存器[%d]", i)
 				e.CurrentFrame.Registers[i] = newArray
 			}
 		}
@@ -1149,7 +1355,7 @@ func (e *Executor) updateVariableReferences(oldArray, newArray ValueGC) error {
 	for frame != nil {
 		for i, regValue := range frame.Registers {
 			if regValue.IsGCManaged() && uintptr(regValue.data) == oldObjPtr {
-				fmt.Printf("DEBUG [updateVariableReferences] 更新栈帧寄存器[%d]\n", i)
+				e.tracef("updateVariableReferences", "更新栈帧寄存器[%d]", i)
 				frame.Registers[i] = newArray
 			}
 		}
@@ -1224,7 +1430,7 @@ func (e *Executor) ExecuteArithmeticSequence(ops []OpCode, operands [][]int) err
 func (e *Executor) executeNewArray(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG executeNewArray: A=%d, B=%d (length=%d)\n", inst.A, inst.B, inst.B)
+	e.tracef("NEW_ARRAY", "A=%d, B=%d (length=%d)", inst.A, inst.B, inst.B)
 
 	length := inst.B
 	if length < 0 {
@@ -1245,14 +1451,14 @@ func (e *Executor) executeNewArray(inst Instruction) error {
 	}
 
 	arrayValue := NewArrayValueGC(elements)
-	fmt.Printf("DEBUG 创建的数组类型: %s\n", arrayValue.Type())
-	fmt.Printf("DEBUG 创建的数组IsArray(): %v\n", arrayValue.IsArray())
+	e.tracef("NEW_ARRAY", "创建的数组类型: %s", arrayValue.Type())
+	e.tracef("NEW_ARRAY", "创建的数组IsArray(): %v", arrayValue.IsArray())
 
 	if _, arrayElements, err := arrayValue.AsArrayData(); err == nil {
-		fmt.Printf("DEBUG 创建数组成功: Length=%d\n", len(arrayElements))
-		fmt.Printf("DEBUG Elements长度: %d\n", len(arrayElements))
+		e.tracef("NEW_ARRAY", "创建数组成功: Length=%d", len(arrayElements))
+		e.tracef("NEW_ARRAY", "Elements长度: %d", len(arrayElements))
 	} else {
-		fmt.Printf("DEBUG 创建数组失败: %v\n", err)
+		e.tracef("NEW_ARRAY", "创建数组失败: %v", err)
 	}
 
 	// GC优化：管理引用计数
@@ -1261,26 +1467,26 @@ func (e *Executor) executeNewArray(inst Instruction) error {
 		e.gcOptimizer.OnRegisterSet(oldValue, arrayValue)
 	}
 
-	fmt.Printf("DEBUG 设置到寄存器前，数组类型: %s\n", arrayValue.Type())
+	e.tracef("NEW_ARRAY", "设置到寄存器前，数组类型: %s", arrayValue.Type())
 
 	err := frame.SetRegister(inst.A, arrayValue)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("DEBUG 设置到寄存器后，开始验证...\n")
+	e.tracef("NEW_ARRAY", "设置到寄存器后，开始验证...")
 
 	// 验证设置后的寄存器
 	verifyValue := frame.GetRegister(inst.A)
-	fmt.Printf("DEBUG 验证值类型: %s\n", verifyValue.Type())
-	fmt.Printf("DEBUG 验证值IsArray(): %v\n", verifyValue.IsArray())
+	e.tracef("NEW_ARRAY", "验证值类型: %s", verifyValue.Type())
+	e.tracef("NEW_ARRAY", "验证值IsArray(): %v", verifyValue.IsArray())
 
 	if verifyValue.IsArray() {
 		if _, verifyElements, err := verifyValue.AsArrayData(); err == nil {
-			fmt.Printf("DEBUG 寄存器验证: Length=%d\n", len(verifyElements))
+			e.tracef("NEW_ARRAY", "寄存器验证: Length=%d", len(verifyElements))
 		}
 	} else {
-		fmt.Printf("DEBUG 寄存器验证失败: 不是数组类型\n")
+		e.tracef("NEW_ARRAY", "寄存器验证失败: 不是数组类型")
 	}
 
 	frame.PC++
@@ -1291,7 +1497,7 @@ func (e *Executor) executeNewArray(inst Instruction) error {
 func (e *Executor) executeNewArrayWithCapacity(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG executeNewArrayWithCapacity: A=%d, B=%d, C=%d\n", inst.A, inst.B, inst.C)
+	e.tracef("NEW_ARRAY_CAP", "A=%d, B=%d, C=%d", inst.A, inst.B, inst.C)
 
 	capacityValue := frame.GetRegister(inst.B)
 	if !capacityValue.IsNumber() {
@@ -1332,12 +1538,12 @@ func (e *Executor) executeNewArrayWithCapacity(inst Instruction) error {
 	}
 
 	arrayValue := NewArrayValueGC(elements)
-	fmt.Printf("DEBUG 创建的数组类型: %s, 容量: %d\n", arrayValue.Type(), capacity)
+	e.tracef("NEW_ARRAY_CAP", "创建的数组类型: %s, 容量: %d", arrayValue.Type(), capacity)
 
 	if arrData, _, err := arrayValue.AsArrayData(); err == nil {
-		fmt.Printf("DEBUG 创建数组成功: Length=%d, Capacity=%d\n", arrData.Length, arrData.Capacity)
+		e.tracef("NEW_ARRAY_CAP", "创建数组成功: Length=%d, Capacity=%d", arrData.Length, arrData.Capacity)
 	} else {
-		fmt.Printf("DEBUG 创建数组失败: %v\n", err)
+		e.tracef("NEW_ARRAY_CAP", "创建数组失败: %v", err)
 	}
 
 	// GC优化：管理引用计数
@@ -1346,26 +1552,26 @@ func (e *Executor) executeNewArrayWithCapacity(inst Instruction) error {
 		e.gcOptimizer.OnRegisterSet(oldValue, arrayValue)
 	}
 
-	fmt.Printf("DEBUG 设置到寄存器前，数组类型: %s\n", arrayValue.Type())
+	e.tracef("NEW_ARRAY_CAP", "设置到寄存器前，数组类型: %s", arrayValue.Type())
 
 	err = frame.SetRegister(inst.A, arrayValue)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("DEBUG 设置到寄存器后，开始验证...\n")
+	e.tracef("NEW_ARRAY_CAP", "设置到寄存器后，开始验证...")
 
 	// 验证设置后的寄存器
 	verifyValue := frame.GetRegister(inst.A)
-	fmt.Printf("DEBUG 验证值类型: %s\n", verifyValue.Type())
-	fmt.Printf("DEBUG 验证值IsArray(): %v\n", verifyValue.IsArray())
+	e.tracef("NEW_ARRAY_CAP", "验证值类型: %s", verifyValue.Type())
+	e.tracef("NEW_ARRAY_CAP", "验证值IsArray(): %v", verifyValue.IsArray())
 
 	if verifyValue.IsArray() {
 		if verifyArrData, _, err := verifyValue.AsArrayData(); err == nil {
-			fmt.Printf("DEBUG 寄存器验证: Length=%d, Capacity=%d\n", verifyArrData.Length, verifyArrData.Capacity)
+			e.tracef("NEW_ARRAY_CAP", "寄存器验证: Length=%d, Capacity=%d", verifyArrData.Length, verifyArrData.Capacity)
 		}
 	} else {
-		fmt.Printf("DEBUG 寄存器验证失败: 不是数组类型\n")
+		e.tracef("NEW_ARRAY_CAP", "寄存器验证失败: 不是数组类型")
 	}
 
 	frame.PC++
@@ -1376,14 +1582,12 @@ func (e *Executor) executeNewArrayWithCapacity(inst Instruction) error {
 func (e *Executor) executeArrayGet(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG executeArrayGet: A=%d, B=%d, C=%d\n", inst.A, inst.B, inst.C)
+	e.tracef("ARRAY_GET", "A=%d, B=%d, C=%d", inst.A, inst.B, inst.C)
 
 	arrayValue := frame.GetRegister(inst.B)
 	indexValue := frame.GetRegister(inst.C)
 
-	fmt.Printf("DEBUG 获取到的值类型:\n")
-	fmt.Printf("  arrayValue类型: %s\n", arrayValue.Type())
-	fmt.Printf("  indexValue类型: %s\n", indexValue.Type())
+	e.tracef("ARRAY_GET", "获取到的值类型: arrayValue=%s, indexValue=%s", arrayValue.Type(), indexValue.Type())
 
 	// 检查array类型
 	if !arrayValue.IsArray() {
@@ -1401,14 +1605,14 @@ func (e *Executor) executeArrayGet(inst Instruction) error {
 	}
 
 	index := int(indexNum)
-	fmt.Printf("DEBUG 即将调用ArrayGetValueGC: index=%d\n", index)
+	e.tracef("ARRAY_GET", "即将调用ArrayGetValueGC: index=%d", index)
 
 	element, err := ArrayGetValueGC(arrayValue, index)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("DEBUG ArrayGetValueGC 返回的元素类型: %s\n", element.Type())
+	e.tracef("ARRAY_GET", "ArrayGetValueGC 返回的元素类型: %s", element.Type())
 
 	// GC优化：管理引用计数
 	if e.enableGCOpt && e.gcOptimizer != nil {
@@ -1429,16 +1633,13 @@ func (e *Executor) executeArrayGet(inst Instruction) error {
 func (e *Executor) executeArraySet(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG executeArraySet: A=%d, B=%d, C=%d\n", inst.A, inst.B, inst.C)
+	e.tracef("ARRAY_SET", "A=%d, B=%d, C=%d", inst.A, inst.B, inst.C)
 
 	arrayValue := frame.GetRegister(inst.A)
 	indexValue := frame.GetRegister(inst.B)
 	value := frame.GetRegister(inst.C)
 
-	fmt.Printf("DEBUG 获取到的值类型:\n")
-	fmt.Printf("  arrayValue类型: %s\n", arrayValue.Type())
-	fmt.Printf("  indexValue类型: %s\n", indexValue.Type())
-	fmt.Printf("  value类型: %s\n", value.Type())
+	e.tracef("ARRAY_SET", "获取到的值类型: arrayValue=%s, indexValue=%s, value=%s", arrayValue.Type(), indexValue.Type(), value.Type())
 
 	// 检查array类型
 	if !arrayValue.IsArray() {
@@ -1456,7 +1657,7 @@ func (e *Executor) executeArraySet(inst Instruction) error {
 	}
 
 	index := int(indexNum)
-	fmt.Printf("DEBUG 即将调用ArraySetValueGCWithExpansion: index=%d\n", index)
+	e.tracef("ARRAY_SET", "即将调用ArraySetValueGCWithExpansion: index=%d", index)
 
 	// 使用新的支持扩容的设置方法
 	newArrayValue, err := ArraySetValueGCWithExpansion(arrayValue, index, value)
@@ -1466,7 +1667,7 @@ func (e *Executor) executeArraySet(inst Instruction) error {
 
 	// 检查是否发生了扩容（通过容量变化检测）
 	if newArrayValue.data != arrayValue.data {
-		fmt.Printf("DEBUG 数组扩容发生，更新寄存器引用\n")
+		e.tracef("ARRAY_SET", "数组扩容发生，更新寄存器引用")
 		// 更新寄存器中的数组引用
 		err = frame.SetRegister(inst.A, newArrayValue)
 		if err != nil {
@@ -1476,11 +1677,11 @@ func (e *Executor) executeArraySet(inst Instruction) error {
 		// 同时更新可能关联的变量存储位置
 		err = e.updateVariableReferences(arrayValue, newArrayValue)
 		if err != nil {
-			fmt.Printf("DEBUG 警告: 更新变量引用失败: %v\n", err)
+			e.tracef("ARRAY_SET", "警告: 更新变量引用失败: %v", err)
 		}
 	}
 
-	fmt.Printf("DEBUG executeArraySet完成\n")
+	e.tracef("ARRAY_SET", "executeArraySet完成")
 	frame.PC++
 	return nil
 }
@@ -1614,6 +1815,7 @@ func (e *Executor) executeGCCollect(inst Instruction) error {
 	if err != nil {
 		return err
 	}
+	e.CollectUnreachable()
 
 	frame.PC++
 	return nil
@@ -162,6 +162,13 @@ func (opt *GCOptimizer) shouldTriggerByObjectCount() bool {
 	return int(liveObjects) > opt.adaptiveThreshold
 }
 
+// traceGC 将GC触发事件通知执行器的跟踪器
+func (opt *GCOptimizer) traceGC(reason string, duration time.Duration, err error) {
+	if opt.executor != nil && opt.executor.tracing {
+		opt.executor.tracer.OnGC(reason, duration, err)
+	}
+}
+
 // triggerGC 触发GC
 func (opt *GCOptimizer) triggerGC(reason string) {
 	if opt.config.VerboseGCLogging {
@@ -180,11 +187,18 @@ func (opt *GCOptimizer) triggerGC(reason string) {
 		if opt.config.VerboseGCLogging {
 			fmt.Printf("GC触发失败: %v\n", err)
 		}
+		opt.traceGC(reason, time.Since(startTime), err)
 		return
 	}
 
+	// 回收不可达的协程和promise
+	if opt.executor != nil {
+		opt.executor.CollectUnreachable()
+	}
+
 	// 更新统计
 	duration := time.Since(startTime)
+	opt.traceGC(reason, duration, nil)
 	atomic.AddUint64(&opt.stats.AutoGCTriggers, 1)
 	atomic.AddUint64(&opt.stats.TotalGCTime, uint64(duration.Nanoseconds()))
 
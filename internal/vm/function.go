@@ -1,5 +1,7 @@
 package vm
 
+import "fmt"
+
 // OpCode VM指令操作码
 type OpCode uint8
 
@@ -70,11 +72,123 @@ const (
 	OP_WEAK_GET // 获取弱引用值: WEAK_GET A B : R(A) := WeakGet(R(B))
 
 	// AQL扩展指令（为将来准备）
-	OP_ASYNC_CALL // 异步函数调用
-	OP_AWAIT      // await操作
-	OP_YIELD      // 协程yield
+	OP_ASYNC_CALL // 保留：async函数通过普通CALL调用，返回promise
+	OP_AWAIT      // AWAIT A B : R(A) := await R(B)
+	OP_YIELD      // YIELD A B : 挂起当前协程并交出R(B)，恢复时 R(A) := 恢复值
+
+	// 对象操作指令
+	OP_NEW_OBJECT    // NEW_OBJECT A B : R(A) := {} (B为字段数量提示)
+	OP_GET_FIELD     // GET_FIELD A B C : R(A) := R(B)[K(C)]
+	OP_SET_FIELD     // SET_FIELD A B C : R(A)[K(B)] := R(C)
+	OP_GET_INDEX     // GET_INDEX A B C : R(A) := R(B)[R(C)] (数组下标或对象动态键)
+	OP_SET_INDEX     // SET_INDEX A B C : R(A)[R(B)] := R(C) (数组下标或对象动态键)
+	OP_SPREAD_OBJECT // SPREAD_OBJECT A B : 将R(B)的全部字段按顺序复制到R(A)
+
+	// 异常处理指令
+	OP_THROW // THROW A : 抛出R(A)
+	OP_CATCH // CATCH A : R(A) := 当前捕获的异常（异常处理入口的第一条指令）
+
+	// AI服务调用指令
+	OP_SERVICE_CALL // SERVICE_CALL A B C : R(A) := @K(C)(R(A+1), ..., R(A+B-1))，K(C)为"service.method"
+
+	// 模块指令
+	OP_IMPORT // IMPORT A B C : R(A) := 模块K(B)的导出K(C)，C为-1时为全部导出组成的对象
+
+	// 比较跳转指令（窥孔优化将比较和紧随的JUMP_IF_FALSE融合为一条）
+	OP_JUMP_IF_NOT_EQ  // JUMP_IF_NOT_EQ A B C Bx : R(A) := R(B) == R(C); if !R(A) then PC := PC + Bx
+	OP_JUMP_IF_NOT_NEQ // JUMP_IF_NOT_NEQ A B C Bx : R(A) := R(B) != R(C); if !R(A) then PC := PC + Bx
+	OP_JUMP_IF_NOT_LT  // JUMP_IF_NOT_LT A B C Bx : R(A) := R(B) < R(C); if !R(A) then PC := PC + Bx
+	OP_JUMP_IF_NOT_GT  // JUMP_IF_NOT_GT A B C Bx : R(A) := R(B) > R(C); if !R(A) then PC := PC + Bx
+	OP_JUMP_IF_NOT_LTE // JUMP_IF_NOT_LTE A B C Bx : R(A) := R(B) <= R(C); if !R(A) then PC := PC + Bx
+	OP_JUMP_IF_NOT_GTE // JUMP_IF_NOT_GTE A B C Bx : R(A) := R(B) >= R(C); if !R(A) then PC := PC + Bx
 )
 
+// CompareJumps 比较指令到对应比较跳转指令的映射
+var CompareJumps = map[OpCode]OpCode{
+	OP_EQ:  OP_JUMP_IF_NOT_EQ,
+	OP_NEQ: OP_JUMP_IF_NOT_NEQ,
+	OP_LT:  OP_JUMP_IF_NOT_LT,
+	OP_GT:  OP_JUMP_IF_NOT_GT,
+	OP_LTE: OP_JUMP_IF_NOT_LTE,
+	OP_GTE: OP_JUMP_IF_NOT_GTE,
+}
+
+// opCodeNames 操作码助记符
+var opCodeNames = map[OpCode]string{
+	OP_MOVE:                    "MOVE",
+	OP_LOADK:                   "LOADK",
+	OP_ADD:                     "ADD",
+	OP_SUB:                     "SUB",
+	OP_MUL:                     "MUL",
+	OP_DIV:                     "DIV",
+	OP_MOD:                     "MOD",
+	OP_CALL:                    "CALL",
+	OP_RETURN:                  "RETURN",
+	OP_HALT:                    "HALT",
+	OP_EQ:                      "EQ",
+	OP_NEQ:                     "NEQ",
+	OP_LT:                      "LT",
+	OP_GT:                      "GT",
+	OP_LTE:                     "LTE",
+	OP_GTE:                     "GTE",
+	OP_NOT:                     "NOT",
+	OP_NEG:                     "NEG",
+	OP_GET_GLOBAL:              "GET_GLOBAL",
+	OP_SET_GLOBAL:              "SET_GLOBAL",
+	OP_GET_LOCAL:               "GET_LOCAL",
+	OP_SET_LOCAL:               "SET_LOCAL",
+	OP_POP:                     "POP",
+	OP_JUMP:                    "JUMP",
+	OP_JUMP_IF_FALSE:           "JUMP_IF_FALSE",
+	OP_JUMP_IF_TRUE:            "JUMP_IF_TRUE",
+	OP_NEW_ARRAY:               "NEW_ARRAY",
+	OP_NEW_ARRAY_WITH_CAPACITY: "NEW_ARRAY_WITH_CAPACITY",
+	OP_ARRAY_GET:               "ARRAY_GET",
+	OP_ARRAY_SET:               "ARRAY_SET",
+	OP_ARRAY_LEN:               "ARRAY_LEN",
+	OP_GC_WRITE_BARRIER:        "GC_WRITE_BARRIER",
+	OP_GC_INC_REF:              "GC_INC_REF",
+	OP_GC_DEC_REF:              "GC_DEC_REF",
+	OP_GC_ALLOC:                "GC_ALLOC",
+	OP_GC_COLLECT:              "GC_COLLECT",
+	OP_GC_CHECK:                "GC_CHECK",
+	OP_GC_PIN:                  "GC_PIN",
+	OP_GC_UNPIN:                "GC_UNPIN",
+	OP_MAKE_CLOSURE:            "MAKE_CLOSURE",
+	OP_GET_UPVALUE:             "GET_UPVALUE",
+	OP_SET_UPVALUE:             "SET_UPVALUE",
+	OP_CLOSE_UPVALUE:           "CLOSE_UPVALUE",
+	OP_WEAK_REF:                "WEAK_REF",
+	OP_WEAK_GET:                "WEAK_GET",
+	OP_ASYNC_CALL:              "ASYNC_CALL",
+	OP_AWAIT:                   "AWAIT",
+	OP_YIELD:                   "YIELD",
+	OP_NEW_OBJECT:              "NEW_OBJECT",
+	OP_GET_FIELD:               "GET_FIELD",
+	OP_SET_FIELD:               "SET_FIELD",
+	OP_GET_INDEX:               "GET_INDEX",
+	OP_SET_INDEX:               "SET_INDEX",
+	OP_SPREAD_OBJECT:           "SPREAD_OBJECT",
+	OP_THROW:                   "THROW",
+	OP_CATCH:                   "CATCH",
+	OP_SERVICE_CALL:            "SERVICE_CALL",
+	OP_IMPORT:                  "IMPORT",
+	OP_JUMP_IF_NOT_EQ:          "JUMP_IF_NOT_EQ",
+	OP_JUMP_IF_NOT_NEQ:         "JUMP_IF_NOT_NEQ",
+	OP_JUMP_IF_NOT_LT:          "JUMP_IF_NOT_LT",
+	OP_JUMP_IF_NOT_GT:          "JUMP_IF_NOT_GT",
+	OP_JUMP_IF_NOT_LTE:         "JUMP_IF_NOT_LTE",
+	OP_JUMP_IF_NOT_GTE:         "JUMP_IF_NOT_GTE",
+}
+
+// String 返回操作码助记符
+func (op OpCode) String() string {
+	if name, ok := opCodeNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP_%d", uint8(op))
+}
+
 // Instruction VM指令表示
 type Instruction struct {
 	OpCode OpCode
@@ -96,12 +210,48 @@ type Function struct {
 	Instructions []Instruction // 指令序列
 	Constants    []ValueGC     // 常量表（使用GC安全的ValueGC）
 
+	// 异常处理表，按从内到外的顺序排列
+	Handlers []ExceptionHandler
+
+	// 闭包捕获变量的描述，与 MAKE_CLOSURE 的捕获顺序一一对应
+	Upvalues []UpvalueDesc
+
 	// 调试信息
-	Source      string // 源文件路径
-	LineNumbers []int  // 行号映射
+	Source      string   // 源文件路径
+	LineNumbers []int    // 行号映射（与Instructions一一对应，0表示未知）
+	Columns     []int    // 列号映射（与Instructions一一对应，0表示未知）
+	LocalNames  []string // 局部变量名（按寄存器索引，空字符串表示临时寄存器）
+	GlobalNames []string // 全局变量名（仅顶层函数，按全局变量索引）
+
+	// 异步与生成器支持
+	IsAsync     bool // 是否为异步函数
+	IsGenerator bool // 是否为生成器函数（调用时返回协程）
+
+	// 所属模块，nil表示主程序（全局变量使用 Executor.Globals）
+	Module *Module
+}
 
-	// 异步支持（为将来准备）
-	IsAsync bool // 是否为异步函数
+// ExceptionHandler 异常处理表项：在[StartPC, EndPC)内抛出的异常跳转到HandlerPC处理
+type ExceptionHandler struct {
+	StartPC   int // 受保护区间起点（包含）
+	EndPC     int // 受保护区间终点（不包含）
+	HandlerPC int // 异常处理入口，第一条指令为CATCH
+}
+
+// UpvalueKind 捕获变量在外层函数中的位置
+type UpvalueKind uint8
+
+const (
+	UpvalueLocal  UpvalueKind = iota // 外层函数的局部变量
+	UpvalueOuter                     // 外层函数自己的upvalue
+	UpvalueGlobal                    // 全局变量
+)
+
+// UpvalueDesc 闭包捕获变量的描述
+type UpvalueDesc struct {
+	Name  string      // 变量名
+	Kind  UpvalueKind // 变量在外层函数中的位置
+	Index int         // 外层函数中的局部变量、upvalue或全局变量索引
 }
 
 // NewFunction 创建新函数
@@ -114,10 +264,43 @@ func NewFunction(name string) *Function {
 		Instructions: make([]Instruction, 0),
 		Constants:    make([]ValueGC, 0),
 		LineNumbers:  make([]int, 0),
+		Columns:      make([]int, 0),
 		IsAsync:      false,
 	}
 }
 
+// minFrameRegisters 栈帧的最小寄存器数量
+const minFrameRegisters = 16
+
+// frameRegisters 返回函数栈帧的寄存器数量：最大栈大小，但不少于 minFrameRegisters
+func (f *Function) frameRegisters() int {
+	if f.MaxStackSize < minFrameRegisters {
+		return minFrameRegisters
+	}
+	return f.MaxStackSize
+}
+
+// FindHandler 查找覆盖指令位置pc的最内层异常处理表项
+func (f *Function) FindHandler(pc int) (ExceptionHandler, bool) {
+	for _, handler := range f.Handlers {
+		if pc >= handler.StartPC && pc < handler.EndPC {
+			return handler, true
+		}
+	}
+	return ExceptionHandler{}, false
+}
+
+// PositionAt 返回指令对应的源码行列号，无调试信息时返回0
+func (f *Function) PositionAt(pc int) (line, column int) {
+	if pc >= 0 && pc < len(f.LineNumbers) {
+		line = f.LineNumbers[pc]
+	}
+	if pc >= 0 && pc < len(f.Columns) {
+		column = f.Columns[pc]
+	}
+	return line, column
+}
+
 // AddInstruction 添加指令
 func (f *Function) AddInstruction(op OpCode, a, b, c int) {
 	f.Instructions = append(f.Instructions, Instruction{
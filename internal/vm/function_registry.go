@@ -36,6 +36,14 @@ func (fr *FunctionRegistry) RegisterFunction(function *Function) int {
 	return id
 }
 
+// UnregisterFunction 注销函数，之后该ID不再有效，ID不会被复用
+func (fr *FunctionRegistry) UnregisterFunction(id int) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	delete(fr.functions, id)
+}
+
 // GetFunction 根据ID获取函数
 func (fr *FunctionRegistry) GetFunction(id int) (*Function, error) {
 	fr.mu.RLock()
@@ -81,3 +89,11 @@ func GetFunction(id int) (*Function, error) {
 	}
 	return GlobalFunctionRegistry.GetFunction(id)
 }
+
+// 便利方法：全局注册表中的函数数量
+func FunctionCount() int {
+	if GlobalFunctionRegistry == nil {
+		return 0
+	}
+	return GlobalFunctionRegistry.GetFunctionCount()
+}
@@ -0,0 +1,339 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// =============================================================================
+// 运行时加载代码：load / loadString / eval
+// =============================================================================
+
+// 设计原理：
+// - vm 不依赖编译器，编译器包在初始化时通过 SetChunkCompiler 提供编译函数，
+//   内建函数在运行中的VM里完成 词法分析 → 语法分析 → 编译
+// - 加载得到的代码块是一个原生函数，调用时执行块的顶层代码；块拥有自己的全局变量
+//   （与 import 的模块相同），不会读写调用方的全局变量；eval 编译后直接执行，不创建原生函数
+// - 块的模块不加入执行器的模块表：代码块原生函数、块中的函数值和正在执行的栈帧引用模块，
+//   CollectUnreachable 发现块不可达时从函数注册表中注销块中的函数
+// - 提供env对象时块运行在受限环境中：只能看到env中的名字（内建函数也需要显式放入env），
+//   不能import模块或调用服务；每次执行结束后块的全局变量写回env
+// - 语法和编译错误以可捕获的 SyntaxError / CompileError 抛出，带有 line、column、chunk 字段
+
+// ChunkOptions 代码块的编译选项
+type ChunkOptions struct {
+	Name       string   // 块名，作为错误位置中的文件名
+	Globals    []string // 预定义的全局变量，依次占用全局变量索引 0..n-1
+	Restricted bool     // 不提供内建函数，只能引用Globals和块内定义的名字
+	ReturnLast bool     // 最后一条表达式语句的值作为块的返回值
+}
+
+// Chunk 编译后的代码块
+type Chunk struct {
+	Main    *Function // 块的顶层代码
+	Globals []string  // 全局变量名，按索引排列（编译器内部变量为空字符串）
+}
+
+// CompileError 代码块的语法或编译错误
+type CompileError struct {
+	Kind    string // SyntaxError 或 CompileError
+	Chunk   string // 块名
+	Line    int    // 出错行，0表示未知
+	Column  int    // 出错列
+	Message string
+}
+
+func (ce *CompileError) Error() string {
+	if ce.Line > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", ce.Chunk, ce.Line, ce.Column, ce.Message)
+	}
+	return fmt.Sprintf("%s: %s", ce.Chunk, ce.Message)
+}
+
+// value 转换为脚本可见的错误对象
+func (ce *CompileError) value() ValueGC {
+	errValue := NewErrorValueGC(ce.Kind, ce.Error())
+	ObjectSetValueGC(errValue, "chunk", NewStringValueGC(ce.Chunk))
+	ObjectSetValueGC(errValue, "line", NewSmallIntValueGC(int32(ce.Line)))
+	ObjectSetValueGC(errValue, "column", NewSmallIntValueGC(int32(ce.Column)))
+	return errValue
+}
+
+// ChunkCompiler 把源码编译为代码块，错误为 *CompileError
+type ChunkCompiler func(source string, options ChunkOptions) (*Chunk, error)
+
+var chunkCompiler ChunkCompiler
+
+// SetChunkCompiler 设置运行时加载代码使用的编译函数
+func SetChunkCompiler(compile ChunkCompiler) {
+	chunkCompiler = compile
+}
+
+// loadedChunk 执行器跟踪的代码块
+type loadedChunk struct {
+	functions []int // 块中函数在函数注册表中的ID
+	loader    int   // 代码块原生函数的下标，eval直接执行的块为-1
+}
+
+// unregister 从函数注册表中注销块中的函数
+func (c *loadedChunk) unregister() {
+	for _, id := range c.functions {
+		GlobalFunctionRegistry.UnregisterFunction(id)
+	}
+}
+
+// LoadChunk 编译源码并返回可调用的代码块
+// mode 为 "t"（文本）、"b"（字节码）或 "bt"；env 为nil值时块可以使用内建函数
+func (e *Executor) LoadChunk(source, name, mode string, env ValueGC, returnLast bool) (ValueGC, error) {
+	module, chunk, err := e.compileChunk(source, name, mode, env, returnLast)
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+
+	loader, err := e.NewNativeClosure("chunk:"+name, 0, func(e *Executor, args []ValueGC) (ValueGC, error) {
+		return e.runChunk(module, chunk, env)
+	}, func(mark func(ValueGC)) {
+		mark(env)
+		for _, global := range module.Globals {
+			mark(global)
+		}
+	})
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	e.trackChunk(module, int(loader.data))
+	return loader, nil
+}
+
+// compileChunk 编译源码并创建块的模块，env中的值依次成为块的全局变量
+func (e *Executor) compileChunk(source, name, mode string, env ValueGC, returnLast bool) (*Module, *Chunk, error) {
+	e.collectIfGrown()
+
+	var keys []string
+	var values []ValueGC
+	restricted := !env.IsNil()
+	if restricted {
+		if !env.IsObject() {
+			return nil, nil, fmt.Errorf("env must be an object, got %s", TypeName(env))
+		}
+		var err error
+		if keys, values, err = env.AsObjectEntries(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var chunk *Chunk
+	if strings.HasPrefix(source, BytecodeMagic) {
+		if !strings.Contains(mode, "b") {
+			return nil, nil, fmt.Errorf("attempt to load a binary chunk (mode is %q)", mode)
+		}
+		if restricted {
+			return nil, nil, fmt.Errorf("a binary chunk cannot run in an env")
+		}
+		main, err := ReadBytecode(bytes.NewReader([]byte(source)))
+		if err != nil {
+			return nil, nil, err
+		}
+		chunk = &Chunk{Main: main}
+	} else {
+		if !strings.Contains(mode, "t") {
+			return nil, nil, fmt.Errorf("attempt to load a text chunk (mode is %q)", mode)
+		}
+		if chunkCompiler == nil {
+			return nil, nil, fmt.Errorf("no compiler available")
+		}
+		var err error
+		chunk, err = chunkCompiler(source, ChunkOptions{
+			Name:       name,
+			Globals:    keys,
+			Restricted: restricted,
+			ReturnLast: returnLast,
+		})
+		if err != nil {
+			if ce, ok := err.(*CompileError); ok {
+				return nil, nil, &ThrowError{Value: ce.value()}
+			}
+			return nil, nil, err
+		}
+	}
+
+	module := NewModule(name, chunk.Main, nil)
+	module.Restricted = restricted
+	for _, value := range values {
+		// 块的全局变量可能比env中的值活得更久
+		module.Globals = append(module.Globals, CopyValueGC(value))
+	}
+	return module, chunk, nil
+}
+
+// trackChunk 开始跟踪块的可达性，loader为代码块原生函数的下标
+func (e *Executor) trackChunk(module *Module, loader int) {
+	if e.chunks == nil {
+		e.chunks = make(map[*Module]*loadedChunk)
+	}
+	e.chunks[module] = &loadedChunk{functions: functionIDs(module.Main, nil), loader: loader}
+}
+
+// runChunk 执行块的顶层代码，受限环境中执行结束后把块的全局变量写回env
+func (e *Executor) runChunk(module *Module, chunk *Chunk, env ValueGC) (ValueGC, error) {
+	result, err := e.runFrame(NewStackFrame(module.Main, nil, -1), nil)
+	if module.Restricted {
+		syncChunkGlobals(module, chunk.Globals, env)
+	}
+	return result, err
+}
+
+// functionIDs 追加function常量表中（递归）所有注册函数的ID
+func functionIDs(function *Function, ids []int) []int {
+	for _, constant := range function.Constants {
+		id := constant.AsFunctionID()
+		if id == 0 {
+			continue
+		}
+		ids = append(ids, id)
+		if nested, err := GetFunction(id); err == nil {
+			ids = functionIDs(nested, ids)
+		}
+	}
+	return ids
+}
+
+// syncChunkGlobals 把块的全局变量写回env
+func syncChunkGlobals(module *Module, names []string, env ValueGC) {
+	for i, name := range names {
+		if name == "" || i >= len(module.Globals) {
+			continue
+		}
+		ObjectSetValueGC(env, name, module.Globals[i])
+	}
+}
+
+// =============================================================================
+// 内建函数
+// =============================================================================
+
+func init() {
+	loadBuiltins := []struct {
+		name  string
+		arity int
+		fn    NativeFunc
+	}{
+		{"load", -1, builtinLoad},
+		{"loadString", -1, builtinLoadString},
+		{"eval", -1, builtinEval},
+	}
+
+	for _, b := range loadBuiltins {
+		if _, err := RegisterNative(b.name, b.arity, b.fn); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+// builtinLoad load(source, chunkName?, mode?, env?): 编译源码并返回代码块
+// source 可以是字符串，也可以是依次返回代码片段、以nil或空字符串结束的函数
+func builtinLoad(vm *Executor, args []ValueGC) (ValueGC, error) {
+	if err := checkLoadArgs(args, 1, 4); err != nil {
+		return NewNilValueGC(), err
+	}
+	source, err := readChunkSource(vm, args[0])
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	name, err := optionalString("chunkName", args, 1, "load")
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	mode, err := optionalString("mode", args, 2, "bt")
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	return vm.LoadChunk(source, name, mode, optionalArg(args, 3), false)
+}
+
+// builtinLoadString loadString(code, chunkName?, env?): 编译文本代码并返回代码块
+func builtinLoadString(vm *Executor, args []ValueGC) (ValueGC, error) {
+	if err := checkLoadArgs(args, 1, 3); err != nil {
+		return NewNilValueGC(), err
+	}
+	if !args[0].IsString() {
+		return NewNilValueGC(), fmt.Errorf("code must be a string, got %s", TypeName(args[0]))
+	}
+	name, err := optionalString("chunkName", args, 1, "string")
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	return vm.LoadChunk(args[0].AsString(), name, "t", optionalArg(args, 2), false)
+}
+
+// builtinEval eval(code, env?): 编译并立即执行代码，返回最后一条表达式语句的值
+func builtinEval(vm *Executor, args []ValueGC) (ValueGC, error) {
+	if err := checkLoadArgs(args, 1, 2); err != nil {
+		return NewNilValueGC(), err
+	}
+	if !args[0].IsString() {
+		return NewNilValueGC(), fmt.Errorf("code must be a string, got %s", TypeName(args[0]))
+	}
+	env := optionalArg(args, 1)
+	module, chunk, err := vm.compileChunk(args[0].AsString(), "eval", "t", env, true)
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	vm.trackChunk(module, -1)
+	return vm.runChunk(module, chunk, env)
+}
+
+// checkLoadArgs 检查参数数量在[min, max]之间
+func checkLoadArgs(args []ValueGC, min, max int) error {
+	if len(args) < min || len(args) > max {
+		return fmt.Errorf("expects %d to %d arguments, got %d", min, max, len(args))
+	}
+	return nil
+}
+
+// optionalArg 返回第i个参数，未提供时为nil
+func optionalArg(args []ValueGC, i int) ValueGC {
+	if i < len(args) {
+		return args[i]
+	}
+	return NewNilValueGC()
+}
+
+// optionalString 返回第i个字符串参数，未提供或为nil时返回def
+func optionalString(param string, args []ValueGC, i int, def string) (string, error) {
+	arg := optionalArg(args, i)
+	switch {
+	case arg.IsNil():
+		return def, nil
+	case arg.IsString():
+		return arg.AsString(), nil
+	default:
+		return "", fmt.Errorf("%s must be a string, got %s", param, TypeName(arg))
+	}
+}
+
+// readChunkSource 读取load的source参数：字符串原样返回，函数则反复调用并拼接返回的片段
+func readChunkSource(vm *Executor, source ValueGC) (string, error) {
+	if source.IsString() {
+		return source.AsString(), nil
+	}
+	if !source.IsFunction() && !source.IsCallable() && !source.IsClosure() && !source.IsNativeFunction() {
+		return "", fmt.Errorf("source must be a string or a reader function, got %s", TypeName(source))
+	}
+
+	var text strings.Builder
+	for {
+		piece, err := vm.Call(source, nil)
+		if err != nil {
+			return "", err
+		}
+		if piece.IsNil() || piece.IsString() && piece.AsString() == "" {
+			return text.String(), nil
+		}
+		if !piece.IsString() {
+			return "", fmt.Errorf("reader function must return a string, got %s", TypeName(piece))
+		}
+		text.WriteString(piece.AsString())
+	}
+}
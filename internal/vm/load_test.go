@@ -0,0 +1,141 @@
+package vm_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 运行时加载测试
+// =============================================================================
+
+func TestLoadAndEval(t *testing.T) {
+	executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	got := aqltest.Run(t, executor, out, `
+let answer = load("return 42 + 8", "answer", "t", null)
+print(answer())
+let make = loadString("function calc(x, y) { return x * y + 10 }; return calc", "math")
+print(make()(5, 3))
+let x = 1
+print(eval("let x = 99; x * 2"), x)
+
+let parts = ["return ", "1 + ", "2"]
+let i = 0
+function reader() {
+    if (i >= len(parts)) { return null }
+    i = i + 1
+    return parts[i - 1]
+}
+print(load(reader)())
+`)
+	if want := "50\n25\n198 1\n3\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	got := aqltest.Run(t, executor, out, `
+let env = {n: 5, show: print}
+let chunk = loadString("let doubled = n * 2
+show(n, doubled)
+n = n + 1", "sandbox", env)
+chunk()
+chunk()
+print(env.n, env.doubled)
+try { eval("len([1])", {}) } catch (e) { print(e.name, e.line, e.column, e.chunk) }
+`)
+	want := "5 10\n6 12\n7 12\nCompileError 1 1 eval\n"
+	if got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	got := aqltest.Run(t, executor, out, `
+try { loadString("let = 3", "bad") } catch (e) { print(e.name, e.chunk, e.line) }
+try { eval("@llm.chat(1)", {}) } catch (e) { print(e.message) }
+try { load("1", "bin", "b") } catch (e) { print(e.message) }
+try { eval("throw boom", {boom: {name: "Boom", message: "inside"}}) } catch (e) { print(e.name, e.message) }
+`)
+	for _, want := range []string{
+		"SyntaxError bad 1",
+		"service calls are not allowed in a restricted environment",
+		"attempt to load a text chunk",
+		"Boom inside",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should mention %q, got %q", want, got)
+		}
+	}
+
+	chunk, err := executor.LoadChunk(`import {a} from "./lib"`, "restricted", "t", vm.NewObjectValueGC(0), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.Call(chunk, nil); err == nil || !strings.Contains(err.Error(), "restricted environment") {
+		t.Errorf("import in a restricted chunk should fail, got %v", err)
+	}
+}
+
+func TestLoadReleasesChunks(t *testing.T) {
+	executor, out := newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	registerCollector(t, executor)
+	functions := vm.FunctionCount()
+	natives := vm.GlobalNativeRegistry.AnonymousCount()
+
+	got := aqltest.Run(t, executor, out, `
+let keep = eval("function f(x) { return x + 1 }; f")
+let chunk = loadString("let n = 0; function inc() { n = n + 1; return n }; return inc")
+let inc = chunk()
+for (let i = 0; i < 2000; i = i + 1) {
+    eval("function g() { return 1 }; g() + " + i)
+    loadString("function h() { return 2 }; return h")
+}
+@gc.collect()
+print(keep(1), inc(), inc())
+`)
+	if want := "2 1 2\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+	// 只有仍被引用的块保留：f、inc 和 chunk 本身
+	if live := vm.FunctionCount() - functions; live != 2 {
+		t.Errorf("only f and inc should stay registered, got %d functions", live)
+	}
+	if live := vm.GlobalNativeRegistry.AnonymousCount() - natives; live != 1 {
+		t.Errorf("only chunk should stay registered, got %d natives", live)
+	}
+}
+
+func TestCloseReleasesChunks(t *testing.T) {
+	functions := vm.FunctionCount()
+	natives := vm.GlobalNativeRegistry.AnonymousCount()
+
+	executor, out := aqltest.NewExecutor()
+	got := aqltest.Run(t, executor, out, `
+let f = eval("function f(x) { return x * 2 }; f")
+let g = loadString("function g() { return 1 }; return g")
+let wrapped = retry(f, 2)
+print(f(21), g()(), wrapped(1))
+`)
+	if want := "42 1 2\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+	if vm.FunctionCount() == functions || vm.GlobalNativeRegistry.AnonymousCount() == natives {
+		t.Fatal("the script should register chunk functions and natives")
+	}
+
+	// 仍被引用的块和闭包也随执行器一起释放
+	executor.Close()
+	if live := vm.FunctionCount() - functions; live != 0 {
+		t.Errorf("closing should unregister chunk functions, %d left", live)
+	}
+	if live := vm.GlobalNativeRegistry.AnonymousCount() - natives; live != 0 {
+		t.Errorf("closing should release natives, %d left", live)
+	}
+}
@@ -0,0 +1,225 @@
+package vm
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// =============================================================================
+// 模块：import / export
+// =============================================================================
+
+// 设计原理：
+// - 模块是单独编译的源文件，拥有自己的全局变量表；模块中的函数通过 Function.Module
+//   找到所属模块，GET_GLOBAL/SET_GLOBAL 访问该模块的全局变量，主程序仍使用 Executor.Globals
+// - 路径解析和编译由宿主提供的 ModuleLoader 完成（vm 不依赖编译器），加载器负责按路径缓存，
+//   同一路径只编译一次、得到同一个 Module
+// - 模块顶层代码在第一次被导入时执行一次，之后的导入直接读取导出；
+//   导入正在执行的模块即为循环导入，报告完整的导入链
+// - 导出在导入时按值读取：模块执行完成后导出的名字即绑定到当时的值
+
+// ModuleExport 模块导出项
+type ModuleExport struct {
+	Name  string // 导出名
+	Index int    // 对应的模块全局变量索引
+}
+
+// moduleState 模块的执行状态
+type moduleState int
+
+const (
+	moduleUnloaded moduleState = iota // 尚未执行
+	moduleLoading                     // 顶层代码正在执行
+	moduleLoaded                      // 已执行完成
+	moduleFailed                      // 顶层代码执行出错
+)
+
+// Module 已编译的模块及其全局变量
+// Module 保存执行状态，一个加载器缓存的模块只应在一个 Executor 中使用
+type Module struct {
+	Path    string         // 模块文件的绝对路径
+	Main    *Function      // 模块顶层代码
+	Exports []ModuleExport // 导出项，按声明顺序
+	Globals []ValueGC      // 模块的全局变量
+
+	// Restricted 为true时模块中的代码不能import或调用服务（运行时加载到受限环境中的代码块）
+	Restricted bool
+
+	state moduleState
+	err   error // 顶层代码的执行错误，再次导入时原样返回
+}
+
+// ModuleLoader 按导入路径查找并编译模块
+type ModuleLoader interface {
+	// Load 解析spec并返回对应的模块，from为导入方的源文件路径（可能为空）
+	// 同一文件必须返回同一个 *Module
+	Load(spec, from string) (*Module, error)
+}
+
+// NewModule 创建模块，并把main及其嵌套的所有函数关联到该模块
+func NewModule(path string, main *Function, exports []ModuleExport) *Module {
+	module := &Module{Path: path, Main: main, Exports: exports}
+	bindModule(main, module, make(map[*Function]bool))
+	return module
+}
+
+// bindModule 递归设置函数及其常量表中函数的所属模块
+func bindModule(function *Function, module *Module, visited map[*Function]bool) {
+	if function == nil || visited[function] {
+		return
+	}
+	visited[function] = true
+	function.Module = module
+	for _, constant := range function.Constants {
+		if !constant.IsFunction() {
+			continue
+		}
+		if nested, ok := constant.AsFunction().(*Function); ok {
+			bindModule(nested, module, visited)
+		}
+	}
+}
+
+// Export 返回导出项的当前值
+func (m *Module) Export(name string) (ValueGC, bool) {
+	for _, export := range m.Exports {
+		if export.Name == name {
+			return m.global(export.Index), true
+		}
+	}
+	return NewNilValueGC(), false
+}
+
+// Namespace 返回全部导出组成的对象
+func (m *Module) Namespace() ValueGC {
+	namespace := NewObjectValueGC(len(m.Exports))
+	for _, export := range m.Exports {
+		ObjectSetValueGC(namespace, export.Name, m.global(export.Index))
+	}
+	return namespace
+}
+
+// global 返回模块全局变量，未赋值时为nil
+func (m *Module) global(index int) ValueGC {
+	if index < 0 || index >= len(m.Globals) {
+		return NewNilValueGC()
+	}
+	return m.Globals[index]
+}
+
+// SetModuleLoader 设置 import 使用的模块加载器
+func (e *Executor) SetModuleLoader(loader ModuleLoader) {
+	e.moduleLoader = loader
+}
+
+// ModuleLoader 返回模块加载器，未设置时为nil
+func (e *Executor) ModuleLoader() ModuleLoader {
+	return e.moduleLoader
+}
+
+// Import 加载模块，第一次导入时执行模块的顶层代码
+// from为导入方的源文件路径，用于解析相对路径
+func (e *Executor) Import(spec, from string) (*Module, error) {
+	if e.moduleLoader == nil {
+		return nil, importError("cannot import %q: no module loader configured", spec)
+	}
+	module, err := e.moduleLoader.Load(spec, from)
+	if err != nil {
+		return nil, importError("%v", err)
+	}
+
+	switch module.state {
+	case moduleLoaded:
+		return module, nil
+	case moduleFailed:
+		return nil, module.err
+	case moduleLoading:
+		return nil, importError("import cycle: %s", e.importChain(module))
+	}
+
+	module.state = moduleLoading
+	e.modules = append(e.modules, module)
+	e.importing = append(e.importing, module)
+	_, err = e.runFrame(NewStackFrame(module.Main, nil, -1), nil)
+	e.importing = e.importing[:len(e.importing)-1]
+	if err != nil {
+		module.state, module.err = moduleFailed, err
+		return nil, err
+	}
+	module.state = moduleLoaded
+	return module, nil
+}
+
+// importChain 描述从module开始、回到module的导入链
+func (e *Executor) importChain(module *Module) string {
+	var names []string
+	for i := len(e.importing) - 1; i >= 0; i-- {
+		names = append([]string{filepath.Base(e.importing[i].Path)}, names...)
+		if e.importing[i] == module {
+			break
+		}
+	}
+	return strings.Join(append(names, filepath.Base(module.Path)), " -> ")
+}
+
+// importError 创建脚本可捕获的 ImportError
+func importError(format string, args ...interface{}) error {
+	return &ThrowError{Value: NewErrorValueGC("ImportError", fmt.Sprintf(format, args...))}
+}
+
+// allModules 返回导入的模块和运行时加载的代码块
+func (e *Executor) allModules() []*Module {
+	modules := append([]*Module(nil), e.modules...)
+	for module := range e.chunks {
+		modules = append(modules, module)
+	}
+	return modules
+}
+
+// globals 返回当前栈帧可见的全局变量表：模块函数使用模块的全局变量
+func (e *Executor) globals() *[]ValueGC {
+	if frame := e.CurrentFrame; frame != nil && frame.Function != nil && frame.Function.Module != nil {
+		return &frame.Function.Module.Globals
+	}
+	return &e.Globals
+}
+
+// executeImport IMPORT A B C : R(A) := 模块K(B)的导出K(C)，C为-1时为全部导出组成的对象
+func (e *Executor) executeImport(inst Instruction) error {
+	frame := e.CurrentFrame
+
+	constants := frame.Function.Constants
+	if inst.B < 0 || inst.B >= len(constants) {
+		return fmt.Errorf("module path constant index out of bounds: %d", inst.B)
+	}
+	if inst.C >= len(constants) {
+		return fmt.Errorf("export name constant index out of bounds: %d", inst.C)
+	}
+	spec := constants[inst.B].AsString()
+	if module := frame.Function.Module; module != nil && module.Restricted {
+		return importError("cannot import %q in a restricted environment", spec)
+	}
+
+	module, err := e.Import(spec, frame.Function.Source)
+	if err != nil {
+		return err
+	}
+
+	var value ValueGC
+	if inst.C < 0 {
+		value = module.Namespace()
+	} else {
+		name := constants[inst.C].AsString()
+		var ok bool
+		if value, ok = module.Export(name); !ok {
+			return importError("module %s has no export %s", spec, name)
+		}
+	}
+
+	if err := e.setRegisterWithGC(frame, inst.A, value); err != nil {
+		return err
+	}
+	frame.PC++
+	return nil
+}
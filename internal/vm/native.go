@@ -0,0 +1,255 @@
+package vm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// =============================================================================
+// 原生（Go）函数
+// =============================================================================
+
+// 设计原理：
+// - 原生函数保存在全局注册表中，ValueGC 只内联存储注册表下标，无需 GC 管理
+// - 宿主程序在编译脚本之前调用 RegisterNative 注册函数，编译器把已注册的名字定义为内建符号
+// - 同名函数重复注册时替换实现但保留下标，已编译的字节码仍然有效
+// - 运行时创建的原生闭包（如装饰器返回的包装函数）是匿名条目：不能按名字查找，
+//   也不会成为内建符号；匿名条目单独存放，下标从 anonymousNativeBase 开始且不复用
+// - 原生闭包属于创建它的执行器：捕获的Go状态中的脚本值由 Trace 交给 CollectUnreachable 标记，
+//   闭包本身不可达时从注册表中释放
+
+// ValueGCTypeNativeFunction 原生函数类型（内联存储注册表下标）
+const ValueGCTypeNativeFunction ValueTypeGC = ValueGCTypeStruct + 1
+
+// NativeFunc 原生函数签名
+type NativeFunc func(vm *Executor, args []ValueGC) (ValueGC, error)
+
+// NativeFunction 已注册的原生函数
+type NativeFunction struct {
+	Name  string     // 脚本中可见的名字
+	Arity int        // 参数数量，-1表示可变参数
+	Fn    NativeFunc // Go实现
+
+	Anonymous bool // 运行时创建的原生闭包，不对应内建符号
+
+	// Trace 把Fn捕获的Go状态中持有的脚本值交给mark，可以为nil
+	Trace func(mark func(ValueGC))
+}
+
+// anonymousNativeBase 匿名原生函数的起始下标，与具名函数的下标不重叠
+const anonymousNativeBase = 1 << 30
+
+// NativeRegistry 原生函数注册表
+type NativeRegistry struct {
+	mu        sync.RWMutex
+	functions []*NativeFunction
+	byName    map[string]int
+
+	anonymous     map[int]*NativeFunction // 运行时创建的原生闭包，按下标索引
+	nextAnonymous int                     // 下一个匿名下标相对 anonymousNativeBase 的偏移
+}
+
+// GlobalNativeRegistry 全局原生函数注册表（默认包含内建函数）
+var GlobalNativeRegistry = NewNativeRegistry()
+
+// NewNativeRegistry 创建空的原生函数注册表
+func NewNativeRegistry() *NativeRegistry {
+	return &NativeRegistry{
+		functions: make([]*NativeFunction, 0, 16),
+		byName:    make(map[string]int),
+		anonymous: make(map[int]*NativeFunction),
+	}
+}
+
+// Register 注册原生函数并返回下标
+func (nr *NativeRegistry) Register(name string, arity int, fn NativeFunc) (int, error) {
+	if name == "" {
+		return -1, fmt.Errorf("native function name is empty")
+	}
+	if fn == nil {
+		return -1, fmt.Errorf("native function %s has nil implementation", name)
+	}
+	if arity < -1 {
+		return -1, fmt.Errorf("invalid arity %d for native function %s", arity, name)
+	}
+
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+
+	native := &NativeFunction{Name: name, Arity: arity, Fn: fn}
+	if index, exists := nr.byName[name]; exists {
+		nr.functions[index] = native
+		return index, nil
+	}
+
+	index := len(nr.functions)
+	nr.functions = append(nr.functions, native)
+	nr.byName[name] = index
+	return index, nil
+}
+
+// RegisterAnonymous 注册匿名原生函数并返回下标，name只用于显示；trace见 NativeFunction.Trace
+func (nr *NativeRegistry) RegisterAnonymous(name string, arity int, fn NativeFunc, trace func(mark func(ValueGC))) (int, error) {
+	if fn == nil {
+		return -1, fmt.Errorf("native function %s has nil implementation", name)
+	}
+	if arity < -1 {
+		return -1, fmt.Errorf("invalid arity %d for native function %s", arity, name)
+	}
+
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+
+	index := anonymousNativeBase + nr.nextAnonymous
+	nr.nextAnonymous++
+	nr.anonymous[index] = &NativeFunction{Name: name, Arity: arity, Fn: fn, Anonymous: true, Trace: trace}
+	return index, nil
+}
+
+// Release 释放匿名原生函数，之后该下标不再有效；具名函数不能释放
+func (nr *NativeRegistry) Release(index int) {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+
+	delete(nr.anonymous, index)
+}
+
+// AnonymousCount 返回尚未释放的匿名原生函数数量
+func (nr *NativeRegistry) AnonymousCount() int {
+	nr.mu.RLock()
+	defer nr.mu.RUnlock()
+
+	return len(nr.anonymous)
+}
+
+// Get 根据下标获取原生函数
+func (nr *NativeRegistry) Get(index int) (*NativeFunction, error) {
+	nr.mu.RLock()
+	defer nr.mu.RUnlock()
+
+	if index >= anonymousNativeBase {
+		if native, exists := nr.anonymous[index]; exists {
+			return native, nil
+		}
+	} else if index >= 0 && index < len(nr.functions) {
+		return nr.functions[index], nil
+	}
+	return nil, fmt.Errorf("native function with index %d not found", index)
+}
+
+// Lookup 根据名字查找原生函数下标
+func (nr *NativeRegistry) Lookup(name string) (int, bool) {
+	nr.mu.RLock()
+	defer nr.mu.RUnlock()
+
+	index, exists := nr.byName[name]
+	return index, exists
+}
+
+// Functions 按下标顺序返回所有具名原生函数
+func (nr *NativeRegistry) Functions() []*NativeFunction {
+	nr.mu.RLock()
+	defer nr.mu.RUnlock()
+
+	result := make([]*NativeFunction, len(nr.functions))
+	copy(result, nr.functions)
+	return result
+}
+
+// 便利方法：向全局注册表注册原生函数
+func RegisterNative(name string, arity int, fn NativeFunc) (int, error) {
+	return GlobalNativeRegistry.Register(name, arity, fn)
+}
+
+// 便利方法：按下标顺序返回全局注册表中的具名原生函数
+func NativeFunctions() []*NativeFunction {
+	return GlobalNativeRegistry.Functions()
+}
+
+// =============================================================================
+// 原生函数值
+// =============================================================================
+
+// NewNativeFunctionValueGC 创建原生函数值
+func NewNativeFunctionValueGC(index int) ValueGC {
+	return ValueGC{
+		typeAndFlags: uint64(ValueGCTypeNativeFunction) | ValueGCFlagInline,
+		data:         uint64(index),
+	}
+}
+
+// NewNativeClosure 创建属于该执行器的原生函数值，fn可以捕获任意Go状态
+// fn捕获的脚本值需要由trace交给mark，否则 CollectUnreachable 不知道它们仍被引用；
+// 闭包本身不可达时由 CollectUnreachable 释放
+func (e *Executor) NewNativeClosure(name string, arity int, fn NativeFunc, trace func(mark func(ValueGC))) (ValueGC, error) {
+	e.collectIfGrown()
+
+	index, err := GlobalNativeRegistry.RegisterAnonymous(name, arity, fn, trace)
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+	if e.natives == nil {
+		e.natives = make(map[int]bool)
+	}
+	e.natives[index] = true
+	return NewNativeFunctionValueGC(index), nil
+}
+
+// IsNativeFunction 判断是否为原生函数
+func (v ValueGC) IsNativeFunction() bool { return v.Type() == ValueGCTypeNativeFunction }
+
+// AsNativeFunction 获取原生函数，无效时返回nil
+func (v ValueGC) AsNativeFunction() *NativeFunction {
+	if !v.IsNativeFunction() {
+		return nil
+	}
+	native, err := GlobalNativeRegistry.Get(int(v.data))
+	if err != nil {
+		return nil
+	}
+	return native
+}
+
+// =============================================================================
+// 原生函数调用
+// =============================================================================
+
+// callNative 执行对原生函数的CALL指令: R(A) := R(A)(R(A+1), ..., R(A+B-1))
+func (e *Executor) callNative(inst Instruction, funcValue ValueGC) error {
+	frame := e.CurrentFrame
+
+	native := funcValue.AsNativeFunction()
+	if native == nil {
+		return fmt.Errorf("invalid native function")
+	}
+
+	argCount := inst.B - 1
+	if native.Arity >= 0 && argCount != native.Arity {
+		return fmt.Errorf("%s() expects %d argument(s), got %d", native.Name, native.Arity, argCount)
+	}
+
+	args := make([]ValueGC, argCount)
+	for i := 0; i < argCount; i++ {
+		args[i] = frame.GetRegister(inst.A + 1 + i)
+	}
+
+	if e.tracing {
+		e.tracer.OnCall(native.Name, args, e.CallDepth+1)
+	}
+
+	result, err := native.Fn(e, args)
+	if err != nil {
+		return fmt.Errorf("%s(): %w", native.Name, err)
+	}
+
+	if e.tracing {
+		e.tracer.OnReturn(native.Name, []ValueGC{result}, e.CallDepth+1)
+	}
+
+	if err := e.setRegisterWithGC(frame, inst.A, result); err != nil {
+		return err
+	}
+
+	frame.PC++
+	return nil
+}
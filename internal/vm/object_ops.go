@@ -0,0 +1,171 @@
+package vm
+
+import "fmt"
+
+// setRegisterWithGC 设置寄存器并通知GC优化器
+func (e *Executor) setRegisterWithGC(frame *StackFrame, reg int, value ValueGC) error {
+	if e.enableGCOpt && e.gcOptimizer != nil {
+		oldValue := frame.GetRegister(reg)
+		e.gcOptimizer.OnRegisterSet(oldValue, value)
+	}
+	return frame.SetRegister(reg, value)
+}
+
+// fieldKeyConstant 读取常量表中的字段名
+func fieldKeyConstant(frame *StackFrame, index int) (string, error) {
+	if index < 0 || index >= len(frame.Function.Constants) {
+		return "", fmt.Errorf("field name constant index out of range: %d", index)
+	}
+	key := frame.Function.Constants[index]
+	if !key.IsString() {
+		return "", fmt.Errorf("field name constant must be a string, got %s", key.Type())
+	}
+	return key.AsString(), nil
+}
+
+// executeNewObject 执行NEW_OBJECT指令: R(A) := {}
+func (e *Executor) executeNewObject(inst Instruction) error {
+	frame := e.CurrentFrame
+
+	if inst.B < 0 {
+		return fmt.Errorf("invalid object capacity hint: %d", inst.B)
+	}
+
+	if err := e.setRegisterWithGC(frame, inst.A, NewObjectValueGC(inst.B)); err != nil {
+		return err
+	}
+
+	frame.PC++
+	return nil
+}
+
+// executeGetField 执行GET_FIELD指令: R(A) := R(B)[K(C)]
+func (e *Executor) executeGetField(inst Instruction) error {
+	frame := e.CurrentFrame
+
+	key, err := fieldKeyConstant(frame, inst.C)
+	if err != nil {
+		return err
+	}
+
+	objValue := frame.GetRegister(inst.B)
+	if !objValue.IsObject() {
+		return fmt.Errorf("cannot read property '%s' of %s", key, objValue.Type())
+	}
+
+	value, _, err := ObjectGetValueGC(objValue, key)
+	if err != nil {
+		return err
+	}
+
+	if err := e.setRegisterWithGC(frame, inst.A, value); err != nil {
+		return err
+	}
+
+	frame.PC++
+	return nil
+}
+
+// executeSetField 执行SET_FIELD指令: R(A)[K(B)] := R(C)
+func (e *Executor) executeSetField(inst Instruction) error {
+	frame := e.CurrentFrame
+
+	key, err := fieldKeyConstant(frame, inst.B)
+	if err != nil {
+		return err
+	}
+
+	objValue := frame.GetRegister(inst.A)
+	if !objValue.IsObject() {
+		return fmt.Errorf("cannot set property '%s' of %s", key, objValue.Type())
+	}
+
+	if err := ObjectSetValueGC(objValue, key, frame.GetRegister(inst.C)); err != nil {
+		return err
+	}
+
+	frame.PC++
+	return nil
+}
+
+// executeGetIndex 执行GET_INDEX指令: R(A) := R(B)[R(C)]
+// 对象按动态键取字段，其余情况按数组下标处理
+func (e *Executor) executeGetIndex(inst Instruction) error {
+	frame := e.CurrentFrame
+
+	objValue := frame.GetRegister(inst.B)
+	if !objValue.IsObject() {
+		return e.executeArrayGet(inst)
+	}
+
+	key, err := ObjectKeyFromValueGC(frame.GetRegister(inst.C))
+	if err != nil {
+		return err
+	}
+
+	value, _, err := ObjectGetValueGC(objValue, key)
+	if err != nil {
+		return err
+	}
+
+	if err := e.setRegisterWithGC(frame, inst.A, value); err != nil {
+		return err
+	}
+
+	frame.PC++
+	return nil
+}
+
+// executeSetIndex 执行SET_INDEX指令: R(A)[R(B)] := R(C)
+// 对象按动态键设置字段，其余情况按数组下标处理
+func (e *Executor) executeSetIndex(inst Instruction) error {
+	frame := e.CurrentFrame
+
+	objValue := frame.GetRegister(inst.A)
+	if !objValue.IsObject() {
+		return e.executeArraySet(inst)
+	}
+
+	key, err := ObjectKeyFromValueGC(frame.GetRegister(inst.B))
+	if err != nil {
+		return err
+	}
+
+	if err := ObjectSetValueGC(objValue, key, frame.GetRegister(inst.C)); err != nil {
+		return err
+	}
+
+	frame.PC++
+	return nil
+}
+
+// executeSpreadObject 执行SPREAD_OBJECT指令: 将R(B)的字段按插入顺序复制到R(A)
+// 展开nil不产生任何字段
+func (e *Executor) executeSpreadObject(inst Instruction) error {
+	frame := e.CurrentFrame
+
+	target := frame.GetRegister(inst.A)
+	if !target.IsObject() {
+		return fmt.Errorf("spread target must be an object, got %s", target.Type())
+	}
+
+	source := frame.GetRegister(inst.B)
+	switch {
+	case source.IsNil():
+	case source.IsObject():
+		keys, values, err := source.AsObjectEntries()
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			if err := ObjectSetValueGC(target, key, values[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot spread %s into object", source.Type())
+	}
+
+	frame.PC++
+	return nil
+}
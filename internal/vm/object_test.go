@@ -0,0 +1,165 @@
+package vm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 对象测试
+// =============================================================================
+
+func TestObjectLiterals(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name: "fields",
+			source: `let config = {timeout: 30, retries: 3, nested: {on: true}}
+print(config.timeout, config["retries"], config.nested.on, config.missing)`,
+			want: "30 3 true nil\n",
+		},
+		{
+			name: "assignment",
+			source: `let config = {timeout: 30, retries: 3}
+config.timeout = 60
+config["extra"] = "x"
+let k = "retries"
+config[k] = config[k] + 1
+print(config, len(config), type(config))`,
+			want: "{timeout: 60, retries: 4, extra: x} 3 object\n",
+		},
+		{
+			name:   "equality and truthiness",
+			source: `print({a: 1, b: 2} == {b: 2, a: 1}, {a: 1} == {a: 2}, {} == {}, {a: 1} != {a: 1}, !{})`,
+			want:   "true false true false false\n",
+		},
+		{
+			name: "function values",
+			source: `let o = {f: function(x) { return x * 2 }, v: 3, g: function() { return 1 }}
+let list = [1, function() { return 2 }, {n: 3}]
+print(o.f(o.v), o.g(), list[1](), list[2].n)`,
+			want: "6 1 2 3\n",
+		},
+		{
+			name: "ordered keys",
+			source: `let base = {a: 1, b: 2}
+let name = "aql"
+let k = "dyn"
+let o = {z: 0, name, [k]: 1, ["x" + 1]: 2, "quoted key": 3, 7: "seven", ...base, b: 20}
+print(o)
+print(o.dyn, o["quoted key"], o["7"], o.b, base.b)
+let s = {...{a: 1, b: 2}, a: 3}
+print(s, {a: 1, a: 2})`,
+			want: "{z: 0, name: aql, dyn: 1, x1: 2, quoted key: 3, 7: seven, a: 1, b: 20}\n" +
+				"1 3 seven 20 2\n{a: 3, b: 2} {a: 2}\n",
+		},
+		{
+			name: "property errors",
+			source: `let n = 1
+try { print(n.x) } catch (e) { print(e.message) }
+try { n.x = 1 } catch (e) { print(e.message) }`,
+			want: "cannot read property 'x' of smallint\ncannot set property 'x' of smallint\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor, out := aqltest.NewExecutor()
+			if got := aqltest.Run(t, executor, out, tt.source); got != tt.want {
+				t.Errorf("output should be %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestObjectStoresClosures(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	got := aqltest.Run(t, executor, out, `
+function mk() {
+    let n = 2
+    let o = {}
+    o.a = function() { return n }
+    o.a = function() { return n + 1 }
+    o.b = function() { return n * 10 }
+    return o
+}
+let o = mk()
+print(mk().a(), o.a(), o.b())
+o.b = 1
+print(o.b)
+`)
+	if want := "3 3 20\n1\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestObjectEqualityWithCycles(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	got := aqltest.Run(t, executor, out, `
+let a = {}
+a.s = a
+let b = {}
+b.s = b
+let c = {s: {}}
+print(a == b, a != b, a == c)
+let x = {n: 1}
+x.list = [x]
+let y = {n: 1}
+y.list = [y]
+let z = {n: 2}
+z.list = [z]
+print(x == y, x == z, [x] == [y])
+`)
+	if want := "true false false\ntrue false true\n"; got != want {
+		t.Errorf("output should be %q, got %q", want, got)
+	}
+}
+
+func TestObjectManyFields(t *testing.T) {
+	aqltest.InitRuntime()
+	obj := vm.NewObjectValueGC(0)
+	const n = 1000
+	for i := 0; i < n; i++ {
+		if err := vm.ObjectSetValueGC(obj, fmt.Sprintf("k%d", i), vm.NewNumberValueGC(float64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i += 2 {
+		vm.ObjectSetValueGC(obj, fmt.Sprintf("k%d", i), vm.NewNumberValueGC(float64(-i)))
+	}
+
+	for i := 0; i < n; i++ {
+		value, ok, err := vm.ObjectGetValueGC(obj, fmt.Sprintf("k%d", i))
+		want := float64(i)
+		if i%2 == 0 {
+			want = -want
+		}
+		if got, _ := value.ToNumber(); err != nil || !ok || got != want {
+			t.Fatalf("k%d should be %v, got %v (found %v, error %v)", i, want, value, ok, err)
+		}
+	}
+	if _, ok, _ := vm.ObjectGetValueGC(obj, "missing"); ok {
+		t.Error("missing key should not be found")
+	}
+
+	keys, _, err := obj.AsObjectEntries()
+	if err != nil || len(keys) != n || keys[0] != "k0" || keys[n-1] != fmt.Sprintf("k%d", n-1) {
+		t.Errorf("keys should keep insertion order, got %d keys (error %v)", len(keys), err)
+	}
+
+	// 插入顺序相反的对象仍然相等
+	reversed := vm.NewObjectValueGC(n)
+	for i := n - 1; i >= 0; i-- {
+		value, _, _ := vm.ObjectGetValueGC(obj, fmt.Sprintf("k%d", i))
+		vm.ObjectSetValueGC(reversed, fmt.Sprintf("k%d", i), value)
+	}
+	if !obj.Equal(reversed) {
+		t.Error("objects with the same fields should be equal")
+	}
+}
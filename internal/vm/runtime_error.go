@@ -0,0 +1,134 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// =============================================================================
+// 运行时错误
+// =============================================================================
+
+// 调用栈最多保留的帧数：靠近出错位置的帧和靠近主函数的帧（如栈溢出时）
+const (
+	stackTraceHeadFrames = 32
+	stackTraceTailFrames = 8
+)
+
+// StackTraceEntry AQL调用栈中的一帧
+type StackTraceEntry struct {
+	Function string // 函数名
+	File     string // 源文件（未知时为空）
+	Line     int    // 行号（未知时为0）
+	Column   int    // 列号（未知时为0）
+	PC       int    // 指令位置
+}
+
+// String 返回 "at 函数名 (文件:行:列)" 形式的描述
+func (entry StackTraceEntry) String() string {
+	return fmt.Sprintf("at %s (%s)", entry.Function, formatLocation(entry.File, entry.Line, entry.Column, entry.PC))
+}
+
+// RuntimeError Executor.Execute 返回的结构化运行时错误
+type RuntimeError struct {
+	Message    string            // 错误信息
+	File       string            // 出错位置的源文件
+	Line       int               // 出错位置的行号
+	Column     int               // 出错位置的列号
+	StackTrace []StackTraceEntry // 调用栈，第一项为出错的函数，最后一项为主函数
+	Omitted    int               // 调用栈过深时在中间省略的帧数
+	Value      ValueGC           // 未被捕获的异常值（内部错误转换为错误对象）
+	Cause      error             // 原始错误
+}
+
+// Error 返回 "文件:行:列: 运行时错误: 信息"，位置未知的部分省略
+func (re *RuntimeError) Error() string {
+	var out strings.Builder
+	if re.File != "" {
+		out.WriteString(re.File)
+		out.WriteString(":")
+	}
+	if re.Line > 0 {
+		fmt.Fprintf(&out, "%d:%d:", re.Line, re.Column)
+	}
+	if out.Len() > 0 {
+		out.WriteString(" ")
+	}
+	out.WriteString("运行时错误: ")
+	out.WriteString(re.Message)
+	return out.String()
+}
+
+// Unwrap 返回原始错误
+func (re *RuntimeError) Unwrap() error {
+	return re.Cause
+}
+
+// FormatStackTrace 返回多行调用栈描述，每行一帧
+func (re *RuntimeError) FormatStackTrace() string {
+	var out strings.Builder
+	for i, entry := range re.StackTrace {
+		if re.Omitted > 0 && i == stackTraceHeadFrames {
+			fmt.Fprintf(&out, "    ... (省略 %d 帧)\n", re.Omitted)
+		}
+		out.WriteString("    ")
+		out.WriteString(entry.String())
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// newRuntimeError 根据当前栈帧链构造运行时错误
+func newRuntimeError(frame *StackFrame, err error) *RuntimeError {
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr
+	}
+
+	re := &RuntimeError{
+		Message:    err.Error(),
+		Value:      exceptionValue(err),
+		Cause:      err,
+		StackTrace: buildStackTrace(frame),
+	}
+	if n := len(re.StackTrace); n > stackTraceHeadFrames+stackTraceTailFrames {
+		re.Omitted = n - stackTraceHeadFrames - stackTraceTailFrames
+		re.StackTrace = append(re.StackTrace[:stackTraceHeadFrames], re.StackTrace[n-stackTraceTailFrames:]...)
+	}
+	if len(re.StackTrace) > 0 {
+		top := re.StackTrace[0]
+		re.File, re.Line, re.Column = top.File, top.Line, top.Column
+	}
+	return re
+}
+
+// buildStackTrace 沿 StackFrame.Caller 链构造调用栈
+func buildStackTrace(frame *StackFrame) []StackTraceEntry {
+	var trace []StackTraceEntry
+	for f := frame; f != nil; f = f.Caller {
+		if f.Function == nil {
+			continue
+		}
+		line, column := f.Function.PositionAt(f.PC)
+		trace = append(trace, StackTraceEntry{
+			Function: f.Function.Name,
+			File:     f.Function.Source,
+			Line:     line,
+			Column:   column,
+			PC:       f.PC,
+		})
+	}
+	return trace
+}
+
+// formatLocation 格式化源码位置，没有行号时退化为指令位置
+func formatLocation(file string, line, column, pc int) string {
+	if file == "" {
+		file = "<unknown>"
+	}
+	if line <= 0 {
+		return fmt.Sprintf("%s:pc=%d", file, pc)
+	}
+	return fmt.Sprintf("%s:%d:%d", file, line, column)
+}
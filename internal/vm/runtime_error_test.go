@@ -0,0 +1,118 @@
+package vm_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/compiler1"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 运行时错误位置测试
+// =============================================================================
+
+// runError 以name为源文件名编译并运行脚本，返回结构化的运行时错误
+func runError(t *testing.T, name, source string) *vm.RuntimeError {
+	t.Helper()
+	aqltest.InitRuntime()
+	chunk, err := compiler1.CompileChunk(source, vm.ChunkOptions{Name: name})
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	executor, _ := aqltest.NewExecutor()
+	_, err = executor.Execute(chunk.Main, nil)
+	var runtimeErr *vm.RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("script should fail with a RuntimeError, got %v", err)
+	}
+	return runtimeErr
+}
+
+func TestRuntimeErrorPosition(t *testing.T) {
+	tests := []struct {
+		source  string
+		line    int
+		column  int
+		message string
+	}{
+		{"let a = [1]\nprint(a[3])\n", 2, 8, "array index out of bounds"},
+		{"let n = 5\nlet x = 1\n\n  n()\n", 4, 4, "attempted to call non-function value"},
+		{"let o = null\nprint(o.field)\n", 2, 8, "cannot read property 'field' of nil"},
+	}
+
+	for _, tt := range tests {
+		re := runError(t, "pos.aql", tt.source)
+		if re.File != "pos.aql" || re.Line != tt.line || re.Column != tt.column {
+			t.Errorf("%q should fail at pos.aql:%d:%d, got %s:%d:%d", tt.source, tt.line, tt.column, re.File, re.Line, re.Column)
+		}
+		if !strings.Contains(re.Message, tt.message) {
+			t.Errorf("%q should fail with %q, got %q", tt.source, tt.message, re.Message)
+		}
+		if want := fmt.Sprintf("pos.aql:%d:%d: 运行时错误: ", tt.line, tt.column); !strings.HasPrefix(re.Error(), want) {
+			t.Errorf("error should start with %q, got %q", want, re.Error())
+		}
+	}
+}
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	re := runError(t, "trace.aql", `function inner(a) {
+    return a[9]
+}
+function outer(a) {
+    let b = a
+    return inner(b)
+}
+outer([1, 2])
+`)
+
+	want := "    at inner (trace.aql:2:13)\n" +
+		"    at outer (trace.aql:6:17)\n" +
+		"    at trace.aql (trace.aql:8:6)\n"
+	if got := re.FormatStackTrace(); got != want {
+		t.Errorf("stack trace should be:\n%s\ngot:\n%s", want, got)
+	}
+	if re.Omitted != 0 {
+		t.Errorf("no frames should be omitted, got %d", re.Omitted)
+	}
+}
+
+func TestRuntimeErrorOmitsDeepFrames(t *testing.T) {
+	re := runError(t, "deep.aql", `function down(n) {
+    if (n == 0) { return [][1] }
+    return down(n - 1)
+}
+down(99)
+`)
+
+	// 100层down加上顶层函数，只保留最里面32帧和最外面8帧
+	if re.Omitted != 101-40 || len(re.StackTrace) != 40 {
+		t.Errorf("61 frames should be omitted leaving 40, got %d omitted and %d kept", re.Omitted, len(re.StackTrace))
+	}
+	// 块的顶层函数以块名命名
+	if last := re.StackTrace[len(re.StackTrace)-1]; last.Function != "deep.aql" || last.Line != 5 {
+		t.Errorf("the last frame should be the chunk at line 5, got %s", last)
+	}
+	if !strings.Contains(re.FormatStackTrace(), "    ... (省略 61 帧)\n") {
+		t.Errorf("omitted frames should be reported, got:\n%s", re.FormatStackTrace())
+	}
+}
+
+func TestLineNumbersCoverInstructions(t *testing.T) {
+	function := aqltest.Compile(t, "let a = 1\nlet b = a + 2\nprint(b)\n")
+	if len(function.LineNumbers) != len(function.Instructions) || len(function.Columns) != len(function.Instructions) {
+		t.Fatalf("positions should map every instruction: %d instructions, %d lines, %d columns",
+			len(function.Instructions), len(function.LineNumbers), len(function.Columns))
+	}
+	for pc := range function.Instructions {
+		if line, _ := function.PositionAt(pc); line < 1 || line > 3 {
+			t.Errorf("instruction %d (%s) should map to lines 1-3, got %d", pc, function.Instructions[pc].OpCode, line)
+		}
+	}
+	if line, column := function.PositionAt(len(function.Instructions)); line != 0 || column != 0 {
+		t.Errorf("positions past the end should be unknown, got %d:%d", line, column)
+	}
+}
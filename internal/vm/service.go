@@ -0,0 +1,564 @@
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// =============================================================================
+// AI服务调用
+// =============================================================================
+
+// 设计原理：
+// - @service.method(args) 编译为 SERVICE_CALL 指令，服务名和方法名以 "service.method" 常量的形式保存
+// - 服务提供者（ServiceProvider）是宿主注册在执行器上的Go对象，按名字在运行时查找，
+//   因此同一份字节码可以在不同环境中接入真实服务或测试用的mock服务
+// - 参数和返回值在AQL值与普通Go值（nil、bool、int64、float64、string、[]interface{}、
+//   map[string]interface{}）之间转换，提供者不需要了解ValueGC
+// - 异步任务之外服务调用是同步的：提供者返回之前脚本不会继续执行；失败时抛出可捕获的 ServiceError
+// - 异步任务中的服务调用通过事件循环的 Go 在后台goroutine中执行，任务挂起直到结果返回，
+//   其间事件循环继续运行其他任务，多个任务的服务调用因此可以并发进行
+// - 提供者返回 ServiceStream 时调用结果是一个协程，脚本用 next/status 逐项读取，
+//   每次 next 只阻塞到下一项到达，适合逐token处理的流式回复
+
+// ServiceProvider AI服务提供者
+type ServiceProvider interface {
+	// Call 调用服务方法，args 和返回值均为普通Go值
+	// 方法不存在时返回包装了 ErrUnknownMethod 的错误
+	// 异步任务中的调用在后台goroutine中进行，同一提供者可能被并发调用
+	Call(ctx context.Context, method string, args []interface{}) (interface{}, error)
+}
+
+// ServiceFunc 用函数实现的服务提供者
+type ServiceFunc func(ctx context.Context, method string, args []interface{}) (interface{}, error)
+
+// Call 实现 ServiceProvider
+func (f ServiceFunc) Call(ctx context.Context, method string, args []interface{}) (interface{}, error) {
+	return f(ctx, method, args)
+}
+
+// ServiceStream 流式服务结果，ServiceProvider.Call 返回它时脚本得到一个协程
+type ServiceStream interface {
+	// Next 返回下一项（普通Go值），读完时返回 io.EOF
+	Next() (interface{}, error)
+	// Close 释放底层连接，读完、出错或协程被回收时调用
+	Close() error
+}
+
+// ErrUnknownMethod 服务不支持所调用的方法
+var ErrUnknownMethod = errors.New("unknown method")
+
+// ServiceError 服务调用失败，脚本中捕获为 {name, message, service, method, ...Details}
+type ServiceError struct {
+	Name    string                 // 错误名称，默认为 ServiceError
+	Service string                 // 服务名
+	Method  string                 // 方法名
+	Message string                 // 错误描述
+	Details map[string]interface{} // 附加字段（如HTTP状态码），会合并进错误对象
+	Err     error                  // 原始错误
+}
+
+// Error 返回 "@service.method: message"
+func (se *ServiceError) Error() string {
+	if se.Service == "" {
+		return se.Message
+	}
+	return fmt.Sprintf("@%s.%s: %s", se.Service, se.Method, se.Message)
+}
+
+// Unwrap 返回原始错误
+func (se *ServiceError) Unwrap() error { return se.Err }
+
+// Value 返回脚本可见的错误对象
+func (se *ServiceError) Value() ValueGC {
+	name := se.Name
+	if name == "" {
+		name = "ServiceError"
+	}
+	errValue := NewErrorValueGC(name, se.Error())
+	ObjectSetValueGC(errValue, "service", NewStringValueGC(se.Service))
+	ObjectSetValueGC(errValue, "method", NewStringValueGC(se.Method))
+
+	keys := make([]string, 0, len(se.Details))
+	for key := range se.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, err := FromGoValue(se.Details[key]); err == nil {
+			ObjectSetValueGC(errValue, key, value)
+		}
+	}
+	return errValue
+}
+
+// RegisterService 在执行器上注册服务提供者，同名服务会被替换
+func (e *Executor) RegisterService(name string, provider ServiceProvider) error {
+	if name == "" {
+		return fmt.Errorf("service name is empty")
+	}
+	if provider == nil {
+		return fmt.Errorf("service %s has nil provider", name)
+	}
+	if e.services == nil {
+		e.services = make(map[string]ServiceProvider)
+	}
+	e.services[name] = provider
+	return nil
+}
+
+// Service 返回已注册的服务提供者
+func (e *Executor) Service(name string) (ServiceProvider, bool) {
+	provider, ok := e.services[name]
+	return provider, ok
+}
+
+// Services 返回已注册的服务名（按字母顺序）
+func (e *Executor) Services() []string {
+	names := make([]string, 0, len(e.services))
+	for name := range e.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetContext 设置服务调用使用的context，nil表示context.Background()
+func (e *Executor) SetContext(ctx context.Context) {
+	e.ctx = ctx
+}
+
+// Context 返回服务调用使用的context
+func (e *Executor) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+// splitServiceName 把 "service.method" 拆分为服务名和方法名
+func splitServiceName(name string) (string, string, error) {
+	service, method, ok := strings.Cut(name, ".")
+	if !ok || service == "" || method == "" {
+		return "", "", fmt.Errorf("invalid service call target %q", name)
+	}
+	return service, method, nil
+}
+
+// executeServiceCall SERVICE_CALL A B C : R(A) := @K(C)(R(A+1), ..., R(A+B-1))
+func (e *Executor) executeServiceCall(inst Instruction) error {
+	frame := e.CurrentFrame
+
+	if inst.C < 0 || inst.C >= len(frame.Function.Constants) {
+		return fmt.Errorf("service name constant index out of bounds: %d", inst.C)
+	}
+	service, method, err := splitServiceName(frame.Function.Constants[inst.C].AsString())
+	if err != nil {
+		return err
+	}
+	if module := frame.Function.Module; module != nil && module.Restricted {
+		return &ServiceError{Service: service, Method: method, Message: "service calls are not allowed in a restricted environment"}
+	}
+
+	argCount := inst.B - 1
+	values := make([]ValueGC, argCount)
+	for i := 0; i < argCount; i++ {
+		values[i] = frame.GetRegister(inst.A + 1 + i)
+	}
+
+	// 异步任务中挂起任务，结果返回后从下一条指令继续
+	if co := e.currentCoroutine(); co != nil && co.promise != nil {
+		return e.callServiceAsync(co, service, method, values)
+	}
+
+	result, err := e.CallService(service, method, values)
+	if err != nil {
+		return err
+	}
+
+	if err := e.setRegisterWithGC(frame, inst.A, result); err != nil {
+		return err
+	}
+	frame.PC++
+	return nil
+}
+
+// CallService 调用已注册的服务方法，失败时返回 *ServiceError
+func (e *Executor) CallService(service, method string, values []ValueGC) (ValueGC, error) {
+	provider, args, err := e.serviceArgs(service, method, values)
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+
+	name := "@" + service + "." + method
+	if e.tracing {
+		e.tracer.OnCall(name, values, e.CallDepth+1)
+	}
+
+	output, err := provider.Call(e.Context(), method, args)
+	result, err := e.serviceResult(service, method, output, err)
+	if err != nil {
+		return NewNilValueGC(), err
+	}
+
+	if e.tracing {
+		e.tracer.OnReturn(name, []ValueGC{result}, e.CallDepth+1)
+	}
+	return result, nil
+}
+
+// callServiceAsync 在后台goroutine中调用服务并挂起异步任务co，
+// 调用完成后以结果恢复任务，失败时在调用处抛出 ServiceError
+func (e *Executor) callServiceAsync(co *Coroutine, service, method string, values []ValueGC) error {
+	provider, args, err := e.serviceArgs(service, method, values)
+	if err != nil {
+		return err
+	}
+
+	name := "@" + service + "." + method
+	depth := e.CallDepth + 1
+	if e.tracing {
+		e.tracer.OnCall(name, values, depth)
+	}
+
+	p := e.NewPromise()
+	ctx := e.Context()
+	e.Loop().Go(func() func() {
+		output, err := provider.Call(ctx, method, args)
+		return func() {
+			result, err := e.serviceResult(service, method, output, err)
+			if err != nil {
+				p.failure = err
+				p.Reject(exceptionValue(err))
+				return
+			}
+			if e.tracing {
+				e.tracer.OnReturn(name, []ValueGC{result}, depth)
+			}
+			p.Resolve(result)
+		}
+	})
+
+	p.then(func(p *Promise) {
+		e.stepTask(co, p.Result, p.State == PromiseRejected)
+	})
+	e.suspend(co)
+	return nil
+}
+
+// serviceArgs 查找服务提供者并把参数转换为Go值
+func (e *Executor) serviceArgs(service, method string, values []ValueGC) (ServiceProvider, []interface{}, error) {
+	provider, ok := e.services[service]
+	if !ok {
+		return nil, nil, &ServiceError{
+			Service: service,
+			Method:  method,
+			Message: fmt.Sprintf("unknown service @%s", service),
+		}
+	}
+
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		arg, err := ToGoValue(value)
+		if err != nil {
+			return nil, nil, &ServiceError{
+				Name:    "TypeError",
+				Service: service,
+				Method:  method,
+				Message: fmt.Sprintf("argument %d: %v", i+1, err),
+				Err:     err,
+			}
+		}
+		args[i] = arg
+	}
+	return provider, args, nil
+}
+
+// serviceResult 把提供者的返回值转换为AQL值，流式结果转换为协程
+func (e *Executor) serviceResult(service, method string, output interface{}, err error) (ValueGC, error) {
+	if err != nil {
+		return NewNilValueGC(), wrapServiceError(service, method, err)
+	}
+
+	if stream, ok := output.(ServiceStream); ok {
+		return e.newStreamCoroutine(service, method, stream), nil
+	}
+	result, err := FromGoValue(output)
+	if err != nil {
+		return NewNilValueGC(), &ServiceError{
+			Name:    "TypeError",
+			Service: service,
+			Method:  method,
+			Message: fmt.Sprintf("result: %v", err),
+			Err:     err,
+		}
+	}
+	return result, nil
+}
+
+// streamSource 流式服务调用的数据源
+type streamSource struct {
+	service string
+	method  string
+	stream  ServiceStream
+	closed  bool
+}
+
+// next 读取下一项，done为true表示流已结束
+func (s *streamSource) next() (ValueGC, bool, error) {
+	item, err := s.stream.Next()
+	if err == io.EOF {
+		return NewNilValueGC(), true, nil
+	}
+	if err != nil {
+		return NewNilValueGC(), true, wrapServiceError(s.service, s.method, err)
+	}
+
+	value, err := FromGoValue(item)
+	if err != nil {
+		return NewNilValueGC(), true, &ServiceError{
+			Name:    "TypeError",
+			Service: s.service,
+			Method:  s.method,
+			Message: fmt.Sprintf("stream item: %v", err),
+			Err:     err,
+		}
+	}
+	return value, false, nil
+}
+
+// close 关闭数据源，可以重复调用
+func (s *streamSource) close() {
+	if !s.closed {
+		s.closed = true
+		s.stream.Close()
+	}
+}
+
+// newStreamCoroutine 创建读取服务流的协程
+func (e *Executor) newStreamCoroutine(service, method string, stream ServiceStream) ValueGC {
+	e.nextCoroutineID++
+	co := &Coroutine{
+		ID:     e.nextCoroutineID,
+		Name:   "@" + service + "." + method,
+		Status: CoroutineSuspended,
+		value:  NewNilValueGC(),
+		source: &streamSource{service: service, method: method, stream: stream},
+	}
+	if e.coroutines == nil {
+		e.coroutines = make(map[int]*Coroutine)
+	}
+	e.coroutines[co.ID] = co
+	e.tracef("COROUTINE", "创建流式协程 #%d (%s)", co.ID, co.Name)
+	return NewCoroutineValueGC(co.ID)
+}
+
+// resumeStream 恢复流式协程：读取下一项，流结束或出错时协程结束
+func (e *Executor) resumeStream(co *Coroutine) (ValueGC, error) {
+	co.Status = CoroutineRunning
+	value, done, err := co.source.next()
+	if done {
+		co.Status = CoroutineDead
+		co.source.close()
+	} else {
+		co.Status = CoroutineSuspended
+	}
+	co.value = value
+	return value, err
+}
+
+// wrapServiceError 把提供者返回的错误包装为 *ServiceError，补齐服务名和方法名
+func wrapServiceError(service, method string, err error) error {
+	var serviceErr *ServiceError
+	if errors.As(err, &serviceErr) {
+		wrapped := *serviceErr
+		if wrapped.Service == "" {
+			wrapped.Service = service
+			wrapped.Method = method
+		}
+		return &wrapped
+	}
+
+	var throwErr *ThrowError
+	if errors.As(err, &throwErr) {
+		return err
+	}
+
+	if errors.Is(err, ErrUnknownMethod) {
+		return &ServiceError{
+			Service: service,
+			Method:  method,
+			Message: fmt.Sprintf("service @%s has no method %s", service, method),
+			Err:     err,
+		}
+	}
+	return &ServiceError{Service: service, Method: method, Message: err.Error(), Err: err}
+}
+
+// =============================================================================
+// AQL值与Go值的转换
+// =============================================================================
+
+// maxConvertDepth 转换时允许的最大嵌套深度，防止循环引用导致无限递归
+const maxConvertDepth = 64
+
+// ToGoValue 把AQL值转换为普通Go值
+// 数组转换为 []interface{}，对象转换为 map[string]interface{}，函数等值无法转换
+func ToGoValue(v ValueGC) (interface{}, error) {
+	return toGoValue(v, 0)
+}
+
+func toGoValue(v ValueGC, depth int) (interface{}, error) {
+	if depth > maxConvertDepth {
+		return nil, fmt.Errorf("value nested too deeply (possible cycle)")
+	}
+
+	switch v.Type() {
+	case ValueGCTypeNil:
+		return nil, nil
+	case ValueGCTypeBool:
+		return v.AsBool(), nil
+	case ValueGCTypeSmallInt:
+		return int64(v.AsSmallInt()), nil
+	case ValueGCTypeDouble:
+		return v.AsDouble(), nil
+	case ValueGCTypeString:
+		return v.AsString(), nil
+	case ValueGCTypeArray:
+		_, elements, err := v.AsArrayData()
+		if err != nil {
+			return nil, err
+		}
+		result := make([]interface{}, len(elements))
+		for i, element := range elements {
+			item, err := toGoValue(element, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = item
+		}
+		return result, nil
+	case ValueGCTypeObject:
+		keys, values, err := v.AsObjectEntries()
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]interface{}, len(keys))
+		for i, key := range keys {
+			item, err := toGoValue(values[i], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = item
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", TypeName(v))
+	}
+}
+
+// FromGoValue 把普通Go值转换为AQL值
+// map的键按字母顺序写入对象，保证结果确定
+func FromGoValue(x interface{}) (ValueGC, error) {
+	return fromGoValue(x, 0)
+}
+
+func fromGoValue(x interface{}, depth int) (ValueGC, error) {
+	if depth > maxConvertDepth {
+		return NewNilValueGC(), fmt.Errorf("value nested too deeply")
+	}
+
+	switch x := x.(type) {
+	case nil:
+		return NewNilValueGC(), nil
+	case ValueGC:
+		return x, nil
+	case bool:
+		return NewBoolValueGC(x), nil
+	case int:
+		return NewNumberValueGC(float64(x)), nil
+	case int32:
+		return NewNumberValueGC(float64(x)), nil
+	case int64:
+		return NewNumberValueGC(float64(x)), nil
+	case uint:
+		return NewNumberValueGC(float64(x)), nil
+	case uint32:
+		return NewNumberValueGC(float64(x)), nil
+	case uint64:
+		return NewNumberValueGC(float64(x)), nil
+	case float32:
+		return NewNumberValueGC(float64(x)), nil
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return NewDoubleValueGC(x), nil
+		}
+		return NewNumberValueGC(x), nil
+	case json.Number:
+		f, err := x.Float64()
+		if err != nil {
+			return NewNilValueGC(), err
+		}
+		return NewNumberValueGC(f), nil
+	case string:
+		return NewStringValueGC(x), nil
+	case []byte:
+		return NewStringValueGC(string(x)), nil
+	case []string:
+		elements := make([]ValueGC, len(x))
+		for i, s := range x {
+			elements[i] = NewStringValueGC(s)
+		}
+		return NewArrayValueGC(elements), nil
+	case []interface{}:
+		elements := make([]ValueGC, len(x))
+		for i, item := range x {
+			element, err := fromGoValue(item, depth+1)
+			if err != nil {
+				return NewNilValueGC(), err
+			}
+			elements[i] = element
+		}
+		return NewArrayValueGC(elements), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		obj := NewObjectValueGC(len(keys))
+		for _, key := range keys {
+			value, err := fromGoValue(x[key], depth+1)
+			if err != nil {
+				return NewNilValueGC(), err
+			}
+			if err := ObjectSetValueGC(obj, key, value); err != nil {
+				return NewNilValueGC(), err
+			}
+		}
+		return obj, nil
+	case map[string]string:
+		keys := make([]string, 0, len(x))
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		obj := NewObjectValueGC(len(keys))
+		for _, key := range keys {
+			if err := ObjectSetValueGC(obj, key, NewStringValueGC(x[key])); err != nil {
+				return NewNilValueGC(), err
+			}
+		}
+		return obj, nil
+	default:
+		return NewNilValueGC(), fmt.Errorf("cannot convert Go value of type %T", x)
+	}
+}
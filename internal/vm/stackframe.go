@@ -25,11 +25,7 @@ type StackFrame struct {
 
 // NewStackFrame 创建新栈帧
 func NewStackFrame(function *Function, caller *StackFrame, returnAddr int) *StackFrame {
-	// 计算寄存器大小，至少需要函数的最大栈大小
-	regSize := function.MaxStackSize
-	if regSize < 16 {
-		regSize = 16 // 最小寄存器数量
-	}
+	regSize := function.frameRegisters()
 
 	frame := &StackFrame{
 		Function:     function,
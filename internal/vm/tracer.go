@@ -0,0 +1,290 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/zhnt/aql/internal/gc"
+)
+
+// =============================================================================
+// 执行跟踪器
+// =============================================================================
+
+// 设计原理：
+// - 执行器在指令分派、函数调用、返回、GC触发和出错时回调 Tracer
+// - 默认使用 NopTracer，不产生任何输出，也不格式化调试信息
+// - 值层面的操作（数组分配、闭包创建等）没有执行器上下文，使用包级默认跟踪器
+// - TextTracer 按原有的 "DEBUG [分类] 信息" 格式输出，JSONTracer 每个事件输出一行JSON
+
+// Tracer 执行跟踪器接口
+type Tracer interface {
+	// OnInstruction 在执行指令之前调用
+	OnInstruction(frame *StackFrame, inst Instruction)
+	// OnCall 在进入函数（包括原生函数）时调用，depth为调用后的深度
+	OnCall(callee string, args []ValueGC, depth int)
+	// OnReturn 在函数返回时调用，depth为返回前的深度
+	OnReturn(function string, results []ValueGC, depth int)
+	// OnGC 在GC优化器触发回收之后调用
+	OnGC(reason string, duration time.Duration, err error)
+	// OnError 在执行出错、即将中止时调用
+	OnError(frame *StackFrame, err error)
+	// Log 输出分类调试信息
+	Log(category, message string)
+}
+
+// NopTracer 不做任何事的跟踪器
+type NopTracer struct{}
+
+func (NopTracer) OnInstruction(*StackFrame, Instruction) {}
+func (NopTracer) OnCall(string, []ValueGC, int)          {}
+func (NopTracer) OnReturn(string, []ValueGC, int)        {}
+func (NopTracer) OnGC(string, time.Duration, error)      {}
+func (NopTracer) OnError(*StackFrame, error)             {}
+func (NopTracer) Log(string, string)                     {}
+
+// isNopTracer 判断跟踪器是否不产生任何输出
+func isNopTracer(t Tracer) bool {
+	if t == nil {
+		return true
+	}
+	_, ok := t.(NopTracer)
+	return ok
+}
+
+// =============================================================================
+// 默认跟踪器
+// =============================================================================
+
+var (
+	defaultTracer  Tracer = NopTracer{}
+	defaultTracing bool
+)
+
+// SetDefaultTracer 设置包级默认跟踪器
+// 新建的执行器和值层面的调试信息都使用它，GC管理器的调试信息也会转发给它
+func SetDefaultTracer(t Tracer) {
+	if t == nil {
+		t = NopTracer{}
+	}
+	defaultTracer = t
+	defaultTracing = !isNopTracer(t)
+
+	if defaultTracing {
+		gc.SetDebugLogger(t.Log)
+	} else {
+		gc.SetDebugLogger(nil)
+	}
+}
+
+// DefaultTracer 返回包级默认跟踪器
+func DefaultTracer() Tracer {
+	return defaultTracer
+}
+
+// tracef 通过默认跟踪器输出调试信息（用于没有执行器上下文的值操作）
+func tracef(category, format string, args ...interface{}) {
+	if !defaultTracing {
+		return
+	}
+	defaultTracer.Log(category, fmt.Sprintf(format, args...))
+}
+
+// SetTracer 设置执行器的跟踪器，nil表示关闭跟踪
+func (e *Executor) SetTracer(t Tracer) {
+	if t == nil {
+		t = NopTracer{}
+	}
+	e.tracer = t
+	e.tracing = !isNopTracer(t)
+}
+
+// Tracer 返回执行器当前的跟踪器
+func (e *Executor) Tracer() Tracer {
+	if e.tracer == nil {
+		return NopTracer{}
+	}
+	return e.tracer
+}
+
+// tracef 通过执行器的跟踪器输出调试信息
+func (e *Executor) tracef(category, format string, args ...interface{}) {
+	if !e.tracing {
+		return
+	}
+	e.tracer.Log(category, fmt.Sprintf(format, args...))
+}
+
+// =============================================================================
+// 文本跟踪器
+// =============================================================================
+
+// TextTracer 以文本形式输出调试信息
+// 默认只输出 Log 信息（与原来硬编码的 DEBUG 输出一致），Events 为 true 时同时输出各类事件
+type TextTracer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	Events bool // 是否输出指令、调用、返回、GC和错误事件
+}
+
+// NewTextTracer 创建文本跟踪器
+func NewTextTracer(w io.Writer) *TextTracer {
+	return &TextTracer{w: w}
+}
+
+func (t *TextTracer) printf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, format, args...)
+}
+
+func (t *TextTracer) OnInstruction(frame *StackFrame, inst Instruction) {
+	if t.Events {
+		t.printf("TRACE [EXEC] %s:%04d %s A=%d B=%d C=%d Bx=%d\n",
+			frame.Function.Name, frame.PC, inst.OpCode, inst.A, inst.B, inst.C, inst.Bx)
+	}
+}
+
+func (t *TextTracer) OnCall(callee string, args []ValueGC, depth int) {
+	if t.Events {
+		t.printf("TRACE [CALL] %s argc=%d depth=%d\n", callee, len(args), depth)
+	}
+}
+
+func (t *TextTracer) OnReturn(function string, results []ValueGC, depth int) {
+	if t.Events {
+		t.printf("TRACE [RETURN] %s results=%d depth=%d\n", function, len(results), depth)
+	}
+}
+
+func (t *TextTracer) OnGC(reason string, duration time.Duration, err error) {
+	if !t.Events {
+		return
+	}
+	if err != nil {
+		t.printf("TRACE [GC] reason=%s error=%v\n", reason, err)
+		return
+	}
+	t.printf("TRACE [GC] reason=%s duration=%v\n", reason, duration)
+}
+
+func (t *TextTracer) OnError(frame *StackFrame, err error) {
+	if !t.Events {
+		return
+	}
+	if frame != nil && frame.Function != nil {
+		t.printf("TRACE [ERROR] %s:%04d %v\n", frame.Function.Name, frame.PC, err)
+		return
+	}
+	t.printf("TRACE [ERROR] %v\n", err)
+}
+
+func (t *TextTracer) Log(category, message string) {
+	t.printf("DEBUG [%s] %s\n", category, message)
+}
+
+// =============================================================================
+// JSON Lines 跟踪器
+// =============================================================================
+
+// JSONTracer 每个事件输出一行JSON，便于离线分析
+type JSONTracer struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	start time.Time
+	seq   uint64
+}
+
+// TraceEvent JSONTracer输出的事件记录
+type TraceEvent struct {
+	Seq        uint64   `json:"seq"`
+	ElapsedNS  int64    `json:"elapsed_ns"`
+	Event      string   `json:"event"`
+	Function   string   `json:"function,omitempty"`
+	PC         *int     `json:"pc,omitempty"`
+	Op         string   `json:"op,omitempty"`
+	A          *int     `json:"a,omitempty"`
+	B          *int     `json:"b,omitempty"`
+	C          *int     `json:"c,omitempty"`
+	Bx         *int     `json:"bx,omitempty"`
+	Depth      int      `json:"depth,omitempty"`
+	Values     []string `json:"values,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+	DurationNS int64    `json:"duration_ns,omitempty"`
+	Category   string   `json:"category,omitempty"`
+	Message    string   `json:"message,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// NewJSONTracer 创建JSON Lines跟踪器
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w), start: time.Now()}
+}
+
+func (t *JSONTracer) emit(event *TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	event.Seq = t.seq
+	event.ElapsedNS = time.Since(t.start).Nanoseconds()
+	_ = t.enc.Encode(event)
+}
+
+func (t *JSONTracer) OnInstruction(frame *StackFrame, inst Instruction) {
+	pc, a, b, c, bx := frame.PC, inst.A, inst.B, inst.C, inst.Bx
+	t.emit(&TraceEvent{
+		Event:    "instruction",
+		Function: frame.Function.Name,
+		PC:       &pc,
+		Op:       inst.OpCode.String(),
+		A:        &a,
+		B:        &b,
+		C:        &c,
+		Bx:       &bx,
+	})
+}
+
+func (t *JSONTracer) OnCall(callee string, args []ValueGC, depth int) {
+	t.emit(&TraceEvent{Event: "call", Function: callee, Depth: depth, Values: traceValues(args)})
+}
+
+func (t *JSONTracer) OnReturn(function string, results []ValueGC, depth int) {
+	t.emit(&TraceEvent{Event: "return", Function: function, Depth: depth, Values: traceValues(results)})
+}
+
+func (t *JSONTracer) OnGC(reason string, duration time.Duration, err error) {
+	event := &TraceEvent{Event: "gc", Reason: reason, DurationNS: duration.Nanoseconds()}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	t.emit(event)
+}
+
+func (t *JSONTracer) OnError(frame *StackFrame, err error) {
+	event := &TraceEvent{Event: "error", Error: err.Error()}
+	if frame != nil && frame.Function != nil {
+		pc := frame.PC
+		event.Function = frame.Function.Name
+		event.PC = &pc
+	}
+	t.emit(event)
+}
+
+func (t *JSONTracer) Log(category, message string) {
+	t.emit(&TraceEvent{Event: "log", Category: category, Message: message})
+}
+
+// traceValues 将值转换为字符串表示
+func traceValues(values []ValueGC) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = v.ToString()
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package vm_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/zhnt/aql/internal/aqltest"
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 跟踪器测试
+// =============================================================================
+
+// recordingTracer 记录调用、返回和错误事件，其余事件只计数
+type recordingTracer struct {
+	vm.NopTracer
+	events       []string
+	instructions int
+}
+
+func (r *recordingTracer) OnInstruction(*vm.StackFrame, vm.Instruction) {
+	r.instructions++
+}
+
+func (r *recordingTracer) OnCall(callee string, args []vm.ValueGC, depth int) {
+	r.events = append(r.events, fmt.Sprintf("call %s %v depth=%d", callee, traceStrings(args), depth))
+}
+
+func (r *recordingTracer) OnReturn(function string, results []vm.ValueGC, depth int) {
+	r.events = append(r.events, fmt.Sprintf("return %s %v depth=%d", function, traceStrings(results), depth))
+}
+
+func (r *recordingTracer) OnError(frame *vm.StackFrame, err error) {
+	r.events = append(r.events, fmt.Sprintf("error %s", frame.Function.Name))
+}
+
+func traceStrings(values []vm.ValueGC) []string {
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = v.ToString()
+	}
+	return result
+}
+
+func TestTracerEvents(t *testing.T) {
+	executor, out := aqltest.NewExecutor()
+	tracer := &recordingTracer{}
+	executor.SetTracer(tracer)
+	aqltest.Run(t, executor, out, `
+function add(a, b) { return a + b }
+print(add(1, 2))
+`)
+
+	want := []string{
+		"call add [1 2] depth=2",
+		"return add [3] depth=2",
+		"call print [3] depth=2",
+		"return print [nil] depth=2",
+	}
+	if got := strings.Join(tracer.events, "\n"); !strings.Contains(got, strings.Join(want, "\n")) {
+		t.Errorf("events should contain:\n%s\ngot:\n%s", strings.Join(want, "\n"), got)
+	}
+	if tracer.instructions == 0 {
+		t.Error("instructions should be traced")
+	}
+}
+
+func TestTracerError(t *testing.T) {
+	executor, _ := aqltest.NewExecutor()
+	tracer := &recordingTracer{}
+	executor.SetTracer(tracer)
+	function := aqltest.Compile(t, `
+function f(a) { return a[5] }
+f([1])
+`)
+	if _, err := executor.Execute(function, nil); err == nil {
+		t.Fatal("indexing out of bounds should fail")
+	}
+	if last := tracer.events[len(tracer.events)-1]; last != "error f" {
+		t.Errorf("the error should be traced in f, got %q", last)
+	}
+}
+
+func TestTextTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := vm.NewTextTracer(&buf)
+	executor, out := aqltest.NewExecutor()
+	executor.SetTracer(tracer)
+
+	// 默认只输出 Log 信息
+	aqltest.Run(t, executor, out, `function add(a, b) { return a + b }; add(1, 2)`)
+	tracer.Log("TEST", "hello")
+	if got := buf.String(); strings.Contains(got, "TRACE [") || !strings.HasSuffix(got, "DEBUG [TEST] hello\n") {
+		t.Errorf("without events only logs should be written, got:\n%s", got)
+	}
+
+	buf.Reset()
+	tracer.Events = true
+	aqltest.Run(t, executor, out, `function add(a, b) { return a + b }; add(1, 2)`)
+	for _, want := range []string{"TRACE [EXEC] main:0000 ", "TRACE [CALL] add argc=2 depth=2\n", "TRACE [RETURN] add results=1 depth=2\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("trace should contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
+	var buf bytes.Buffer
+	executor, out := aqltest.NewExecutor()
+	executor.SetTracer(vm.NewJSONTracer(&buf))
+	aqltest.Run(t, executor, out, `function add(a, b) { return a + b }; add(1, 2)`)
+
+	var calls []vm.TraceEvent
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i, line := range lines {
+		var event vm.TraceEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line %d is not JSON: %v\n%s", i+1, err, line)
+		}
+		if event.Seq != uint64(i+1) {
+			t.Errorf("line %d should have seq %d, got %d", i+1, i+1, event.Seq)
+		}
+		if event.Event == "instruction" && (event.PC == nil || event.Op == "") {
+			t.Errorf("instruction events should have pc and op: %s", line)
+		}
+		if event.Event == "call" {
+			calls = append(calls, event)
+		}
+	}
+	if len(calls) != 1 || calls[0].Function != "add" || strings.Join(calls[0].Values, ",") != "1,2" {
+		t.Errorf("there should be one call to add with 1 and 2, got %+v", calls)
+	}
+}
+
+func TestDefaultTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := vm.NewTextTracer(&buf)
+	vm.SetDefaultTracer(tracer)
+	defer vm.SetDefaultTracer(nil)
+
+	// 新建的执行器使用默认跟踪器，值层面的调试信息也写到默认跟踪器
+	executor, out := aqltest.NewExecutor()
+	if executor.Tracer() != vm.Tracer(tracer) {
+		t.Errorf("new executors should use the default tracer, got %T", executor.Tracer())
+	}
+	aqltest.Run(t, executor, out, `let a = [1, 2, 3]`)
+	if !strings.Contains(buf.String(), "DEBUG [NewArrayValueGC] ") {
+		t.Errorf("array allocation should be logged, got:\n%s", buf.String())
+	}
+
+	vm.SetDefaultTracer(nil)
+	if _, ok := vm.DefaultTracer().(vm.NopTracer); !ok {
+		t.Errorf("nil should reset the default tracer, got %T", vm.DefaultTracer())
+	}
+	executor.SetTracer(nil)
+	if _, ok := executor.Tracer().(vm.NopTracer); !ok {
+		t.Errorf("nil should turn tracing off, got %T", executor.Tracer())
+	}
+}
@@ -6,40 +6,40 @@ import "fmt"
 func (e *Executor) executeGetUpvalue(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [GET_UPVALUE] A=%d, B=%d\n", inst.A, inst.B)
-	fmt.Printf("DEBUG [GET_UPVALUE] 当前栈帧: %s (PC: %d)\n", frame.Function.Name, frame.PC)
+	e.tracef("GET_UPVALUE", "A=%d, B=%d", inst.A, inst.B)
+	e.tracef("GET_UPVALUE", "当前栈帧: %s (PC: %d)", frame.Function.Name, frame.PC)
 
 	// 检查栈帧upvalue状态
 	if frame.Upvalues == nil {
-		fmt.Printf("DEBUG [GET_UPVALUE] 错误: 栈帧upvalue为nil\n")
+		e.tracef("GET_UPVALUE", "错误: 栈帧upvalue为nil")
 		return fmt.Errorf("no upvalues in current frame")
 	}
 
-	fmt.Printf("DEBUG [GET_UPVALUE] 栈帧upvalue数量: %d\n", len(frame.Upvalues))
+	e.tracef("GET_UPVALUE", "栈帧upvalue数量: %d", len(frame.Upvalues))
 
 	// 获取upvalue
 	upvalue := frame.GetUpvalue(inst.B)
 	if upvalue == nil {
-		fmt.Printf("DEBUG [GET_UPVALUE] 错误: upvalue[%d]为nil\n", inst.B)
+		e.tracef("GET_UPVALUE", "错误: upvalue[%d]为nil", inst.B)
 		return fmt.Errorf("invalid upvalue index: %d", inst.B)
 	}
 
-	fmt.Printf("DEBUG [GET_UPVALUE] upvalue[%d] 状态: IsClosed=%v, Name=%s\n",
+	e.tracef("GET_UPVALUE", "upvalue[%d] 状态: IsClosed=%v, Name=%s",
 		inst.B, upvalue.IsClosed, upvalue.Name)
 
 	// 获取值
 	value := upvalue.Get()
 	// 只打印类型，避免String()方法的递归
-	fmt.Printf("DEBUG [GET_UPVALUE] 获取到的值类型: %s\n", value.Type())
+	e.tracef("GET_UPVALUE", "获取到的值类型: %s", value.Type())
 
 	// 存储到寄存器
 	err := frame.SetRegister(inst.A, value)
 	if err != nil {
-		fmt.Printf("DEBUG [GET_UPVALUE] 存储寄存器错误: %v\n", err)
+		e.tracef("GET_UPVALUE", "存储寄存器错误: %v", err)
 		return err
 	}
 
-	fmt.Printf("DEBUG [GET_UPVALUE] 成功存储到寄存器[%d]\n", inst.A)
+	e.tracef("GET_UPVALUE", "成功存储到寄存器[%d]", inst.A)
 
 	frame.PC++
 	return nil
@@ -49,32 +49,32 @@ func (e *Executor) executeGetUpvalue(inst Instruction) error {
 func (e *Executor) executeSetUpvalue(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [SET_UPVALUE] A=%d, B=%d\n", inst.A, inst.B)
-	fmt.Printf("DEBUG [SET_UPVALUE] 当前栈帧: %s (PC: %d)\n", frame.Function.Name, frame.PC)
+	e.tracef("SET_UPVALUE", "A=%d, B=%d", inst.A, inst.B)
+	e.tracef("SET_UPVALUE", "当前栈帧: %s (PC: %d)", frame.Function.Name, frame.PC)
 
 	// 检查栈帧upvalue状态
 	if frame.Upvalues == nil {
-		fmt.Printf("DEBUG [SET_UPVALUE] 错误: 栈帧upvalue为nil\n")
+		e.tracef("SET_UPVALUE", "错误: 栈帧upvalue为nil")
 		return fmt.Errorf("no upvalues in current frame")
 	}
 
 	// 获取upvalue和新值
 	upvalue := frame.GetUpvalue(inst.B)
 	if upvalue == nil {
-		fmt.Printf("DEBUG [SET_UPVALUE] 错误: upvalue[%d]为nil\n", inst.B)
+		e.tracef("SET_UPVALUE", "错误: upvalue[%d]为nil", inst.B)
 		return fmt.Errorf("invalid upvalue index: %d", inst.B)
 	}
 
 	newValue := frame.GetRegister(inst.A)
 	// 只打印类型，避免String()方法的递归
-	fmt.Printf("DEBUG [SET_UPVALUE] 设置新值类型: %s\n", newValue.Type())
-	fmt.Printf("DEBUG [SET_UPVALUE] upvalue[%d] 状态: IsClosed=%v, Name=%s\n",
+	e.tracef("SET_UPVALUE", "设置新值类型: %s", newValue.Type())
+	e.tracef("SET_UPVALUE", "upvalue[%d] 状态: IsClosed=%v, Name=%s",
 		inst.B, upvalue.IsClosed, upvalue.Name)
 
 	// 设置值
 	upvalue.Set(newValue)
 
-	fmt.Printf("DEBUG [SET_UPVALUE] 成功设置upvalue[%d]\n", inst.B)
+	e.tracef("SET_UPVALUE", "成功设置upvalue[%d]", inst.B)
 
 	frame.PC++
 	return nil
@@ -84,21 +84,21 @@ func (e *Executor) executeSetUpvalue(inst Instruction) error {
 func (e *Executor) executeCloseUpvalue(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [CLOSE_UPVALUE] A=%d\n", inst.A)
-	fmt.Printf("DEBUG [CLOSE_UPVALUE] 当前栈帧: %s\n", frame.Function.Name)
+	e.tracef("CLOSE_UPVALUE", "A=%d", inst.A)
+	e.tracef("CLOSE_UPVALUE", "当前栈帧: %s", frame.Function.Name)
 
 	// 关闭指定索引及以上的所有upvalue
 	if frame.Upvalues != nil {
-		fmt.Printf("DEBUG [CLOSE_UPVALUE] 栈帧有%d个upvalue\n", len(frame.Upvalues))
+		e.tracef("CLOSE_UPVALUE", "栈帧有%d个upvalue", len(frame.Upvalues))
 		for i := inst.A; i < len(frame.Upvalues); i++ {
 			if frame.Upvalues[i] != nil && !frame.Upvalues[i].IsClosed {
-				fmt.Printf("DEBUG [CLOSE_UPVALUE] 关闭upvalue[%d]: %s\n",
+				e.tracef("CLOSE_UPVALUE", "关闭upvalue[%d]: %s",
 					i, frame.Upvalues[i].Name)
 				frame.Upvalues[i].Close()
 			}
 		}
 	} else {
-		fmt.Printf("DEBUG [CLOSE_UPVALUE] 栈帧没有upvalue\n")
+		e.tracef("CLOSE_UPVALUE", "栈帧没有upvalue")
 	}
 
 	frame.PC++
@@ -109,13 +109,13 @@ func (e *Executor) executeCloseUpvalue(inst Instruction) error {
 func (e *Executor) executeMakeClosureNew(inst Instruction) error {
 	frame := e.CurrentFrame
 
-	fmt.Printf("DEBUG [MAKE_CLOSURE] A=%d, B=%d, C=%d\n", inst.A, inst.B, inst.C)
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 当前栈帧: %s (PC: %d)\n", frame.Function.Name, frame.PC)
+	e.tracef("MAKE_CLOSURE", "A=%d, B=%d, C=%d", inst.A, inst.B, inst.C)
+	e.tracef("MAKE_CLOSURE", "当前栈帧: %s (PC: %d)", frame.Function.Name, frame.PC)
 
 	// 获取函数对象
 	funcValue := frame.GetRegister(inst.B)
 	if !funcValue.IsFunction() {
-		fmt.Printf("DEBUG [MAKE_CLOSURE] 错误: 寄存器[%d]不是函数: %s\n",
+		e.tracef("MAKE_CLOSURE", "错误: 寄存器[%d]不是函数: %s",
 			inst.B, funcValue.Type())
 		return fmt.Errorf("expected function in MAKE_CLOSURE")
 	}
@@ -123,15 +123,15 @@ func (e *Executor) executeMakeClosureNew(inst Instruction) error {
 	// 获取Function对象
 	var targetFunc *Function
 	if targetFunc = funcValue.AsFunction().(*Function); targetFunc == nil {
-		fmt.Printf("DEBUG [MAKE_CLOSURE] 错误: 无法转换为Function\n")
+		e.tracef("MAKE_CLOSURE", "错误: 无法转换为Function")
 		return fmt.Errorf("invalid function in MAKE_CLOSURE")
 	}
 
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 目标函数: %s\n", targetFunc.Name)
+	e.tracef("MAKE_CLOSURE", "目标函数: %s", targetFunc.Name)
 
 	// 获取捕获变量数量
 	captureCount := inst.C
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 需要捕获%d个变量\n", captureCount)
+	e.tracef("MAKE_CLOSURE", "需要捕获%d个变量", captureCount)
 
 	// 创建upvalue数组
 	upvalues := make([]*Upvalue, captureCount)
@@ -143,26 +143,33 @@ func (e *Executor) executeMakeClosureNew(inst Instruction) error {
 		captureValue := frame.GetRegister(inst.B + 1 + i)
 
 		// 只打印类型，避免String()方法的递归
-		fmt.Printf("DEBUG [MAKE_CLOSURE] 捕获变量[%d] 类型: %s\n",
+		e.tracef("MAKE_CLOSURE", "捕获变量[%d] 类型: %s",
 			i, captureValue.Type())
 
+		// 变量名来自编译器记录的捕获描述，没有描述时使用序号
+		name := fmt.Sprintf("capture_%d", i)
+		if i < len(targetFunc.Upvalues) {
+			name = targetFunc.Upvalues[i].Name
+		}
+
 		// 创建upvalue（暂时关闭状态，后续可优化为指向栈）
 		upvalue := &Upvalue{
-			Stack:    nil,                          // 暂时不指向栈
-			Value:    captureValue,                 // 直接存储值
-			IsClosed: true,                         // 暂时设为关闭状态
-			Name:     fmt.Sprintf("capture_%d", i), // 临时名称
+			Stack:    nil,          // 暂时不指向栈
+			Value:    captureValue, // 直接存储值
+			IsClosed: true,         // 暂时设为关闭状态
+			Name:     name,
 		}
 		upvalues[i] = upvalue
 
-		fmt.Printf("DEBUG [MAKE_CLOSURE] 创建upvalue[%d]: Name=%s, IsClosed=%v\n",
+		e.tracef("MAKE_CLOSURE", "创建upvalue[%d]: Name=%s, IsClosed=%v",
 			i, upvalue.Name, upvalue.IsClosed)
 	}
 
 	// 直接创建Callable ValueGC（使用新的统一系统）
 	callableValue := NewCallableValueGC(targetFunc, upvalues)
+	e.pin(callableValue)
 
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 创建Callable ValueGC成功\n")
+	e.tracef("MAKE_CLOSURE", "创建Callable ValueGC成功")
 
 	// GC优化：管理引用计数
 	if e.enableGCOpt && e.gcOptimizer != nil {
@@ -172,11 +179,11 @@ func (e *Executor) executeMakeClosureNew(inst Instruction) error {
 
 	err := frame.SetRegister(inst.A, callableValue)
 	if err != nil {
-		fmt.Printf("DEBUG [MAKE_CLOSURE] 存储寄存器错误: %v\n", err)
+		e.tracef("MAKE_CLOSURE", "存储寄存器错误: %v", err)
 		return err
 	}
 
-	fmt.Printf("DEBUG [MAKE_CLOSURE] 成功存储Callable到寄存器[%d]\n", inst.A)
+	e.tracef("MAKE_CLOSURE", "成功存储Callable到寄存器[%d]", inst.A)
 
 	frame.PC++
 	return nil
@@ -41,7 +41,7 @@ const (
 	ValueGCTypeCallable // GC 管理（可调用对象：函数和闭包）
 	ValueGCTypeClosure  // GC 管理（闭包）- 即将废弃
 	ValueGCTypeArray    // GC 管理
-	ValueGCTypeStruct   // GC 管理（预留）
+	ValueGCTypeStruct   // GC 管理（对象/哈希表，见 value_gc_object.go）
 )
 
 // Value 标志位掩码和定义
@@ -246,7 +246,7 @@ func newGCStringValueGC(s string) ValueGC {
 
 	// 拷贝字符串内容到紧随结构体的内存中
 	contentPtr := unsafe.Pointer(uintptr(unsafe.Pointer(strDataPtr)) + unsafe.Sizeof(GCStringData{}))
-	copy((*[1024]byte)(contentPtr)[:len(strData)], strData)
+	copy(unsafe.Slice((*byte)(contentPtr), len(strData)), strData)
 
 	// 创建 Value，存储 GCObject 指针
 	return ValueGC{
@@ -266,7 +266,7 @@ func NewArrayValueGCWithCapacity(elements []ValueGC, hintCapacity int) ValueGC {
 		panic("ValueGCManager not initialized")
 	}
 
-	fmt.Printf("DEBUG [NewArrayValueGC] 开始创建数组，元素数量: %d, 容量提示: %d\n", len(elements), hintCapacity)
+	tracef("NewArrayValueGC", "开始创建数组，元素数量: %d, 容量提示: %d", len(elements), hintCapacity)
 
 	// 计算所需容量
 	requiredLength := len(elements)
@@ -275,7 +275,7 @@ func NewArrayValueGCWithCapacity(elements []ValueGC, hintCapacity int) ValueGC {
 	// 使用智能容量计算
 	actualCapacity := calculateExpandedCapacity(0, minCapacity)
 
-	fmt.Printf("DEBUG [NewArrayValueGC] 容量计算: 最小=%d, 实际=%d\n", minCapacity, actualCapacity)
+	tracef("NewArrayValueGC", "容量计算: 最小=%d, 实际=%d", minCapacity, actualCapacity)
 
 	// 计算内存大小
 	headerSize := 16                    // GCObject Header
@@ -283,33 +283,29 @@ func NewArrayValueGCWithCapacity(elements []ValueGC, hintCapacity int) ValueGC {
 	elementsSize := actualCapacity * 16 // Elements数据
 	totalSize := headerSize + arrayDataSize + elementsSize
 
-	fmt.Printf("DEBUG [NewArrayValueGC] 内存布局:\n")
-	fmt.Printf("  - GCObject Header: %d字节\n", headerSize)
-	fmt.Printf("  - GCArrayData: %d字节\n", arrayDataSize)
-	fmt.Printf("  - 元素数量: %d, 容量: %d\n", requiredLength, actualCapacity)
-	fmt.Printf("  - 元素数据大小: %d字节\n", elementsSize)
-	fmt.Printf("  - 总大小: %d字节\n", totalSize)
+	tracef("NewArrayValueGC", "内存布局: header=%d字节, arrayData=%d字节, 元素数量=%d, 容量=%d, 元素数据=%d字节, 总大小=%d字节",
+		headerSize, arrayDataSize, requiredLength, actualCapacity, elementsSize, totalSize)
 
 	// 分配内存
 	gcObj := GlobalValueGCManager.gcManager.AllocateIsolated(totalSize, uint8(gc.ObjectTypeArray))
 	if gcObj == nil {
-		fmt.Printf("DEBUG [NewArrayValueGC] 尝试普通分配作为后备\n")
+		tracef("NewArrayValueGC", "尝试普通分配作为后备")
 		gcObj = GlobalValueGCManager.gcManager.Allocate(totalSize, uint8(gc.ObjectTypeArray))
 	}
 
 	if gcObj == nil {
-		fmt.Printf("DEBUG [NewArrayValueGC] 错误: GC分配失败\n")
+		tracef("NewArrayValueGC", "错误: GC分配失败")
 		panic("failed to allocate array object")
 	}
 
-	fmt.Printf("DEBUG [NewArrayValueGC] GC对象分配成功: %p\n", gcObj)
+	tracef("NewArrayValueGC", "GC对象分配成功: %p", gcObj)
 
 	// 初始化数组头
 	arrData := (*GCArrayData)(gcObj.GetDataPtr())
 	arrData.Length = uint32(requiredLength)
 	arrData.Capacity = uint32(actualCapacity)
 
-	fmt.Printf("DEBUG [NewArrayValueGC] 初始化数组头: Length=%d, Capacity=%d\n", arrData.Length, arrData.Capacity)
+	tracef("NewArrayValueGC", "初始化数组头: Length=%d, Capacity=%d", arrData.Length, arrData.Capacity)
 
 	// 拷贝元素
 	for i, elem := range elements {
@@ -318,7 +314,7 @@ func NewArrayValueGCWithCapacity(elements []ValueGC, hintCapacity int) ValueGC {
 			panic(fmt.Sprintf("failed to get element pointer for index %d", i))
 		}
 		*elemPtr = SafeCopyValueGC(elem)
-		fmt.Printf("DEBUG [NewArrayValueGC] 拷贝元素[%d]: 类型=%s\n", i, elem.Type())
+		tracef("NewArrayValueGC", "拷贝元素[%d]: 类型=%s", i, elem.Type())
 	}
 
 	// 剩余位置填充nil
@@ -330,7 +326,7 @@ func NewArrayValueGCWithCapacity(elements []ValueGC, hintCapacity int) ValueGC {
 		}
 	}
 
-	fmt.Printf("DEBUG [NewArrayValueGC] 数组创建完成\n")
+	tracef("NewArrayValueGC", "数组创建完成")
 
 	return ValueGC{
 		typeAndFlags: uint64(ValueGCTypeArray) | ValueGCFlagGCManaged,
@@ -383,13 +379,13 @@ func NewFunctionValueGCFromID(functionID int) ValueGC {
 
 // NewCallableValueGC 创建Callable ValueGC（新的统一可调用对象）
 func NewCallableValueGC(function *Function, upvalues []*Upvalue) ValueGC {
-	fmt.Printf("DEBUG [NewCallableValueGC] 输入函数: %p\n", function)
+	tracef("NewCallableValueGC", "输入函数: %p", function)
 	if function != nil {
-		fmt.Printf("DEBUG [NewCallableValueGC] 函数名: %s\n", function.Name)
+		tracef("NewCallableValueGC", "函数名: %s", function.Name)
 	} else {
-		fmt.Printf("DEBUG [NewCallableValueGC] 函数为nil!\n")
+		tracef("NewCallableValueGC", "函数为nil!")
 	}
-	fmt.Printf("DEBUG [NewCallableValueGC] upvalue数量: %d\n", len(upvalues))
+	tracef("NewCallableValueGC", "upvalue数量: %d", len(upvalues))
 
 	// 在堆上分配Callable对象，确保生命周期正确
 	callable := &Callable{
@@ -397,10 +393,10 @@ func NewCallableValueGC(function *Function, upvalues []*Upvalue) ValueGC {
 		Upvalues: upvalues,
 	}
 
-	fmt.Printf("DEBUG [NewCallableValueGC] 创建callable对象: %p\n", callable)
-	fmt.Printf("DEBUG [NewCallableValueGC] callable.Function: %p\n", callable.Function)
+	tracef("NewCallableValueGC", "创建callable对象: %p", callable)
+	tracef("NewCallableValueGC", "callable.Function: %p", callable.Function)
 	if callable.Function != nil {
-		fmt.Printf("DEBUG [NewCallableValueGC] callable.Function.Name: %s\n", callable.Function.Name)
+		tracef("NewCallableValueGC", "callable.Function.Name: %s", callable.Function.Name)
 	}
 
 	// 安全地存储堆指针
@@ -409,19 +405,19 @@ func NewCallableValueGC(function *Function, upvalues []*Upvalue) ValueGC {
 		data:         uint64(uintptr(unsafe.Pointer(callable))),
 	}
 
-	fmt.Printf("DEBUG [NewCallableValueGC] 存储的指针地址: 0x%x\n", result.data)
-	fmt.Printf("DEBUG [NewCallableValueGC] 类型: %s\n", result.Type())
+	tracef("NewCallableValueGC", "存储的指针地址: 0x%x", result.data)
+	tracef("NewCallableValueGC", "类型: %s", result.Type())
 
 	return result
 }
 
 // NewClosureValueGC 创建闭包ValueGC（堆分配版本）- 即将废弃
 func NewClosureValueGC(function *Function, captures map[string]ValueGC) ValueGC {
-	fmt.Printf("DEBUG [NewClosureValueGC] 输入函数: %p\n", function)
+	tracef("NewClosureValueGC", "输入函数: %p", function)
 	if function != nil {
-		fmt.Printf("DEBUG [NewClosureValueGC] 函数名: %s\n", function.Name)
+		tracef("NewClosureValueGC", "函数名: %s", function.Name)
 	}
-	fmt.Printf("DEBUG [NewClosureValueGC] 捕获变量数量: %d\n", len(captures))
+	tracef("NewClosureValueGC", "捕获变量数量: %d", len(captures))
 
 	// 在堆上分配闭包对象，确保生命周期正确
 	closure := &Closure{
@@ -429,19 +425,19 @@ func NewClosureValueGC(function *Function, captures map[string]ValueGC) ValueGC
 		Captures: make(map[string]ValueGC),
 	}
 
-	fmt.Printf("DEBUG [NewClosureValueGC] 创建的闭包对象: %p\n", closure)
-	fmt.Printf("DEBUG [NewClosureValueGC] 闭包.Function: %p\n", closure.Function)
+	tracef("NewClosureValueGC", "创建的闭包对象: %p", closure)
+	tracef("NewClosureValueGC", "闭包.Function: %p", closure.Function)
 	if closure.Function != nil {
-		fmt.Printf("DEBUG [NewClosureValueGC] 闭包.Function.Name: %s\n", closure.Function.Name)
+		tracef("NewClosureValueGC", "闭包.Function.Name: %s", closure.Function.Name)
 	}
 
 	// 复制捕获变量到堆分配的map
 	for name, value := range captures {
 		closure.Captures[name] = value
-		fmt.Printf("DEBUG [NewClosureValueGC] 复制捕获变量: %s -> %s\n", name, value.Type())
+		tracef("NewClosureValueGC", "复制捕获变量: %s -> %s", name, value.Type())
 	}
 
-	fmt.Printf("DEBUG [NewClosureValueGC] 最终闭包对象: %p, Function: %p\n", closure, closure.Function)
+	tracef("NewClosureValueGC", "最终闭包对象: %p, Function: %p", closure, closure.Function)
 
 	// 安全地存储堆指针
 	return ValueGC{
@@ -487,7 +483,7 @@ func (v ValueGC) AsString() string {
 		gcObj := (*gc.GCObject)(unsafe.Pointer(uintptr(v.data)))
 		strData := (*GCStringData)(gcObj.GetDataPtr())
 		contentPtr := unsafe.Pointer(uintptr(unsafe.Pointer(strData)) + unsafe.Sizeof(GCStringData{}))
-		return string((*[1024]byte)(contentPtr)[:strData.Length])
+		return string(unsafe.Slice((*byte)(contentPtr), strData.Length))
 	}
 }
 
@@ -567,69 +563,77 @@ func (v ValueGC) AsFunction() interface{} {
 	return v
 }
 
+// AsFunctionID 获取内联存储的Function ID，非内联函数值返回0
+func (v ValueGC) AsFunctionID() int {
+	if v.Type() != ValueGCTypeFunction || !v.IsInline() {
+		return 0
+	}
+	return int(v.data)
+}
+
 // AsCallable 获取可调用对象（带安全检查）
 func (v ValueGC) AsCallable() *Callable {
-	fmt.Printf("DEBUG [AsCallable] 输入值类型: %s\n", v.Type())
+	tracef("AsCallable", "输入值类型: %s", v.Type())
 
 	if v.Type() != ValueGCTypeCallable {
-		fmt.Printf("DEBUG [AsCallable] 类型不匹配，期望: %s, 实际: %s\n", ValueGCTypeCallable, v.Type())
+		tracef("AsCallable", "类型不匹配，期望: %s, 实际: %s", ValueGCTypeCallable, v.Type())
 		return nil
 	}
 
 	// 检查指针有效性
 	if v.data == 0 {
-		fmt.Printf("DEBUG [AsCallable] 指针为空\n")
+		tracef("AsCallable", "指针为空")
 		return nil
 	}
 
-	fmt.Printf("DEBUG [AsCallable] 指针地址: 0x%x\n", v.data)
+	tracef("AsCallable", "指针地址: 0x%x", v.data)
 
 	// 从指针恢复可调用对象
 	callable := (*Callable)(unsafe.Pointer(uintptr(v.data)))
 
-	fmt.Printf("DEBUG [AsCallable] 恢复的callable指针: %p\n", callable)
+	tracef("AsCallable", "恢复的callable指针: %p", callable)
 
 	// 基本有效性检查
 	if callable == nil {
-		fmt.Printf("DEBUG [AsCallable] callable为nil\n")
+		tracef("AsCallable", "callable为nil")
 		return nil
 	}
 
 	if callable.Function == nil {
-		fmt.Printf("DEBUG [AsCallable] callable.Function为nil\n")
+		tracef("AsCallable", "callable.Function为nil")
 		return nil
 	}
 
-	fmt.Printf("DEBUG [AsCallable] 成功恢复callable，函数: %s\n", callable.Function.Name)
+	tracef("AsCallable", "成功恢复callable，函数: %s", callable.Function.Name)
 	return callable
 }
 
 // AsClosure 获取闭包对象（带安全检查）- 即将废弃
 func (v ValueGC) AsClosure() *Closure {
-	fmt.Printf("DEBUG [AsClosure] 检查闭包: Type=%s, data=%d\n", v.Type(), v.data)
+	tracef("AsClosure", "检查闭包: Type=%s, data=%d", v.Type(), v.data)
 
 	if v.Type() != ValueGCTypeClosure {
-		fmt.Printf("DEBUG [AsClosure] 类型错误: 期望=%s, 实际=%s\n", ValueGCTypeClosure, v.Type())
+		tracef("AsClosure", "类型错误: 期望=%s, 实际=%s", ValueGCTypeClosure, v.Type())
 		return nil
 	}
 
 	// 检查指针有效性
 	if v.data == 0 {
-		fmt.Printf("DEBUG [AsClosure] 数据指针为空\n")
+		tracef("AsClosure", "数据指针为空")
 		return nil
 	}
 
 	// 从指针恢复闭包对象
 	closure := (*Closure)(unsafe.Pointer(uintptr(v.data)))
-	fmt.Printf("DEBUG [AsClosure] 恢复闭包对象: %p\n", closure)
+	tracef("AsClosure", "恢复闭包对象: %p", closure)
 
 	// 基本有效性检查
 	if closure == nil || closure.Function == nil {
-		fmt.Printf("DEBUG [AsClosure] 闭包对象或函数为nil: closure=%p, function=%p\n", closure, closure.Function)
+		tracef("AsClosure", "闭包对象或函数为nil: closure=%p, function=%p", closure, closure.Function)
 		return nil
 	}
 
-	fmt.Printf("DEBUG [AsClosure] 成功恢复闭包，函数: %s\n", closure.Function.Name)
+	tracef("AsClosure", "成功恢复闭包，函数: %s", closure.Function.Name)
 	return closure
 }
 
@@ -642,23 +646,29 @@ func (v ValueGC) IsTruthy() bool {
 // 简化引用计数管理
 // =============================================================================
 
+// refCounted 判断值是否指向带GC对象头的堆对象
+// Callable、Closure 指向普通的Go结构体，没有对象头，不能参与引用计数
+func (v ValueGC) refCounted() bool {
+	return v.IsGCManaged() && v.RequiresGC()
+}
+
 // IncRef 增加引用计数（简化版本）
 func (v ValueGC) IncRef() {
-	if v.RequiresGC() {
+	if v.refCounted() {
 		incrementValueRefCountSimple(v)
 	}
 }
 
 // DecRef 减少引用计数（简化版本）
 func (v ValueGC) DecRef() {
-	if v.RequiresGC() {
+	if v.refCounted() {
 		decrementValueRefCountSimple(v)
 	}
 }
 
 // RefCount 获取引用计数（简化版本）
 func (v ValueGC) RefCount() uint32 {
-	if !v.RequiresGC() {
+	if !v.refCounted() {
 		return 0
 	}
 	return getValueRefCountSimple(v)
@@ -672,7 +682,7 @@ func incrementValueRefCountSimple(v ValueGC) {
 	oldRefCount := header.RefCount()
 	header.IncRefCount()
 
-	fmt.Printf("DEBUG [SimpleRefCount] IncRef: obj=%p, %d -> %d\n", objPtr, oldRefCount, header.RefCount())
+	tracef("SimpleRefCount", "IncRef: obj=%p, %d -> %d", objPtr, oldRefCount, header.RefCount())
 }
 
 func decrementValueRefCountSimple(v ValueGC) {
@@ -682,10 +692,10 @@ func decrementValueRefCountSimple(v ValueGC) {
 	oldRefCount := header.RefCount()
 	newRefCount := header.DecRefCount()
 
-	fmt.Printf("DEBUG [SimpleRefCount] DecRef: obj=%p, %d -> %d\n", objPtr, oldRefCount, newRefCount)
+	tracef("SimpleRefCount", "DecRef: obj=%p, %d -> %d", objPtr, oldRefCount, newRefCount)
 
 	if newRefCount == 0 {
-		fmt.Printf("DEBUG [SimpleRefCount] 对象引用计数归零，开始清理: obj=%p\n", objPtr)
+		tracef("SimpleRefCount", "对象引用计数归零，开始清理: obj=%p", objPtr)
 		handleZeroRefCountSimple(v)
 	}
 }
@@ -699,7 +709,7 @@ func getValueRefCountSimple(v ValueGC) uint32 {
 // handleZeroRefCountSimple 简化的零引用计数处理
 func handleZeroRefCountSimple(v ValueGC) {
 	objPtr := unsafe.Pointer(uintptr(v.data))
-	fmt.Printf("DEBUG [SimpleRefCount] 处理零引用计数: obj=%p, type=%s\n", objPtr, v.Type())
+	tracef("SimpleRefCount", "处理零引用计数: obj=%p, type=%s", objPtr, v.Type())
 
 	// 根据类型处理子对象的引用计数
 	switch v.Type() {
@@ -718,7 +728,7 @@ func handleZeroRefCountSimple(v ValueGC) {
 	// 释放对象内存
 	if GlobalValueGCManager != nil {
 		gcObj := (*gc.GCObject)(objPtr)
-		fmt.Printf("DEBUG [SimpleRefCount] 释放对象内存: obj=%p\n", objPtr)
+		tracef("SimpleRefCount", "释放对象内存: obj=%p", objPtr)
 		GlobalValueGCManager.gcManager.Deallocate(gcObj)
 	}
 }
@@ -727,16 +737,16 @@ func handleZeroRefCountSimple(v ValueGC) {
 func handleArrayZeroRefSimple(v ValueGC) {
 	_, elements, err := v.AsArrayData()
 	if err != nil {
-		fmt.Printf("DEBUG [SimpleRefCount] 数组数据获取失败: %v\n", err)
+		tracef("SimpleRefCount", "数组数据获取失败: %v", err)
 		return
 	}
 
-	fmt.Printf("DEBUG [SimpleRefCount] 处理数组子元素引用计数: 长度=%d\n", len(elements))
+	tracef("SimpleRefCount", "处理数组子元素引用计数: 长度=%d", len(elements))
 
 	// 减少所有元素的引用计数
 	for i, elem := range elements {
 		if elem.RequiresGC() {
-			fmt.Printf("DEBUG [SimpleRefCount] 减少元素[%d]引用计数: type=%s\n", i, elem.Type())
+			tracef("SimpleRefCount", "减少元素[%d]引用计数: type=%s", i, elem.Type())
 			elem.DecRef()
 		}
 	}
@@ -753,7 +763,7 @@ func handleArrayZeroRefSimple(v ValueGC) {
 // CopyValueGC 安全拷贝值（自动管理引用计数）
 func CopyValueGC(v ValueGC) ValueGC {
 	if v.RequiresGC() {
-		fmt.Printf("DEBUG [CopyValueGC] 拷贝GC对象: obj=%p, type=%s\n", unsafe.Pointer(uintptr(v.data)), v.Type())
+		tracef("CopyValueGC", "拷贝GC对象: obj=%p, type=%s", unsafe.Pointer(uintptr(v.data)), v.Type())
 		// 使用简化的引用计数管理
 		v.IncRef()
 	}
@@ -763,13 +773,13 @@ func CopyValueGC(v ValueGC) ValueGC {
 // AssignValueGC 安全赋值（自动管理引用计数）
 func AssignValueGC(dst *ValueGC, src ValueGC) {
 	if dst.RequiresGC() {
-		fmt.Printf("DEBUG [AssignValueGC] 赋值前减少旧值引用: obj=%p, type=%s\n", unsafe.Pointer(uintptr(dst.data)), dst.Type())
+		tracef("AssignValueGC", "赋值前减少旧值引用: obj=%p, type=%s", unsafe.Pointer(uintptr(dst.data)), dst.Type())
 		// 使用简化的引用计数管理
 		dst.DecRef()
 	}
 
 	if src.RequiresGC() {
-		fmt.Printf("DEBUG [AssignValueGC] 赋值时增加新值引用: obj=%p, type=%s\n", unsafe.Pointer(uintptr(src.data)), src.Type())
+		tracef("AssignValueGC", "赋值时增加新值引用: obj=%p, type=%s", unsafe.Pointer(uintptr(src.data)), src.Type())
 		// 使用简化的引用计数管理
 		src.IncRef()
 	}
@@ -787,7 +797,7 @@ func SafeCopyValueGC(v ValueGC) ValueGC {
 func safeCopyValueGCWithDepth(v ValueGC, depth int, visited map[uintptr]bool) ValueGC {
 	// 深度限制，避免无限递归
 	if depth > 10 {
-		fmt.Printf("DEBUG [SafeCopyValueGC] 深度限制达到，返回nil: depth=%d\n", depth)
+		tracef("SafeCopyValueGC", "深度限制达到，返回nil: depth=%d", depth)
 		return NewNilValueGC()
 	}
 
@@ -796,7 +806,7 @@ func safeCopyValueGCWithDepth(v ValueGC, depth int, visited map[uintptr]bool) Va
 
 		// 检查是否已经访问过（循环引用检测）
 		if visited[objPtr] {
-			fmt.Printf("DEBUG [SafeCopyValueGC] 检测到循环引用，返回nil: obj=%p\n", unsafe.Pointer(objPtr))
+			tracef("SafeCopyValueGC", "检测到循环引用，返回nil: obj=%p", unsafe.Pointer(objPtr))
 			return NewNilValueGC()
 		}
 
@@ -806,7 +816,7 @@ func safeCopyValueGCWithDepth(v ValueGC, depth int, visited map[uintptr]bool) Va
 			delete(visited, objPtr)
 		}()
 
-		fmt.Printf("DEBUG [SafeCopyValueGC] 拷贝GC对象: obj=%p, type=%s, depth=%d\n", unsafe.Pointer(objPtr), v.Type(), depth)
+		tracef("SafeCopyValueGC", "拷贝GC对象: obj=%p, type=%s, depth=%d", unsafe.Pointer(objPtr), v.Type(), depth)
 
 		// 对于数组，进行深度拷贝以避免循环引用
 		if v.Type() == ValueGCTypeArray {
@@ -826,11 +836,11 @@ func safeCopyValueGCWithDepth(v ValueGC, depth int, visited map[uintptr]bool) Va
 func safeCopyArrayValueGC(arrayValue ValueGC, depth int, visited map[uintptr]bool) ValueGC {
 	arrData, elements, err := arrayValue.AsArrayData()
 	if err != nil {
-		fmt.Printf("DEBUG [SafeCopyArrayValueGC] 数组数据获取失败: %v\n", err)
+		tracef("SafeCopyArrayValueGC", "数组数据获取失败: %v", err)
 		return NewNilValueGC()
 	}
 
-	fmt.Printf("DEBUG [SafeCopyArrayValueGC] 开始拷贝数组: 长度=%d, 深度=%d\n", arrData.Length, depth)
+	tracef("SafeCopyArrayValueGC", "开始拷贝数组: 长度=%d, 深度=%d", arrData.Length, depth)
 
 	// 创建新的元素数组
 	newElements := make([]ValueGC, arrData.Length)
@@ -842,7 +852,7 @@ func safeCopyArrayValueGC(arrayValue ValueGC, depth int, visited map[uintptr]boo
 		// 递归安全拷贝每个元素
 		newElements[i] = safeCopyValueGCWithDepth(element, depth+1, visited)
 
-		fmt.Printf("DEBUG [SafeCopyArrayValueGC] 拷贝元素[%d]: 原类型=%s, 新类型=%s\n", i, element.Type(), newElements[i].Type())
+		tracef("SafeCopyArrayValueGC", "拷贝元素[%d]: 原类型=%s, 新类型=%s", i, element.Type(), newElements[i].Type())
 	}
 
 	// 创建新的数组对象
@@ -900,6 +910,8 @@ func (v ValueGC) ToBool() bool {
 		return v.AsDouble() != 0.0
 	case ValueGCTypeString:
 		return v.AsString() != ""
+	case ValueGCTypeObject:
+		return true // 对象（包括空对象）总是真值
 	default:
 		return true // 函数等其他类型被认为是真值
 	}
@@ -964,6 +976,17 @@ func (v ValueGC) toStringWithDepth(depth int) string {
 			return result
 		}
 		return "array:invalid"
+	case ValueGCTypeObject:
+		return v.objectToStringWithDepth(depth)
+	case ValueGCTypeNativeFunction:
+		if native := v.AsNativeFunction(); native != nil {
+			return fmt.Sprintf("builtin:%s", native.Name)
+		}
+		return "builtin:invalid"
+	case ValueGCTypeCoroutine:
+		return fmt.Sprintf("coroutine#%d", v.AsCoroutineID())
+	case ValueGCTypePromise:
+		return fmt.Sprintf("promise#%d", v.AsPromiseID())
 	default:
 		return fmt.Sprintf("unknown:%d", v.Type())
 	}
@@ -998,7 +1021,13 @@ func (vt ValueTypeGC) String() string {
 	case ValueGCTypeArray:
 		return "array"
 	case ValueGCTypeStruct:
-		return "struct"
+		return "object"
+	case ValueGCTypeNativeFunction:
+		return "native"
+	case ValueGCTypeCoroutine:
+		return "coroutine"
+	case ValueGCTypePromise:
+		return "promise"
 	default:
 		return "unknown"
 	}
@@ -0,0 +1,375 @@
+package vm
+
+import (
+	"fmt"
+	"strconv"
+	"unsafe"
+
+	"github.com/zhnt/aql/internal/gc"
+)
+
+// =============================================================================
+// 对象（哈希表）值
+// =============================================================================
+
+// 设计原理：
+// - 对象复用预留的 ValueGCTypeStruct 类型和 gc.ObjectTypeStruct 对象类型
+// - 对象头 GCObjectData 分配后地址不变，ValueGC 始终指向它，因此对象是引用类型
+// - 字段存放在独立的 GC 存储区中，扩容时只替换存储区，无需更新任何引用
+// - 字段按插入顺序连续存放，查找时先比较哈希再比较键
+// - 字段数达到 objectIndexThreshold 后另建开放寻址的哈希索引（槽中存字段下标+1），
+//   查找不再线性扫描；索引同样放在GC存储区中，装载率超过一半时加倍重建
+
+// ValueGCTypeObject 对象类型（复用预留的Struct类型）
+const ValueGCTypeObject = ValueGCTypeStruct
+
+// GCObjectData GC 管理的对象数据
+type GCObjectData struct {
+	Length    uint32       // 字段数量
+	Capacity  uint32       // 字段存储区容量
+	Entries   *gc.GCObject // 字段存储区（GCObjectEntry数组）
+	IndexSize uint32       // 哈希索引的槽数（2的幂），0表示没有索引
+	Index     *gc.GCObject // 哈希索引（uint32数组），字段较少时为nil
+}
+
+// GCObjectEntry 对象字段
+type GCObjectEntry struct {
+	Hash  uint64  // 键的哈希值
+	Key   ValueGC // 键（字符串）
+	Value ValueGC // 值
+}
+
+const (
+	gcObjectHeaderSize   = int(unsafe.Sizeof(gc.GCObjectHeader{}))
+	gcObjectEntrySize    = int(unsafe.Sizeof(GCObjectEntry{}))
+	minObjectCapacity    = 4
+	objectIndexThreshold = 8 // 字段数达到该值时建立哈希索引
+	objectGrowthFactor   = 2
+	maxObjectFieldCount  = 1 << 24
+)
+
+// NewObjectValueGC 创建空对象，capacityHint为预期字段数量
+func NewObjectValueGC(capacityHint int) ValueGC {
+	if GlobalValueGCManager == nil {
+		panic("ValueGCManager not initialized")
+	}
+
+	totalSize := gcObjectHeaderSize + int(unsafe.Sizeof(GCObjectData{}))
+	gcObj := GlobalValueGCManager.gcManager.AllocateIsolated(totalSize, uint8(gc.ObjectTypeStruct))
+	if gcObj == nil {
+		gcObj = GlobalValueGCManager.gcManager.Allocate(totalSize, uint8(gc.ObjectTypeStruct))
+	}
+	if gcObj == nil {
+		panic("failed to allocate object")
+	}
+
+	objData := (*GCObjectData)(gcObj.GetDataPtr())
+	objData.Length = 0
+	objData.Capacity = 0
+	objData.Entries = nil
+	objData.IndexSize = 0
+	objData.Index = nil
+
+	if err := growObjectEntries(objData, capacityHint); err != nil {
+		panic(err.Error())
+	}
+
+	return ValueGC{
+		typeAndFlags: uint64(ValueGCTypeObject) | ValueGCFlagGCManaged,
+		data:         uint64(uintptr(unsafe.Pointer(gcObj))),
+	}
+}
+
+// IsObject 判断是否为对象
+func (v ValueGC) IsObject() bool { return v.Type() == ValueGCTypeObject }
+
+// ObjectGetValueGC 读取对象字段，字段不存在时返回nil和false
+func ObjectGetValueGC(objValue ValueGC, key string) (ValueGC, bool, error) {
+	objData, err := getObjectData(objValue)
+	if err != nil {
+		return NewNilValueGC(), false, err
+	}
+
+	index := findObjectEntry(objData, key, hashObjectKey(key))
+	if index < 0 {
+		return NewNilValueGC(), false, nil
+	}
+	return objectEntries(objData)[index].Value, true, nil
+}
+
+// ObjectSetValueGC 设置对象字段，新字段追加在末尾
+func ObjectSetValueGC(objValue ValueGC, key string, value ValueGC) error {
+	objData, err := getObjectData(objValue)
+	if err != nil {
+		return err
+	}
+
+	hash := hashObjectKey(key)
+	if index := findObjectEntry(objData, key, hash); index >= 0 {
+		entries := objectEntries(objData)
+		AssignValueGC(&entries[index].Value, value)
+		return nil
+	}
+
+	if objData.Length == objData.Capacity {
+		if err := growObjectEntries(objData, int(objData.Capacity)*objectGrowthFactor); err != nil {
+			return err
+		}
+	}
+
+	objData.Length++
+	entry := &objectEntries(objData)[objData.Length-1]
+	entry.Hash = hash
+	entry.Key = NewStringValueGC(key)
+	entry.Value = CopyValueGC(value)
+	return indexObjectEntry(objData, int(objData.Length-1))
+}
+
+// ObjectLengthValueGC 获取对象字段数量
+func ObjectLengthValueGC(objValue ValueGC) (int, error) {
+	objData, err := getObjectData(objValue)
+	if err != nil {
+		return 0, err
+	}
+	return int(objData.Length), nil
+}
+
+// AsObjectEntries 按插入顺序返回对象的键和值
+func (v ValueGC) AsObjectEntries() ([]string, []ValueGC, error) {
+	objData, err := getObjectData(v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := objectEntries(objData)
+	keys := make([]string, len(entries))
+	values := make([]ValueGC, len(entries))
+	for i := range entries {
+		keys[i] = entries[i].Key.AsString()
+		values[i] = entries[i].Value
+	}
+	return keys, values, nil
+}
+
+// ObjectKeyFromValueGC 将动态键转换为对象字段名，支持字符串和整数
+func ObjectKeyFromValueGC(key ValueGC) (string, error) {
+	switch key.Type() {
+	case ValueGCTypeString:
+		return key.AsString(), nil
+	case ValueGCTypeSmallInt:
+		return strconv.Itoa(int(key.AsSmallInt())), nil
+	case ValueGCTypeDouble:
+		f := key.AsDouble()
+		if f == float64(int64(f)) {
+			return strconv.FormatInt(int64(f), 10), nil
+		}
+		return "", fmt.Errorf("object key must be a string or integer, got %s", key.ToString())
+	default:
+		return "", fmt.Errorf("object key must be a string or integer, got %s", key.Type())
+	}
+}
+
+// =============================================================================
+// 对象相等与字符串表示
+// =============================================================================
+
+// equalObject 对象相等比较：同一引用，或字段集合相同且对应值相等（与字段顺序无关）
+// 循环引用回到正在比较的一对对象时视为相等
+func (v ValueGC) equalObject(other ValueGC, compared comparedPairs) bool {
+	if v.data == other.data {
+		return true
+	}
+
+	data1, err1 := getObjectData(v)
+	data2, err2 := getObjectData(other)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	if data1.Length != data2.Length {
+		return false
+	}
+	if !compared.enter(v, other) {
+		return true
+	}
+
+	for _, entry := range objectEntries(data1) {
+		key := entry.Key.AsString()
+		index := findObjectEntry(data2, key, entry.Hash)
+		if index < 0 {
+			return false
+		}
+		if !entry.Value.equal(objectEntries(data2)[index].Value, compared) {
+			return false
+		}
+	}
+	return true
+}
+
+// objectToStringWithDepth 对象的字符串表示: {key: value, ...}
+func (v ValueGC) objectToStringWithDepth(depth int) string {
+	objData, err := getObjectData(v)
+	if err != nil {
+		return "object:invalid"
+	}
+
+	result := "{"
+	for i, entry := range objectEntries(objData) {
+		if i > 0 {
+			result += ", "
+		}
+		result += entry.Key.AsString() + ": " + entry.Value.toStringWithDepth(depth+1)
+	}
+	result += "}"
+	return result
+}
+
+// =============================================================================
+// 内部实现
+// =============================================================================
+
+// getObjectData 从ValueGC获取对象数据
+func getObjectData(objValue ValueGC) (*GCObjectData, error) {
+	if !objValue.IsObject() {
+		return nil, fmt.Errorf("not an object: %s", objValue.Type())
+	}
+
+	gcObj := *(**gc.GCObject)(unsafe.Pointer(&objValue.data))
+	return (*GCObjectData)(gcObj.GetDataPtr()), nil
+}
+
+// objectEntries 返回已使用字段的slice视图
+func objectEntries(objData *GCObjectData) []GCObjectEntry {
+	if objData.Length == 0 || objData.Entries == nil {
+		return nil
+	}
+	return unsafe.Slice((*GCObjectEntry)(objData.Entries.GetDataPtr()), objData.Length)
+}
+
+// findObjectEntry 查找字段下标，不存在返回-1
+func findObjectEntry(objData *GCObjectData, key string, hash uint64) int {
+	entries := objectEntries(objData)
+	if objData.Index == nil {
+		for i := range entries {
+			if entries[i].Hash == hash && entries[i].Key.AsString() == key {
+				return i
+			}
+		}
+		return -1
+	}
+
+	slots := objectIndexSlots(objData)
+	mask := uint64(objData.IndexSize - 1)
+	for i := hash & mask; ; i = (i + 1) & mask {
+		slot := slots[i]
+		if slot == 0 {
+			return -1
+		}
+		if entry := &entries[slot-1]; entry.Hash == hash && entry.Key.AsString() == key {
+			return int(slot - 1)
+		}
+	}
+}
+
+// objectIndexSlots 返回哈希索引的槽
+func objectIndexSlots(objData *GCObjectData) []uint32 {
+	return unsafe.Slice((*uint32)(objData.Index.GetDataPtr()), objData.IndexSize)
+}
+
+// indexObjectEntry 把新追加的字段加入哈希索引，必要时建立或扩大索引
+func indexObjectEntry(objData *GCObjectData, index int) error {
+	length := int(objData.Length)
+	if length < objectIndexThreshold {
+		return nil
+	}
+	if objData.Index == nil || length*2 > int(objData.IndexSize) {
+		return rebuildObjectIndex(objData, length*4)
+	}
+	insertObjectIndex(objData, index)
+	return nil
+}
+
+// rebuildObjectIndex 分配至少minSlots个槽的索引，并加入全部字段
+func rebuildObjectIndex(objData *GCObjectData, minSlots int) error {
+	size := 1
+	for size < minSlots {
+		size <<= 1
+	}
+
+	totalSize := gcObjectHeaderSize + size*int(unsafe.Sizeof(uint32(0)))
+	newIndex := GlobalValueGCManager.gcManager.Allocate(totalSize, uint8(gc.ObjectTypeUserData))
+	if newIndex == nil {
+		return fmt.Errorf("failed to allocate object index")
+	}
+	clear(unsafe.Slice((*uint32)(newIndex.GetDataPtr()), size))
+
+	oldIndex := objData.Index
+	objData.Index = newIndex
+	objData.IndexSize = uint32(size)
+	for i := 0; i < int(objData.Length); i++ {
+		insertObjectIndex(objData, i)
+	}
+
+	if oldIndex != nil {
+		GlobalValueGCManager.gcManager.Deallocate(oldIndex)
+	}
+	return nil
+}
+
+// insertObjectIndex 把第index个字段放入线性探测找到的第一个空槽
+func insertObjectIndex(objData *GCObjectData, index int) {
+	slots := objectIndexSlots(objData)
+	mask := uint64(objData.IndexSize - 1)
+	for i := objectEntries(objData)[index].Hash & mask; ; i = (i + 1) & mask {
+		if slots[i] == 0 {
+			slots[i] = uint32(index + 1)
+			return
+		}
+	}
+}
+
+// growObjectEntries 分配更大的字段存储区并迁移已有字段
+func growObjectEntries(objData *GCObjectData, minCapacity int) error {
+	newCapacity := max(minCapacity, minObjectCapacity)
+	if newCapacity <= int(objData.Capacity) {
+		return nil
+	}
+	if newCapacity > maxObjectFieldCount {
+		return fmt.Errorf("object too large: %d fields", newCapacity)
+	}
+
+	totalSize := gcObjectHeaderSize + newCapacity*gcObjectEntrySize
+	newEntries := GlobalValueGCManager.gcManager.Allocate(totalSize, uint8(gc.ObjectTypeUserData))
+	if newEntries == nil {
+		return fmt.Errorf("failed to allocate object storage")
+	}
+
+	// 迁移已有字段，其余位置清零
+	newSlice := unsafe.Slice((*GCObjectEntry)(newEntries.GetDataPtr()), newCapacity)
+	copied := copy(newSlice, objectEntries(objData))
+	for i := copied; i < newCapacity; i++ {
+		newSlice[i] = GCObjectEntry{}
+	}
+
+	oldEntries := objData.Entries
+	objData.Entries = newEntries
+	objData.Capacity = uint32(newCapacity)
+
+	if oldEntries != nil {
+		GlobalValueGCManager.gcManager.Deallocate(oldEntries)
+	}
+	return nil
+}
+
+// hashObjectKey 计算字段名的FNV-1a哈希
+func hashObjectKey(key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	hash := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= prime64
+	}
+	return hash
+}
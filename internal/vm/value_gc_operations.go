@@ -171,6 +171,27 @@ func EqualValuesGC(a, b ValueGC) (ValueGC, error) {
 
 // Equal 判断两个值是否相等
 func (v ValueGC) Equal(other ValueGC) bool {
+	return v.equal(other, nil)
+}
+
+// comparedPairs 正在比较的数组或对象对，用于在循环引用中终止深度比较
+type comparedPairs map[[2]uint64]bool
+
+// enter 记录开始比较v和other，返回false表示这一对已经在比较中（视为相等）
+func (c *comparedPairs) enter(v, other ValueGC) bool {
+	pair := [2]uint64{v.data, other.data}
+	if (*c)[pair] {
+		return false
+	}
+	if *c == nil {
+		*c = make(comparedPairs)
+	}
+	(*c)[pair] = true
+	return true
+}
+
+// equal 判断两个值是否相等，compared 为外层正在比较的容器对
+func (v ValueGC) equal(other ValueGC, compared comparedPairs) bool {
 	// 类型不同直接返回false
 	if v.Type() != other.Type() {
 		return false
@@ -187,18 +208,20 @@ func (v ValueGC) Equal(other ValueGC) bool {
 		return v.AsString() == other.AsString()
 	case ValueGCTypeBool:
 		return v.AsBool() == other.AsBool()
-	case ValueGCTypeFunction:
-		// 函数引用相等比较
+	case ValueGCTypeFunction, ValueGCTypeNativeFunction, ValueGCTypeCoroutine, ValueGCTypePromise:
+		// 函数、协程和promise引用相等比较
 		return v.data == other.data
 	case ValueGCTypeArray:
-		return v.equalArray(other)
+		return v.equalArray(other, compared)
+	case ValueGCTypeObject:
+		return v.equalObject(other, compared)
 	default:
 		return false
 	}
 }
 
 // equalArray 数组相等比较（深度比较）
-func (v ValueGC) equalArray(other ValueGC) bool {
+func (v ValueGC) equalArray(other ValueGC, compared comparedPairs) bool {
 	arrData1, elements1, err1 := v.AsArrayData()
 	arrData2, elements2, err2 := other.AsArrayData()
 	if err1 != nil || err2 != nil {
@@ -214,10 +237,13 @@ func (v ValueGC) equalArray(other ValueGC) bool {
 	if arrData1.Length != arrData2.Length {
 		return false
 	}
+	if !compared.enter(v, other) {
+		return true
+	}
 
 	// 逐元素比较
 	for i := uint32(0); i < arrData1.Length; i++ {
-		if !elements1[i].Equal(elements2[i]) {
+		if !elements1[i].equal(elements2[i], compared) {
 			return false
 		}
 	}
@@ -357,7 +383,7 @@ func ArrayGetValueGC(arrayValue ValueGC, index int) (ValueGC, error) {
 		return NewNilValueGC(), fmt.Errorf("array index out of bounds: %d (length: %d)", index, arrData.Length)
 	}
 
-	fmt.Printf("DEBUG [ArrayGetValueGC] 数组长度: %d, 索引: %d\n", arrData.Length, index)
+	tracef("ArrayGetValueGC", "数组长度: %d, 索引: %d", arrData.Length, index)
 
 	// 获取元素指针
 	elemPtr := getElementPtr(arrData, index)
@@ -366,27 +392,27 @@ func ArrayGetValueGC(arrayValue ValueGC, index int) (ValueGC, error) {
 	}
 
 	element := *elemPtr
-	fmt.Printf("DEBUG [ArrayGetValueGC] 元素类型: %s\n", element.Type())
+	tracef("ArrayGetValueGC", "元素类型: %s", element.Type())
 
 	// 类型特定的调试信息
 	switch element.Type() {
 	case ValueGCTypeSmallInt:
-		fmt.Printf("DEBUG [ArrayGetValueGC] 小整数值: %d\n", element.AsSmallInt())
+		tracef("ArrayGetValueGC", "小整数值: %d", element.AsSmallInt())
 	case ValueGCTypeDouble:
-		fmt.Printf("DEBUG [ArrayGetValueGC] 双精度值: %f\n", element.AsDouble())
+		tracef("ArrayGetValueGC", "双精度值: %f", element.AsDouble())
 	case ValueGCTypeString:
-		fmt.Printf("DEBUG [ArrayGetValueGC] 字符串值: %s\n", element.AsString())
+		tracef("ArrayGetValueGC", "字符串值: %s", element.AsString())
 	case ValueGCTypeArray:
 		if elemArrData, elemErr := getArrayData(element); elemErr == nil {
-			fmt.Printf("DEBUG [ArrayGetValueGC] 嵌套数组长度: %d\n", elemArrData.Length)
+			tracef("ArrayGetValueGC", "嵌套数组长度: %d", elemArrData.Length)
 		}
 	case ValueGCTypeNil:
-		fmt.Printf("DEBUG [ArrayGetValueGC] nil值\n")
+		tracef("ArrayGetValueGC", "nil值")
 	}
 
 	// 使用SafeCopyValueGC进行安全拷贝，避免循环引用
 	result := SafeCopyValueGC(element)
-	fmt.Printf("DEBUG [ArrayGetValueGC] 安全拷贝后类型: %s\n", result.Type())
+	tracef("ArrayGetValueGC", "安全拷贝后类型: %s", result.Type())
 
 	return result, nil
 }
@@ -402,11 +428,11 @@ func ArraySetValueGCWithExpansion(arrayValue ValueGC, index int, value ValueGC)
 		return NewNilValueGC(), err
 	}
 
-	fmt.Printf("DEBUG [ArraySetValueGCWithExpansion] 设置元素: index=%d, 当前容量=%d\n", index, arrData.Capacity)
+	tracef("ArraySetValueGCWithExpansion", "设置元素: index=%d, 当前容量=%d", index, arrData.Capacity)
 
 	// 检查是否需要扩容
 	if index >= int(arrData.Capacity) {
-		fmt.Printf("DEBUG [ArraySetValueGCWithExpansion] 需要扩容: index=%d >= capacity=%d\n", index, arrData.Capacity)
+		tracef("ArraySetValueGCWithExpansion", "需要扩容: index=%d >= capacity=%d", index, arrData.Capacity)
 
 		// 扩容并返回新的ValueGC
 		newArrayValue, err := expandArrayForIndex(arrayValue, index)
@@ -472,7 +498,7 @@ func ArraySetValueGC(arrayValue ValueGC, index int, value ValueGC) error {
 	}
 
 	*elemPtr = SafeCopyValueGC(value)
-	fmt.Printf("DEBUG [ArraySetValueGC] 设置元素[%d]成功, 类型=%s\n", index, value.Type())
+	tracef("ArraySetValueGC", "设置元素[%d]成功, 类型=%s", index, value.Type())
 	return nil
 }
 
@@ -548,7 +574,7 @@ func NewMatrixValueGC(rows, cols int) (ValueGC, error) {
 		return NewNilValueGC(), fmt.Errorf("matrix dimensions must be positive: rows=%d, cols=%d", rows, cols)
 	}
 
-	fmt.Printf("DEBUG [NewMatrixValueGC] 创建矩阵: %dx%d\n", rows, cols)
+	tracef("NewMatrixValueGC", "创建矩阵: %dx%d", rows, cols)
 
 	// 创建矩阵的行数组
 	matrix := make([]ValueGC, rows)
@@ -565,19 +591,19 @@ func NewMatrixValueGC(rows, cols int) (ValueGC, error) {
 
 		// 创建行数组
 		matrix[i] = NewArrayValueGC(rowElements)
-		fmt.Printf("DEBUG [NewMatrixValueGC] 创建行 %d: 长度=%d\n", i, cols)
+		tracef("NewMatrixValueGC", "创建行 %d: 长度=%d", i, cols)
 	}
 
 	// 创建矩阵（二维数组）
 	result := NewArrayValueGC(matrix)
-	fmt.Printf("DEBUG [NewMatrixValueGC] 矩阵创建完成: %dx%d\n", rows, cols)
+	tracef("NewMatrixValueGC", "矩阵创建完成: %dx%d", rows, cols)
 
 	return result, nil
 }
 
 // GetMatrixElementValueGC 获取矩阵元素 matrix[row][col]（GC安全）
 func GetMatrixElementValueGC(matrix ValueGC, row, col int) (ValueGC, error) {
-	fmt.Printf("DEBUG [GetMatrixElementValueGC] 获取矩阵元素: [%d][%d]\n", row, col)
+	tracef("GetMatrixElementValueGC", "获取矩阵元素: [%d][%d]", row, col)
 
 	// 检查矩阵类型
 	if !matrix.IsArray() {
@@ -601,13 +627,13 @@ func GetMatrixElementValueGC(matrix ValueGC, row, col int) (ValueGC, error) {
 		return NewNilValueGC(), fmt.Errorf("failed to get column %d from row %d: %v", col, row, err)
 	}
 
-	fmt.Printf("DEBUG [GetMatrixElementValueGC] 获取元素成功: [%d][%d] = %s\n", row, col, element.Type())
+	tracef("GetMatrixElementValueGC", "获取元素成功: [%d][%d] = %s", row, col, element.Type())
 	return element, nil
 }
 
 // SetMatrixElementValueGC 设置矩阵元素 matrix[row][col] = value（GC安全）
 func SetMatrixElementValueGC(matrix ValueGC, row, col int, value ValueGC) error {
-	fmt.Printf("DEBUG [SetMatrixElementValueGC] 设置矩阵元素: [%d][%d] = %s\n", row, col, value.Type())
+	tracef("SetMatrixElementValueGC", "设置矩阵元素: [%d][%d] = %s", row, col, value.Type())
 
 	// 检查矩阵类型
 	if !matrix.IsArray() {
@@ -627,7 +653,7 @@ func SetMatrixElementValueGC(matrix ValueGC, row, col int, value ValueGC) error
 
 	// 获取行的原始引用（不拷贝）
 	rowArray := matrixElements[row]
-	fmt.Printf("DEBUG [SetMatrixElementValueGC] 获取行[%d]: 类型=%s\n", row, rowArray.Type())
+	tracef("SetMatrixElementValueGC", "获取行[%d]: 类型=%s", row, rowArray.Type())
 
 	// 检查行是否为数组
 	if !rowArray.IsArray() {
@@ -640,7 +666,7 @@ func SetMatrixElementValueGC(matrix ValueGC, row, col int, value ValueGC) error
 		return fmt.Errorf("failed to set column %d in row %d: %v", col, row, err)
 	}
 
-	fmt.Printf("DEBUG [SetMatrixElementValueGC] 设置元素成功: [%d][%d] = %s\n", row, col, value.Type())
+	tracef("SetMatrixElementValueGC", "设置元素成功: [%d][%d] = %s", row, col, value.Type())
 	return nil
 }
 
@@ -673,7 +699,7 @@ func GetMatrixDimensionsValueGC(matrix ValueGC) (int, int, error) {
 	}
 
 	cols := int(firstRowData.Length)
-	fmt.Printf("DEBUG [GetMatrixDimensionsValueGC] 矩阵维度: %dx%d\n", rows, cols)
+	tracef("GetMatrixDimensionsValueGC", "矩阵维度: %dx%d", rows, cols)
 
 	return rows, cols, nil
 }
@@ -737,7 +763,7 @@ func FillMatrixValueGC(matrix ValueGC, value ValueGC) error {
 		return fmt.Errorf("failed to get matrix dimensions: %v", err)
 	}
 
-	fmt.Printf("DEBUG [FillMatrixValueGC] 填充矩阵: %dx%d, 值类型=%s\n", rows, cols, value.Type())
+	tracef("FillMatrixValueGC", "填充矩阵: %dx%d, 值类型=%s", rows, cols, value.Type())
 
 	// 填充每个元素
 	for i := 0; i < rows; i++ {
@@ -749,7 +775,7 @@ func FillMatrixValueGC(matrix ValueGC, value ValueGC) error {
 		}
 	}
 
-	fmt.Printf("DEBUG [FillMatrixValueGC] 矩阵填充完成\n")
+	tracef("FillMatrixValueGC", "矩阵填充完成")
 	return nil
 }
 
@@ -796,7 +822,7 @@ func CloneValueGC(v ValueGC) ValueGC {
 // expandArrayForIndex 扩容数组以支持指定索引的访问
 // 返回新的 ValueGC，调用者需要更新引用
 func expandArrayForIndex(arrayValue ValueGC, targetIndex int) (ValueGC, error) {
-	fmt.Printf("DEBUG [expandArrayForIndex] 开始扩容数组: targetIndex=%d\n", targetIndex)
+	tracef("expandArrayForIndex", "开始扩容数组: targetIndex=%d", targetIndex)
 
 	// 获取原数组数据
 	oldArrData, err := getArrayData(arrayValue)
@@ -804,13 +830,13 @@ func expandArrayForIndex(arrayValue ValueGC, targetIndex int) (ValueGC, error) {
 		return NewNilValueGC(), fmt.Errorf("failed to get array data: %v", err)
 	}
 
-	fmt.Printf("DEBUG [expandArrayForIndex] 原数组: 长度=%d, 容量=%d\n", oldArrData.Length, oldArrData.Capacity)
+	tracef("expandArrayForIndex", "原数组: 长度=%d, 容量=%d", oldArrData.Length, oldArrData.Capacity)
 
 	// 计算新容量
 	requiredCapacity := targetIndex + 1
 	newCapacity := calculateExpandedCapacity(int(oldArrData.Capacity), requiredCapacity)
 
-	fmt.Printf("DEBUG [expandArrayForIndex] 新容量计算: 需要=%d, 实际=%d\n", requiredCapacity, newCapacity)
+	tracef("expandArrayForIndex", "新容量计算: 需要=%d, 实际=%d", requiredCapacity, newCapacity)
 
 	// 分配新的更大的数组
 	headerSize := 16
@@ -820,7 +846,7 @@ func expandArrayForIndex(arrayValue ValueGC, targetIndex int) (ValueGC, error) {
 
 	newGcObj := GlobalValueGCManager.gcManager.AllocateIsolated(totalSize, uint8(gc.ObjectTypeArray))
 	if newGcObj == nil {
-		fmt.Printf("DEBUG [expandArrayForIndex] 尝试普通分配作为后备\n")
+		tracef("expandArrayForIndex", "尝试普通分配作为后备")
 		newGcObj = GlobalValueGCManager.gcManager.Allocate(totalSize, uint8(gc.ObjectTypeArray))
 	}
 
@@ -828,14 +854,14 @@ func expandArrayForIndex(arrayValue ValueGC, targetIndex int) (ValueGC, error) {
 		return NewNilValueGC(), fmt.Errorf("failed to allocate expanded array")
 	}
 
-	fmt.Printf("DEBUG [expandArrayForIndex] 新数组分配成功: %p\n", newGcObj)
+	tracef("expandArrayForIndex", "新数组分配成功: %p", newGcObj)
 
 	// 初始化新数组头
 	newArrData := (*GCArrayData)(newGcObj.GetDataPtr())
 	newArrData.Length = oldArrData.Length
 	newArrData.Capacity = uint32(newCapacity) // 容量变化！
 
-	fmt.Printf("DEBUG [expandArrayForIndex] 新数组头: 长度=%d, 容量=%d\n", newArrData.Length, newArrData.Capacity)
+	tracef("expandArrayForIndex", "新数组头: 长度=%d, 容量=%d", newArrData.Length, newArrData.Capacity)
 
 	// 拷贝现有元素
 	for i := uint32(0); i < oldArrData.Length; i++ {
@@ -855,7 +881,7 @@ func expandArrayForIndex(arrayValue ValueGC, targetIndex int) (ValueGC, error) {
 		}
 	}
 
-	fmt.Printf("DEBUG [expandArrayForIndex] 扩容完成\n")
+	tracef("expandArrayForIndex", "扩容完成")
 
 	return ValueGC{
 		typeAndFlags: uint64(ValueGCTypeArray) | ValueGCFlagGCManaged,
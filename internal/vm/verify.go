@@ -0,0 +1,227 @@
+package vm
+
+import "fmt"
+
+// =============================================================================
+// 字节码校验
+// =============================================================================
+
+// 设计原理：
+// - 执行器信任指令：越界的寄存器、常量或跳转目标要到运行时才报错，甚至引发panic。
+//   Verify 在执行前按 opCodeOperands 的操作数声明静态检查每条指令
+// - 寄存器上限为栈帧的寄存器数量（MaxStackSize，至少 minFrameRegisters），
+//   CALL、RETURN、MAKE_CLOSURE、SERVICE_CALL 隐式使用的连续寄存器同样检查
+// - 从入口和异常处理入口出发做可达性分析，每条路径必须结束于 RETURN、HALT 或 THROW；
+//   顶层函数执行到末尾等同于 HALT，嵌套函数执行到末尾会停止整个程序，因此视为错误
+// - 函数常量必须能在 FunctionRegistry 中找到，找到的嵌套函数递归校验
+
+// VerifyError 字节码校验错误
+type VerifyError struct {
+	Function string // 函数名
+	PC       int    // 出错指令的位置，-1表示与具体指令无关
+	Message  string
+}
+
+func (e *VerifyError) Error() string {
+	if e.PC >= 0 {
+		return fmt.Sprintf("verify %s at pc %d: %s", e.Function, e.PC, e.Message)
+	}
+	return fmt.Sprintf("verify %s: %s", e.Function, e.Message)
+}
+
+// Verify 校验顶层函数及其引用的全部嵌套函数，返回发现的第一个错误
+func Verify(main *Function) error {
+	if main == nil {
+		return &VerifyError{Function: "<nil>", PC: -1, Message: "function is nil"}
+	}
+
+	seen := map[*Function]bool{main: true}
+	queue := []*Function{main}
+	for i := 0; i < len(queue); i++ {
+		fn := queue[i]
+		v := &verifier{fn: fn, registers: fn.frameRegisters(), topLevel: i == 0}
+		nested, err := v.verify()
+		if err != nil {
+			return err
+		}
+		for _, n := range nested {
+			if !seen[n] {
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	return nil
+}
+
+// verifier 单个函数的校验状态
+type verifier struct {
+	fn        *Function
+	registers int
+	topLevel  bool
+}
+
+func (v *verifier) errorf(pc int, format string, args ...interface{}) error {
+	return &VerifyError{Function: v.fn.Name, PC: pc, Message: fmt.Sprintf(format, args...)}
+}
+
+// verify 依次检查常量、异常处理表、指令和控制流，返回常量引用的嵌套函数
+func (v *verifier) verify() ([]*Function, error) {
+	fn := v.fn
+	if fn.ParamCount < 0 || fn.ParamCount > v.registers {
+		return nil, v.errorf(-1, "parameter count %d exceeds %d registers", fn.ParamCount, v.registers)
+	}
+
+	var nested []*Function
+	for i, constant := range fn.Constants {
+		switch {
+		case constant.IsFunction():
+			n, err := GetFunction(constant.AsFunctionID())
+			if err != nil {
+				return nil, v.errorf(-1, "constant K%d: %v", i, err)
+			}
+			nested = append(nested, n)
+		case constant.IsNativeFunction():
+			if constant.AsNativeFunction() == nil {
+				return nil, v.errorf(-1, "constant K%d: unknown native function", i)
+			}
+		}
+	}
+
+	n := len(fn.Instructions)
+	for i, h := range fn.Handlers {
+		if h.StartPC < 0 || h.StartPC > h.EndPC || h.EndPC > n {
+			return nil, v.errorf(-1, "handler %d: protected range [%d, %d) out of range", i, h.StartPC, h.EndPC)
+		}
+		if h.HandlerPC < 0 || h.HandlerPC >= n || fn.Instructions[h.HandlerPC].OpCode != OP_CATCH {
+			return nil, v.errorf(-1, "handler %d: entry %d is not a CATCH instruction", i, h.HandlerPC)
+		}
+	}
+
+	for pc, inst := range fn.Instructions {
+		if err := v.instruction(pc, inst); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.controlFlow(); err != nil {
+		return nil, err
+	}
+	return nested, nil
+}
+
+// instruction 检查单条指令的操作码和操作数范围
+func (v *verifier) instruction(pc int, inst Instruction) error {
+	if _, known := opCodeNames[inst.OpCode]; !known {
+		return v.errorf(pc, "unknown opcode %d", inst.OpCode)
+	}
+
+	fn := v.fn
+	for _, spec := range opCodeOperands[inst.OpCode] {
+		x := spec.field.value(inst)
+		switch spec.kind {
+		case operandRegister:
+			if x < 0 || x >= v.registers {
+				return v.errorf(pc, "%s: register R%d out of range (%d registers)", inst.OpCode, x, v.registers)
+			}
+		case operandConstant:
+			if inst.OpCode == OP_IMPORT && spec.field == fieldC && x == -1 {
+				continue
+			}
+			if x < 0 || x >= len(fn.Constants) {
+				return v.errorf(pc, "%s: constant K%d out of range (%d constants)", inst.OpCode, x, len(fn.Constants))
+			}
+			// 除LOADK外，常量操作数都是名字（字段名、服务名、模块路径和导出名）
+			if inst.OpCode != OP_LOADK && !fn.Constants[x].IsString() {
+				return v.errorf(pc, "%s: constant K%d should be a string, got %s", inst.OpCode, x, fn.Constants[x].Type())
+			}
+		case operandGlobal:
+			if x < 0 {
+				return v.errorf(pc, "%s: negative global index %d", inst.OpCode, x)
+			}
+		case operandUpvalue:
+			if x < 0 || x >= len(fn.Upvalues) {
+				return v.errorf(pc, "%s: upvalue U%d out of range (%d upvalues)", inst.OpCode, x, len(fn.Upvalues))
+			}
+		case operandJump:
+			if target := pc + x; target < 0 || target > len(fn.Instructions) {
+				return v.errorf(pc, "%s: jump target %d out of range", inst.OpCode, target)
+			}
+		case operandNumber:
+			if x < 0 {
+				return v.errorf(pc, "%s: negative count %d", inst.OpCode, x)
+			}
+		}
+	}
+
+	// 隐式使用的连续寄存器
+	last := -1
+	switch inst.OpCode {
+	case OP_CALL, OP_ASYNC_CALL, OP_SERVICE_CALL:
+		if inst.B < 1 {
+			return v.errorf(pc, "%s: operand B must count the callee, got %d", inst.OpCode, inst.B)
+		}
+		last = inst.A + inst.B - 1
+	case OP_RETURN:
+		last = inst.A + inst.B - 2
+	case OP_MAKE_CLOSURE:
+		last = inst.B + inst.C
+	case OP_GC_ALLOC:
+		if t := ValueTypeGC(inst.B); t != ValueGCTypeString && t != ValueGCTypeArray {
+			return v.errorf(pc, "%s: unsupported allocation type %s", inst.OpCode, t)
+		}
+	}
+	if last >= v.registers {
+		return v.errorf(pc, "%s: uses registers up to R%d (%d registers)", inst.OpCode, last, v.registers)
+	}
+	return nil
+}
+
+// controlFlow 检查所有可达路径都结束于 RETURN、HALT 或 THROW
+func (v *verifier) controlFlow() error {
+	fn := v.fn
+	n := len(fn.Instructions)
+	if n == 0 {
+		if v.topLevel {
+			return nil
+		}
+		return v.errorf(-1, "function has no instructions")
+	}
+
+	reached := make([]bool, n)
+	work := []int{0}
+	for _, h := range fn.Handlers {
+		work = append(work, h.HandlerPC)
+	}
+
+	for len(work) > 0 {
+		pc := work[len(work)-1]
+		work = work[:len(work)-1]
+		if reached[pc] {
+			continue
+		}
+		reached[pc] = true
+
+		inst := fn.Instructions[pc]
+		var next []int
+		switch inst.OpCode {
+		case OP_RETURN, OP_HALT, OP_THROW:
+		case OP_JUMP:
+			next = []int{pc + inst.Bx}
+		case OP_JUMP_IF_FALSE, OP_JUMP_IF_TRUE, OP_JUMP_IF_NOT_EQ, OP_JUMP_IF_NOT_NEQ,
+			OP_JUMP_IF_NOT_LT, OP_JUMP_IF_NOT_GT, OP_JUMP_IF_NOT_LTE, OP_JUMP_IF_NOT_GTE:
+			next = []int{pc + 1, pc + inst.Bx}
+		default:
+			next = []int{pc + 1}
+		}
+		for _, target := range next {
+			if target == n {
+				if !v.topLevel {
+					return v.errorf(pc, "control reaches the end of the function without RETURN")
+				}
+				continue
+			}
+			work = append(work, target)
+		}
+	}
+	return nil
+}
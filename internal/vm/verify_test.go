@@ -0,0 +1,88 @@
+package vm_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhnt/aql/internal/vm"
+)
+
+// =============================================================================
+// 字节码校验测试
+// =============================================================================
+
+func TestVerifyCompiledPrograms(t *testing.T) {
+	newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	for _, path := range sourceFiles(t) {
+		function := compileFile(path)
+		if function == nil {
+			continue
+		}
+		if err := vm.Verify(function); err != nil {
+			t.Errorf("%s should verify: %v", path, err)
+		}
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"register", "function main (stack=4)\n  MOVE R20, R0", "verify main at pc 0: MOVE: register R20 out of range (16 registers)"},
+		{"constant", "LOADK R0, K3", "LOADK: constant K3 out of range (0 constants)"},
+		{"field name", "function main\n  constant K0 1\n  GET_FIELD R0, R1, K0", "GET_FIELD: constant K0 should be a string, got smallint"},
+		{"jump target", "JUMP @10", "JUMP: jump target 10 out of range"},
+		{"unknown opcode", "OP_200 0, 0, 0, 0", "unknown opcode 200"},
+		{"call range", "function main (stack=16)\n  CALL R15, 3, 1", "CALL: uses registers up to R17 (16 registers)"},
+		{"allocation type", "GC_ALLOC R0, 1", "GC_ALLOC: unsupported allocation type smallint"},
+		{"handler entry", "function main\n  handler [a, b) -> b\na:\n  HALT\nb:\n  HALT", "handler 0: entry 1 is not a CATCH instruction"},
+		{
+			"missing return",
+			"function main\n  constant K0 <function f>\nfunction f\n  constant K0 1\n  LOADK R0, K0",
+			"verify f at pc 0: control reaches the end of the function without RETURN",
+		},
+		{
+			"upvalue",
+			"function main\n  constant K0 <function f>\nfunction f\n  GET_UPVALUE R0, U0\n  RETURN R0, 1",
+			"GET_UPVALUE: upvalue U0 out of range (0 upvalues)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			function, err := vm.Assemble(tt.source)
+			if err != nil {
+				t.Fatalf("assemble: %v", err)
+			}
+			err = vm.Verify(function)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error should mention %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	function := vm.NewFunction("main")
+	function.Constants = append(function.Constants, vm.NewFunctionValueGCFromID(1<<20))
+	if err := vm.Verify(function); err == nil || !strings.Contains(err.Error(), "constant K0") {
+		t.Errorf("an unregistered function constant should fail verification, got %v", err)
+	}
+}
+
+func TestReadBytecodeVerifies(t *testing.T) {
+	newExecutor(vm.NewManualClock(time.Unix(0, 0)))
+	function, err := vm.Assemble("function main\n  constant K0 1\n  JUMP @7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := vm.WriteBytecode(&buf, function); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.ReadBytecode(&buf); err == nil || !strings.Contains(err.Error(), "jump target 7 out of range") {
+		t.Errorf("loading invalid bytecode should fail verification, got %v", err)
+	}
+}